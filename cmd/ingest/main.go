@@ -0,0 +1,91 @@
+// Command ingest loads Open Library's authors and works data dumps into a
+// local index, which the server serves author and subject queries from when
+// OPENLIBRARY_INDEX_PATH points at it, going to the live API only for data
+// newer than the dump.
+//
+// The dumps are published at https://openlibrary.org/developers/dumps and may
+// be passed compressed or not:
+//
+//	go run ./cmd/ingest -index openlibrary.db \
+//		-authors ol_dump_authors_latest.txt.gz -works ol_dump_works_latest.txt.gz
+//	OPENLIBRARY_INDEX_PATH=openlibrary.db go run ./cmd/server
+//
+// Loading again updates the index in place, so a newer dump can be loaded
+// over an older one. The index records the newest record's modification
+// time as its dump date.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/olindex"
+)
+
+func main() {
+	var (
+		indexPath   = flag.String("index", "openlibrary.db", "path of the index to create or update")
+		authorsPath = flag.String("authors", "", "authors dump to load")
+		worksPath   = flag.String("works", "", "works dump to load")
+	)
+	flag.Parse()
+	if *authorsPath == "" && *worksPath == "" {
+		log.Fatal("at least one of -authors and -works is required")
+	}
+
+	// Stop between batches on interrupt, keeping what was loaded
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := olindex.Create(*indexPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	if *authorsPath != "" {
+		loadDump(ctx, db, "authors", *authorsPath, olindex.LoadAuthors)
+	}
+	if *worksPath != "" {
+		loadDump(ctx, db, "works", *worksPath, olindex.LoadWorks)
+	}
+	if err := olindex.CountWorks(db); err != nil {
+		log.Fatalf("Error counting authors' works: %v", err)
+	}
+	log.Printf("Index %s loaded in %v", *indexPath, time.Since(start).Round(time.Second))
+}
+
+// loadDump loads the dump at path with load, decompressing it if gzipped.
+func loadDump(ctx context.Context, db *sql.DB, kind, path string, load func(context.Context, *sql.DB, io.Reader) (int, error)) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Error opening %s dump: %v", kind, err)
+	}
+	defer f.Close()
+
+	var dump io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			log.Fatalf("Error decompressing %s dump: %v", kind, err)
+		}
+		defer gz.Close()
+		dump = gz
+	}
+
+	log.Printf("Loading %s from %s", kind, path)
+	n, err := load(ctx, db, dump)
+	if err != nil {
+		log.Fatalf("Error loading %s after %d records: %v", kind, n, err)
+	}
+	log.Printf("Loaded %d %s", n, kind)
+}
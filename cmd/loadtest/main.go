@@ -0,0 +1,220 @@
+// Command loadtest drives the recommendations endpoint with concurrent
+// requests and reports latency percentiles and upstream call counts, so
+// changes to the pipeline's performance can be measured.
+//
+// Run it against a server using the mock Open Library in cmd/mockol, so
+// results do not depend on, or load, the real one:
+//
+//	go run ./cmd/mockol
+//	OPENLIBRARY_TARGET=local go run ./cmd/server
+//	go run ./cmd/loadtest -requests 500 -concurrency 20
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// result is the outcome of one request.
+type result struct {
+	status        int
+	latency       time.Duration
+	upstreamCalls int
+	cacheHits     int
+	stored        bool
+	stages        map[string]float64
+	err           error
+}
+
+func main() {
+	var (
+		baseURL     = flag.String("url", "http://localhost:8080", "base URL of the server")
+		requests    = flag.Int("requests", 200, "total number of requests")
+		concurrency = flag.Int("concurrency", 10, "number of requests in flight at once")
+		users       = flag.Int("users", 7, "pairs are drawn from user IDs 1 through this")
+		apiKey      = flag.String("api-key", "", "API key sent in X-API-Key, if any")
+		params      = flag.String("params", "", "extra query parameters, e.g. 'strategy=blend&count=5'")
+		timeout     = flag.Duration("timeout", time.Minute, "per-request timeout")
+		seed        = flag.Int64("seed", 1, "seed for choosing user pairs, for repeatable runs")
+	)
+	flag.Parse()
+	if *requests <= 0 || *concurrency <= 0 || *users < 2 {
+		log.Fatal("requests and concurrency must be positive, and users at least 2")
+	}
+	extra, err := url.ParseQuery(*params)
+	if err != nil {
+		log.Fatalf("Invalid -params: %v", err)
+	}
+
+	// Choose every pair up front, so the run is the same whatever the scheduling
+	rng := rand.New(rand.NewSource(*seed))
+	targets := make(chan string, *requests)
+	for i := 0; i < *requests; i++ {
+		user1 := rng.Intn(*users) + 1
+		user2 := rng.Intn(*users-1) + 1
+		if user2 >= user1 {
+			user2++
+		}
+		query := url.Values{"user1": {strconv.Itoa(user1)}, "user2": {strconv.Itoa(user2)}}
+		for key, values := range extra {
+			query[key] = values
+		}
+		targets <- *baseURL + "/recommendations?" + query.Encode()
+	}
+	close(targets)
+
+	client := &http.Client{Timeout: *timeout}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []result
+	)
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range targets {
+				res := send(client, target, *apiKey)
+				mu.Lock()
+				results = append(results, res)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report(os.Stdout, results, time.Since(start))
+}
+
+// send makes one request and reads the cost the server reports in its meta block.
+func send(client *http.Client, target, apiKey string) result {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return result{err: err}
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), err: err}
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Meta struct {
+			UpstreamCalls int                `json:"upstream_calls"`
+			CacheHits     int                `json:"cache_hits"`
+			Stored        bool               `json:"stored"`
+			TimingsMS     map[string]float64 `json:"timings_ms"`
+		} `json:"meta"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	io.Copy(io.Discard, resp.Body)
+	res := result{status: resp.StatusCode, latency: time.Since(start)}
+	if err == nil && resp.StatusCode == http.StatusOK {
+		res.upstreamCalls = body.Meta.UpstreamCalls
+		res.cacheHits = body.Meta.CacheHits
+		res.stored = body.Meta.Stored
+		res.stages = body.Meta.TimingsMS
+	}
+	return res
+}
+
+// report prints throughput, status counts, latency percentiles, upstream
+// call counts, and mean stage timings.
+func report(out io.Writer, results []result, elapsed time.Duration) {
+	var (
+		latencies     []time.Duration
+		statuses      = make(map[int]int)
+		failures      = make(map[string]int)
+		upstreamCalls int
+		cacheHits     int
+		stored        int
+		stageTotals   = make(map[string]float64)
+		stageCounts   = make(map[string]int)
+	)
+	for _, res := range results {
+		if res.err != nil {
+			failures[res.err.Error()]++
+			continue
+		}
+		latencies = append(latencies, res.latency)
+		statuses[res.status]++
+		upstreamCalls += res.upstreamCalls
+		cacheHits += res.cacheHits
+		if res.stored {
+			stored++
+		}
+		for stage, ms := range res.stages {
+			stageTotals[stage] += ms
+			stageCounts[stage]++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Requests\t%d in %v (%.1f/s)\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	for _, status := range sortedKeys(statuses) {
+		fmt.Fprintf(w, "Status %d\t%d\n", status, statuses[status])
+	}
+	for message, count := range failures {
+		fmt.Fprintf(w, "Failed\t%d: %s\n", count, message)
+	}
+	if len(latencies) > 0 {
+		for _, p := range []float64{50, 90, 95, 99, 100} {
+			fmt.Fprintf(w, "Latency p%g\t%v\n", p, percentile(latencies, p).Round(time.Millisecond))
+		}
+	}
+	if ok := statuses[http.StatusOK]; ok > 0 {
+		fmt.Fprintf(w, "Upstream calls\t%d (%.1f per successful request)\n", upstreamCalls, float64(upstreamCalls)/float64(ok))
+		fmt.Fprintf(w, "Cache hits\t%d (%.1f per successful request)\n", cacheHits, float64(cacheHits)/float64(ok))
+		fmt.Fprintf(w, "Stored results\t%d\n", stored)
+	}
+	stages := make([]string, 0, len(stageTotals))
+	for stage := range stageTotals {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		fmt.Fprintf(w, "Mean %s\t%.1fms\n", stage, stageTotals[stage]/float64(stageCounts[stage]))
+	}
+	w.Flush()
+}
+
+// percentile returns the p-th percentile of sorted latencies, by the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
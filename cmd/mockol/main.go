@@ -0,0 +1,182 @@
+// Command mockol serves a small, deterministic stand-in for the Open Library
+// API, so the server can be run and load tested without depending on, or
+// loading, the real one. Its address is the "local" Open Library target:
+//
+//	go run ./cmd/mockol
+//	OPENLIBRARY_TARGET=local go run ./cmd/server
+//
+// Every author name resolves to one author with five works, except names
+// containing "Silver" or "Hemmingway", which resolve to none. Every subject
+// has twelve works. -delay slows every response, to model a distant upstream.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subjects are the subjects given to authors' works, three to a work.
+var subjects = []string{"fiction", "science fiction", "fantasy", "adventure", "space"}
+
+// textValue is Open Library's typed text value.
+type textValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func main() {
+	var (
+		addr  = flag.String("addr", "localhost:9090", "address to listen on")
+		delay = flag.Duration("delay", 0, "time to wait before every response")
+	)
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search/authors.json", searchAuthors)
+	mux.HandleFunc("GET /search.json", searchWorks)
+	mux.HandleFunc("GET /authors/{key}/works.json", authorWorks)
+	mux.HandleFunc("GET /subjects/{subject}", subjectWorks)
+	mux.HandleFunc("GET /works/{key}/editions.json", workEditions)
+	mux.HandleFunc("GET /works/{key}", work)
+
+	var handler http.Handler = mux
+	if *delay > 0 {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(*delay)
+			mux.ServeHTTP(w, r)
+		})
+	}
+	log.Printf("Serving mock Open Library on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// keyNumber returns the number in an Open Library key such as "OL123W", or
+// false if it has none.
+func keyNumber(key string) (int, bool) {
+	key = strings.TrimSuffix(key, ".json")
+	if len(key) < 4 || !strings.HasPrefix(key, "OL") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(key[2 : len(key)-1])
+	return n, err == nil
+}
+
+func searchAuthors(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("q")
+	docs := []map[string]any{}
+	if !strings.Contains(name, "Silver") && !strings.Contains(name, "Hemmingway") {
+		h := fnv.New32a()
+		h.Write([]byte(name))
+		n := int(h.Sum32() % 10_000_000)
+		docs = append(docs, map[string]any{
+			"name":       name,
+			"key":        fmt.Sprintf("OL%dA", n),
+			"work_count": n%100 + 1,
+		})
+	}
+	writeJSON(w, map[string]any{"docs": docs})
+}
+
+func searchWorks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"docs": []map[string]any{
+		{"key": "/works/OL812W", "title": "Saga three", "author_name": []string{"Auth 0"}, "first_publish_year": 2001, "subject": []string{"Sampled", "Fantasy"}},
+		{"key": "/works/OL810W", "title": "Saga opener", "author_name": []string{"Auth 0"}, "first_publish_year": 1999},
+	}})
+}
+
+func authorWorks(w http.ResponseWriter, r *http.Request) {
+	n, ok := keyNumber(r.PathValue("key"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	entries := make([]map[string]any, 5)
+	for i := range entries {
+		first := (n + i) % 3
+		entries[i] = map[string]any{
+			"title":    fmt.Sprintf("W%d", i),
+			"key":      fmt.Sprintf("/works/OL%dW", n+i),
+			"subjects": subjects[first : first+3],
+		}
+	}
+	writeJSON(w, map[string]any{"entries": entries})
+}
+
+func subjectWorks(w http.ResponseWriter, r *http.Request) {
+	subject, ok := strings.CutSuffix(r.PathValue("subject"), ".json")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	works := make([]map[string]any, 12)
+	for i := range works {
+		genre := "Fiction"
+		if i%4 == 3 {
+			genre = "Juvenile fiction"
+		}
+		works[i] = map[string]any{
+			"title":              fmt.Sprintf("%s book %d", subject, i),
+			"authors":            []map[string]string{{"name": fmt.Sprintf("Auth %d", i%4)}},
+			"key":                fmt.Sprintf("/works/OL9%02dW", i),
+			"first_publish_year": 2025 - i%6,
+			"edition_count":      i + 1,
+			"subject":            []string{genre},
+		}
+	}
+	writeJSON(w, map[string]any{"works": works})
+}
+
+func workEditions(w http.ResponseWriter, r *http.Request) {
+	n, ok := keyNumber(r.PathValue("key"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	format := "Paperback"
+	if n%3 == 1 {
+		format = "Audio CD"
+	}
+	entries := []map[string]any{{"title": "x", "physical_format": format}}
+	if n%2 == 0 {
+		entries = append(entries, map[string]any{"series": []string{fmt.Sprintf("Mock Saga ; %d", n%3+1)}})
+	}
+	writeJSON(w, map[string]any{"entries": entries})
+}
+
+// work answers with a description, an excerpt, a first sentence or none of
+// them, depending on the work.
+func work(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	n, ok := keyNumber(key)
+	if !ok || !strings.HasSuffix(key, ".json") {
+		http.NotFound(w, r)
+		return
+	}
+	path := r.URL.Path
+	switch n % 4 {
+	case 0:
+		writeJSON(w, map[string]any{"description": "A description of " + path})
+	case 1:
+		writeJSON(w, map[string]any{"excerpts": []map[string]any{
+			{"excerpt": textValue{"/type/text", "Excerpt of " + path}},
+		}})
+	case 2:
+		writeJSON(w, map[string]any{"first_sentence": textValue{"/type/text", "First sentence of " + path}})
+	default:
+		writeJSON(w, map[string]any{})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"be-takehome-2024/internal/backup"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/random"
+)
+
+const usage = `usage: server [flags] [command]
+
+With no command, serves the API. Commands:
+  backup <path | s3://bucket/key>   snapshot the database
+  restore <path | s3://bucket/key>  replace the database with a backup
+
+A restored database is kept at the next start only with DATABASE_RESET=false.
+
+Flags:
+  --deterministic  freeze the clock and seed random choices, such as
+                   scheduler jitter and log sampling, for reproducible
+                   integration tests
+  --now <time>     the RFC 3339 time the clock is frozen at
+                   (default 2024-06-01T00:00:00Z)
+  --seed <n>       the seed of random choices (default 1)
+`
+
+// makeDeterministic freezes the clock at now, an RFC 3339 time, and seeds
+// random choices with seed.
+func makeDeterministic(now string, seed uint64) error {
+	t, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		return fmt.Errorf("invalid --now '%s': must be an RFC 3339 time", now)
+	}
+	clock.Use(clock.NewFrozen(t))
+	random.Seed(seed)
+	log.Printf("Running deterministically: clock frozen at %s, seed %d", t.Format(time.RFC3339), seed)
+	return nil
+}
+
+// runCommand runs a maintenance command and returns the exit code.
+func runCommand(args []string) int {
+	if len(args) != 2 || (args[0] != "backup" && args[0] != "restore") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	run, verb := backup.Save, "Backed up the database to"
+	if args[0] == "restore" {
+		run, verb = backup.Load, "Restored the database from"
+	}
+	res, err := run(context.Background(), args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", args[0], err)
+		return 1
+	}
+	fmt.Printf("%s %s (%d bytes)\n", verb, res.Location, res.Bytes)
+	return 0
+}
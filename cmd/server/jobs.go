@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/events"
+	"be-takehome-2024/internal/queue"
+	"be-takehome-2024/internal/recommend"
+	"be-takehome-2024/internal/scheduler"
+	"be-takehome-2024/internal/services"
+)
+
+// registerJobs schedules every background job, each enabled by its own flag.
+// Jobs without a cron schedule configured run at their fixed interval.
+func registerJobs(cfg *config.Config) error {
+	jobs := []struct {
+		name     string
+		schedule string
+		enabled  bool
+		run      func(context.Context) error
+	}{
+		// Keep favorite authors' keys fresh between requests
+		{"warm_cache", cfg.WarmCacheSchedule, cfg.WarmCache, warmCache},
+		// Keep recently requested pairs' recommendations fresh
+		{"refresh", scheduleOr(cfg.PairRefreshSchedule, cfg.PairRefreshInterval), cfg.PairRefresh, func(ctx context.Context) error {
+			return recommend.RefreshPairs(ctx, config.Get().PairRefreshWindow)
+		}},
+		// Deliver subscriptions' recommendations as they come due
+		{"digest", scheduleOr(cfg.DigestSchedule, cfg.SubscriptionPollInterval), cfg.Subscriptions, recommend.RunDueSubscriptions},
+		// Keep history, audit, and stored results from growing without bound
+		{"retention", scheduleOr(cfg.RetentionSchedule, cfg.RetentionInterval), cfg.Retention, purgeExpired},
+		// Keep the SQLite database compact and its write-ahead log short
+		{"checkpoint", scheduleOr("", cfg.CheckpointInterval), cfg.Maintenance, maintain(checkpoint)},
+		{"vacuum", scheduleOr("", cfg.VacuumInterval), cfg.Maintenance, maintain(vacuum)},
+		{"integrity_check", scheduleOr("", cfg.IntegrityCheckInterval), cfg.Maintenance, maintain(checkIntegrity)},
+	}
+	scheduler.SetJitter(cfg.SchedulerJitter)
+	for _, job := range jobs {
+		if err := scheduler.Register(job.name, job.schedule, job.enabled, job.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleOr returns schedule, or one running every interval if it is empty.
+func scheduleOr(schedule string, interval time.Duration) string {
+	if schedule != "" {
+		return schedule
+	}
+	return "@every " + interval.String()
+}
+
+// queuePrefix namespaces the task queue's keys in Redis.
+const queuePrefix = "bookrec:queue:"
+
+// startQueue selects the task queue's backend and starts its workers.
+func startQueue(cfg *config.Config) error {
+	switch cfg.QueueBackend {
+	case "memory":
+		queue.Use(queue.NewMemoryBackend(), cfg.QueueResultTTL)
+	case "redis":
+		backend, err := queue.NewRedisBackend(cfg.QueueRedisURL, queuePrefix)
+		if err != nil {
+			return err
+		}
+		queue.Use(backend, cfg.QueueResultTTL)
+	default:
+		return fmt.Errorf("unknown queue backend '%s'", cfg.QueueBackend)
+	}
+	queue.Start(context.Background(), cfg.QueueWorkers)
+	log.Printf("Running background tasks on %d workers, kept in %s", max(cfg.QueueWorkers, 1), cfg.QueueBackend)
+	return nil
+}
+
+// startEvents connects to the message bus domain events are published to,
+// if one is configured.
+func startEvents(cfg *config.Config) error {
+	var bus events.Bus
+	var err error
+	switch cfg.EventBus {
+	case "":
+		return nil
+	case "nats":
+		bus, err = events.NewNATS(cfg.EventBusURL)
+	case "kafka":
+		bus, err = events.NewKafkaREST(services.HTTPClient, cfg.EventBusURL)
+	default:
+		err = fmt.Errorf("unknown event bus '%s'", cfg.EventBus)
+	}
+	if err != nil {
+		return err
+	}
+	events.Use(bus, cfg.EventSubjectPrefix)
+	log.Printf("Publishing events to %s at %s", cfg.EventBus, cfg.EventBusURL)
+	return nil
+}
@@ -1,30 +1,186 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"be-takehome-2024/internal/config"
 	"be-takehome-2024/internal/database"
 	"be-takehome-2024/internal/handlers"
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/metrics"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/scheduler"
+	"be-takehome-2024/internal/services"
 )
 
 func main() {
 	startTime := time.Now()
 
-	// Set up the database
-	database.SetupDatabase()
+	// Mask email addresses in everything logged
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	// Load any additional message translations
+	if dir := config.Get().MessagesDir; dir != "" {
+		catalog, err := i18n.LoadDir(dir)
+		if err != nil {
+			log.Fatalf("Error loading message catalogs: %v", err)
+		}
+		i18n.SetCatalog(catalog)
+	}
+
+	// Optionally freeze time and randomness for reproducible test runs
+	deterministic := flag.Bool("deterministic", false, "")
+	now := flag.String("now", "2024-06-01T00:00:00Z", "")
+	seed := flag.Uint64("seed", 1, "")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if *deterministic {
+		if err := makeDeterministic(*now, *seed); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Run a maintenance command instead of serving, if given one
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	// Set up the database, or keep the existing one if asked to
+	if cfg := config.Get(); !cfg.DatabaseReset && database.Exists() {
+		if err := database.ValidateExisting(); err != nil {
+			log.Fatalf("Error opening existing database: %v", err)
+		}
+		if err := maintain(database.EnsurePersonas)(context.Background()); err != nil {
+			log.Fatalf("Error adding personas to existing database: %v", err)
+		}
+		log.Printf("Using existing database")
+	} else {
+		database.SetupDatabase()
+	}
+
+	// Apply the curated subject stop-list, aliases, and blocklist
+	if err := handlers.LoadSubjectCuration(); err != nil {
+		log.Fatalf("Error loading subject curation: %v", err)
+	}
+
+	// Optionally warm the author caches before reporting ready
+	if config.Get().WarmUp {
+		go warmUp()
+	} else {
+		services.MarkReady()
+	}
+
+	// Run background tasks from the configured queue
+	if err := startQueue(config.Get()); err != nil {
+		log.Fatalf("Error starting task queue: %v", err)
+	}
+
+	// Publish domain events to the configured message bus
+	if err := startEvents(config.Get()); err != nil {
+		log.Fatalf("Error configuring event bus: %v", err)
+	}
+
+	// Run the background jobs on their schedules
+	if err := registerJobs(config.Get()); err != nil {
+		log.Fatalf("Error scheduling background jobs: %v", err)
+	}
+	scheduler.Start(context.Background())
+
+	// Reload tunables on SIGHUP
+	go reloadOnHangup()
 
 	// Set up the HTTP server
-	http.HandleFunc("/recommendations", func(w http.ResponseWriter, r *http.Request) {
-		requestStart := time.Now()
-		handlers.RecommendationsHandler(w, r)
-		requestDuration := time.Since(requestStart)
-		log.Printf("Request processed in %v", requestDuration)
-	})
+	http.HandleFunc("/recommendations", handlers.Audited("recommendations.get", handlers.WithTenant(handlers.EnforceQuota(handlers.RecommendationsHandler))))
+	http.HandleFunc("POST /recommendations/adhoc", handlers.Audited("recommendations.adhoc", handlers.WithTenant(handlers.EnforceQuota(handlers.AdhocRecommendationsHandler))))
+	http.HandleFunc("GET /readyz", handlers.ReadyzHandler)
+	http.HandleFunc("GET /metrics", metrics.Handler)
+	http.HandleFunc("GET /me/usage", handlers.WithTenant(handlers.MeUsageHandler))
+	http.HandleFunc("GET /covers/{cover_id}/{size}", handlers.CoversHandler)
+	http.HandleFunc("GET /authors/{key}/works", handlers.AuthorWorksHandler)
+	http.HandleFunc("GET /authors/{key}/subjects", handlers.AuthorSubjectsHandler)
+	http.HandleFunc("GET /users", handlers.WithTenant(handlers.ListUsersHandler))
+	http.HandleFunc("POST /users", handlers.Audited("user.create", handlers.WithTenant(handlers.Authenticated(handlers.CreateUserHandler))))
+	http.HandleFunc("POST /users/import", handlers.Audited("user.import", handlers.WithTenant(handlers.Authenticated(handlers.ImportUsersHandler))))
+	http.HandleFunc("GET /tasks/{id}", handlers.WithTenant(handlers.TaskHandler))
+	http.HandleFunc("PUT /users/{id}", handlers.Audited("user.update", handlers.WithTenant(handlers.Authenticated(handlers.UpdateUserHandler))))
+	http.HandleFunc("POST /users/{id}/read-books", handlers.Audited("read_book.log", handlers.WithTenant(handlers.LogReadBookHandler)))
+	http.HandleFunc("GET /users/{id}/read-books", handlers.WithTenant(handlers.ListReadBooksHandler))
+	http.HandleFunc("DELETE /users/{id}/read-books/{work_key}", handlers.Audited("read_book.delete", handlers.WithTenant(handlers.DeleteReadBookHandler)))
+	http.HandleFunc("POST /users/{id}/wishlist", handlers.Audited("wishlist.add", handlers.WithTenant(handlers.AddWishlistHandler)))
+	http.HandleFunc("GET /users/{id}/wishlist", handlers.WithTenant(handlers.ListWishlistHandler))
+	http.HandleFunc("DELETE /users/{id}/wishlist/{work_key}", handlers.Audited("wishlist.remove", handlers.WithTenant(handlers.RemoveWishlistHandler)))
+	http.HandleFunc("DELETE /users/{id}/data", handlers.Audited("user.delete", handlers.WithTenant(handlers.Authenticated(handlers.DeleteUserDataHandler))))
+	http.HandleFunc("GET /users/{id}/export", handlers.Audited("user.export", handlers.WithTenant(handlers.Authenticated(handlers.ExportUserDataHandler))))
+	http.HandleFunc("POST /groups", handlers.Audited("group.create", handlers.WithTenant(handlers.Authenticated(handlers.CreateGroupHandler))))
+	http.HandleFunc("GET /groups/{id}", handlers.WithTenant(handlers.GetGroupHandler))
+	http.HandleFunc("POST /groups/{id}/members", handlers.Audited("group.join", handlers.WithTenant(handlers.Authenticated(handlers.JoinGroupHandler))))
+	http.HandleFunc("DELETE /groups/{id}/members/{user_id}", handlers.Audited("group.leave", handlers.WithTenant(handlers.Authenticated(handlers.LeaveGroupHandler))))
+	http.HandleFunc("GET /groups/{id}/recommendations", handlers.Audited("group_recommendations.get", handlers.WithTenant(handlers.EnforceQuota(handlers.GroupRecommendationsHandler))))
+	http.HandleFunc("POST /groups/{id}/recommendations/{work_key}/vote", handlers.Audited("group_recommendation.vote", handlers.WithTenant(handlers.Authenticated(handlers.VoteGroupRecommendationHandler))))
+	http.HandleFunc("GET /groups/{id}/recommendations/tally", handlers.WithTenant(handlers.GroupTallyHandler))
+	http.HandleFunc("GET /groups/{id}/reading-list", handlers.WithTenant(handlers.GetReadingListHandler))
+	http.HandleFunc("POST /groups/{id}/reading-list", handlers.Audited("reading_list.add", handlers.WithTenant(handlers.Authenticated(handlers.AddReadingListHandler))))
+	http.HandleFunc("DELETE /groups/{id}/reading-list/{work_key}", handlers.Audited("reading_list.remove", handlers.WithTenant(handlers.Authenticated(handlers.RemoveReadingListHandler))))
+	http.HandleFunc("PUT /groups/{id}/reading-list/{work_key}/votes/{user_id}", handlers.Audited("reading_list.vote", handlers.WithTenant(handlers.Authenticated(handlers.VoteReadingListHandler))))
+	http.HandleFunc("DELETE /groups/{id}/reading-list/{work_key}/votes/{user_id}", handlers.Audited("reading_list.unvote", handlers.WithTenant(handlers.Authenticated(handlers.VoteReadingListHandler))))
+	http.HandleFunc("POST /subscriptions", handlers.Audited("subscription.create", handlers.WithTenant(handlers.Authenticated(handlers.CreateSubscriptionHandler))))
+	http.HandleFunc("GET /subscriptions", handlers.WithTenant(handlers.Authenticated(handlers.ListSubscriptionsHandler)))
+	http.HandleFunc("GET /subscriptions/{id}", handlers.WithTenant(handlers.Authenticated(handlers.GetSubscriptionHandler)))
+	http.HandleFunc("POST /subscriptions/{id}/pause", handlers.Audited("subscription.pause", handlers.WithTenant(handlers.Authenticated(handlers.PauseSubscriptionHandler))))
+	http.HandleFunc("POST /subscriptions/{id}/resume", handlers.Audited("subscription.resume", handlers.WithTenant(handlers.Authenticated(handlers.ResumeSubscriptionHandler))))
+	http.HandleFunc("DELETE /subscriptions/{id}", handlers.Audited("subscription.delete", handlers.WithTenant(handlers.Authenticated(handlers.DeleteSubscriptionHandler))))
+	http.HandleFunc("POST /webhooks", handlers.RequireAdmin(handlers.Audited("webhook.create", handlers.CreateWebhookHandler)))
+	http.HandleFunc("GET /webhooks", handlers.RequireAdmin(handlers.ListWebhooksHandler))
+	http.HandleFunc("DELETE /webhooks/{id}", handlers.RequireAdmin(handlers.Audited("webhook.delete", handlers.DeleteWebhookHandler)))
+	http.HandleFunc("POST /admin/organizations", handlers.RequireAdmin(handlers.Audited("organization.create", handlers.AdminCreateOrganizationHandler)))
+	http.HandleFunc("GET /admin/organizations", handlers.RequireAdmin(handlers.AdminListOrganizationsHandler))
+	http.HandleFunc("POST /admin/organizations/{id}/api-keys", handlers.RequireAdmin(handlers.Audited("api_key.create", handlers.AdminCreateAPIKeyHandler)))
+	http.HandleFunc("DELETE /admin/api-keys/{id}", handlers.RequireAdmin(handlers.Audited("api_key.revoke", handlers.AdminRevokeAPIKeyHandler)))
+	http.HandleFunc("POST /admin/backup", handlers.RequireAdmin(handlers.Audited("database.backup", handlers.AdminBackupHandler)))
+	http.HandleFunc("POST /admin/restore", handlers.RequireAdmin(handlers.Audited("database.restore", handlers.AdminRestoreHandler)))
+	http.HandleFunc("GET /admin/status", handlers.RequireAdmin(handlers.AdminStatusHandler))
+	http.HandleFunc("GET /admin/jobs", handlers.RequireAdmin(handlers.AdminJobsHandler))
+	http.HandleFunc("GET /admin/queue", handlers.RequireAdmin(handlers.AdminQueueHandler))
+	http.HandleFunc("GET /admin/queue/{id}", handlers.RequireAdmin(handlers.AdminQueueTaskHandler))
+	http.HandleFunc("POST /admin/queue/{id}/retry", handlers.RequireAdmin(handlers.Audited("task.retry", handlers.AdminRetryTaskHandler)))
+	http.HandleFunc("DELETE /admin/queue/{id}", handlers.RequireAdmin(handlers.Audited("task.discard", handlers.AdminDiscardTaskHandler)))
+	http.HandleFunc("POST /admin/config/reload", handlers.RequireAdmin(handlers.Audited("config.reload", handlers.AdminReloadConfigHandler)))
+	http.HandleFunc("GET /admin/subjects/curation", handlers.RequireAdmin(handlers.AdminSubjectCurationHandler))
+	http.HandleFunc("PUT /admin/subjects/curation/{list}/{subject}", handlers.RequireAdmin(handlers.Audited("subject_rule.set", handlers.AdminSetSubjectRuleHandler)))
+	http.HandleFunc("DELETE /admin/subjects/curation/{list}/{subject}", handlers.RequireAdmin(handlers.Audited("subject_rule.delete", handlers.AdminDeleteSubjectRuleHandler)))
+	http.HandleFunc("GET /admin/features", handlers.RequireAdmin(handlers.AdminListFeaturesHandler))
+	http.HandleFunc("PUT /admin/features/{name}", handlers.RequireAdmin(handlers.Audited("feature.set", handlers.AdminSetFeatureHandler)))
+	http.HandleFunc("DELETE /admin/features/{name}", handlers.RequireAdmin(handlers.Audited("feature.delete", handlers.AdminDeleteFeatureHandler)))
+	http.HandleFunc("GET /admin/audit", handlers.RequireAdmin(handlers.AdminAuditHandler))
+	http.HandleFunc("GET /admin/analytics", handlers.RequireAdmin(handlers.AdminAnalyticsHandler))
+	http.HandleFunc("GET /admin/cache", handlers.RequireAdmin(handlers.AdminCacheStatsHandler))
+	http.HandleFunc("DELETE /admin/cache", handlers.RequireAdmin(handlers.Audited("cache.flush", handlers.AdminCacheFlushHandler)))
+	http.HandleFunc("DELETE /admin/cache/{name}", handlers.RequireAdmin(handlers.Audited("cache.flush", handlers.AdminCacheFlushHandler)))
+	http.HandleFunc("DELETE /admin/cache/{name}/{key}", handlers.RequireAdmin(handlers.Audited("cache.delete", handlers.AdminCacheDeleteKeyHandler)))
+	http.HandleFunc("POST /admin/cache/invalidate", handlers.RequireAdmin(handlers.Audited("cache.invalidate", handlers.AdminCacheInvalidateHandler)))
 
-	fmt.Println("Server is running on port 8080...")
+	cfg := config.Get()
+	server, err := newServer(cfg)
+	if err != nil {
+		log.Fatalf("Invalid server configuration: %v", err)
+	}
+	listener, err := listen(cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", cfg.ListenAddr, err)
+	}
+	scheme := "http"
+	if server.TLSConfig != nil {
+		scheme = "https"
+	}
+	fmt.Printf("Server is running on %s (%s)...\n", listener.Addr(), scheme)
 
 	go func() {
 		time.Sleep(100 * time.Millisecond) // Give the server a moment to start
@@ -32,9 +188,58 @@ func main() {
 		fmt.Printf("Total setup time: %v\n", totalSetupTime)
 	}()
 
-	err := http.ListenAndServe(":8080", nil)
+	err = serve(server, listener)
 	if err != nil {
 		totalRunTime := time.Since(startTime)
 		log.Printf("Server stopped after running for %v. Error: %v", totalRunTime, err)
 	}
-}
\ No newline at end of file
+}
+
+// reloadOnHangup reloads the configuration each time the process receives SIGHUP.
+func reloadOnHangup() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		if _, err := config.Reload(); err != nil {
+			log.Printf("Error reloading configuration: %v", err)
+			continue
+		}
+		log.Printf("Reloaded configuration")
+	}
+}
+
+// warmUp resolves all users' favorite authors, then marks the server ready.
+// The server is marked ready even if the warm-up fails, since requests can
+// still resolve authors on demand.
+func warmUp() {
+	defer services.MarkReady()
+	if err := warmCache(context.Background()); err != nil {
+		log.Printf("Warm-up: %v", err)
+	}
+}
+
+// warmCache resolves all users' favorite authors and stores their keys.
+func warmCache(ctx context.Context) error {
+	db, err := database.Open()
+	if err != nil {
+		return fmt.Errorf("warm-up skipped: %v", err)
+	}
+	defer db.Close()
+
+	authors, err := database.GetAllFavoriteAuthors(db, config.Get().FavoriteAuthorsCap)
+	if err != nil {
+		return fmt.Errorf("warm-up skipped: %v", err)
+	}
+	// Every author's resolution is saved with the same statement
+	queries, err := database.Prepare(ctx, db)
+	if err != nil {
+		return fmt.Errorf("warm-up skipped: %v", err)
+	}
+	defer queries.Close()
+	for name, author := range services.WarmUp(ctx, authors, config.Get().WarmUpRate) {
+		if err := queries.SaveAuthorResolution(context.WithoutCancel(ctx), name, author.Key, author.WorkCount); err != nil {
+			log.Printf("Warm-up: error saving resolution of author '%s': %v", redact.Name(name), err)
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/database"
+)
+
+// maintain returns a job running one maintenance task on its own connection.
+func maintain(task func(*sql.DB) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		db, err := database.Open()
+		if err != nil {
+			return fmt.Errorf("database maintenance skipped: %v", err)
+		}
+		defer db.Close()
+		return task(db)
+	}
+}
+
+func checkpoint(db *sql.DB) error {
+	pages, busy, err := database.Checkpoint(db)
+	if err != nil {
+		return fmt.Errorf("error checkpointing the write-ahead log: %v", err)
+	}
+	if busy {
+		log.Printf("Write-ahead log checkpoint incomplete, database busy; %d pages checkpointed", pages)
+	}
+	return nil
+}
+
+func vacuum(db *sql.DB) error {
+	start := time.Now()
+	if err := database.Vacuum(db); err != nil {
+		return fmt.Errorf("error vacuuming the database: %v", err)
+	}
+	log.Printf("Vacuumed the database in %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func checkIntegrity(db *sql.DB) error {
+	problems, err := database.IntegrityCheck(db)
+	if err != nil {
+		return fmt.Errorf("error checking database integrity: %v", err)
+	}
+	for _, problem := range problems {
+		log.Printf("Database integrity problem: %s", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database integrity check found %d problems: %s", len(problems), strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/services"
+)
+
+// purgeExpired deletes the recommendation history, audit entries, stored
+// pair recommendations, anonymous usage, and blob store payloads older than
+// their retention periods, read on each run so reloading the configuration
+// changes them. A failure purging one kind of data is logged and the others
+// are still purged; the last is returned.
+func purgeExpired(ctx context.Context) error {
+	cfg := config.Get()
+	db, err := database.Open()
+	if err != nil {
+		return fmt.Errorf("retention purge skipped: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	purges := []struct {
+		name      string
+		retention time.Duration
+		purge     func(*sql.DB, time.Time) (int64, error)
+	}{
+		{"recommendation history entries", cfg.HistoryRetention, database.PurgeHistory},
+		{"audit log entries", cfg.AuditRetention, database.PurgeAudit},
+		{"stored pair recommendations", cfg.StoredResultRetention, database.PurgePairRecommendations},
+		// Only today's anonymous usage counts against a quota
+		{"anonymous usage counts", 24 * time.Hour, database.PurgeAnonymousUsage},
+		{"stored upstream payloads", cfg.BlobStoreRetention, func(_ *sql.DB, before time.Time) (int64, error) {
+			return services.PurgeStoredPayloads(ctx, before)
+		}},
+	}
+	var lastErr error
+	for _, p := range purges {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := p.purge(db, now.Add(-p.retention))
+		if err != nil {
+			lastErr = fmt.Errorf("error purging %s older than %v: %v", p.name, p.retention, err)
+			log.Print(lastErr)
+		}
+		if n > 0 {
+			log.Printf("Purged %d %s older than %v", n, p.name, p.retention)
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/handlers"
+)
+
+// newServer returns the HTTP server for the configured address, timeouts, and
+// protocols, serving the default mux with every request measured and a
+// sample logged in detail.
+func newServer(cfg *config.Config) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           handlers.DetailLogged(handlers.Measured(handlers.Hardened(handlers.TimeLimited(http.DefaultServeMux)))),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+
+	// A non-nil, empty TLSNextProto disables HTTP/2 negotiation
+	if !cfg.HTTP2 {
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	switch {
+	case cfg.TLSCertFile != "" || cfg.TLSKeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case cfg.TLSSelfSigned:
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("error generating self-signed certificate: %v", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	return server, nil
+}
+
+// serve accepts connections on the listener, over TLS when the server has a certificate.
+func serve(server *http.Server, listener net.Listener) error {
+	if server.TLSConfig != nil {
+		// The certificates are already loaded, so no files are passed
+		return server.ServeTLS(listener, "", "")
+	}
+	return server.Serve(listener)
+}
+
+// listen returns the listener inherited from systemd socket activation, if
+// any, and otherwise listens on addr: a unix domain socket when it starts
+// with "unix:", and TCP otherwise.
+func listen(addr string) (net.Listener, error) {
+	if listener, err := systemdListener(); listener != nil || err != nil {
+		return listener, err
+	}
+
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// A socket left behind by an earlier run would make the listen fail
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// systemdListenFDsStart is the first file descriptor systemd passes.
+const systemdListenFDsStart = 3
+
+// systemdListener returns the socket passed by systemd socket activation, or
+// nil when the process was not socket activated. Only the first socket is
+// used; the unit should configure a single ListenStream.
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	// Keep child processes from thinking they were activated too
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(uintptr(systemdListenFDsStart), "systemd-socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("error using systemd socket: %v", err)
+	}
+	return listener, nil
+}
+
+// selfSignedCertificate generates a certificate for localhost valid for a
+// year. Clients must be told to trust it, so it is only fit for development.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: crypto.Signer(key)}, nil
+}
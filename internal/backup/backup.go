@@ -0,0 +1,176 @@
+// Package backup snapshots the database to, and restores it from, a local
+// file or an object in an S3-compatible bucket. Locations are file paths or
+// s3://bucket/key URLs; buckets are reached through the configured endpoint
+// and credentials.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/s3"
+	"be-takehome-2024/internal/services"
+)
+
+// Result describes a completed backup or restore.
+type Result struct {
+	Location    string    `json:"location"`
+	Bytes       int64     `json:"bytes"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// DefaultName returns a timestamped file name for a backup taken at t.
+func DefaultName(t time.Time) string {
+	return "user-" + t.UTC().Format("20060102T150405Z") + ".db"
+}
+
+// IsRemote reports whether location is an S3 URL rather than a file path.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+// Save snapshots the database to location.
+func Save(ctx context.Context, location string) (Result, error) {
+	db, err := database.Open()
+	if err != nil {
+		return Result{}, err
+	}
+	defer db.Close()
+
+	if !IsRemote(location) {
+		if dir := filepath.Dir(location); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return Result{}, err
+			}
+		}
+		if err := database.Backup(ctx, db, location); err != nil {
+			return Result{}, err
+		}
+		return result(location, location)
+	}
+
+	bucket, key, err := parseS3(location)
+	if err != nil {
+		return Result{}, err
+	}
+	tmp, err := tempPath()
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.Remove(tmp)
+	if err := database.Backup(ctx, db, tmp); err != nil {
+		return Result{}, err
+	}
+	res, err := result(location, tmp)
+	if err != nil {
+		return Result{}, err
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	if err := newS3Client().Put(ctx, bucket, key, f, res.Bytes, "application/vnd.sqlite3"); err != nil {
+		return Result{}, s3Error(err)
+	}
+	return res, nil
+}
+
+// Load replaces the database with the backup at location. It fails with
+// database.ErrInvalidBackup if the backup is not of the current schema, and
+// with an error matching os.ErrNotExist if there is no backup there.
+func Load(ctx context.Context, location string) (Result, error) {
+	path := location
+	if IsRemote(location) {
+		bucket, key, err := parseS3(location)
+		if err != nil {
+			return Result{}, err
+		}
+		tmp, err := tempPath()
+		if err != nil {
+			return Result{}, err
+		}
+		defer os.Remove(tmp)
+		if err := download(ctx, bucket, key, tmp); err != nil {
+			return Result{}, err
+		}
+		path = tmp
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		return Result{}, err
+	}
+	defer db.Close()
+	if err := database.Restore(ctx, db, path); err != nil {
+		return Result{}, err
+	}
+	return result(location, path)
+}
+
+func result(location, path string) (Result, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Location: location, Bytes: info.Size(), CompletedAt: time.Now().UTC()}, nil
+}
+
+func newS3Client() *s3.Client {
+	cfg := config.Get()
+	return s3.New(services.HTTPClient, cfg.BackupS3Endpoint, cfg.BackupS3Region, cfg.BackupS3AccessKeyID, cfg.BackupS3SecretAccessKey)
+}
+
+// s3Error points to the settings to fix when S3 is not configured.
+func s3Error(err error) error {
+	if errors.Is(err, s3.ErrNotConfigured) {
+		return errors.New("S3 backups need BACKUP_S3_ENDPOINT, BACKUP_S3_ACCESS_KEY_ID, and BACKUP_S3_SECRET_ACCESS_KEY")
+	}
+	return err
+}
+
+// download copies bucket/key to a file at path.
+func download(ctx context.Context, bucket, key, path string) error {
+	body, err := newS3Client().Get(ctx, bucket, key)
+	if err != nil {
+		return s3Error(err)
+	}
+	defer body.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// tempPath returns a path for a local copy of a remote backup.
+func tempPath() (string, error) {
+	f, err := os.CreateTemp("", "backup-*.db")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// parseS3 splits an s3://bucket/key URL.
+func parseS3(location string) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("S3 location %q must be s3://bucket/key", location)
+	}
+	return bucket, key, nil
+}
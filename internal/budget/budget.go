@@ -0,0 +1,220 @@
+// Package budget caps and counts the upstream calls made on behalf of a
+// single request. The budget travels in the request context, so every
+// outbound call made with that context is charged to it.
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrExceeded is returned for upstream calls made after the budget is spent.
+var ErrExceeded = errors.New("upstream call budget exceeded")
+
+// ErrCacheOnly is returned for upstream calls made by a cache-only request,
+// whose data must already be cached.
+var ErrCacheOnly = errors.New("not cached, and upstream calls are disabled in cache-only mode")
+
+// ErrDeadline is returned for upstream calls refused or cut off by the
+// budget's deadline.
+var ErrDeadline = errors.New("request deadline reached")
+
+// Budget tracks a request's upstream calls and cache hits. A nil *Budget is
+// unlimited and records nothing, so callers need not check for one.
+type Budget struct {
+	max       int64 // Zero means unlimited
+	calls     atomic.Int64
+	cacheHits atomic.Int64
+	exceeded  atomic.Bool
+	deadline  time.Time // Zero means none
+	expired   atomic.Bool
+	cacheOnly bool
+	missed    atomic.Bool
+}
+
+// New returns a budget allowing max upstream calls. Zero means unlimited.
+func New(max int) *Budget {
+	return &Budget{max: int64(max)}
+}
+
+type contextKey struct{}
+
+// WithBudget returns a context charging upstream calls to b.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, contextKey{}, b)
+}
+
+// FromContext returns the budget of a context, or nil if it has none.
+func FromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(contextKey{}).(*Budget)
+	return b
+}
+
+// SetDeadline limits upstream calls to before t: later calls are refused and
+// calls still running at t are cut off, so a best-effort request can assemble
+// what it has instead of waiting on them. It must be called before the
+// budget is shared.
+func (b *Budget) SetDeadline(t time.Time) {
+	b.deadline = t
+}
+
+// SetCacheOnly refuses every upstream call, so the request is answered from
+// caches alone. It must be called before the budget is shared.
+func (b *Budget) SetCacheOnly() {
+	b.cacheOnly = true
+}
+
+// CacheOnly reports whether upstream calls are refused, so stored data is
+// used however old it is, as nothing can replace it.
+func (b *Budget) CacheOnly() bool {
+	return b != nil && b.cacheOnly
+}
+
+// CacheMissed reports whether a cache-only request needed an upstream call.
+func (b *Budget) CacheMissed() bool {
+	return b != nil && b.missed.Load()
+}
+
+// HasDeadline reports whether upstream calls are limited by a deadline.
+func (b *Budget) HasDeadline() bool {
+	return b != nil && !b.deadline.IsZero()
+}
+
+// Spend charges one upstream call, returning ErrExceeded once the budget is
+// spent, ErrDeadline once its deadline has passed, and ErrCacheOnly if calls
+// are refused.
+func (b *Budget) Spend() error {
+	if b == nil {
+		return nil
+	}
+	if b.cacheOnly {
+		b.missed.Store(true)
+		return ErrCacheOnly
+	}
+	if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+		b.expired.Store(true)
+		return ErrDeadline
+	}
+	if calls := b.calls.Add(1); b.max > 0 && calls > b.max {
+		b.calls.Add(-1)
+		b.exceeded.Store(true)
+		return ErrExceeded
+	}
+	return nil
+}
+
+// CacheHit records an upstream call saved by a cache.
+func (b *Budget) CacheHit() {
+	if b != nil {
+		b.cacheHits.Add(1)
+	}
+}
+
+// CacheHit records a cache hit against the budget of a context, if any.
+func CacheHit(ctx context.Context) {
+	FromContext(ctx).CacheHit()
+}
+
+// Exceeded reports whether any upstream call was refused.
+func (b *Budget) Exceeded() bool {
+	return b != nil && b.exceeded.Load()
+}
+
+// Expired reports whether any upstream call was refused or cut off by the
+// deadline, so the request's result may be missing data.
+func (b *Budget) Expired() bool {
+	return b != nil && b.expired.Load()
+}
+
+// Expire marks the budget as having been cut off by its deadline, for a
+// request that takes on a result another request's deadline cut short.
+func (b *Budget) Expire() {
+	if b != nil {
+		b.expired.Store(true)
+	}
+}
+
+// CutShort reports whether err is an upstream failure caused by the deadline
+// of the context's budget, or any failure once the deadline has cut calls
+// off, so best-effort callers can carry on without the missing data.
+func CutShort(ctx context.Context, err error) bool {
+	return err != nil && (errors.Is(err, ErrDeadline) || FromContext(ctx).Expired())
+}
+
+// UpstreamCalls returns the number of upstream calls made.
+func (b *Budget) UpstreamCalls() int {
+	if b == nil {
+		return 0
+	}
+	return int(b.calls.Load())
+}
+
+// CacheHits returns the number of cache hits recorded.
+func (b *Budget) CacheHits() int {
+	if b == nil {
+		return 0
+	}
+	return int(b.cacheHits.Load())
+}
+
+// Transport charges each request to the budget in its context before passing
+// it to Next, refusing requests once the budget is spent and cutting them
+// off at its deadline.
+type Transport struct {
+	Next http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := FromContext(req.Context())
+	if err := b.Spend(); err != nil {
+		return nil, err
+	}
+	if !b.HasDeadline() {
+		return t.Next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithDeadline(req.Context(), b.deadline)
+	resp, err := t.Next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, b.cutOff(ctx, err)
+	}
+	// The deadline also bounds reading the body
+	resp.Body = &deadlineBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, budget: b}
+	return resp, nil
+}
+
+// cutOff returns err, marked as ErrDeadline when the deadline caused it.
+func (b *Budget) cutOff(ctx context.Context, err error) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) || time.Now().Before(b.deadline) {
+		return err
+	}
+	b.expired.Store(true)
+	return fmt.Errorf("%w: %w", ErrDeadline, err)
+}
+
+// deadlineBody is a response body read under a budget's deadline.
+type deadlineBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+	budget *Budget
+}
+
+func (body *deadlineBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = body.budget.cutOff(body.ctx, err)
+	}
+	return n, err
+}
+
+func (body *deadlineBody) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+	size    int64
+}
+
+// Cache is a concurrency-safe in-memory key/value store whose entries expire
+// after a fixed TTL. When a limit on entries or bytes is set, the least
+// recently used entries are evicted to stay within it.
+type Cache[V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	defaultTTL time.Duration
+	maxEntries int
+	maxBytes   int64
+	items      map[string]*list.Element // Of *entry[V]
+	order      *list.List               // Most recently used first
+	bytes      int64
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	evictions  atomic.Uint64
+}
+
+// New returns an empty, unbounded cache whose entries live for ttl,
+// registered under name for inspection.
+func New[V any](name string, ttl time.Duration) *Cache[V] {
+	c := &Cache[V]{ttl: ttl, defaultTTL: ttl, items: make(map[string]*list.Element), order: list.New()}
+	Register(name, c)
+	return c
+}
+
+// Get returns the cached value for key, if present and not expired.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	e := elem.Value.(*entry[V])
+	if clock.Now().After(e.expires) {
+		c.remove(elem)
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	c.hits.Add(1)
+	return e.value, true
+}
+
+// Set stores value under key, replacing any existing entry, and evicts the
+// least recently used entries if the cache is over its limits.
+func (c *Cache[V]) Set(key string, value V) {
+	size := approximateSize(key, value)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	c.items[key] = c.order.PushFront(&entry[V]{key: key, value: value, expires: clock.Now().Add(c.ttl), size: size})
+	c.bytes += size
+	c.evict()
+}
+
+// SetLimits bounds the cache to maxEntries entries and maxBytes approximate
+// bytes, evicting entries at once if it is over them. Zero means no limit.
+func (c *Cache[V]) SetLimits(maxEntries int, maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries, c.maxBytes = maxEntries, maxBytes
+	c.evict()
+}
+
+// evict drops least recently used entries until the cache is within its
+// limits. The caller must hold c.mu.
+func (c *Cache[V]) evict() {
+	for c.order.Len() > 0 && ((c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// remove deletes an entry. The caller must hold c.mu.
+func (c *Cache[V]) remove(elem *list.Element) {
+	e := c.order.Remove(elem).(*entry[V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// SetTTL changes the TTL of entries stored from now on, restoring the TTL
+// the cache was created with when ttl is zero. Existing entries keep theirs.
+func (c *Cache[V]) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ttl <= 0 {
+		ttl = c.defaultTTL
+	}
+	c.ttl = ttl
+}
+
+// TTL returns the TTL of entries stored from now on.
+func (c *Cache[V]) TTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+// Delete removes key, reporting whether it was present.
+func (c *Cache[V]) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if ok {
+		c.remove(elem)
+	}
+	return ok
+}
+
+// Flush removes every entry.
+func (c *Cache[V]) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+	c.bytes = 0
+}
+
+// Stats reports the cache's size, limits, and effectiveness.
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	entries, bytes := len(c.items), c.bytes
+	maxEntries, maxBytes := c.maxEntries, c.maxBytes
+	c.mu.Unlock()
+	s := NewStats(entries, bytes, c.hits.Load(), c.misses.Load())
+	s.MaxEntries, s.MaxBytes, s.Evictions = maxEntries, maxBytes, c.evictions.Load()
+	return s
+}
+
+// Sizer is implemented by values that report their own approximate size,
+// such as large byte slices, which are costly to encode on every Set.
+type Sizer interface {
+	Size() int64
+}
+
+// approximateSize estimates an entry's memory footprint from its JSON encoding,
+// which is close enough for the strings and slices the caches hold, or from
+// the value's own Size.
+func approximateSize(key string, value interface{}) int64 {
+	if s, ok := value.(Sizer); ok {
+		return int64(len(key)) + s.Size()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return int64(len(key))
+	}
+	return int64(len(key) + len(encoded))
+}
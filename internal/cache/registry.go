@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats describes a cache's contents and hit rate.
+type Stats struct {
+	Entries int     `json:"entries"`
+	Bytes   int64   `json:"approx_bytes"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+	// Evictions counts entries dropped to stay within the limits, which are
+	// zero when unbounded.
+	Evictions  uint64 `json:"evictions"`
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int64  `json:"max_bytes"`
+}
+
+// NewStats builds Stats, deriving the hit rate from the hit and miss counts.
+func NewStats(entries int, bytes int64, hits, misses uint64) Stats {
+	s := Stats{Entries: entries, Bytes: bytes, Hits: hits, Misses: misses}
+	if total := hits + misses; total > 0 {
+		s.HitRate = float64(hits) / float64(total)
+	}
+	return s
+}
+
+// Store is a cache that can be inspected and invalidated by name.
+type Store interface {
+	Stats() Stats
+	Delete(key string) bool
+	Flush()
+}
+
+// ttlStore is a store whose TTL can be changed at runtime.
+type ttlStore interface {
+	SetTTL(ttl time.Duration)
+}
+
+// boundedStore is a store whose size can be limited at runtime.
+type boundedStore interface {
+	SetLimits(maxEntries int, maxBytes int64)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Store)
+)
+
+// Register makes a store visible to Lookup and Names.
+func Register(name string, s Store) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = s
+}
+
+// Lookup returns the store registered under name.
+func Lookup(name string) (Store, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Names returns the registered store names in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FlushAll empties every registered store.
+func FlushAll() {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, s := range registry {
+		s.Flush()
+	}
+}
+
+// SetTTL changes the TTL of the named store, reporting whether it has one.
+// A zero ttl restores the store's default.
+func SetTTL(name string, ttl time.Duration) bool {
+	s, ok := Lookup(name)
+	if !ok {
+		return false
+	}
+	t, ok := s.(ttlStore)
+	if ok {
+		t.SetTTL(ttl)
+	}
+	return ok
+}
+
+// SetLimits bounds the named store's entries and approximate bytes,
+// reporting whether it can be bounded. Zero means no limit.
+func SetLimits(name string, maxEntries int, maxBytes int64) bool {
+	s, ok := Lookup(name)
+	if !ok {
+		return false
+	}
+	b, ok := s.(boundedStore)
+	if ok {
+		b.SetLimits(maxEntries, maxBytes)
+	}
+	return ok
+}
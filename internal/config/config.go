@@ -0,0 +1,612 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// openLibraryTargets are the named Open Library deployments selectable with
+// OPENLIBRARY_TARGET, as API and covers base URLs.
+var openLibraryTargets = map[string][2]string{
+	"production": {"https://openlibrary.org", "https://covers.openlibrary.org"},
+	"local":      {"http://localhost:9090", "http://localhost:9090"},
+}
+
+// Strategies are the recommendation strategies the recommend package
+// registers, listed here so RECOMMENDATION_STRATEGY can be checked without
+// importing it.
+var Strategies = []string{"collaborative", "popularity", "subject-intersection"}
+
+// Config holds the service's runtime settings.
+type Config struct {
+	// ListenAddr is the host:port the server listens on, or "unix:" followed by
+	// the path of a unix domain socket. A listener passed by systemd socket
+	// activation takes precedence.
+	ListenAddr string
+	// TLSCertFile and TLSKeyFile are the PEM certificate and key served over
+	// HTTPS. The server speaks plain HTTP when neither is set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSSelfSigned serves HTTPS with a generated self-signed certificate when
+	// no certificate is configured, for development only.
+	TLSSelfSigned bool
+	// HTTP2 enables HTTP/2, which is negotiated over TLS only.
+	HTTP2 bool
+	// ReadHeaderTimeout bounds reading a request's headers, so slow clients
+	// can't hold connections open before a handler runs.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a request, including its body.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds handling a request and writing the response, so it
+	// must exceed the longest handler timeout.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds how long a keep-alive connection waits for its next request.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of a request's headers.
+	MaxHeaderBytes int
+	// RequestTimeout bounds handling a request, answered with a timeout
+	// problem once it passes, 0 for no bound.
+	RequestTimeout time.Duration
+	// RouteTimeouts overrides RequestTimeout by route, e.g.
+	// "/recommendations=20s,/groups/{id}/recommendations=40s". Backups and
+	// restores have no bound unless overridden here.
+	RouteTimeouts map[string]time.Duration
+	// MaxRequestBodyBytes caps the size of request bodies, 0 for no cap.
+	MaxRequestBodyBytes int
+	// MaxURLLength caps the length of request URLs, 0 for no cap.
+	MaxURLLength int
+	// MaxQueryParamLength caps the length of each query parameter's name and
+	// value, 0 for no cap.
+	MaxQueryParamLength int
+	// OpenLibraryBaseURL is the root of the Open Library JSON API, e.g. a
+	// staging mirror, local mock, or proxy in front of openlibrary.org.
+	OpenLibraryBaseURL string
+	// OpenLibraryCoversURL is the root of the Open Library cover image service.
+	OpenLibraryCoversURL string
+	// OpenLibraryIndexPath, when set, is a local index of Open Library's data
+	// dumps, loaded by cmd/ingest, that author and subject queries are served
+	// from, with the live API filling in data newer than the dump.
+	OpenLibraryIndexPath string
+	// OpenLibraryIndexOnly serves queries from the index alone, never
+	// reaching the live API for data newer than the dump.
+	OpenLibraryIndexOnly bool
+	// CacheOnly serves recommendations from persisted caches and the local
+	// index alone, making no upstream calls, as during an Open Library outage.
+	CacheOnly bool
+	// OutboundProxyURL is the HTTP(S) proxy all upstream requests go through, if any.
+	OutboundProxyURL string
+	// OutboundNoProxy lists hosts (or ".domain" suffixes) reached without the proxy.
+	OutboundNoProxy []string
+	// CallbackAllowedHosts lists the hosts (or ".domain" suffixes) that
+	// subscriptions may deliver to. When empty, any host resolving only to
+	// public addresses is allowed.
+	CallbackAllowedHosts []string
+	// OutboundIdleConnsPerHost is how many idle connections to each upstream
+	// host are kept for reuse.
+	OutboundIdleConnsPerHost int
+	// OutboundDNSCacheTTL is how long upstream hosts' addresses are cached,
+	// 0 to resolve them for every connection.
+	OutboundDNSCacheTTL time.Duration
+	// OutboundCABundle is a PEM file of extra CAs trusted for upstream TLS,
+	// e.g. for a corporate TLS-inspecting proxy.
+	OutboundCABundle string
+	// GoogleBooksAPIKey is sent with Google Books requests when set.
+	GoogleBooksAPIKey string
+	// SubjectEmbedder embeds subjects for semantic subject matching: "local"
+	// for the built-in word hashing, or "http" for the embeddings API at
+	// EmbeddingsURL.
+	SubjectEmbedder string
+	// EmbeddingsURL is an OpenAI-compatible embeddings endpoint, queried with
+	// EmbeddingsModel and, when set, EmbeddingsAPIKey.
+	EmbeddingsURL    string
+	EmbeddingsModel  string
+	EmbeddingsAPIKey string
+	// SemanticSimilarity is how similar, from 0 to 1, two subjects' embeddings
+	// must be for semantic matching to treat them as related.
+	SemanticSimilarity float64
+	// DefaultStrategy is the recommendation strategy used when a request does not name one.
+	DefaultStrategy string
+	// Experiment is the active A/B experiment definition, if any. See experiments.Parse.
+	Experiment string
+	// ColdStartSubjects are popular subjects used in place of the profile of a
+	// user whose favorite authors cannot be resolved.
+	ColdStartSubjects []string
+	// SubjectAliases adds to or overrides the built-in subject aliases, e.g.
+	// "ya=young adult,sff=speculative fiction"; an empty subject, as in
+	// "sf=", drops a built-in alias.
+	SubjectAliases map[string]string
+	// AuthorResolutionTTL is how long a favorite author's stored key is used
+	// before the author is searched for again.
+	AuthorResolutionTTL time.Duration
+	// UserSubjectsTTL is how long a user's materialized subject counts are used
+	// before their favorite authors' works are fetched again.
+	UserSubjectsTTL time.Duration
+	// PairRefresh enables the background job recomputing recommendations for
+	// recently requested user pairs.
+	PairRefresh bool
+	// PairRefreshInterval is how often the background job runs, unless
+	// PairRefreshSchedule gives a cron schedule for it.
+	PairRefreshInterval time.Duration
+	PairRefreshSchedule string
+	// PairRefreshWindow is how recently a pair must have been requested to be refreshed.
+	PairRefreshWindow time.Duration
+	// Subscriptions enables the background job delivering scheduled
+	// recommendations to subscriptions.
+	Subscriptions bool
+	// SubscriptionPollInterval is how often the job, the "digest" job, checks
+	// for due subscriptions, unless DigestSchedule gives a cron schedule for it.
+	SubscriptionPollInterval time.Duration
+	DigestSchedule           string
+	// Retention enables the background job purging data older than its
+	// retention period: recommendation history after HistoryRetention, audit
+	// entries after AuditRetention, stored pair recommendations not
+	// requested within StoredResultRetention, and upstream payloads in the
+	// blob store after BlobStoreRetention. The job runs every
+	// RetentionInterval, unless RetentionSchedule gives a cron schedule for it.
+	Retention             bool
+	RetentionInterval     time.Duration
+	RetentionSchedule     string
+	HistoryRetention      time.Duration
+	AuditRetention        time.Duration
+	StoredResultRetention time.Duration
+	BlobStoreRetention    time.Duration
+	// Maintenance enables the background jobs keeping the SQLite database
+	// healthy: checkpointing the write-ahead log every CheckpointInterval,
+	// vacuuming every VacuumInterval, and checking integrity every
+	// IntegrityCheckInterval.
+	Maintenance            bool
+	CheckpointInterval     time.Duration
+	VacuumInterval         time.Duration
+	IntegrityCheckInterval time.Duration
+	// DatabaseReset recreates the database with sample data on every start.
+	// When false, an existing database, such as a restored backup, is kept
+	// if it is of the current schema.
+	DatabaseReset bool
+	// BackupDir is where the admin backup endpoint writes, and the restore
+	// endpoint reads, backups given by file name.
+	BackupDir string
+	// BackupS3Endpoint, BackupS3Region, BackupS3AccessKeyID, and
+	// BackupS3SecretAccessKey reach the S3-compatible store holding backups
+	// at s3://bucket/key locations.
+	BackupS3Endpoint        string
+	BackupS3Region          string
+	BackupS3AccessKeyID     string
+	BackupS3SecretAccessKey string
+	// BlobStoreBucket, when set, keeps large cached upstream payloads, author
+	// and subject work listings and cover images, in that bucket of an
+	// S3-compatible store as well as in memory or on local disk. Payloads
+	// there outlive restarts and are served when the upstream fails. Keys
+	// start with BlobStorePrefix.
+	BlobStoreBucket          string
+	BlobStorePrefix          string
+	BlobStoreEndpoint        string
+	BlobStoreRegion          string
+	BlobStoreAccessKeyID     string
+	BlobStoreSecretAccessKey string
+	// SLIWindow is the span the SLI metrics, such as the request success
+	// ratio and p95 latency, are computed over.
+	SLIWindow time.Duration
+	// PairResultMaxAge is how old a stored pair recommendation may be and
+	// still be served instead of being recomputed.
+	PairResultMaxAge time.Duration
+	// WarmUp resolves every user's favorite authors at startup, before the
+	// server reports ready.
+	WarmUp bool
+	// WarmUpRate is the maximum number of author searches per second during warm-up.
+	WarmUpRate float64
+	// WarmCache enables the background job resolving every user's favorite
+	// authors again on WarmCacheSchedule, keeping their keys fresh between
+	// requests.
+	WarmCache         bool
+	WarmCacheSchedule string
+	// SchedulerJitter is the longest random delay added to each run of a
+	// background job, so instances sharing a schedule do not run in step.
+	SchedulerJitter time.Duration
+	// QueueBackend is where background tasks are kept: "memory", in
+	// process, or "redis", shared by instances at QueueRedisURL.
+	QueueBackend  string
+	QueueRedisURL string
+	// QueueWorkers is how many background tasks run at once.
+	QueueWorkers int
+	// QueueResultTTL is how long a finished task's result is kept.
+	QueueResultTTL time.Duration
+	// EventBus is the message bus domain events are published to: "nats",
+	// "kafka" through a REST proxy, or empty to publish none. EventBusURL
+	// is the NATS server or REST proxy, and each event's subject, or topic,
+	// is EventSubjectPrefix followed by its type.
+	EventBus           string
+	EventBusURL        string
+	EventSubjectPrefix string
+	// RecencyWindows are the successively wider publication windows, in
+	// years, searched for recently published books.
+	RecencyWindows []int
+	// CacheTTLs overrides the TTL of in-memory caches by name, e.g.
+	// "subject_works=2h,author_keys=48h".
+	CacheTTLs map[string]time.Duration
+	// CacheMaxEntries and CacheMaxBytes bound each in-memory cache, which
+	// evicts its least recently used entries beyond them. Zero means no limit.
+	CacheMaxEntries int
+	CacheMaxBytes   int
+	// FavoriteAuthorsCap is how many of a user's favorite authors, in their
+	// order, recommendations draw on. Requests with a premium API key use
+	// PremiumFavoriteAuthorsCap instead.
+	FavoriteAuthorsCap        int
+	PremiumFavoriteAuthorsCap int
+	// WorksPerAuthor is how many of each favorite author's works their
+	// subjects are counted from.
+	WorksPerAuthor int
+	// WorksSampling is which works are counted for authors with more than
+	// WorksPerAuthor: "recent" for their newest, "editions" for those with
+	// the most editions, or empty for the provider's own order.
+	WorksSampling string
+	// APIKeyDailyQuota is the number of recommendation requests an API key may
+	// make per UTC day, unless the key sets its own quota. Zero means unlimited.
+	APIKeyDailyQuota int
+	// UpstreamCallBudget caps the upstream calls a single recommendation
+	// request may make. Zero means unlimited.
+	UpstreamCallBudget int
+	// UpstreamRevalidation keeps Open Library responses with their ETag or
+	// Last-Modified, so refetches are conditional and answered by a 304
+	// when nothing changed.
+	UpstreamRevalidation bool
+	// UpstreamMaxResponseBytes caps how much of an upstream JSON response is
+	// read; anything larger is a misbehaving upstream.
+	UpstreamMaxResponseBytes int
+	// DescriptionMaxLength caps, in characters, the book descriptions and
+	// author bios sent to clients; longer ones are truncated with a marker.
+	// Zero means no limit.
+	DescriptionMaxLength int
+	// DetailLogSampleRate is the fraction of requests whose details, such as
+	// stage timings, author resolutions, and upstream calls, are logged.
+	// Requests slower than SlowRequestThreshold are always logged in detail.
+	DetailLogSampleRate  float64
+	SlowRequestThreshold time.Duration
+	// LogRedactPII replaces usernames and the favorite authors tied to a
+	// user with opaque tokens in the logs, and masks email addresses.
+	LogRedactPII bool
+	// MessagesDir holds <lang>.json message catalogs adding to or overriding
+	// the built-in translations, if set.
+	MessagesDir string
+	// AdminToken is the bearer token required by admin endpoints, which are
+	// disabled when it is empty.
+	AdminToken string
+}
+
+var (
+	current atomic.Pointer[Config]
+	once    sync.Once
+)
+
+// Load reads the configuration from environment variables, applying defaults
+// for anything unset. Values in the CONFIG_FILE, if any, override the
+// environment.
+func Load() *Config {
+	cfg, err := load()
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	return cfg
+}
+
+func load() (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	values, err := readConfigFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	fileValues = values
+	defer func() { fileValues = nil }()
+
+	target, ok := openLibraryTargets[getEnv("OPENLIBRARY_TARGET", "production")]
+	if !ok {
+		log.Printf("Unknown OPENLIBRARY_TARGET, using production")
+		target = openLibraryTargets["production"]
+	}
+
+	cfg := &Config{
+		ListenAddr:                getEnv("LISTEN_ADDR", net.JoinHostPort(getEnv("BIND_ADDRESS", ""), getEnv("PORT", "8080"))),
+		TLSCertFile:               getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:                getEnv("TLS_KEY_FILE", ""),
+		TLSSelfSigned:             getEnvBool("TLS_SELF_SIGNED", false),
+		HTTP2:                     getEnvBool("HTTP2_ENABLED", true),
+		ReadHeaderTimeout:         getEnvDuration("READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:               getEnvDuration("READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:              getEnvDuration("WRITE_TIMEOUT", 45*time.Second),
+		IdleTimeout:               getEnvDuration("IDLE_TIMEOUT", 2*time.Minute),
+		MaxHeaderBytes:            getEnvInt("MAX_HEADER_BYTES", 64<<10),
+		RequestTimeout:            getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+		RouteTimeouts:             getEnvDurations("ROUTE_TIMEOUTS"),
+		MaxRequestBodyBytes:       getEnvInt("MAX_REQUEST_BODY_BYTES", 1<<20),
+		MaxURLLength:              getEnvInt("MAX_URL_LENGTH", 8192),
+		MaxQueryParamLength:       getEnvInt("MAX_QUERY_PARAM_LENGTH", 2048),
+		OpenLibraryBaseURL:        getEnv("OPENLIBRARY_BASE_URL", target[0]),
+		OpenLibraryCoversURL:      getEnv("OPENLIBRARY_COVERS_URL", target[1]),
+		OpenLibraryIndexPath:      getEnv("OPENLIBRARY_INDEX_PATH", ""),
+		OpenLibraryIndexOnly:      getEnvBool("OPENLIBRARY_INDEX_ONLY", false),
+		CacheOnly:                 getEnvBool("CACHE_ONLY", false),
+		OutboundProxyURL:          getEnv("OUTBOUND_PROXY_URL", ""),
+		OutboundNoProxy:           getEnvList("OUTBOUND_NO_PROXY", nil),
+		OutboundCABundle:          getEnv("OUTBOUND_CA_BUNDLE", ""),
+		CallbackAllowedHosts:      getEnvList("CALLBACK_ALLOWED_HOSTS", nil),
+		OutboundIdleConnsPerHost:  getEnvInt("OUTBOUND_IDLE_CONNS_PER_HOST", 32),
+		OutboundDNSCacheTTL:       getEnvDuration("OUTBOUND_DNS_CACHE_TTL", time.Minute),
+		GoogleBooksAPIKey:         getEnv("GOOGLE_BOOKS_API_KEY", ""),
+		SubjectEmbedder:           getEnvEnum("SUBJECT_EMBEDDER", "local", "local", "http"),
+		EmbeddingsURL:             getEnv("EMBEDDINGS_URL", ""),
+		EmbeddingsModel:           getEnv("EMBEDDINGS_MODEL", ""),
+		EmbeddingsAPIKey:          getEnv("EMBEDDINGS_API_KEY", ""),
+		SemanticSimilarity:        getEnvFloat("SEMANTIC_SIMILARITY_THRESHOLD", 0.45),
+		DefaultStrategy:           getEnv("RECOMMENDATION_STRATEGY", "subject-intersection"),
+		Experiment:                getEnv("RECOMMENDATION_EXPERIMENT", ""),
+		AdminToken:                getEnv("ADMIN_TOKEN", ""),
+		MessagesDir:               getEnv("MESSAGES_DIR", ""),
+		AuthorResolutionTTL:       getEnvDuration("AUTHOR_RESOLUTION_TTL", 7*24*time.Hour),
+		UserSubjectsTTL:           getEnvDuration("USER_SUBJECTS_TTL", 24*time.Hour),
+		PairRefresh:               getEnvBool("PAIR_REFRESH_ENABLED", true),
+		PairRefreshInterval:       getEnvDuration("PAIR_REFRESH_INTERVAL", 15*time.Minute),
+		PairRefreshSchedule:       getEnv("PAIR_REFRESH_SCHEDULE", ""),
+		PairRefreshWindow:         getEnvDuration("PAIR_REFRESH_WINDOW", 24*time.Hour),
+		PairResultMaxAge:          getEnvDuration("PAIR_RESULT_MAX_AGE", 30*time.Minute),
+		Retention:                 getEnvBool("RETENTION_ENABLED", true),
+		RetentionInterval:         getEnvDuration("RETENTION_INTERVAL", time.Hour),
+		RetentionSchedule:         getEnv("RETENTION_SCHEDULE", ""),
+		HistoryRetention:          getEnvDuration("HISTORY_RETENTION", 90*24*time.Hour),
+		AuditRetention:            getEnvDuration("AUDIT_RETENTION", 365*24*time.Hour),
+		StoredResultRetention:     getEnvDuration("STORED_RESULT_RETENTION", 7*24*time.Hour),
+		BlobStoreRetention:        getEnvDuration("BLOB_STORE_RETENTION", 30*24*time.Hour),
+		Maintenance:               getEnvBool("SQLITE_MAINTENANCE_ENABLED", true),
+		CheckpointInterval:        getEnvDuration("SQLITE_CHECKPOINT_INTERVAL", 5*time.Minute),
+		VacuumInterval:            getEnvDuration("SQLITE_VACUUM_INTERVAL", 24*time.Hour),
+		IntegrityCheckInterval:    getEnvDuration("SQLITE_INTEGRITY_CHECK_INTERVAL", 24*time.Hour),
+		DatabaseReset:             getEnvBool("DATABASE_RESET", true),
+		BackupDir:                 getEnv("BACKUP_DIR", "./backups"),
+		BackupS3Endpoint:          getEnv("BACKUP_S3_ENDPOINT", "https://s3.amazonaws.com"),
+		BackupS3Region:            getEnv("BACKUP_S3_REGION", "us-east-1"),
+		BackupS3AccessKeyID:       getEnv("BACKUP_S3_ACCESS_KEY_ID", ""),
+		BackupS3SecretAccessKey:   getEnv("BACKUP_S3_SECRET_ACCESS_KEY", ""),
+		BlobStoreBucket:           getEnv("BLOB_STORE_BUCKET", ""),
+		BlobStorePrefix:           getEnv("BLOB_STORE_PREFIX", "upstream/"),
+		BlobStoreEndpoint:         getEnv("BLOB_STORE_ENDPOINT", "https://s3.amazonaws.com"),
+		BlobStoreRegion:           getEnv("BLOB_STORE_REGION", "us-east-1"),
+		BlobStoreAccessKeyID:      getEnv("BLOB_STORE_ACCESS_KEY_ID", ""),
+		BlobStoreSecretAccessKey:  getEnv("BLOB_STORE_SECRET_ACCESS_KEY", ""),
+		SLIWindow:                 getEnvDuration("SLI_WINDOW", 5*time.Minute),
+		Subscriptions:             getEnvBool("SUBSCRIPTIONS_ENABLED", true),
+		SubscriptionPollInterval:  getEnvDuration("SUBSCRIPTION_POLL_INTERVAL", time.Minute),
+		DigestSchedule:            getEnv("DIGEST_SCHEDULE", ""),
+		RecencyWindows:            getEnvIntList("RECENCY_WINDOWS", []int{2, 5, 10}),
+		CacheTTLs:                 getEnvDurations("CACHE_TTLS"),
+		SubjectAliases:            getEnvMap("SUBJECT_ALIASES"),
+		CacheMaxEntries:           getEnvInt("CACHE_MAX_ENTRIES", 10000),
+		CacheMaxBytes:             getEnvInt("CACHE_MAX_BYTES", 64<<20),
+		FavoriteAuthorsCap:        getEnvInt("FAVORITE_AUTHORS_CAP", 5),
+		PremiumFavoriteAuthorsCap: getEnvInt("PREMIUM_FAVORITE_AUTHORS_CAP", 20),
+		WorksPerAuthor:            getEnvInt("WORKS_PER_AUTHOR", 100),
+		WorksSampling:             getEnvEnum("WORKS_SAMPLING", "", "recent", "editions"),
+		APIKeyDailyQuota:          getEnvInt("API_KEY_DAILY_QUOTA", 1000),
+		UpstreamCallBudget:        getEnvInt("UPSTREAM_CALL_BUDGET", 200),
+		UpstreamRevalidation:      getEnvBool("UPSTREAM_REVALIDATION", true),
+		UpstreamMaxResponseBytes:  getEnvInt("UPSTREAM_MAX_RESPONSE_BYTES", 16<<20),
+		DescriptionMaxLength:      getEnvInt("DESCRIPTION_MAX_LENGTH", 2000),
+		DetailLogSampleRate:       getEnvRate("DETAIL_LOG_SAMPLE_RATE"),
+		SlowRequestThreshold:      getEnvDuration("SLOW_REQUEST_THRESHOLD", 5*time.Second),
+		LogRedactPII:              getEnvBool("LOG_REDACT_PII", true),
+		WarmUp:                    getEnvBool("WARMUP_ENABLED", false),
+		WarmUpRate:                getEnvFloat("WARMUP_RATE", 2),
+		WarmCache:                 getEnvBool("WARM_CACHE_ENABLED", false),
+		WarmCacheSchedule:         getEnv("WARM_CACHE_SCHEDULE", "0 */6 * * *"),
+		SchedulerJitter:           getEnvDuration("SCHEDULER_JITTER", 30*time.Second),
+		QueueBackend:              getEnv("QUEUE_BACKEND", "memory"),
+		QueueRedisURL:             getEnv("QUEUE_REDIS_URL", "redis://localhost:6379/0"),
+		QueueWorkers:              getEnvInt("QUEUE_WORKERS", 4),
+		QueueResultTTL:            getEnvDuration("QUEUE_RESULT_TTL", 24*time.Hour),
+		EventBus:                  getEnv("EVENT_BUS", ""),
+		EventBusURL:               getEnv("EVENT_BUS_URL", ""),
+		EventSubjectPrefix:        getEnv("EVENT_SUBJECT_PREFIX", "bookrec."),
+		ColdStartSubjects: getEnvList("COLD_START_SUBJECTS", []string{
+			"fiction", "fantasy", "science fiction", "mystery", "romance", "historical fiction", "biography", "history",
+		}),
+	}
+	if err := cfg.checkTimeouts(); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(Strategies, cfg.DefaultStrategy) {
+		return nil, fmt.Errorf("unknown RECOMMENDATION_STRATEGY '%s', want one of %s", cfg.DefaultStrategy, strings.Join(Strategies, ", "))
+	}
+	return cfg, nil
+}
+
+// checkTimeouts makes sure the write timeout outlasts every request timeout,
+// so a timed out request's problem can still be written.
+func (cfg *Config) checkTimeouts() error {
+	if cfg.WriteTimeout <= 0 {
+		return nil
+	}
+	if cfg.RequestTimeout >= cfg.WriteTimeout {
+		return fmt.Errorf("REQUEST_TIMEOUT (%v) must be shorter than WRITE_TIMEOUT (%v)", cfg.RequestTimeout, cfg.WriteTimeout)
+	}
+	for route, timeout := range cfg.RouteTimeouts {
+		if timeout >= cfg.WriteTimeout {
+			return fmt.Errorf("ROUTE_TIMEOUTS entry for %s (%v) must be shorter than WRITE_TIMEOUT (%v)", route, timeout, cfg.WriteTimeout)
+		}
+	}
+	return nil
+}
+
+// Get returns the active configuration, loading it on first use.
+func Get() *Config {
+	once.Do(func() { current.Store(Load()) })
+	return current.Load()
+}
+
+// lookupEnv returns a setting from the config file being loaded, or else from the environment.
+func lookupEnv(key string) (string, bool) {
+	if v, ok := fileValues[key]; ok {
+		return v, true
+	}
+	return os.LookupEnv(key)
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := lookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getEnvBool reads a boolean, falling back when unset or invalid.
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(getEnv(key, strconv.FormatBool(fallback)))
+	if err != nil {
+		log.Printf("Invalid %s, using %v", key, fallback)
+		return fallback
+	}
+	return v
+}
+
+// getEnvInt reads a non-negative integer, falling back when unset or invalid.
+func getEnvInt(key string, fallback int) int {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s, using %v", key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvEnum reads one of the allowed values, falling back when unset or
+// not allowed.
+func getEnvEnum(key, fallback string, allowed ...string) string {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	for _, value := range allowed {
+		if v == value {
+			return v
+		}
+	}
+	log.Printf("Invalid %s, using %q", key, fallback)
+	return fallback
+}
+
+// getEnvFloat reads a positive number, falling back when unset or invalid.
+func getEnvFloat(key string, fallback float64) float64 {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		log.Printf("Invalid %s, using %v", key, fallback)
+		return fallback
+	}
+	return f
+}
+
+// getEnvRate reads a fraction between 0 and 1, falling back to 0 when unset or invalid.
+func getEnvRate(key string) float64 {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		log.Printf("Invalid %s, using 0", key)
+		return 0
+	}
+	return f
+}
+
+// getEnvDuration reads a positive duration such as "36h", falling back when unset or invalid.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s, using %v", key, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvList reads a comma-separated list, dropping empty items.
+func getEnvList(key string, fallback []string) []string {
+	v, ok := lookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvIntList reads a comma-separated list of positive integers in
+// increasing order, falling back when unset or invalid.
+func getEnvIntList(key string, fallback []int) []int {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return fallback
+	}
+	var ns []int
+	for _, item := range items {
+		n, err := strconv.Atoi(item)
+		if err != nil || n <= 0 || (len(ns) > 0 && n <= ns[len(ns)-1]) {
+			log.Printf("Invalid %s, using %v", key, fallback)
+			return fallback
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+// getEnvDurations reads a comma-separated list of name=duration pairs,
+// skipping invalid ones.
+func getEnvDurations(key string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, item := range getEnvList(key, nil) {
+		name, value, _ := strings.Cut(item, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			log.Printf("Invalid %s entry '%s', ignoring it", key, item)
+			continue
+		}
+		durations[strings.TrimSpace(name)] = d
+	}
+	return durations
+}
+
+// getEnvMap reads a comma-separated list of name=value pairs, skipping
+// invalid ones.
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, item := range getEnvList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			log.Printf("Invalid %s entry '%s', ignoring it", key, item)
+			continue
+		}
+		values[name] = strings.TrimSpace(value)
+	}
+	return values
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// loadMu serializes loads, which share fileValues.
+	loadMu sync.Mutex
+	// fileValues holds the settings read from the config file during a load.
+	fileValues map[string]string
+
+	hooksMu sync.Mutex
+	hooks   []func(*Config)
+)
+
+// Reload reads the configuration again and makes it active, then runs the
+// reload hooks. On error the active configuration is kept.
+//
+// Settings read per request, such as quotas, budgets, TTLs, and recency
+// windows, take effect immediately. Settings used at startup, such as the
+// listen address, TLS, and upstream hosts, need a restart.
+func Reload() (*Config, error) {
+	Get() // Make sure the initial load has happened
+	cfg, err := load()
+	if err != nil {
+		return nil, err
+	}
+	current.Store(cfg)
+
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	for _, hook := range hooks {
+		hook(cfg)
+	}
+	return cfg, nil
+}
+
+// OnReload registers a function applying a reloaded configuration to state
+// derived from it at startup.
+func OnReload(hook func(*Config)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// readConfigFile reads KEY=VALUE settings, one per line, skipping blank lines
+// and lines starting with '#'. An empty path means no file.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file: %v", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	return values, nil
+}
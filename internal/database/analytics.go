@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Analytics summarizes the service's use since a point in time, from the
+// audit log and recommendation history.
+type Analytics struct {
+	Since    time.Time        `json:"since"`
+	Requests RequestAnalytics `json:"requests"`
+	// Recommendations counts recommendation responses, and how many served a
+	// stored recommendation rather than computing one.
+	Recommendations int     `json:"recommendations"`
+	StoredHits      int     `json:"stored_hits"`
+	StoredHitRate   float64 `json:"stored_hit_rate"`
+	// AvgLatencyMS is the mean duration of successful recommendation requests.
+	AvgLatencyMS float64      `json:"avg_latency_ms"`
+	TopSubjects  []CountedKey `json:"top_subjects"`
+	TopWorks     []CountedKey `json:"top_works"`
+}
+
+// RequestAnalytics counts audited requests.
+type RequestAnalytics struct {
+	Total    int            `json:"total"`
+	Errors   int            `json:"errors"` // Responses with a 5xx status
+	ByAction map[string]int `json:"by_action"`
+}
+
+// CountedKey is a subject or work and how often it was recommended.
+type CountedKey struct {
+	Key   string `json:"key"`
+	Title string `json:"title,omitempty"`
+	Count int    `json:"count"`
+}
+
+// recommendationAction is the audit action of pair recommendation requests.
+const recommendationAction = "recommendations.get"
+
+// GetAnalytics summarizes activity since a time, listing up to limit of the
+// most recommended subjects and works.
+func GetAnalytics(db *sql.DB, since time.Time, limit int) (Analytics, error) {
+	since = since.UTC()
+	a := Analytics{Since: since, Requests: RequestAnalytics{ByAction: make(map[string]int)}}
+
+	rows, err := db.Query(`
+		SELECT action, COUNT(*), SUM(CASE WHEN status >= 500 THEN 1 ELSE 0 END)
+		FROM audit_log WHERE created_at >= ? GROUP BY action
+	`, since)
+	if err != nil {
+		return Analytics{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var action string
+		var count, errors int
+		if err := rows.Scan(&action, &count, &errors); err != nil {
+			return Analytics{}, err
+		}
+		a.Requests.ByAction[action] = count
+		a.Requests.Total += count
+		a.Requests.Errors += errors
+	}
+	if err := rows.Err(); err != nil {
+		return Analytics{}, err
+	}
+
+	var avg sql.NullFloat64
+	err = db.QueryRow(`
+		SELECT AVG(duration_ms) FROM audit_log
+		WHERE action = ? AND status < 300 AND created_at >= ?
+	`, recommendationAction, since).Scan(&avg)
+	if err != nil {
+		return Analytics{}, err
+	}
+	a.AvgLatencyMS = avg.Float64
+
+	err = db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(stored), 0) FROM recommendation_history WHERE created_at >= ?
+	`, since).Scan(&a.Recommendations, &a.StoredHits)
+	if err != nil {
+		return Analytics{}, err
+	}
+	if a.Recommendations > 0 {
+		a.StoredHitRate = float64(a.StoredHits) / float64(a.Recommendations)
+	}
+
+	a.TopSubjects, err = countedKeys(db, `
+		SELECT subject, '', COUNT(*) FROM recommendation_history
+		WHERE created_at >= ? GROUP BY subject ORDER BY COUNT(*) DESC, subject LIMIT ?
+	`, since, limit)
+	if err != nil {
+		return Analytics{}, err
+	}
+	a.TopWorks, err = countedKeys(db, `
+		SELECT json_extract(work.value, '$.key') AS key, MAX(json_extract(work.value, '$.title')), COUNT(*)
+		FROM recommendation_history, json_each(recommendation_history.recommendations) AS work
+		WHERE created_at >= ? GROUP BY key ORDER BY COUNT(*) DESC, key LIMIT ?
+	`, since, limit)
+	if err != nil {
+		return Analytics{}, err
+	}
+	return a, nil
+}
+
+func countedKeys(db *sql.DB, query string, args ...interface{}) ([]CountedKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []CountedKey{}
+	for rows.Next() {
+		var k CountedKey
+		if err := rows.Scan(&k.Key, &k.Title, &k.Count); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+// AuditEntry records one API operation.
+type AuditEntry struct {
+	ID         int               `json:"id"`
+	Action     string            `json:"action"`
+	Actor      string            `json:"actor"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Params     map[string]string `json:"params"`
+	Status     int               `json:"status"`
+	DurationMS int64             `json:"duration_ms"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// AuditFilter narrows an audit log query. Zero values match everything.
+type AuditFilter struct {
+	Action string
+	Actor  string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// AuditRepository stores the audit log.
+type AuditRepository interface {
+	RecordAudit(ctx context.Context, entry AuditEntry) error
+	QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+	UserAuditEntries(ctx context.Context, userID int, username string) ([]AuditEntry, error)
+}
+
+var _ AuditRepository = (*Queries)(nil)
+
+const auditColumns = "id, action, actor, method, path, params, status, duration_ms, created_at"
+
+// userAuditCondition matches the audit entries of requests about the user
+// with ID ?1 and lowercase username ?2: those to the user's own paths, to a
+// path naming them as a group member or voter, or with a query parameter
+// naming them.
+const userAuditCondition = `(
+	path = '/users/' || ?1 OR path LIKE '/users/' || ?1 || '/%'
+	OR path LIKE '/groups/%/members/' || ?1 OR path LIKE '/groups/%/votes/' || ?1
+	OR LOWER(json_extract(params, '$.user1')) IN (?1, ?2)
+	OR LOWER(json_extract(params, '$.user2')) IN (?1, ?2)
+	OR json_extract(params, '$.user_id') = ?1
+)`
+
+const (
+	recordAuditQuery = `
+		INSERT INTO audit_log(action, actor, method, path, params, status, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	userAuditEntriesQuery = "SELECT " + auditColumns + " FROM audit_log WHERE " + userAuditCondition + " ORDER BY id"
+)
+
+// RecordAudit appends an entry to the audit log.
+func RecordAudit(db *sql.DB, entry AuditEntry) error {
+	return New(db).RecordAudit(context.Background(), entry)
+}
+
+// RecordAudit appends an entry to the audit log.
+func (q *Queries) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	params, err := json.Marshal(entry.Params)
+	if err != nil {
+		return err
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = clock.Now()
+	}
+	_, err = q.exec(ctx, recordAuditQuery, entry.Action, entry.Actor, entry.Method, entry.Path, string(params), entry.Status, entry.DurationMS, entry.CreatedAt.UTC())
+	return err
+}
+
+// QueryAudit returns matching audit entries, newest first.
+func QueryAudit(db *sql.DB, filter AuditFilter) ([]AuditEntry, error) {
+	return New(db).QueryAudit(context.Background(), filter)
+}
+
+// QueryAudit returns matching audit entries, newest first.
+func (q *Queries) QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := "SELECT " + auditColumns + " FROM audit_log WHERE 1 = 1"
+	var args []interface{}
+	if filter.Action != "" {
+		query += " AND action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.Actor != "" {
+		query += " AND actor = ?"
+		args = append(args, filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.Until.UTC())
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := q.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEntries(rows)
+}
+
+// UserAuditEntries returns the audit entries of requests about a user,
+// oldest first.
+func UserAuditEntries(db *sql.DB, userID int, username string) ([]AuditEntry, error) {
+	return New(db).UserAuditEntries(context.Background(), userID, username)
+}
+
+// UserAuditEntries returns the audit entries of requests about a user,
+// oldest first.
+func (q *Queries) UserAuditEntries(ctx context.Context, userID int, username string) ([]AuditEntry, error) {
+	rows, err := q.query(ctx, userAuditEntriesQuery, strconv.Itoa(userID), strings.ToLower(username))
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEntries(rows)
+}
+
+func scanAuditEntries(rows *sql.Rows) ([]AuditEntry, error) {
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var (
+			entry  AuditEntry
+			params string
+		)
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.Actor, &entry.Method, &entry.Path,
+			&params, &entry.Status, &entry.DurationMS, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(params), &entry.Params); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrInvalidBackup is returned when restoring from a file that is not a
+// database of the current schema.
+var ErrInvalidBackup = errors.New("not a backup of the current schema")
+
+// Exists reports whether the database file exists.
+func Exists() bool {
+	_, err := os.Stat(dbPath)
+	return err == nil
+}
+
+// ValidateExisting migrates the existing database, such as a restored backup,
+// to the current schema and checks it is of it, for use instead of SetupDatabase.
+func ValidateExisting() error {
+	db, err := Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := Migrate(db); err != nil {
+		return err
+	}
+	return ValidateSchema(db)
+}
+
+// Backup writes a consistent snapshot of db to a new database file at path,
+// using SQLite's online backup API so the server keeps serving meanwhile. The
+// snapshot is written beside path and renamed into place once complete, so a
+// failed backup never leaves a partial file at path.
+func Backup(ctx context.Context, db *sql.DB, path string) error {
+	tmp := path + ".partial"
+	os.Remove(tmp)
+	dst, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	err = copyDatabase(ctx, dst, db)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Restore replaces the contents of db with the backup at path, after checking
+// the backup is of the current schema. Other connections see the restored
+// contents once it completes.
+func Restore(ctx context.Context, db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := ValidateSchema(src); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	return copyDatabase(ctx, db, src)
+}
+
+// copyDatabase copies the main database of src over that of dst in one step.
+func copyDatabase(ctx context.Context, dst, src *sql.DB) error {
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			dstSQLite, ok := dstDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backup requires SQLite connections")
+			}
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
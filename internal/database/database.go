@@ -2,65 +2,450 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
-	"fmt"
 	"strings"
+	"time"
+
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
 )
 
+// dbPath is the location of the SQLite database file.
+const dbPath = "./user.db"
+
+// Open returns a handle to the application database.
+func Open() (*sql.DB, error) {
+	return sql.Open("sqlite3", dbPath)
+}
+
 // SetupDatabase initializes the SQLite database and inserts sample data.
 func SetupDatabase() {
-	os.Remove("./user.db")
-	database, err := sql.Open("sqlite3", "./user.db")
+	// Remove the write-ahead log with the database, or it would be replayed into the new one
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		os.Remove(path)
+	}
+	database, err := Open()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer database.Close()
 
+	// Write ahead, so readers do not block the writer, and checkpoint the log periodically
+	mustExec(database, `PRAGMA journal_mode = WAL`)
+
+	// Create organizations table; every user belongs to one tenant organization
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS organizations (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			slug TEXT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL
+		)
+	`)
+
+	// Create API keys table, storing only a hash of each key
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY,
+			org_id INTEGER NOT NULL REFERENCES organizations(id),
+			name TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			daily_quota INTEGER,
+			premium BOOLEAN NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			revoked_at DATETIME
+		)
+	`)
+
+	// Create API key usage table, counting requests per key per UTC day
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS api_key_usage (
+			api_key_id INTEGER NOT NULL REFERENCES api_keys(id),
+			day TEXT NOT NULL,
+			requests INTEGER NOT NULL,
+			PRIMARY KEY (api_key_id, day)
+		)
+	`)
+
 	// Create users table
-	statement, _ := database.Prepare(`
+	mustExec(database, `
 		CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY, 
-			username TEXT, 
-			fauthors TEXT
+			org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id),
+			username TEXT,
+			version INTEGER NOT NULL DEFAULT 1
+		)
+	`)
+	mustExec(database, `CREATE UNIQUE INDEX IF NOT EXISTS idx_users_org_username ON users(org_id, username COLLATE NOCASE)`)
+
+	// Create favorite authors table, with each author's resolved key once known
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS favorite_authors (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			position INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			author_key TEXT,
+			work_count INTEGER,
+			resolved_at DATETIME,
+			PRIMARY KEY (user_id, position)
+		)
+	`)
+	mustExec(database, `CREATE INDEX IF NOT EXISTS idx_favorite_authors_name ON favorite_authors(name COLLATE NOCASE)`)
+
+	// Create user profiles table, caching each user's subject counts
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS user_profiles (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id),
+			subjects TEXT NOT NULL,
+			updated_at DATETIME NOT NULL
+		)
+	`)
+
+	// Create user subjects table, materializing each user's aggregated subject counts
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS user_subjects (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			subject TEXT NOT NULL,
+			author_count INTEGER NOT NULL,
+			work_share REAL NOT NULL,
+			rank_weight REAL NOT NULL DEFAULT 0,
+			work_count INTEGER NOT NULL DEFAULT 0,
+			favorite_cap INTEGER NOT NULL DEFAULT 0,
+			author_total INTEGER NOT NULL DEFAULT 0,
+			computed_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, subject)
+		)
+	`)
+
+	// Create read books table, holding the works each user has read
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS read_books (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			work_key TEXT NOT NULL,
+			finished_on TEXT,
+			rating INTEGER,
+			logged_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, work_key)
+		)
+	`)
+
+	// Create groups tables: book clubs, their members, and their shared reading list with votes
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS groups (
+			id INTEGER PRIMARY KEY,
+			org_id INTEGER NOT NULL REFERENCES organizations(id),
+			name TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		)
+	`)
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS group_members (
+			group_id INTEGER NOT NULL REFERENCES groups(id),
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			joined_at DATETIME NOT NULL,
+			PRIMARY KEY (group_id, user_id)
+		)
+	`)
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS group_reading_list (
+			group_id INTEGER NOT NULL REFERENCES groups(id),
+			work_key TEXT NOT NULL,
+			title TEXT NOT NULL,
+			authors TEXT NOT NULL,
+			added_by INTEGER,
+			added_at DATETIME NOT NULL,
+			subject TEXT,
+			subject_score REAL,
+			PRIMARY KEY (group_id, work_key)
+		)
+	`)
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS group_reading_list_votes (
+			group_id INTEGER NOT NULL,
+			work_key TEXT NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			voted_at DATETIME NOT NULL,
+			PRIMARY KEY (group_id, work_key, user_id)
+		)
+	`)
+
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS group_recommendations (
+			group_id INTEGER PRIMARY KEY REFERENCES groups(id),
+			result TEXT NOT NULL,
+			computed_at DATETIME NOT NULL
+		)
+	`)
+
+	// Create subscriptions table, scheduling recurring recommendation deliveries
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS subscriptions (
+			id INTEGER PRIMARY KEY,
+			org_id INTEGER NOT NULL REFERENCES organizations(id),
+			user1_id INTEGER REFERENCES users(id),
+			user2_id INTEGER REFERENCES users(id),
+			group_id INTEGER REFERENCES groups(id),
+			cadence TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			paused BOOLEAN NOT NULL DEFAULT 0,
+			next_run_at DATETIME NOT NULL,
+			last_run_at DATETIME,
+			failures INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL
+		)
+	`)
+	mustExec(database, `CREATE INDEX IF NOT EXISTS idx_subscriptions_next_run ON subscriptions(paused, next_run_at)`)
+
+	// Create wishlist table, holding the works each user has saved for later
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS wishlist (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			work_key TEXT NOT NULL,
+			title TEXT NOT NULL,
+			authors TEXT NOT NULL,
+			added_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, work_key)
+		)
+	`)
+
+	// Create recommendation history table
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS recommendation_history (
+			id INTEGER PRIMARY KEY,
+			user1_id INTEGER NOT NULL,
+			user2_id INTEGER NOT NULL,
+			org_id INTEGER NOT NULL DEFAULT 1,
+			strategy TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			experiment TEXT,
+			variant TEXT,
+			recommendations TEXT NOT NULL,
+			stored INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL
 		)
 	`)
-	statement.Exec()
+	mustExec(database, `CREATE INDEX IF NOT EXISTS idx_recommendation_history_created_at ON recommendation_history(created_at)`)
+
+	// Create pair recommendations table, holding the latest result per pair and request options
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS pair_recommendations (
+			user1_id INTEGER NOT NULL,
+			user2_id INTEGER NOT NULL,
+			params TEXT NOT NULL,
+			result TEXT NOT NULL,
+			computed_at DATETIME NOT NULL,
+			requested_at DATETIME NOT NULL,
+			PRIMARY KEY (user1_id, user2_id, params)
+		)
+	`)
+	mustExec(database, `CREATE INDEX IF NOT EXISTS idx_pair_recommendations_requested_at ON pair_recommendations(requested_at)`)
+
+	// Create webhooks table; a NULL user_id subscribes to every pair
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			user_id INTEGER,
+			created_at DATETIME NOT NULL
+		)
+	`)
+
+	// Create feature flags table; org_ids and api_key_ids are JSON arrays
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS feature_flags (
+			name TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL,
+			percentage INTEGER NOT NULL,
+			org_ids TEXT NOT NULL,
+			api_key_ids TEXT NOT NULL,
+			updated_at DATETIME NOT NULL
+		)
+	`)
+
+	// Create subject curation table: stop-listed, aliased, and blocklisted
+	// subjects, on top of the built-in ones
+	mustExec(database, createSubjectCurationTable)
+
+	// Create anonymous usage table, counting requests made without an API key
+	mustExec(database, createAnonymousUsageTable)
+
+	// Create subject translations table, mapping canonical Open Library subjects to display names
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS subject_translations (
+			subject TEXT NOT NULL,
+			lang TEXT NOT NULL,
+			name TEXT NOT NULL,
+			PRIMARY KEY (subject, lang)
+		)
+	`)
+
+	// Create audit log table
+	mustExec(database, `
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY,
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			params TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			created_at DATETIME NOT NULL
+		)
+	`)
+	mustExec(database, `CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`)
+
+	// Insert the default organization, which owns users created without a tenant
+	mustExec(database, `
+		INSERT INTO organizations(id, name, slug, created_at) VALUES (?, ?, ?, ?)
+	`, DefaultOrganizationID, "Default", "default", time.Now().UTC())
+
+	// Insert translations of common subjects
+	statement, err := database.Prepare(`
+		INSERT INTO subject_translations(subject, lang, name) VALUES (?, ?, ?)
+	`)
+	if err != nil {
+		log.Fatalf("Error setting up database: %v", err)
+	}
+	defer statement.Close()
+	for subject, names := range subjectTranslations {
+		for lang, name := range names {
+			if _, err := statement.Exec(subject, lang, name); err != nil {
+				log.Printf("Error inserting translation of subject '%s': %v", subject, err)
+			}
+		}
+	}
 
 	// Insert sample users
 	log.Println("Inserting sample users...")
-	statement, _ = database.Prepare(`
-		INSERT INTO users(username, fauthors) VALUES (?, ?)
-	`)
-	statement.Exec("Sandra", "Andy Weir; Brandon Sanderson; Arthur C. Clarke; Ursula K. Le Guin; H.G. Wells")
-	statement.Exec("JDoe", "George R. R. Martin; Robert Jordan; Neil Gaiman; Robin Hobb; Steven Erikson")
-	statement.Exec("NonFicFan3", "Patrick Radden Keefe; Jon Krakauer; David Grann; Charles Montgomery; Jeff Speck")
-	statement.Exec("test1", "Herman Hesse; Fyodor Dostoevsky; Kurt Vonnegut; Philip K. Dick; Ernest Hemmingway")
-	statement.Exec("test2", "Sarah J. Maas; Kevin Kwan; Deborah Harkness; Mitch Albom")
-	statement.Exec("EdgeCase1", "Silver Surfer")
-	statement.Exec("EdgeCase2", "Andy Weir")
+	if _, err := ImportUsers(database, DefaultOrganizationID, []NewUser{
+		sampleUser("Sandra", "Andy Weir; Brandon Sanderson; Arthur C. Clarke; Ursula K. Le Guin; H.G. Wells"),
+		sampleUser("JDoe", "George R. R. Martin; Robert Jordan; Neil Gaiman; Robin Hobb; Steven Erikson"),
+		sampleUser("NonFicFan3", "Patrick Radden Keefe; Jon Krakauer; David Grann; Charles Montgomery; Jeff Speck"),
+		sampleUser("test1", "Herman Hesse; Fyodor Dostoevsky; Kurt Vonnegut; Philip K. Dick; Ernest Hemmingway"),
+		sampleUser("test2", "Sarah J. Maas; Kevin Kwan; Deborah Harkness; Mitch Albom"),
+		sampleUser("EdgeCase1", "Silver Surfer"),
+		sampleUser("EdgeCase2", "Andy Weir"),
+	}); err != nil {
+		log.Fatalf("Error inserting sample users: %v", err)
+	}
+	if err := EnsurePersonas(database); err != nil {
+		log.Fatalf("Error inserting personas: %v", err)
+	}
+
+	mustExec(database, fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion))
+}
+
+// createSubjectCurationTable creates the subject curation table, by setup
+// and by the migration that added it.
+const createSubjectCurationTable = `
+	CREATE TABLE IF NOT EXISTS subject_curation (
+		kind TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (kind, subject)
+	)
+`
+
+// createAnonymousUsageTable creates the anonymous usage table, by setup and
+// by the migration that added it.
+const createAnonymousUsageTable = `
+	CREATE TABLE IF NOT EXISTS anonymous_usage (
+		client_ip TEXT NOT NULL,
+		day TEXT NOT NULL,
+		requests INTEGER NOT NULL,
+		PRIMARY KEY (client_ip, day)
+	)
+`
+
+// mustExec runs a setup statement, stopping the server if it fails, since
+// nothing works against a partial schema.
+func mustExec(db *sql.DB, query string, args ...interface{}) {
+	if _, err := db.Exec(query, args...); err != nil {
+		log.Fatalf("Error setting up database: %v", err)
+	}
+}
+
+// subjectTranslations are the built-in display names of common subjects, by language.
+var subjectTranslations = map[string]map[string]string{
+	"fiction":             {"es": "ficción", "fr": "fiction", "de": "Belletristik"},
+	"science fiction":     {"es": "ciencia ficción", "fr": "science-fiction", "de": "Science-Fiction"},
+	"fantasy":             {"es": "fantasía", "fr": "fantasy", "de": "Fantasy"},
+	"fantasy fiction":     {"es": "ficción fantástica", "fr": "fiction fantastique", "de": "Fantasyliteratur"},
+	"mystery":             {"es": "misterio", "fr": "mystère", "de": "Krimi"},
+	"romance":             {"es": "novela romántica", "fr": "romance", "de": "Liebesroman"},
+	"historical fiction":  {"es": "novela histórica", "fr": "roman historique", "de": "historischer Roman"},
+	"biography":           {"es": "biografía", "fr": "biographie", "de": "Biografie"},
+	"history":             {"es": "historia", "fr": "histoire", "de": "Geschichte"},
+	"adventure":           {"es": "aventura", "fr": "aventure", "de": "Abenteuer"},
+	"space":               {"es": "espacio", "fr": "espace", "de": "Weltraum"},
+	"horror":              {"es": "terror", "fr": "horreur", "de": "Horror"},
+	"thriller":            {"es": "suspense", "fr": "thriller", "de": "Thriller"},
+	"young adult fiction": {"es": "literatura juvenil", "fr": "littérature jeunesse", "de": "Jugendliteratur"},
+	"true crime":          {"es": "crímenes reales", "fr": "faits divers", "de": "True Crime"},
+	"urban planning":      {"es": "urbanismo", "fr": "urbanisme", "de": "Stadtplanung"},
+	"philosophy":          {"es": "filosofía", "fr": "philosophie", "de": "Philosophie"},
+	"poetry":              {"es": "poesía", "fr": "poésie", "de": "Lyrik"},
+}
+
+// sampleUser builds a sample user from their semicolon-separated favorite authors.
+func sampleUser(username, fauthors string) NewUser {
+	return NewUser{Username: username, FavoriteAuthors: strings.Split(fauthors, ";")}
+}
+
+// GetUserFavoriteAuthors retrieves the names of up to limit favorite authors
+// for a given user ID.
+func GetUserFavoriteAuthors(db *sql.DB, userID, limit int) ([]string, error) {
+	favorites, err := GetUserFavorites(db, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	var authors []string
+	for _, favorite := range favorites {
+		authors = append(authors, favorite.Name)
+	}
+	return authors, nil
 }
 
-// GetUserFavoriteAuthors retrieves up to five favorite authors for a given user ID.
-func GetUserFavoriteAuthors(db *sql.DB, userID int) ([]string, error) {
-	row := db.QueryRow("SELECT fauthors FROM users WHERE id = ?", userID)
-	var fauthors string
-	err := row.Scan(&fauthors)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("User ID %d not found", userID)
-	} else if err != nil {
+// GetAllFavoriteAuthors returns up to limit favorite authors of every user,
+// without duplicates.
+func GetAllFavoriteAuthors(db *sql.DB, limit int) ([]string, error) {
+	rows, err := db.Query("SELECT id FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	// Split and trim authors
-	authors := strings.Split(fauthors, ";")
-	var trimmedAuthors []string
-	for i, author := range authors {
-		if i >= 5 {
-			break
+	var authors []string
+	seen := make(map[string]bool)
+	for _, id := range userIDs {
+		favorites, err := GetUserFavoriteAuthors(db, id, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, author := range favorites {
+			if key := strings.ToLower(author); !seen[key] {
+				seen[key] = true
+				authors = append(authors, author)
+			}
 		}
-		trimmedAuthors = append(trimmedAuthors, strings.TrimSpace(author))
 	}
-	return trimmedAuthors, nil
-}
\ No newline at end of file
+	return authors, nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+// MaxFavoriteAuthors is how many favorite authors a user may have. How many
+// of them recommendations use is configured separately.
+const MaxFavoriteAuthors = 50
+
+// FavoriteAuthor is one of a user's favorite authors and, once resolved, the
+// author's Open Library key and work count.
+type FavoriteAuthor struct {
+	Name       string
+	Key        string
+	WorkCount  int
+	ResolvedAt time.Time // Zero until the author has been resolved
+}
+
+// Fresh reports whether the author was resolved within the last ttl.
+func (f FavoriteAuthor) Fresh(ttl time.Duration) bool {
+	return f.Key != "" && clock.Since(f.ResolvedAt) < ttl
+}
+
+// GetUserFavorites retrieves up to limit favorite authors for a given user
+// ID, in the user's order.
+func GetUserFavorites(db *sql.DB, userID, limit int) ([]FavoriteAuthor, error) {
+	return New(db).GetUserFavorites(context.Background(), userID, limit)
+}
+
+// CountUserFavorites returns how many favorite authors a user has.
+func CountUserFavorites(db *sql.DB, userID int) (int, error) {
+	return New(db).CountUserFavorites(context.Background(), userID)
+}
+
+// SaveAuthorResolution records the key and work count an author name resolved
+// to, for every user who lists that author.
+func SaveAuthorResolution(db *sql.DB, name, key string, workCount int) error {
+	return New(db).SaveAuthorResolution(context.Background(), name, key, workCount)
+}
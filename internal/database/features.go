@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// FeatureFlag is the stored rollout of a feature. An enabled flag is on for
+// the listed organizations and API keys, and for Percentage percent of
+// everyone else.
+type FeatureFlag struct {
+	Name       string    `json:"name"`
+	Enabled    bool      `json:"enabled"`
+	Percentage int       `json:"percentage"`
+	OrgIDs     []int     `json:"org_ids"`
+	APIKeyIDs  []int     `json:"api_key_ids"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SaveFeatureFlag creates or replaces a feature flag.
+func SaveFeatureFlag(db *sql.DB, flag FeatureFlag) (FeatureFlag, error) {
+	if flag.OrgIDs == nil {
+		flag.OrgIDs = []int{}
+	}
+	if flag.APIKeyIDs == nil {
+		flag.APIKeyIDs = []int{}
+	}
+	orgIDs, err := json.Marshal(flag.OrgIDs)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	apiKeyIDs, err := json.Marshal(flag.APIKeyIDs)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+
+	flag.UpdatedAt = time.Now().UTC()
+	_, err = db.Exec(`
+		INSERT INTO feature_flags(name, enabled, percentage, org_ids, api_key_ids, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			enabled = excluded.enabled,
+			percentage = excluded.percentage,
+			org_ids = excluded.org_ids,
+			api_key_ids = excluded.api_key_ids,
+			updated_at = excluded.updated_at
+	`, flag.Name, flag.Enabled, flag.Percentage, string(orgIDs), string(apiKeyIDs), flag.UpdatedAt)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	return flag, nil
+}
+
+// ListFeatureFlags returns every stored feature flag, by name.
+func ListFeatureFlags(db *sql.DB) ([]FeatureFlag, error) {
+	rows, err := db.Query(`
+		SELECT name, enabled, percentage, org_ids, api_key_ids, updated_at
+		FROM feature_flags ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []FeatureFlag
+	for rows.Next() {
+		var (
+			flag              FeatureFlag
+			orgIDs, apiKeyIDs string
+		)
+		if err := rows.Scan(&flag.Name, &flag.Enabled, &flag.Percentage, &orgIDs, &apiKeyIDs, &flag.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(orgIDs), &flag.OrgIDs); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(apiKeyIDs), &flag.APIKeyIDs); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+// DeleteFeatureFlag removes a feature flag, reporting whether it existed.
+func DeleteFeatureFlag(db *sql.DB, name string) (bool, error) {
+	result, err := db.Exec("DELETE FROM feature_flags WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,420 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+var (
+	// ErrGroupNotFound is returned when the organization has no group with the requested ID.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrReadingListEntryNotFound is returned when a work is not on the group's reading list.
+	ErrReadingListEntryNotFound = errors.New("work not on the reading list")
+)
+
+// Group is a book club: users of one organization who read, and are
+// recommended books, together.
+type Group struct {
+	ID        int       `json:"id"`
+	OrgID     int       `json:"org_id"`
+	Name      string    `json:"name"`
+	MemberIDs []int     `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReadingListEntry is a work on a group's shared reading list, with the
+// members who voted to read it.
+type ReadingListEntry struct {
+	WorkKey string    `json:"work_key"`
+	Title   string    `json:"title"`
+	Authors []string  `json:"authors"`
+	AddedBy int       `json:"added_by,omitempty"` // Zero once the member's data is deleted
+	AddedAt time.Time `json:"added_at"`
+	// Subject and SubjectScore are the group recommendation subject the work
+	// came from and its score, when it was voted onto the list from one.
+	Subject      string  `json:"subject,omitempty"`
+	SubjectScore float64 `json:"subject_score,omitempty"`
+	Votes        int     `json:"votes"`
+	VoterIDs     []int   `json:"voter_ids"`
+}
+
+// GroupRecommendation is the latest recommendation made for a group. Result
+// is JSON encoded by the caller.
+type GroupRecommendation struct {
+	GroupID    int
+	Result     string
+	ComputedAt time.Time
+}
+
+// GroupRepository stores groups, their members, recommendations, and
+// reading lists.
+type GroupRepository interface {
+	CreateGroup(ctx context.Context, orgID int, name string, memberIDs []int) (Group, error)
+	GetGroup(ctx context.Context, orgID, groupID int) (Group, error)
+	AddGroupMember(ctx context.Context, groupID, userID int) (bool, error)
+	RemoveGroupMember(ctx context.Context, groupID, userID int) (bool, error)
+	SaveGroupRecommendation(ctx context.Context, groupID int, result string) error
+	GetGroupRecommendation(ctx context.Context, groupID int) (*GroupRecommendation, error)
+	AddReadingListEntry(ctx context.Context, groupID int, entry ReadingListEntry) error
+	GetReadingList(ctx context.Context, groupID int) ([]ReadingListEntry, error)
+	RemoveReadingListEntry(ctx context.Context, groupID int, workKey string) (bool, error)
+	VoteReadingListEntry(ctx context.Context, groupID int, workKey string, userID int) error
+	UnvoteReadingListEntry(ctx context.Context, groupID int, workKey string, userID int) (bool, error)
+}
+
+var _ GroupRepository = (*Queries)(nil)
+
+const (
+	insertGroupQuery       = "INSERT INTO groups(org_id, name, created_at) VALUES (?, ?, ?)"
+	getGroupQuery          = "SELECT id, org_id, name, created_at FROM groups WHERE id = ? AND org_id = ?"
+	groupMembersQuery      = "SELECT user_id FROM group_members WHERE group_id = ? ORDER BY joined_at, user_id"
+	addGroupMemberQuery    = "INSERT OR IGNORE INTO group_members(group_id, user_id, joined_at) VALUES (?, ?, ?)"
+	removeGroupMemberQuery = "DELETE FROM group_members WHERE group_id = ? AND user_id = ?"
+	removeMemberVotesQuery = "DELETE FROM group_reading_list_votes WHERE group_id = ? AND user_id = ?"
+	saveGroupRecQuery      = `
+		INSERT INTO group_recommendations(group_id, result, computed_at) VALUES (?, ?, ?)
+		ON CONFLICT(group_id) DO UPDATE SET result = excluded.result, computed_at = excluded.computed_at
+	`
+	getGroupRecQuery         = "SELECT result, computed_at FROM group_recommendations WHERE group_id = ?"
+	addReadingListEntryQuery = `
+		INSERT INTO group_reading_list(group_id, work_key, title, authors, added_by, added_at, subject, subject_score) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(group_id, work_key) DO UPDATE SET title = excluded.title, authors = excluded.authors,
+			subject = COALESCE(excluded.subject, subject), subject_score = COALESCE(excluded.subject_score, subject_score)
+	`
+	readingListQuery = `
+		SELECT work_key, title, authors, added_by, added_at, subject, subject_score FROM group_reading_list WHERE group_id = ?
+	`
+	readingListVotesQuery       = "SELECT work_key, user_id FROM group_reading_list_votes WHERE group_id = ? ORDER BY voted_at, user_id"
+	removeReadingListEntryQuery = "DELETE FROM group_reading_list WHERE group_id = ? AND work_key = ?"
+	removeEntryVotesQuery       = "DELETE FROM group_reading_list_votes WHERE group_id = ? AND work_key = ?"
+	readingListEntryExistsQuery = "SELECT EXISTS(SELECT 1 FROM group_reading_list WHERE group_id = ? AND work_key = ?)"
+	voteReadingListEntryQuery   = `
+		INSERT OR IGNORE INTO group_reading_list_votes(group_id, work_key, user_id, voted_at) VALUES (?, ?, ?, ?)
+	`
+	unvoteReadingListEntryQuery = "DELETE FROM group_reading_list_votes WHERE group_id = ? AND work_key = ? AND user_id = ?"
+)
+
+// CreateGroup adds a group with its initial members, which must belong to
+// the organization, returning it with its ID set.
+func CreateGroup(db *sql.DB, orgID int, name string, memberIDs []int) (Group, error) {
+	return New(db).CreateGroup(context.Background(), orgID, name, memberIDs)
+}
+
+// CreateGroup adds a group with its initial members, which must belong to
+// the organization, returning it with its ID set.
+func (q *Queries) CreateGroup(ctx context.Context, orgID int, name string, memberIDs []int) (Group, error) {
+	group := Group{OrgID: orgID, Name: name, MemberIDs: []int{}, CreatedAt: clock.Now().UTC()}
+	err := q.inTx(ctx, func(q *Queries) error {
+		result, err := q.exec(ctx, insertGroupQuery, orgID, name, group.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		group.ID = int(id)
+
+		for _, userID := range memberIDs {
+			if _, err := q.exec(ctx, addGroupMemberQuery, group.ID, userID, group.CreatedAt); err != nil {
+				return err
+			}
+		}
+		group.MemberIDs, err = q.groupMembers(ctx, group.ID)
+		return err
+	})
+	if err != nil {
+		return Group{}, err
+	}
+	return group, nil
+}
+
+// GetGroup returns one of the organization's groups with its members.
+func GetGroup(db *sql.DB, orgID, groupID int) (Group, error) {
+	return New(db).GetGroup(context.Background(), orgID, groupID)
+}
+
+// GetGroup returns one of the organization's groups with its members.
+func (q *Queries) GetGroup(ctx context.Context, orgID, groupID int) (Group, error) {
+	var group Group
+	err := q.queryRow(ctx, getGroupQuery, groupID, orgID).Scan(&group.ID, &group.OrgID, &group.Name, &group.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Group{}, ErrGroupNotFound
+	} else if err != nil {
+		return Group{}, err
+	}
+	group.MemberIDs, err = q.groupMembers(ctx, groupID)
+	return group, err
+}
+
+// groupMembers returns the IDs of a group's members, in the order they joined.
+func (q *Queries) groupMembers(ctx context.Context, groupID int) ([]int, error) {
+	rows, err := q.query(ctx, groupMembersQuery, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberIDs := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		memberIDs = append(memberIDs, userID)
+	}
+	return memberIDs, rows.Err()
+}
+
+// AddGroupMember adds a user to a group, reporting whether they were not
+// already a member.
+func AddGroupMember(db *sql.DB, groupID, userID int) (bool, error) {
+	return New(db).AddGroupMember(context.Background(), groupID, userID)
+}
+
+// AddGroupMember adds a user to a group, reporting whether they were not
+// already a member.
+func (q *Queries) AddGroupMember(ctx context.Context, groupID, userID int) (bool, error) {
+	result, err := q.exec(ctx, addGroupMemberQuery, groupID, userID, clock.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RemoveGroupMember removes a user from a group along with their votes,
+// reporting whether they were a member.
+func RemoveGroupMember(db *sql.DB, groupID, userID int) (bool, error) {
+	return New(db).RemoveGroupMember(context.Background(), groupID, userID)
+}
+
+// RemoveGroupMember removes a user from a group along with their votes,
+// reporting whether they were a member.
+func (q *Queries) RemoveGroupMember(ctx context.Context, groupID, userID int) (bool, error) {
+	var removed bool
+	err := q.inTx(ctx, func(q *Queries) error {
+		result, err := q.exec(ctx, removeGroupMemberQuery, groupID, userID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		if _, err := q.exec(ctx, removeMemberVotesQuery, groupID, userID); err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	})
+	return removed, err
+}
+
+// SaveGroupRecommendation stores a group's latest recommendation, replacing
+// the one before it.
+func SaveGroupRecommendation(db *sql.DB, groupID int, result string) error {
+	return New(db).SaveGroupRecommendation(context.Background(), groupID, result)
+}
+
+// SaveGroupRecommendation stores a group's latest recommendation, replacing
+// the one before it.
+func (q *Queries) SaveGroupRecommendation(ctx context.Context, groupID int, result string) error {
+	_, err := q.exec(ctx, saveGroupRecQuery, groupID, result, clock.Now().UTC())
+	return err
+}
+
+// GetGroupRecommendation returns a group's latest recommendation, or nil if
+// it has never been recommended books.
+func GetGroupRecommendation(db *sql.DB, groupID int) (*GroupRecommendation, error) {
+	return New(db).GetGroupRecommendation(context.Background(), groupID)
+}
+
+// GetGroupRecommendation returns a group's latest recommendation, or nil if
+// it has never been recommended books.
+func (q *Queries) GetGroupRecommendation(ctx context.Context, groupID int) (*GroupRecommendation, error) {
+	rec := GroupRecommendation{GroupID: groupID}
+	err := q.queryRow(ctx, getGroupRecQuery, groupID).Scan(&rec.Result, &rec.ComputedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// AddReadingListEntry puts a work on a group's reading list, updating its
+// title, authors, and any subject if it is already there.
+func AddReadingListEntry(db *sql.DB, groupID int, entry ReadingListEntry) error {
+	return New(db).AddReadingListEntry(context.Background(), groupID, entry)
+}
+
+// AddReadingListEntry puts a work on a group's reading list, updating its
+// title, authors, and any subject if it is already there.
+func (q *Queries) AddReadingListEntry(ctx context.Context, groupID int, entry ReadingListEntry) error {
+	authors, err := json.Marshal(entry.Authors)
+	if err != nil {
+		return fmt.Errorf("error encoding authors: %v", err)
+	}
+	addedBy := sql.NullInt64{Int64: int64(entry.AddedBy), Valid: entry.AddedBy != 0}
+	subject := sql.NullString{String: entry.Subject, Valid: entry.Subject != ""}
+	score := sql.NullFloat64{Float64: entry.SubjectScore, Valid: entry.Subject != ""}
+	_, err = q.exec(ctx, addReadingListEntryQuery, groupID, entry.WorkKey, entry.Title, string(authors), addedBy, clock.Now().UTC(), subject, score)
+	return err
+}
+
+// GetReadingList returns a group's reading list, most voted first. Ties go to
+// the work from the higher scoring recommendation subject, and then to the
+// work added first.
+func GetReadingList(db *sql.DB, groupID int) ([]ReadingListEntry, error) {
+	return New(db).GetReadingList(context.Background(), groupID)
+}
+
+// GetReadingList returns a group's reading list, most voted first. Ties go to
+// the work from the higher scoring recommendation subject, and then to the
+// work added first.
+func (q *Queries) GetReadingList(ctx context.Context, groupID int) ([]ReadingListEntry, error) {
+	rows, err := q.query(ctx, readingListQuery, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ReadingListEntry{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var (
+			entry   ReadingListEntry
+			authors string
+			addedBy sql.NullInt64
+			subject sql.NullString
+			score   sql.NullFloat64
+		)
+		if err := rows.Scan(&entry.WorkKey, &entry.Title, &authors, &addedBy, &entry.AddedAt, &subject, &score); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(authors), &entry.Authors); err != nil {
+			return nil, fmt.Errorf("error decoding authors of reading list entry %s: %v", entry.WorkKey, err)
+		}
+		entry.AddedBy = int(addedBy.Int64)
+		entry.Subject = subject.String
+		entry.SubjectScore = score.Float64
+		entry.VoterIDs = []int{}
+		index[entry.WorkKey] = len(entries)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Attach the votes in a single query rather than one per entry
+	voteRows, err := q.query(ctx, readingListVotesQuery, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer voteRows.Close()
+	for voteRows.Next() {
+		var (
+			workKey string
+			userID  int
+		)
+		if err := voteRows.Scan(&workKey, &userID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[workKey]; ok {
+			entries[i].VoterIDs = append(entries[i].VoterIDs, userID)
+			entries[i].Votes++
+		}
+	}
+	if err := voteRows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return readingListBefore(entries[i], entries[j]) })
+	return entries, nil
+}
+
+// readingListBefore orders entries most voted first, then by subject score,
+// then earliest added.
+func readingListBefore(a, b ReadingListEntry) bool {
+	if a.Votes != b.Votes {
+		return a.Votes > b.Votes
+	}
+	if a.SubjectScore != b.SubjectScore {
+		return a.SubjectScore > b.SubjectScore
+	}
+	if !a.AddedAt.Equal(b.AddedAt) {
+		return a.AddedAt.Before(b.AddedAt)
+	}
+	return a.WorkKey < b.WorkKey
+}
+
+// RemoveReadingListEntry takes a work, and its votes, off a group's reading
+// list, reporting whether it was there.
+func RemoveReadingListEntry(db *sql.DB, groupID int, workKey string) (bool, error) {
+	return New(db).RemoveReadingListEntry(context.Background(), groupID, workKey)
+}
+
+// RemoveReadingListEntry takes a work, and its votes, off a group's reading
+// list, reporting whether it was there.
+func (q *Queries) RemoveReadingListEntry(ctx context.Context, groupID int, workKey string) (bool, error) {
+	var removed bool
+	err := q.inTx(ctx, func(q *Queries) error {
+		result, err := q.exec(ctx, removeReadingListEntryQuery, groupID, workKey)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+		if _, err := q.exec(ctx, removeEntryVotesQuery, groupID, workKey); err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	})
+	return removed, err
+}
+
+// VoteReadingListEntry records a member's vote to read a work on the group's
+// reading list. Voting again has no further effect.
+func VoteReadingListEntry(db *sql.DB, groupID int, workKey string, userID int) error {
+	return New(db).VoteReadingListEntry(context.Background(), groupID, workKey, userID)
+}
+
+// VoteReadingListEntry records a member's vote to read a work on the group's
+// reading list. Voting again has no further effect.
+func (q *Queries) VoteReadingListEntry(ctx context.Context, groupID int, workKey string, userID int) error {
+	var exists bool
+	if err := q.queryRow(ctx, readingListEntryExistsQuery, groupID, workKey).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrReadingListEntryNotFound
+	}
+	_, err := q.exec(ctx, voteReadingListEntryQuery, groupID, workKey, userID, clock.Now().UTC())
+	return err
+}
+
+// UnvoteReadingListEntry withdraws a member's vote, reporting whether they had voted.
+func UnvoteReadingListEntry(db *sql.DB, groupID int, workKey string, userID int) (bool, error) {
+	return New(db).UnvoteReadingListEntry(context.Background(), groupID, workKey, userID)
+}
+
+// UnvoteReadingListEntry withdraws a member's vote, reporting whether they had voted.
+func (q *Queries) UnvoteReadingListEntry(ctx context.Context, groupID int, workKey string, userID int) (bool, error) {
+	result, err := q.exec(ctx, unvoteReadingListEntryQuery, groupID, workKey, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
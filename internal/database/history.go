@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/models"
+)
+
+// HistoryEntry describes one recommendation response served to a user pair.
+type HistoryEntry struct {
+	User1ID         int
+	User2ID         int
+	OrgID           int
+	Strategy        string
+	Subject         string
+	Experiment      string
+	Variant         string
+	Recommendations []models.Work
+	// Stored is set when a stored recommendation was served instead of
+	// computing one.
+	Stored bool
+}
+
+// HistoryRepository records the recommendations served.
+type HistoryRepository interface {
+	RecordRecommendation(ctx context.Context, entry HistoryEntry) error
+}
+
+var _ HistoryRepository = (*Queries)(nil)
+
+const recordRecommendationQuery = `
+	INSERT INTO recommendation_history(user1_id, user2_id, org_id, strategy, subject, experiment, variant, recommendations, stored, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// RecordRecommendation appends a served recommendation to the history table.
+func RecordRecommendation(db *sql.DB, entry HistoryEntry) error {
+	return New(db).RecordRecommendation(context.Background(), entry)
+}
+
+// RecordRecommendation appends a served recommendation to the history table.
+func (q *Queries) RecordRecommendation(ctx context.Context, entry HistoryEntry) error {
+	encoded, err := json.Marshal(entry.Recommendations)
+	if err != nil {
+		return err
+	}
+	_, err = q.exec(ctx, recordRecommendationQuery, entry.User1ID, entry.User2ID, entry.OrgID, entry.Strategy, entry.Subject,
+		nullString(entry.Experiment), nullString(entry.Variant), string(encoded), entry.Stored, clock.Now().UTC())
+	return err
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
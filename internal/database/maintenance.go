@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// SchemaVersion is the version of the schema SetupDatabase creates, stored in
+// the database's user_version. Bump it whenever the schema changes.
+const SchemaVersion = 6
+
+// schemaTables are the tables a database of SchemaVersion must have.
+var schemaTables = []string{
+	"organizations", "api_keys", "api_key_usage", "users", "favorite_authors", "user_profiles",
+	"user_subjects", "read_books", "groups", "group_members", "group_reading_list",
+	"group_reading_list_votes", "group_recommendations", "subscriptions", "wishlist",
+	"recommendation_history", "pair_recommendations", "webhooks", "feature_flags",
+	"subject_translations", "subject_curation", "audit_log", "anonymous_usage",
+}
+
+// migrations upgrade a database from the schema version they are keyed by to
+// the next one, so existing databases can be kept across upgrades.
+var migrations = map[int][]string{
+	1: {
+		// History recorded before stored was tracked counts as computed afresh
+		`ALTER TABLE recommendation_history ADD COLUMN stored INTEGER NOT NULL DEFAULT 0`,
+	},
+	2: {
+		// Subjects counted before author_total was stored are dropped, to be
+		// counted again with it, since confidence is scored from it
+		`ALTER TABLE user_subjects ADD COLUMN author_total INTEGER NOT NULL DEFAULT 0`,
+		`DELETE FROM user_subjects`,
+		createSubjectCurationTable,
+	},
+	3: {
+		`ALTER TABLE subscriptions ADD COLUMN failures INTEGER NOT NULL DEFAULT 0`,
+	},
+	4: {
+		// Subjects counted before work_count was stored are dropped, to be
+		// counted again with it, since ties between subjects are broken by it
+		`ALTER TABLE user_subjects ADD COLUMN work_count INTEGER NOT NULL DEFAULT 0`,
+		`DELETE FROM user_subjects`,
+	},
+	5: {
+		createAnonymousUsageTable,
+	},
+}
+
+// Migrate upgrades db to SchemaVersion one version at a time, each in its own
+// transaction. A database of a version it has no migration from is left as
+// is, for ValidateSchema to reject.
+func Migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+	for ; version < SchemaVersion; version++ {
+		statements, ok := migrations[version]
+		if !ok {
+			return nil
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, statement := range append(statements, fmt.Sprintf("PRAGMA user_version = %d", version+1)) {
+			if _, err := tx.Exec(statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error migrating schema version %d: %v", version, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error migrating schema version %d: %v", version, err)
+		}
+		log.Printf("Migrated database schema from version %d to %d", version, version+1)
+	}
+	return nil
+}
+
+// ValidateSchema checks that the database is at SchemaVersion and has every
+// table of that version, so the server never runs against a schema it does
+// not understand.
+func ValidateSchema(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("database schema is version %d, expected %d", version, SchemaVersion)
+	}
+	for _, table := range schemaTables {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", table).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking table %s: %v", table, err)
+		}
+		if !exists {
+			return fmt.Errorf("database schema version %d is missing table %s", version, table)
+		}
+	}
+	return nil
+}
+
+// Checkpoint copies the write-ahead log into the database file and truncates
+// it, returning how many log pages were checkpointed. It reports busy when
+// readers or writers kept it from completing; the next checkpoint catches up.
+func Checkpoint(db *sql.DB) (pages int, busy bool, err error) {
+	var blocked, logPages int
+	if err := db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&blocked, &logPages, &pages); err != nil {
+		return 0, false, err
+	}
+	return pages, blocked != 0, nil
+}
+
+// Vacuum rebuilds the database file, returning the space freed by deletions
+// to the file system.
+func Vacuum(db *sql.DB) error {
+	_, err := db.Exec("VACUUM")
+	return err
+}
+
+// IntegrityCheck runs SQLite's integrity check, returning the problems it
+// found, or none when the database is sound.
+func IntegrityCheck(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// DefaultOrganizationID is the organization of requests that name no tenant.
+const DefaultOrganizationID = 1
+
+// apiKeyPrefix marks API keys so they are recognizable in logs and secret scanners.
+const apiKeyPrefix = "bk_"
+
+var (
+	// ErrOrganizationNotFound is returned when no organization matches.
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrAPIKeyNotFound is returned for unknown or revoked API keys.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// Organization is a tenant: a book club or company whose users are kept apart
+// from every other organization's.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey identifies a client of an organization. The key itself is only
+// known when created; the database stores its hash.
+type APIKey struct {
+	ID    int    `json:"id"`
+	OrgID int    `json:"org_id"`
+	Name  string `json:"name"`
+	// DailyQuota overrides the configured daily request quota when non-nil.
+	DailyQuota *int `json:"daily_quota,omitempty"`
+	// Premium keys may draw on more of each user's favorite authors.
+	Premium   bool       `json:"premium"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateOrganization adds an organization, returning it with its ID set.
+func CreateOrganization(db *sql.DB, name, slug string) (Organization, error) {
+	org := Organization{Name: name, Slug: slug, CreatedAt: time.Now().UTC()}
+	result, err := db.Exec("INSERT INTO organizations(name, slug, created_at) VALUES (?, ?, ?)", org.Name, org.Slug, org.CreatedAt)
+	if err != nil {
+		return Organization{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Organization{}, err
+	}
+	org.ID = int(id)
+	return org, nil
+}
+
+// ListOrganizations returns every organization, oldest first.
+func ListOrganizations(db *sql.DB) ([]Organization, error) {
+	rows, err := db.Query("SELECT id, name, slug, created_at FROM organizations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		var org Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetOrganization returns the organization with the given ID.
+func GetOrganization(db *sql.DB, orgID int) (Organization, error) {
+	return scanOrganization(db.QueryRow("SELECT id, name, slug, created_at FROM organizations WHERE id = ?", orgID))
+}
+
+// GetOrganizationBySlug returns the organization with the given slug.
+func GetOrganizationBySlug(db *sql.DB, slug string) (Organization, error) {
+	return scanOrganization(db.QueryRow("SELECT id, name, slug, created_at FROM organizations WHERE slug = ?", slug))
+}
+
+func scanOrganization(row *sql.Row) (Organization, error) {
+	var org Organization
+	err := row.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Organization{}, ErrOrganizationNotFound
+	}
+	return org, err
+}
+
+// UserInOrganization reports whether the user exists and belongs to the organization.
+func UserInOrganization(db *sql.DB, userID, orgID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ? AND org_id = ?)", userID, orgID).Scan(&exists)
+	return exists, err
+}
+
+// CreateAPIKey issues a new API key for an organization, returning its record
+// and the key, which cannot be recovered later. A nil dailyQuota uses the
+// configured default.
+func CreateAPIKey(db *sql.DB, orgID int, name string, dailyQuota *int, premium bool) (APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+
+	apiKey := APIKey{OrgID: orgID, Name: name, DailyQuota: dailyQuota, Premium: premium, CreatedAt: time.Now().UTC()}
+	result, err := db.Exec("INSERT INTO api_keys(org_id, name, key_hash, daily_quota, premium, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		orgID, name, hashAPIKey(key), dailyQuota, premium, apiKey.CreatedAt)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	apiKey.ID = int(id)
+	return apiKey, key, nil
+}
+
+// LookupAPIKey returns the active API key record matching key.
+func LookupAPIKey(db *sql.DB, key string) (APIKey, error) {
+	var (
+		apiKey APIKey
+		quota  sql.NullInt64
+	)
+	err := db.QueryRow(`
+		SELECT id, org_id, name, daily_quota, premium, created_at FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL
+	`, hashAPIKey(key)).Scan(&apiKey.ID, &apiKey.OrgID, &apiKey.Name, &quota, &apiKey.Premium, &apiKey.CreatedAt)
+	if err == sql.ErrNoRows {
+		return APIKey{}, ErrAPIKeyNotFound
+	} else if err != nil {
+		return APIKey{}, err
+	}
+	if quota.Valid {
+		q := int(quota.Int64)
+		apiKey.DailyQuota = &q
+	}
+	return apiKey, nil
+}
+
+// RevokeAPIKey disables an API key, reporting whether an active key was revoked.
+func RevokeAPIKey(db *sql.DB, id int) (bool, error) {
+	result, err := db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// hashAPIKey returns the stored form of an API key. Keys are long and random,
+// so an unsalted hash is enough to keep them unusable if the database leaks.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
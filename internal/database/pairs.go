@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+// PairRecommendation is the latest stored recommendation for a user pair and
+// set of request options. Params and Result are JSON encoded by the caller.
+type PairRecommendation struct {
+	User1ID     int
+	User2ID     int
+	Params      string
+	Result      string
+	ComputedAt  time.Time
+	RequestedAt time.Time
+}
+
+// PairRepository stores the latest recommendation for each user pair and
+// set of request options.
+type PairRepository interface {
+	SavePairRecommendation(ctx context.Context, user1ID, user2ID int, params, result string) error
+	MarkPairRequested(ctx context.Context, user1ID, user2ID int, params string) error
+	GetPairRecommendation(ctx context.Context, user1ID, user2ID int, params string) (*PairRecommendation, error)
+	GetRecentlyRequestedPairs(ctx context.Context, since time.Time) ([]PairRecommendation, error)
+}
+
+var _ PairRepository = (*Queries)(nil)
+
+const (
+	savePairRecQuery = `
+		INSERT INTO pair_recommendations(user1_id, user2_id, params, result, computed_at, requested_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user1_id, user2_id, params) DO UPDATE SET result = excluded.result, computed_at = excluded.computed_at
+	`
+	markPairRequestedQuery = `
+		UPDATE pair_recommendations SET requested_at = ? WHERE user1_id = ? AND user2_id = ? AND params = ?
+	`
+	getPairRecQuery = `
+		SELECT result, computed_at, requested_at FROM pair_recommendations
+		WHERE user1_id = ? AND user2_id = ? AND params = ?
+	`
+	recentlyRequestedPairsQuery = `
+		SELECT user1_id, user2_id, params, result, computed_at, requested_at FROM pair_recommendations
+		WHERE requested_at >= ?
+		ORDER BY requested_at DESC
+	`
+)
+
+// SavePairRecommendation stores a freshly computed recommendation, replacing
+// any earlier one for the same pair and options.
+func SavePairRecommendation(db *sql.DB, user1ID, user2ID int, params, result string) error {
+	return New(db).SavePairRecommendation(context.Background(), user1ID, user2ID, params, result)
+}
+
+// SavePairRecommendation stores a freshly computed recommendation, replacing
+// any earlier one for the same pair and options.
+func (q *Queries) SavePairRecommendation(ctx context.Context, user1ID, user2ID int, params, result string) error {
+	now := clock.Now().UTC()
+	_, err := q.exec(ctx, savePairRecQuery, user1ID, user2ID, params, result, now, now)
+	return err
+}
+
+// MarkPairRequested records that a pair's stored recommendation was requested,
+// keeping it in the background refresh set.
+func MarkPairRequested(db *sql.DB, user1ID, user2ID int, params string) error {
+	return New(db).MarkPairRequested(context.Background(), user1ID, user2ID, params)
+}
+
+// MarkPairRequested records that a pair's stored recommendation was requested,
+// keeping it in the background refresh set.
+func (q *Queries) MarkPairRequested(ctx context.Context, user1ID, user2ID int, params string) error {
+	_, err := q.exec(ctx, markPairRequestedQuery, clock.Now().UTC(), user1ID, user2ID, params)
+	return err
+}
+
+// GetPairRecommendation returns the stored recommendation for a pair and
+// options, or nil if there is none.
+func GetPairRecommendation(db *sql.DB, user1ID, user2ID int, params string) (*PairRecommendation, error) {
+	return New(db).GetPairRecommendation(context.Background(), user1ID, user2ID, params)
+}
+
+// GetPairRecommendation returns the stored recommendation for a pair and
+// options, or nil if there is none.
+func (q *Queries) GetPairRecommendation(ctx context.Context, user1ID, user2ID int, params string) (*PairRecommendation, error) {
+	pair := PairRecommendation{User1ID: user1ID, User2ID: user2ID, Params: params}
+	err := q.queryRow(ctx, getPairRecQuery, user1ID, user2ID, params).Scan(&pair.Result, &pair.ComputedAt, &pair.RequestedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// GetRecentlyRequestedPairs returns the stored recommendations requested since the given time.
+func GetRecentlyRequestedPairs(db *sql.DB, since time.Time) ([]PairRecommendation, error) {
+	return New(db).GetRecentlyRequestedPairs(context.Background(), since)
+}
+
+// GetRecentlyRequestedPairs returns the stored recommendations requested since the given time.
+func (q *Queries) GetRecentlyRequestedPairs(ctx context.Context, since time.Time) ([]PairRecommendation, error) {
+	rows, err := q.query(ctx, recentlyRequestedPairsQuery, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []PairRecommendation
+	for rows.Next() {
+		var pair PairRecommendation
+		if err := rows.Scan(&pair.User1ID, &pair.User2ID, &pair.Params, &pair.Result, &pair.ComputedAt, &pair.RequestedAt); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// PersonaOrganizationSlug is the slug of the organization owning the
+// personas' users. Tenant slugs cannot start with an underscore, so no
+// tenant can claim it.
+const PersonaOrganizationSlug = "_personas"
+
+// Persona is a built-in reader with curated favorite authors, stored as a
+// synthetic user, so a single user can be paired with them.
+type Persona struct {
+	Slug            string   `json:"slug"`
+	Name            string   `json:"name"`
+	FavoriteAuthors []string `json:"favorite_authors"`
+}
+
+// Personas are the built-in personas.
+var Personas = []Persona{
+	{Slug: "classics", Name: "Classic literature", FavoriteAuthors: []string{"Jane Austen", "Charles Dickens", "Leo Tolstoy", "George Eliot", "Mark Twain"}},
+	{Slug: "hugo-judge", Name: "Hugo Award judge", FavoriteAuthors: []string{"Ursula K. Le Guin", "N. K. Jemisin", "Lois McMaster Bujold", "Connie Willis", "Isaac Asimov"}},
+	{Slug: "epic-fantasy", Name: "Epic fantasy reader", FavoriteAuthors: []string{"J. R. R. Tolkien", "Brandon Sanderson", "Robin Hobb", "Robert Jordan", "Guy Gavriel Kay"}},
+	{Slug: "true-crime", Name: "True crime reader", FavoriteAuthors: []string{"Truman Capote", "Ann Rule", "Erik Larson", "Michelle McNamara", "David Grann"}},
+}
+
+// PersonaSlugs returns the slugs of the built-in personas.
+func PersonaSlugs() []string {
+	slugs := make([]string, len(Personas))
+	for i, persona := range Personas {
+		slugs[i] = persona.Slug
+	}
+	return slugs
+}
+
+// EnsurePersonas adds the personas' organization and users unless they
+// exist, so a database kept from before personas were added has them too.
+func EnsurePersonas(db *sql.DB) error {
+	org, err := GetOrganizationBySlug(db, PersonaOrganizationSlug)
+	if errors.Is(err, ErrOrganizationNotFound) {
+		org, err = CreateOrganization(db, "Personas", PersonaOrganizationSlug)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating persona organization: %v", err)
+	}
+
+	var missing []NewUser
+	for _, persona := range Personas {
+		_, err := GetUserByUsername(db, org.ID, persona.Slug)
+		if errors.Is(err, ErrUserNotFound) {
+			missing = append(missing, NewUser{Username: persona.Slug, FavoriteAuthors: persona.FavoriteAuthors})
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if _, err := ImportUsers(db, org.ID, missing); err != nil {
+		return fmt.Errorf("error creating persona users: %v", err)
+	}
+	return nil
+}
+
+// GetPersonaUserID returns the ID of the synthetic user standing in for the
+// persona with a slug, or ErrUserNotFound if there is none.
+func GetPersonaUserID(db *sql.DB, slug string) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT u.id FROM users u JOIN organizations o ON o.id = u.org_id
+		WHERE o.slug = ? AND u.username = ?
+	`, PersonaOrganizationSlug, slug).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"be-takehome-2024/internal/models"
+)
+
+// SaveUserProfile stores a user's aggregate subject counts, replacing any previous profile.
+func SaveUserProfile(db *sql.DB, userID int, subjects models.SubjectProfile) error {
+	encoded, err := json.Marshal(subjects)
+	if err != nil {
+		return fmt.Errorf("error encoding profile for user ID %d: %v", userID, err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO user_profiles(user_id, subjects, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET subjects = excluded.subjects, updated_at = excluded.updated_at
+	`, userID, string(encoded), time.Now().UTC())
+	return err
+}
+
+// GetUserProfiles returns the stored subject counts of every profiled user in
+// an organization, keyed by user ID.
+func GetUserProfiles(db *sql.DB, orgID int) (map[int]models.SubjectProfile, error) {
+	rows, err := db.Query(`
+		SELECT p.user_id, p.subjects FROM user_profiles p
+		JOIN users u ON u.id = p.user_id
+		WHERE u.org_id = ?
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make(map[int]models.SubjectProfile)
+	for rows.Next() {
+		var (
+			userID  int
+			encoded string
+		)
+		if err := rows.Scan(&userID, &encoded); err != nil {
+			return nil, err
+		}
+		var subjects models.SubjectProfile
+		if err := json.Unmarshal([]byte(encoded), &subjects); err != nil {
+			return nil, fmt.Errorf("error decoding profile for user ID %d: %v", userID, err)
+		}
+		profiles[userID] = subjects
+	}
+	return profiles, rows.Err()
+}
+
+// DeleteUserProfile removes a user's stored profile and materialized subject
+// counts, reporting whether a profile existed.
+func DeleteUserProfile(db *sql.DB, userID int) (bool, error) {
+	if _, err := db.Exec("DELETE FROM user_subjects WHERE user_id = ?", userID); err != nil {
+		return false, err
+	}
+	result, err := db.Exec("DELETE FROM user_profiles WHERE user_id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"be-takehome-2024/internal/clock"
+)
+
+// DBTX is what queries run against: a database, a connection, or a
+// transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// UserRepository reads users and their favorite authors, and records what
+// the authors resolved to.
+type UserRepository interface {
+	UserExists(ctx context.Context, userID int) (bool, error)
+	GetUser(ctx context.Context, userID int) (UserRecord, error)
+	GetUserByUsername(ctx context.Context, orgID int, username string) (UserRecord, error)
+	GetUserFavorites(ctx context.Context, userID, limit int) ([]FavoriteAuthor, error)
+	CountUserFavorites(ctx context.Context, userID int) (int, error)
+	SaveAuthorResolution(ctx context.Context, name, key string, workCount int) error
+}
+
+var _ UserRepository = (*Queries)(nil)
+
+const (
+	userExistsQuery        = "SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)"
+	getUserQuery           = "SELECT id, org_id, username, version FROM users WHERE id = ?"
+	userIDByUsernameQuery  = "SELECT id FROM users WHERE org_id = ? AND username = ? COLLATE NOCASE"
+	favoriteNamesQuery     = "SELECT name FROM favorite_authors WHERE user_id = ? ORDER BY position"
+	countUserFavoriteQuery = "SELECT COUNT(*) FROM favorite_authors WHERE user_id = ? AND name != ''"
+	userFavoritesQuery     = `
+		SELECT name, author_key, work_count, resolved_at
+		FROM favorite_authors
+		WHERE user_id = ? AND name != ''
+		ORDER BY position
+		LIMIT ?
+	`
+	saveAuthorResolutionQuery = `
+		UPDATE favorite_authors SET author_key = ?, work_count = ?, resolved_at = ?
+		WHERE name = ? COLLATE NOCASE
+	`
+)
+
+// preparedQueries are the queries Prepare prepares: all but those built per
+// call, such as QueryAudit's.
+var preparedQueries = []string{
+	userExistsQuery, getUserQuery, userIDByUsernameQuery, favoriteNamesQuery,
+	countUserFavoriteQuery, userFavoritesQuery, saveAuthorResolutionQuery,
+
+	insertGroupQuery, getGroupQuery, groupMembersQuery, addGroupMemberQuery,
+	removeGroupMemberQuery, removeMemberVotesQuery, saveGroupRecQuery, getGroupRecQuery,
+	addReadingListEntryQuery, readingListQuery, readingListVotesQuery, removeReadingListEntryQuery,
+	removeEntryVotesQuery, readingListEntryExistsQuery, voteReadingListEntryQuery, unvoteReadingListEntryQuery,
+
+	createSubscriptionQuery, getSubscriptionQuery, listSubscriptionsQuery, dueSubscriptionsQuery,
+	pauseSubscriptionQuery, subscriptionFailedQuery, subscriptionDeliveredQuery, deleteSubscriptionQuery,
+
+	recordRecommendationQuery,
+
+	savePairRecQuery, markPairRequestedQuery, getPairRecQuery, recentlyRequestedPairsQuery,
+
+	apiKeyUsageQuery, incrementAPIKeyUsageQuery, apiKeyUsageHistoryQuery,
+	incrementAnonymousUsageQuery, purgeAnonymousUsageQuery,
+
+	recordAuditQuery, userAuditEntriesQuery,
+}
+
+// Queries runs typed queries against a DBTX, through statements prepared
+// ahead of time when made by Prepare.
+type Queries struct {
+	db    DBTX
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt // By query; empty unless prepared
+}
+
+// New returns queries run directly against db.
+func New(db DBTX) *Queries {
+	return &Queries{db: db}
+}
+
+// Prepare returns queries run through statements prepared against db, which
+// must be closed with Close. It fails if any statement does not prepare, so
+// a query that doesn't match the schema is caught before it is run.
+func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
+	q := &Queries{db: db, stmts: make(map[string]*sql.Stmt)}
+	for _, query := range preparedQueries {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("error preparing query %q: %w", query, err), q.Close())
+		}
+		q.stmts[query] = stmt
+	}
+	return q, nil
+}
+
+// Close closes the prepared statements.
+func (q *Queries) Close() error {
+	var errs []error
+	for _, stmt := range q.stmts {
+		errs = append(errs, stmt.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// WithTx returns the queries run within tx, through the same prepared
+// statements.
+func (q *Queries) WithTx(tx *sql.Tx) *Queries {
+	return &Queries{db: tx, tx: tx, stmts: q.stmts}
+}
+
+// inTx runs fn with the queries run within a transaction, committed if fn
+// succeeds, or within the queries' own transaction if they have one.
+func (q *Queries) inTx(ctx context.Context, fn func(q *Queries) error) error {
+	if q.tx != nil {
+		return fn(q)
+	}
+	db, ok := q.db.(interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	})
+	if !ok {
+		return errors.New("queries cannot begin a transaction")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(q.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// stmt returns the prepared statement for query, bound to the transaction
+// if any, or nil if it wasn't prepared.
+func (q *Queries) stmt(ctx context.Context, query string) *sql.Stmt {
+	stmt, ok := q.stmts[query]
+	switch {
+	case !ok:
+		return nil
+	case q.tx != nil:
+		return q.tx.StmtContext(ctx, stmt)
+	default:
+		return stmt
+	}
+}
+
+func (q *Queries) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := q.stmt(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return q.db.ExecContext(ctx, query, args...)
+}
+
+func (q *Queries) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := q.stmt(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return q.db.QueryContext(ctx, query, args...)
+}
+
+func (q *Queries) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := q.stmt(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return q.db.QueryRowContext(ctx, query, args...)
+}
+
+// UserExists reports whether a user has the ID.
+func (q *Queries) UserExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := q.queryRow(ctx, userExistsQuery, userID).Scan(&exists)
+	return exists, err
+}
+
+// GetUser returns a user's row with all of their favorite authors.
+func (q *Queries) GetUser(ctx context.Context, userID int) (UserRecord, error) {
+	var user UserRecord
+	err := q.queryRow(ctx, getUserQuery, userID).Scan(&user.ID, &user.OrgID, &user.Username, &user.Version)
+	if err == sql.ErrNoRows {
+		return UserRecord{}, ErrUserNotFound
+	} else if err != nil {
+		return UserRecord{}, err
+	}
+
+	rows, err := q.query(ctx, favoriteNamesQuery, userID)
+	if err != nil {
+		return UserRecord{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var author string
+		if err := rows.Scan(&author); err != nil {
+			return UserRecord{}, err
+		}
+		user.FavoriteAuthors = append(user.FavoriteAuthors, author)
+	}
+	return user, rows.Err()
+}
+
+// GetUserByUsername returns the organization's user with a username, compared
+// case-insensitively, with all of their favorite authors.
+func (q *Queries) GetUserByUsername(ctx context.Context, orgID int, username string) (UserRecord, error) {
+	var userID int
+	err := q.queryRow(ctx, userIDByUsernameQuery, orgID, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return UserRecord{}, ErrUserNotFound
+	} else if err != nil {
+		return UserRecord{}, err
+	}
+	return q.GetUser(ctx, userID)
+}
+
+// GetUserFavorites retrieves up to limit favorite authors for a given user
+// ID, in the user's order.
+func (q *Queries) GetUserFavorites(ctx context.Context, userID, limit int) ([]FavoriteAuthor, error) {
+	exists, err := q.UserExists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("User ID %d not found", userID)
+	}
+
+	rows, err := q.query(ctx, userFavoritesQuery, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var favorites []FavoriteAuthor
+	for rows.Next() {
+		var (
+			favorite   FavoriteAuthor
+			key        sql.NullString
+			workCount  sql.NullInt64
+			resolvedAt sql.NullTime
+		)
+		if err := rows.Scan(&favorite.Name, &key, &workCount, &resolvedAt); err != nil {
+			return nil, err
+		}
+		favorite.Key = key.String
+		favorite.WorkCount = int(workCount.Int64)
+		favorite.ResolvedAt = resolvedAt.Time
+		favorites = append(favorites, favorite)
+	}
+	return favorites, rows.Err()
+}
+
+// CountUserFavorites returns how many favorite authors a user has.
+func (q *Queries) CountUserFavorites(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := q.queryRow(ctx, countUserFavoriteQuery, userID).Scan(&count)
+	return count, err
+}
+
+// SaveAuthorResolution records the key and work count an author name resolved
+// to, for every user who lists that author.
+func (q *Queries) SaveAuthorResolution(ctx context.Context, name, key string, workCount int) error {
+	_, err := q.exec(ctx, saveAuthorResolutionQuery, key, workCount, clock.Now().UTC(), name)
+	return err
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ReadBook is a work a user has logged as read.
+type ReadBook struct {
+	WorkKey    string    `json:"work_key"`
+	FinishedOn string    `json:"finished_on,omitempty"` // YYYY-MM-DD, if given
+	Rating     *int      `json:"rating,omitempty"`      // 1 to 5, if given
+	LoggedAt   time.Time `json:"logged_at"`
+}
+
+// SaveReadBook logs a work as read by a user, replacing any earlier entry
+// for it. The user's stored recommendations are dropped so the work is not
+// served to them again. LoggedAt is set to now.
+func SaveReadBook(db *sql.DB, userID int, book ReadBook) (ReadBook, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return ReadBook{}, err
+	}
+	defer tx.Rollback()
+
+	book.LoggedAt = time.Now().UTC()
+	var finishedOn sql.NullString
+	if book.FinishedOn != "" {
+		finishedOn = sql.NullString{String: book.FinishedOn, Valid: true}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO read_books(user_id, work_key, finished_on, rating, logged_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, work_key) DO UPDATE SET finished_on = excluded.finished_on, rating = excluded.rating, logged_at = excluded.logged_at
+	`, userID, book.WorkKey, finishedOn, book.Rating, book.LoggedAt)
+	if err != nil {
+		return ReadBook{}, err
+	}
+	if _, err := tx.Exec("DELETE FROM pair_recommendations WHERE user1_id = ? OR user2_id = ?", userID, userID); err != nil {
+		return ReadBook{}, err
+	}
+	return book, tx.Commit()
+}
+
+// ListReadBooks returns the works a user has logged as read, most recently
+// logged first.
+func ListReadBooks(db *sql.DB, userID int) ([]ReadBook, error) {
+	rows, err := db.Query(`
+		SELECT work_key, finished_on, rating, logged_at FROM read_books WHERE user_id = ? ORDER BY logged_at DESC, work_key
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []ReadBook{}
+	for rows.Next() {
+		var (
+			book       ReadBook
+			finishedOn sql.NullString
+			rating     sql.NullInt64
+		)
+		if err := rows.Scan(&book.WorkKey, &finishedOn, &rating, &book.LoggedAt); err != nil {
+			return nil, err
+		}
+		book.FinishedOn = finishedOn.String
+		if rating.Valid {
+			r := int(rating.Int64)
+			book.Rating = &r
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// DeleteReadBook removes a work from a user's read books, reporting whether
+// it was there. The user's stored recommendations are dropped so the work
+// can be served to them again.
+func DeleteReadBook(db *sql.DB, userID int, workKey string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM read_books WHERE user_id = ? AND work_key = ?", userID, workKey)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM pair_recommendations WHERE user1_id = ? OR user2_id = ?", userID, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// GetReadWorkKeys returns the keys of every work any of the users has read.
+func GetReadWorkKeys(db *sql.DB, userIDs ...int) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	for _, userID := range userIDs {
+		rows, err := db.Query("SELECT work_key FROM read_books WHERE user_id = ?", userID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			keys[key] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
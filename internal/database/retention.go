@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// purgeBatchSize bounds the rows deleted per statement, so a large purge does
+// not hold the write lock for long.
+const purgeBatchSize = 1000
+
+// PurgeHistory deletes recommendation history served before the cutoff,
+// returning how many entries were removed.
+func PurgeHistory(db *sql.DB, before time.Time) (int64, error) {
+	return purgeBatched(db, "recommendation_history", "created_at", before)
+}
+
+// PurgeAudit deletes audit entries recorded before the cutoff, returning how
+// many were removed.
+func PurgeAudit(db *sql.DB, before time.Time) (int64, error) {
+	return purgeBatched(db, "audit_log", "created_at", before)
+}
+
+// PurgePairRecommendations deletes stored pair recommendations last requested
+// before the cutoff, returning how many were removed. Pairs requested again
+// are simply recomputed.
+func PurgePairRecommendations(db *sql.DB, before time.Time) (int64, error) {
+	return purgeBatched(db, "pair_recommendations", "requested_at", before)
+}
+
+// purgeBatched deletes the table's rows whose time column is before the
+// cutoff, a batch at a time. The table and column are never user input.
+func purgeBatched(db *sql.DB, table, column string, before time.Time) (int64, error) {
+	var total int64
+	for {
+		result, err := db.Exec(`
+			DELETE FROM `+table+` WHERE rowid IN (SELECT rowid FROM `+table+` WHERE `+column+` < ? LIMIT ?)
+		`, before, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Kinds of subject curation rule.
+const (
+	// SubjectStop drops a subject too generic or noisy to match users on.
+	SubjectStop = "stop"
+	// SubjectAlias counts a subject as its Target.
+	SubjectAlias = "alias"
+	// SubjectBlock drops a subject and never recommends books carrying it.
+	SubjectBlock = "block"
+)
+
+// SubjectRule is a stored curation rule for a lowercase subject. A disabled
+// rule cancels the built-in one for the subject.
+type SubjectRule struct {
+	Kind      string    `json:"kind"`
+	Subject   string    `json:"subject"`
+	Target    string    `json:"target,omitempty"` // The subject an alias stands for
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveSubjectRule creates or replaces a subject curation rule.
+func SaveSubjectRule(db *sql.DB, rule SubjectRule) (SubjectRule, error) {
+	rule.UpdatedAt = time.Now().UTC()
+	_, err := db.Exec(`
+		INSERT INTO subject_curation(kind, subject, target, enabled, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, subject) DO UPDATE SET
+			target = excluded.target,
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at
+	`, rule.Kind, rule.Subject, rule.Target, rule.Enabled, rule.UpdatedAt)
+	if err != nil {
+		return SubjectRule{}, err
+	}
+	return rule, nil
+}
+
+// ListSubjectRules returns every stored subject curation rule, by kind and subject.
+func ListSubjectRules(db *sql.DB) ([]SubjectRule, error) {
+	rows, err := db.Query(`
+		SELECT kind, subject, target, enabled, updated_at
+		FROM subject_curation ORDER BY kind, subject
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []SubjectRule
+	for rows.Next() {
+		var rule SubjectRule
+		if err := rows.Scan(&rule.Kind, &rule.Subject, &rule.Target, &rule.Enabled, &rule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// DeleteSubjectRule removes a subject curation rule, reporting whether it existed.
+func DeleteSubjectRule(db *sql.DB, kind, subject string) (bool, error) {
+	result, err := db.Exec("DELETE FROM subject_curation WHERE kind = ? AND subject = ?", kind, subject)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
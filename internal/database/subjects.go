@@ -0,0 +1,38 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// GetSubjectNames returns the display names of subjects in lang, keyed by
+// canonical subject. Subjects without a translation are returned unchanged.
+func GetSubjectNames(db *sql.DB, lang string, subjects []string) (map[string]string, error) {
+	names := make(map[string]string, len(subjects))
+	if len(subjects) == 0 {
+		return names, nil
+	}
+
+	args := []interface{}{lang}
+	for _, subject := range subjects {
+		names[subject] = subject
+		args = append(args, subject)
+	}
+	rows, err := db.Query(`
+		SELECT subject, name FROM subject_translations
+		WHERE lang = ? AND subject IN (?`+strings.Repeat(", ?", len(subjects)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subject, name string
+		if err := rows.Scan(&subject, &name); err != nil {
+			return nil, err
+		}
+		names[subject] = name
+	}
+	return names, rows.Err()
+}
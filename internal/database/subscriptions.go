@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+// ErrSubscriptionNotFound is returned when the organization has no
+// subscription with the requested ID.
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// Subscription delivers fresh recommendations for a user pair or a group to
+// a callback URL on a recurring schedule. Exactly one of User1ID and User2ID
+// or GroupID is set.
+type Subscription struct {
+	ID        int        `json:"id"`
+	OrgID     int        `json:"org_id"`
+	User1ID   int        `json:"user1_id,omitempty"`
+	User2ID   int        `json:"user2_id,omitempty"`
+	GroupID   int        `json:"group_id,omitempty"`
+	Cadence   string     `json:"cadence"`
+	URL       string     `json:"url"`
+	Secret    string     `json:"-"`
+	Paused    bool       `json:"paused"`
+	NextRunAt time.Time  `json:"next_run_at"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	// Failures counts the runs that failed since the last delivery.
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const subscriptionColumns = "id, org_id, user1_id, user2_id, group_id, cadence, url, secret, paused, next_run_at, last_run_at, failures, created_at"
+
+// SubscriptionRepository stores subscriptions and when they run.
+type SubscriptionRepository interface {
+	CreateSubscription(ctx context.Context, sub Subscription) (Subscription, error)
+	GetSubscription(ctx context.Context, orgID, id int) (Subscription, error)
+	ListSubscriptions(ctx context.Context, orgID int) ([]Subscription, error)
+	GetDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error)
+	SetSubscriptionPaused(ctx context.Context, orgID, id int, paused bool) (Subscription, error)
+	ScheduleSubscription(ctx context.Context, id int, nextRunAt time.Time, ranAt *time.Time) error
+	DeleteSubscription(ctx context.Context, orgID, id int) (bool, error)
+}
+
+var _ SubscriptionRepository = (*Queries)(nil)
+
+const (
+	createSubscriptionQuery = `
+		INSERT INTO subscriptions(org_id, user1_id, user2_id, group_id, cadence, url, secret, paused, next_run_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	getSubscriptionQuery       = "SELECT " + subscriptionColumns + " FROM subscriptions WHERE id = ? AND org_id = ?"
+	listSubscriptionsQuery     = "SELECT " + subscriptionColumns + " FROM subscriptions WHERE org_id = ? ORDER BY id"
+	dueSubscriptionsQuery      = "SELECT " + subscriptionColumns + " FROM subscriptions WHERE paused = 0 AND next_run_at <= ? ORDER BY next_run_at"
+	pauseSubscriptionQuery     = "UPDATE subscriptions SET paused = ? WHERE id = ? AND org_id = ?"
+	subscriptionFailedQuery    = "UPDATE subscriptions SET next_run_at = ?, failures = failures + 1 WHERE id = ?"
+	subscriptionDeliveredQuery = "UPDATE subscriptions SET next_run_at = ?, last_run_at = ?, failures = 0 WHERE id = ?"
+	deleteSubscriptionQuery    = "DELETE FROM subscriptions WHERE id = ? AND org_id = ?"
+)
+
+// CreateSubscription adds a subscription, returning it with its ID set.
+func CreateSubscription(db *sql.DB, sub Subscription) (Subscription, error) {
+	return New(db).CreateSubscription(context.Background(), sub)
+}
+
+// CreateSubscription adds a subscription, returning it with its ID set.
+func (q *Queries) CreateSubscription(ctx context.Context, sub Subscription) (Subscription, error) {
+	sub.CreatedAt = clock.Now().UTC()
+	result, err := q.exec(ctx, createSubscriptionQuery, sub.OrgID, nullID(sub.User1ID), nullID(sub.User2ID), nullID(sub.GroupID),
+		sub.Cadence, sub.URL, sub.Secret, sub.Paused, sub.NextRunAt, sub.CreatedAt)
+	if err != nil {
+		return Subscription{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Subscription{}, err
+	}
+	sub.ID = int(id)
+	return sub, nil
+}
+
+// nullID stores a zero ID as NULL.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// GetSubscription returns one of the organization's subscriptions.
+func GetSubscription(db *sql.DB, orgID, id int) (Subscription, error) {
+	return New(db).GetSubscription(context.Background(), orgID, id)
+}
+
+// GetSubscription returns one of the organization's subscriptions.
+func (q *Queries) GetSubscription(ctx context.Context, orgID, id int) (Subscription, error) {
+	subs, err := q.querySubscriptions(ctx, getSubscriptionQuery, id, orgID)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if len(subs) == 0 {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return subs[0], nil
+}
+
+// ListSubscriptions returns the organization's subscriptions, oldest first.
+func ListSubscriptions(db *sql.DB, orgID int) ([]Subscription, error) {
+	return New(db).ListSubscriptions(context.Background(), orgID)
+}
+
+// ListSubscriptions returns the organization's subscriptions, oldest first.
+func (q *Queries) ListSubscriptions(ctx context.Context, orgID int) ([]Subscription, error) {
+	return q.querySubscriptions(ctx, listSubscriptionsQuery, orgID)
+}
+
+// GetDueSubscriptions returns the active subscriptions due to run by now.
+func GetDueSubscriptions(db *sql.DB, now time.Time) ([]Subscription, error) {
+	return New(db).GetDueSubscriptions(context.Background(), now)
+}
+
+// GetDueSubscriptions returns the active subscriptions due to run by now.
+func (q *Queries) GetDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error) {
+	return q.querySubscriptions(ctx, dueSubscriptionsQuery, now)
+}
+
+func (q *Queries) querySubscriptions(ctx context.Context, query string, args ...interface{}) ([]Subscription, error) {
+	rows, err := q.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var (
+			sub                     Subscription
+			user1ID, user2ID, group sql.NullInt64
+			lastRunAt               sql.NullTime
+		)
+		if err := rows.Scan(&sub.ID, &sub.OrgID, &user1ID, &user2ID, &group, &sub.Cadence, &sub.URL, &sub.Secret,
+			&sub.Paused, &sub.NextRunAt, &lastRunAt, &sub.Failures, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		sub.User1ID, sub.User2ID, sub.GroupID = int(user1ID.Int64), int(user2ID.Int64), int(group.Int64)
+		if lastRunAt.Valid {
+			sub.LastRunAt = &lastRunAt.Time
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// SetSubscriptionPaused pauses or resumes a subscription. A resumed
+// subscription that fell due while paused runs at the next check.
+func SetSubscriptionPaused(db *sql.DB, orgID, id int, paused bool) (Subscription, error) {
+	return New(db).SetSubscriptionPaused(context.Background(), orgID, id, paused)
+}
+
+// SetSubscriptionPaused pauses or resumes a subscription. A resumed
+// subscription that fell due while paused runs at the next check.
+func (q *Queries) SetSubscriptionPaused(ctx context.Context, orgID, id int, paused bool) (Subscription, error) {
+	result, err := q.exec(ctx, pauseSubscriptionQuery, paused, id, orgID)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return Subscription{}, err
+	} else if n == 0 {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return q.GetSubscription(ctx, orgID, id)
+}
+
+// ScheduleSubscription records when a subscription next runs and, when it
+// delivered, when it last ran. A run that did not deliver counts as a failure.
+func ScheduleSubscription(db *sql.DB, id int, nextRunAt time.Time, ranAt *time.Time) error {
+	return New(db).ScheduleSubscription(context.Background(), id, nextRunAt, ranAt)
+}
+
+// ScheduleSubscription records when a subscription next runs and, when it
+// delivered, when it last ran. A run that did not deliver counts as a failure.
+func (q *Queries) ScheduleSubscription(ctx context.Context, id int, nextRunAt time.Time, ranAt *time.Time) error {
+	if ranAt == nil {
+		_, err := q.exec(ctx, subscriptionFailedQuery, nextRunAt, id)
+		return err
+	}
+	_, err := q.exec(ctx, subscriptionDeliveredQuery, nextRunAt, *ranAt, id)
+	return err
+}
+
+// DeleteSubscription removes a subscription, reporting whether it existed.
+func DeleteSubscription(db *sql.DB, orgID, id int) (bool, error) {
+	return New(db).DeleteSubscription(context.Background(), orgID, id)
+}
+
+// DeleteSubscription removes a subscription, reporting whether it existed.
+func (q *Queries) DeleteSubscription(ctx context.Context, orgID, id int) (bool, error) {
+	result, err := q.exec(ctx, deleteSubscriptionQuery, id, orgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
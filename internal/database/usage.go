@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// usageDayLayout formats the UTC day usage is counted under.
+const usageDayLayout = "2006-01-02"
+
+// DailyUsage is the number of requests an API key made on one UTC day.
+type DailyUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+}
+
+// UsageDay returns the UTC day t falls in, as usage is keyed.
+func UsageDay(t time.Time) string {
+	return t.UTC().Format(usageDayLayout)
+}
+
+// UsageRepository counts the requests made each day, by API key and, for
+// requests without one, by client address.
+type UsageRepository interface {
+	GetAPIKeyUsage(ctx context.Context, apiKeyID int, day string) (int, error)
+	IncrementAPIKeyUsage(ctx context.Context, apiKeyID int, day string, quota int) (requests int, ok bool, err error)
+	GetAPIKeyUsageHistory(ctx context.Context, apiKeyID int, since string) ([]DailyUsage, error)
+	IncrementAnonymousUsage(ctx context.Context, clientIP, day string, quota int) (requests int, ok bool, err error)
+	PurgeAnonymousUsage(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ UsageRepository = (*Queries)(nil)
+
+const (
+	apiKeyUsageQuery          = "SELECT requests FROM api_key_usage WHERE api_key_id = ? AND day = ?"
+	incrementAPIKeyUsageQuery = `
+		INSERT INTO api_key_usage(api_key_id, day, requests) VALUES (?, ?, 1)
+		ON CONFLICT(api_key_id, day) DO UPDATE SET requests = requests + 1
+		WHERE ? = 0 OR requests < ?
+		RETURNING requests
+	`
+	apiKeyUsageHistoryQuery = `
+		SELECT day, requests FROM api_key_usage WHERE api_key_id = ? AND day >= ? ORDER BY day DESC
+	`
+	incrementAnonymousUsageQuery = `
+		INSERT INTO anonymous_usage(client_ip, day, requests) VALUES (?, ?, 1)
+		ON CONFLICT(client_ip, day) DO UPDATE SET requests = requests + 1
+		WHERE ? = 0 OR requests < ?
+		RETURNING requests
+	`
+	purgeAnonymousUsageQuery = "DELETE FROM anonymous_usage WHERE day < ?"
+)
+
+// GetAPIKeyUsage returns the requests an API key made on the given day.
+func GetAPIKeyUsage(db *sql.DB, apiKeyID int, day string) (int, error) {
+	return New(db).GetAPIKeyUsage(context.Background(), apiKeyID, day)
+}
+
+// GetAPIKeyUsage returns the requests an API key made on the given day.
+func (q *Queries) GetAPIKeyUsage(ctx context.Context, apiKeyID int, day string) (int, error) {
+	var requests int
+	err := q.queryRow(ctx, apiKeyUsageQuery, apiKeyID, day).Scan(&requests)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return requests, err
+}
+
+// IncrementAPIKeyUsage counts a request against an API key for the given day,
+// unless the day's total has reached quota, returning the day's new total.
+// ok is false when the quota was already used up; zero means no quota. The
+// check and the increment are one statement, so concurrent requests can't
+// both take the last request of a quota.
+func IncrementAPIKeyUsage(db *sql.DB, apiKeyID int, day string, quota int) (requests int, ok bool, err error) {
+	return New(db).IncrementAPIKeyUsage(context.Background(), apiKeyID, day, quota)
+}
+
+// IncrementAPIKeyUsage counts a request against an API key for the given day,
+// unless the day's total has reached quota, returning the day's new total.
+// ok is false when the quota was already used up; zero means no quota.
+func (q *Queries) IncrementAPIKeyUsage(ctx context.Context, apiKeyID int, day string, quota int) (requests int, ok bool, err error) {
+	return q.incrementUsage(ctx, incrementAPIKeyUsageQuery, apiKeyID, day, quota)
+}
+
+// incrementUsage runs one of the increment queries, which return nothing
+// once the quota is used up.
+func (q *Queries) incrementUsage(ctx context.Context, query string, owner any, day string, quota int) (requests int, ok bool, err error) {
+	err = q.queryRow(ctx, query, owner, day, quota, quota).Scan(&requests)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return requests, err == nil, err
+}
+
+// GetAPIKeyUsageHistory returns an API key's usage on days since the given
+// day, most recent first. Days without requests are omitted.
+func GetAPIKeyUsageHistory(db *sql.DB, apiKeyID int, since string) ([]DailyUsage, error) {
+	return New(db).GetAPIKeyUsageHistory(context.Background(), apiKeyID, since)
+}
+
+// GetAPIKeyUsageHistory returns an API key's usage on days since the given
+// day, most recent first. Days without requests are omitted.
+func (q *Queries) GetAPIKeyUsageHistory(ctx context.Context, apiKeyID int, since string) ([]DailyUsage, error) {
+	rows, err := q.query(ctx, apiKeyUsageHistoryQuery, apiKeyID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []DailyUsage{}
+	for rows.Next() {
+		var day DailyUsage
+		if err := rows.Scan(&day.Day, &day.Requests); err != nil {
+			return nil, err
+		}
+		usage = append(usage, day)
+	}
+	return usage, rows.Err()
+}
+
+// IncrementAnonymousUsage counts a request made without an API key against
+// the client address it came from, as IncrementAPIKeyUsage counts one against
+// a key.
+func IncrementAnonymousUsage(db *sql.DB, clientIP, day string, quota int) (requests int, ok bool, err error) {
+	return New(db).IncrementAnonymousUsage(context.Background(), clientIP, day, quota)
+}
+
+// IncrementAnonymousUsage counts a request made without an API key against
+// the client address it came from, as IncrementAPIKeyUsage counts one against
+// a key.
+func (q *Queries) IncrementAnonymousUsage(ctx context.Context, clientIP, day string, quota int) (requests int, ok bool, err error) {
+	return q.incrementUsage(ctx, incrementAnonymousUsageQuery, clientIP, day, quota)
+}
+
+// PurgeAnonymousUsage deletes anonymous usage counted on days before the one
+// before falls in, returning how many rows were deleted.
+func PurgeAnonymousUsage(db *sql.DB, before time.Time) (int64, error) {
+	return New(db).PurgeAnonymousUsage(context.Background(), before)
+}
+
+// PurgeAnonymousUsage deletes anonymous usage counted on days before the one
+// before falls in, returning how many rows were deleted.
+func (q *Queries) PurgeAnonymousUsage(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.exec(ctx, purgeAnonymousUsageQuery, UsageDay(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
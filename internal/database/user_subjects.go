@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+)
+
+// UserSubjects is a user's materialized subject counts, as aggregated from
+// their favorite authors' works.
+type UserSubjects struct {
+	AuthorCounts map[string]int     // Number of favorite authors writing in each subject
+	WorkShare    map[string]float64 // Per subject, the summed share of each author's works carrying it
+	RankWeight   map[string]float64 // Per subject, the summed rank weight of the authors writing in it
+	WorkCounts   map[string]int     // Number of the authors' works carrying each subject
+	FavoriteCap  int                // How many of the user's favorite authors were aggregated, at most
+	Authors      int                // How many authors' works were counted; 0 for counts stored before it was recorded
+	ComputedAt   time.Time
+}
+
+// Fresh reports whether the subjects were computed within the last ttl.
+func (s *UserSubjects) Fresh(ttl time.Duration) bool {
+	return s != nil && clock.Since(s.ComputedAt) < ttl
+}
+
+// SaveUserSubjects replaces a user's materialized subject counts. Their
+// ComputedAt is set to now.
+func SaveUserSubjects(db *sql.DB, userID int, subjects UserSubjects) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_subjects WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	statement, err := tx.Prepare(`
+		INSERT INTO user_subjects(user_id, subject, author_count, work_share, rank_weight, work_count, favorite_cap, author_total, computed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	computedAt := clock.Now().UTC()
+	for subject, count := range subjects.AuthorCounts {
+		if _, err := statement.Exec(userID, subject, count, subjects.WorkShare[subject], subjects.RankWeight[subject], subjects.WorkCounts[subject], subjects.FavoriteCap, subjects.Authors, computedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetUserSubjects returns a user's materialized subject counts, or nil if
+// they have never been computed.
+func GetUserSubjects(db *sql.DB, userID int) (*UserSubjects, error) {
+	rows, err := db.Query("SELECT subject, author_count, work_share, rank_weight, work_count, favorite_cap, author_total, computed_at FROM user_subjects WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects *UserSubjects
+	for rows.Next() {
+		var (
+			subject     string
+			count       int
+			share       float64
+			rankWeight  float64
+			workCount   int
+			favoriteCap int
+			authors     int
+			computedAt  time.Time
+		)
+		if err := rows.Scan(&subject, &count, &share, &rankWeight, &workCount, &favoriteCap, &authors, &computedAt); err != nil {
+			return nil, err
+		}
+		if subjects == nil {
+			subjects = &UserSubjects{
+				AuthorCounts: make(map[string]int),
+				WorkShare:    make(map[string]float64),
+				RankWeight:   make(map[string]float64),
+				WorkCounts:   make(map[string]int),
+				FavoriteCap:  favoriteCap,
+				Authors:      authors,
+				ComputedAt:   computedAt,
+			}
+		}
+		subjects.AuthorCounts[subject] = count
+		subjects.WorkShare[subject] = share
+		subjects.RankWeight[subject] = rankWeight
+		subjects.WorkCounts[subject] = workCount
+	}
+	return subjects, rows.Err()
+}
@@ -0,0 +1,492 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/models"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrUserNotFound is returned when no user has the requested ID or username.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrVersionConflict is returned when a user is updated from a version that
+// is no longer current.
+var ErrVersionConflict = errors.New("user was modified since it was read")
+
+// UsernameTakenError is returned when a user is created with a username
+// already used in the organization. Usernames are compared case-insensitively.
+type UsernameTakenError struct {
+	Username string
+}
+
+func (e *UsernameTakenError) Error() string {
+	return fmt.Sprintf("username '%s' is already taken", e.Username)
+}
+
+// UserExport is everything stored about a user.
+type UserExport struct {
+	User      UserRecord      `json:"user"`
+	Profile   *ProfileRecord  `json:"profile"`
+	History   []HistoryRecord `json:"recommendation_history"`
+	ReadBooks []ReadBook      `json:"read_books"`
+	Wishlist  []WishlistEntry `json:"wishlist"`
+	// GroupRecommendations are the stored recommendations of the user's groups.
+	GroupRecommendations []GroupRecommendationRecord `json:"group_recommendations"`
+	// AuditLog is the audit entries of requests about the user.
+	AuditLog []AuditEntry `json:"audit_log"`
+}
+
+// GroupRecommendationRecord is a group's stored recommendation.
+type GroupRecommendationRecord struct {
+	GroupID    int             `json:"group_id"`
+	Result     json.RawMessage `json:"result"`
+	ComputedAt time.Time       `json:"computed_at"`
+}
+
+// UserRecord is a row of the users table.
+type UserRecord struct {
+	ID              int      `json:"id"`
+	OrgID           int      `json:"org_id"`
+	Username        string   `json:"username"`
+	FavoriteAuthors []string `json:"favorite_authors"`
+	// Version increases with every update, so a client can tell whether the
+	// user changed since it read them.
+	Version int `json:"version"`
+}
+
+// ProfileRecord is a user's stored subject profile.
+type ProfileRecord struct {
+	Subjects  models.SubjectProfile `json:"subjects"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+// HistoryRecord is a stored recommendation response.
+type HistoryRecord struct {
+	ID              int             `json:"id"`
+	User1ID         int             `json:"user1_id"`
+	User2ID         int             `json:"user2_id"`
+	Strategy        string          `json:"strategy"`
+	Subject         string          `json:"subject"`
+	Experiment      string          `json:"experiment,omitempty"`
+	Variant         string          `json:"variant,omitempty"`
+	Recommendations json.RawMessage `json:"recommendations"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// NewUser is a user to create, with their favorite authors in order of preference.
+type NewUser struct {
+	Username        string   `json:"username"`
+	FavoriteAuthors []string `json:"favorite_authors"`
+}
+
+// CreateUser adds a user to an organization along with their favorite
+// authors, returning the new user's ID. Either all of it is written or none.
+func CreateUser(db *sql.DB, orgID int, user NewUser) (int, error) {
+	ids, err := ImportUsers(db, orgID, []NewUser{user})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// ImportUsers adds users to an organization along with their favorite
+// authors in a single transaction, so a failure part way leaves none of them
+// behind. It returns the new users' IDs in order.
+func ImportUsers(db *sql.DB, orgID int, users []NewUser) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	favorites, err := tx.Prepare("INSERT INTO favorite_authors(user_id, position, name) VALUES (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer favorites.Close()
+
+	ids := make([]int, len(users))
+	for i, user := range users {
+		result, err := tx.Exec("INSERT INTO users(org_id, username) VALUES (?, ?)", orgID, user.Username)
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, &UsernameTakenError{Username: user.Username}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error inserting user %s: %w", user.Username, err)
+		}
+		userID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		for position, name := range user.FavoriteAuthors {
+			if _, err := favorites.Exec(userID, position, strings.TrimSpace(name)); err != nil {
+				return nil, fmt.Errorf("error inserting favorite author of %s: %w", user.Username, err)
+			}
+		}
+		ids[i] = int(userID)
+	}
+	return ids, tx.Commit()
+}
+
+// UpdateUser replaces a user's username and favorite authors, provided the
+// user is still at the given version, and returns the new version. The
+// user's stored subjects, profile, and pair recommendations are dropped,
+// since they were derived from the old favorites.
+func UpdateUser(db *sql.DB, userID, version int, user NewUser) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET username = ?, version = version + 1 WHERE id = ? AND version = ?", user.Username, userID, version)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return 0, &UsernameTakenError{Username: user.Username}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrUserNotFound
+		}
+		return 0, ErrVersionConflict
+	}
+
+	if _, err := tx.Exec("DELETE FROM favorite_authors WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	for position, name := range user.FavoriteAuthors {
+		if _, err := tx.Exec("INSERT INTO favorite_authors(user_id, position, name) VALUES (?, ?, ?)", userID, position, strings.TrimSpace(name)); err != nil {
+			return 0, err
+		}
+	}
+	for _, table := range []string{"user_subjects", "user_profiles"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM pair_recommendations WHERE user1_id = ? OR user2_id = ?", userID, userID); err != nil {
+		return 0, err
+	}
+	return version + 1, tx.Commit()
+}
+
+// GetUser returns a user's row with all of their favorite authors.
+func GetUser(db *sql.DB, userID int) (UserRecord, error) {
+	return New(db).GetUser(context.Background(), userID)
+}
+
+// GetUserByUsername returns the organization's user with a username, compared
+// case-insensitively, with all of their favorite authors.
+func GetUserByUsername(db *sql.DB, orgID int, username string) (UserRecord, error) {
+	return New(db).GetUserByUsername(context.Background(), orgID, username)
+}
+
+// UserSort orders a user listing by ID or username, descending with a "-" prefix.
+type UserSort string
+
+const (
+	UserSortID           UserSort = "id"
+	UserSortIDDesc       UserSort = "-id"
+	UserSortUsername     UserSort = "username"
+	UserSortUsernameDesc UserSort = "-username"
+)
+
+// UserSorts are the supported user listing orders.
+var UserSorts = []UserSort{UserSortID, UserSortIDDesc, UserSortUsername, UserSortUsernameDesc}
+
+// UserCursor marks the last user of a listing page; the next page starts after it.
+type UserCursor struct {
+	ID       int    `json:"id"`
+	Username string `json:"username,omitempty"`
+}
+
+// UserFilter narrows and orders a user listing. Zero values match everything.
+type UserFilter struct {
+	OrgID int
+	// UsernamePrefix matches usernames starting with it, case-insensitively.
+	UsernamePrefix string
+	Sort           UserSort
+	After          *UserCursor
+	Limit          int
+}
+
+// ListUsers returns a page of an organization's users, with their favorite
+// authors. Pages are keyed on the sort column and ID, so rows added or
+// removed between requests do not shift later pages.
+func ListUsers(db *sql.DB, filter UserFilter) ([]UserRecord, error) {
+	query := "SELECT id, org_id, COALESCE(username, ''), version FROM users WHERE org_id = ?"
+	args := []interface{}{filter.OrgID}
+	if filter.UsernamePrefix != "" {
+		query += ` AND username LIKE ? ESCAPE '\'`
+		args = append(args, likeEscaper.Replace(filter.UsernamePrefix)+"%")
+	}
+
+	byUsername := filter.Sort == UserSortUsername || filter.Sort == UserSortUsernameDesc
+	direction, comparison := "ASC", ">"
+	if filter.Sort == UserSortIDDesc || filter.Sort == UserSortUsernameDesc {
+		direction, comparison = "DESC", "<"
+	}
+	if after := filter.After; after != nil {
+		if byUsername {
+			query += fmt.Sprintf(" AND (COALESCE(username, '') %[1]s ? COLLATE NOCASE OR (COALESCE(username, '') = ? COLLATE NOCASE AND id %[1]s ?))", comparison)
+			args = append(args, after.Username, after.Username, after.ID)
+		} else {
+			query += fmt.Sprintf(" AND id %s ?", comparison)
+			args = append(args, after.ID)
+		}
+	}
+	if byUsername {
+		query += fmt.Sprintf(" ORDER BY COALESCE(username, '') COLLATE NOCASE %[1]s, id %[1]s", direction)
+	} else {
+		query += " ORDER BY id " + direction
+	}
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserRecord{}
+	index := make(map[int]int) // User ID to position in users
+	for rows.Next() {
+		var user UserRecord
+		if err := rows.Scan(&user.ID, &user.OrgID, &user.Username, &user.Version); err != nil {
+			return nil, err
+		}
+		index[user.ID] = len(users)
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return users, nil
+	}
+
+	// Fetch the page's favorite authors in one query
+	placeholders := strings.Repeat(", ?", len(users))[2:]
+	ids := make([]interface{}, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	favorites, err := db.Query("SELECT user_id, name FROM favorite_authors WHERE user_id IN ("+placeholders+") ORDER BY user_id, position", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer favorites.Close()
+	for favorites.Next() {
+		var (
+			userID int
+			name   string
+		)
+		if err := favorites.Scan(&userID, &name); err != nil {
+			return nil, err
+		}
+		users[index[userID]].FavoriteAuthors = append(users[index[userID]].FavoriteAuthors, name)
+	}
+	return users, favorites.Err()
+}
+
+// likeEscaper escapes LIKE wildcards so a prefix matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetUserHistory returns the recommendations served to pairs including the user, oldest first.
+func GetUserHistory(db *sql.DB, userID int) ([]HistoryRecord, error) {
+	rows, err := db.Query(`
+		SELECT id, user1_id, user2_id, strategy, subject, experiment, variant, recommendations, created_at
+		FROM recommendation_history
+		WHERE user1_id = ? OR user2_id = ?
+		ORDER BY id
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []HistoryRecord{}
+	for rows.Next() {
+		var (
+			record              HistoryRecord
+			experiment, variant sql.NullString
+			recommendations     string
+		)
+		if err := rows.Scan(&record.ID, &record.User1ID, &record.User2ID, &record.Strategy, &record.Subject,
+			&experiment, &variant, &recommendations, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		record.Experiment = experiment.String
+		record.Variant = variant.String
+		record.Recommendations = json.RawMessage(recommendations)
+		history = append(history, record)
+	}
+	return history, rows.Err()
+}
+
+// ExportUserData collects everything stored about a user.
+func ExportUserData(db *sql.DB, userID int) (UserExport, error) {
+	user, err := GetUser(db, userID)
+	if err != nil {
+		return UserExport{}, err
+	}
+	export := UserExport{User: user}
+
+	var (
+		subjects  string
+		updatedAt time.Time
+	)
+	err = db.QueryRow("SELECT subjects, updated_at FROM user_profiles WHERE user_id = ?", userID).Scan(&subjects, &updatedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		// The user has never been profiled
+	case err != nil:
+		return UserExport{}, err
+	default:
+		profile := &ProfileRecord{UpdatedAt: updatedAt}
+		if err := json.Unmarshal([]byte(subjects), &profile.Subjects); err != nil {
+			return UserExport{}, fmt.Errorf("error decoding profile for user ID %d: %v", userID, err)
+		}
+		export.Profile = profile
+	}
+
+	export.History, err = GetUserHistory(db, userID)
+	if err != nil {
+		return UserExport{}, err
+	}
+	export.ReadBooks, err = ListReadBooks(db, userID)
+	if err != nil {
+		return UserExport{}, err
+	}
+	export.Wishlist, err = ListWishlist(db, userID)
+	if err != nil {
+		return UserExport{}, err
+	}
+	export.GroupRecommendations, err = userGroupRecommendations(db, userID)
+	if err != nil {
+		return UserExport{}, err
+	}
+	export.AuditLog, err = UserAuditEntries(db, userID, user.Username)
+	if err != nil {
+		return UserExport{}, err
+	}
+	return export, nil
+}
+
+// userGroupRecommendations returns the stored recommendations of the groups
+// the user is a member of.
+func userGroupRecommendations(db *sql.DB, userID int) ([]GroupRecommendationRecord, error) {
+	rows, err := db.Query(`
+		SELECT r.group_id, r.result, r.computed_at
+		FROM group_recommendations r JOIN group_members m ON m.group_id = r.group_id
+		WHERE m.user_id = ?
+		ORDER BY r.group_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []GroupRecommendationRecord{}
+	for rows.Next() {
+		var (
+			record GroupRecommendationRecord
+			result string
+		)
+		if err := rows.Scan(&record.GroupID, &result, &record.ComputedAt); err != nil {
+			return nil, err
+		}
+		record.Result = json.RawMessage(result)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// DeleteUserData removes a user along with their favorites, subjects, profile,
+// read books, wishlist, and group memberships and votes, and any
+// recommendation history, stored recommendations, their groups' stored
+// recommendations, webhooks, subscriptions, or audit entries that include
+// them.
+func DeleteUserData(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM favorite_authors WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_subjects WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_profiles WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM read_books WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM wishlist WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_recommendations WHERE group_id IN (SELECT group_id FROM group_members WHERE user_id = ?)", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_reading_list_votes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE group_reading_list SET added_by = NULL WHERE added_by = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recommendation_history WHERE user1_id = ? OR user2_id = ?", userID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM pair_recommendations WHERE user1_id = ? OR user2_id = ?", userID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM subscriptions WHERE user1_id = ? OR user2_id = ?", userID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM audit_log WHERE "+userAuditCondition, strconv.Itoa(userID), strings.ToLower(username)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
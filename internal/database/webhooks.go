@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Webhook is a registered callback URL. UserID limits it to pairs including
+// that user; zero means every pair.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	UserID    int       `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhook registers a webhook, returning it with its ID set.
+func CreateWebhook(db *sql.DB, hook Webhook) (Webhook, error) {
+	hook.CreatedAt = time.Now().UTC()
+	result, err := db.Exec(`
+		INSERT INTO webhooks(url, secret, user_id, created_at) VALUES (?, ?, ?, ?)
+	`, hook.URL, hook.Secret, sql.NullInt64{Int64: int64(hook.UserID), Valid: hook.UserID != 0}, hook.CreatedAt)
+	if err != nil {
+		return Webhook{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Webhook{}, err
+	}
+	hook.ID = int(id)
+	return hook, nil
+}
+
+// ListWebhooks returns every registered webhook, oldest first.
+func ListWebhooks(db *sql.DB) ([]Webhook, error) {
+	return queryWebhooks(db, "SELECT id, url, secret, user_id, created_at FROM webhooks ORDER BY id")
+}
+
+// GetPairWebhooks returns the webhooks to notify about a pair.
+func GetPairWebhooks(db *sql.DB, user1ID, user2ID int) ([]Webhook, error) {
+	return queryWebhooks(db, `
+		SELECT id, url, secret, user_id, created_at FROM webhooks
+		WHERE user_id IS NULL OR user_id IN (?, ?)
+		ORDER BY id
+	`, user1ID, user2ID)
+}
+
+// DeleteWebhook removes a webhook, reporting whether it existed.
+func DeleteWebhook(db *sql.DB, id int) (bool, error) {
+	result, err := db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func queryWebhooks(db *sql.DB, query string, args ...interface{}) ([]Webhook, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var (
+			hook   Webhook
+			userID sql.NullInt64
+		)
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &userID, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hook.UserID = int(userID.Int64)
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WishlistEntry is a work a user has saved to read later.
+type WishlistEntry struct {
+	WorkKey string    `json:"work_key"`
+	Title   string    `json:"title"`
+	Authors []string  `json:"authors"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// SaveWishlistEntry adds a work to a user's wishlist, updating its title and
+// authors if it is already there. AddedAt is set to when it was first added.
+func SaveWishlistEntry(db *sql.DB, userID int, entry WishlistEntry) (WishlistEntry, error) {
+	authors, err := json.Marshal(entry.Authors)
+	if err != nil {
+		return WishlistEntry{}, fmt.Errorf("error encoding authors: %v", err)
+	}
+	err = db.QueryRow(`
+		INSERT INTO wishlist(user_id, work_key, title, authors, added_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, work_key) DO UPDATE SET title = excluded.title, authors = excluded.authors
+		RETURNING added_at
+	`, userID, entry.WorkKey, entry.Title, string(authors), time.Now().UTC()).Scan(&entry.AddedAt)
+	if err != nil {
+		return WishlistEntry{}, err
+	}
+	return entry, nil
+}
+
+// ListWishlist returns a user's wishlist, most recently added first.
+func ListWishlist(db *sql.DB, userID int) ([]WishlistEntry, error) {
+	rows, err := db.Query(`
+		SELECT work_key, title, authors, added_at FROM wishlist WHERE user_id = ? ORDER BY added_at DESC, work_key
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WishlistEntry{}
+	for rows.Next() {
+		var (
+			entry   WishlistEntry
+			authors string
+		)
+		if err := rows.Scan(&entry.WorkKey, &entry.Title, &authors, &entry.AddedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(authors), &entry.Authors); err != nil {
+			return nil, fmt.Errorf("error decoding authors of wishlist entry %s: %v", entry.WorkKey, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteWishlistEntry removes a work from a user's wishlist, reporting
+// whether it was there.
+func DeleteWishlistEntry(db *sql.DB, userID int, workKey string) (bool, error) {
+	result, err := db.Exec("DELETE FROM wishlist WHERE user_id = ? AND work_key = ?", userID, workKey)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
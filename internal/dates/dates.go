@@ -0,0 +1,70 @@
+// Package dates parses the publish dates upstream book sources return, which
+// come in many formats, from a bare year to free text such as "c1998" or
+// "Spring 2004".
+package dates
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layouts are the exact formats tried, most common first.
+var layouts = []string{
+	"2006",
+	"2006-01-02",
+	"2006-01",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"January 2006",
+	"Jan 2006",
+	"01/02/2006",
+	"2006/01/02",
+}
+
+// yearPattern finds a plausible publish year within free text.
+var yearPattern = regexp.MustCompile(`(?:^|[^0-9])(1[0-9]{3}|20[0-9]{2})(?:[^0-9]|$)`)
+
+// Parse returns the date a publish date string names. A date given only to
+// the year or month falls on the first day of it. Strings in no known
+// format yield the first year found in them, if any; ok is false when
+// there is none.
+func Parse(s string) (t time.Time, ok bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	// Fuzzy strings such as "c1998", "[1987?]", or "Spring 2004"
+	match := yearPattern.FindStringSubmatch(s)
+	if match == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(match[1])
+	return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// Year returns the year a publish date string names, or 0 if it names none.
+func Year(s string) int {
+	t, ok := Parse(s)
+	if !ok {
+		return 0
+	}
+	return t.Year()
+}
+
+// EarliestYear returns the earliest year named by any of the publish dates,
+// such as those of a work's editions, or 0 if they name none.
+func EarliestYear(dates []string) int {
+	earliest := 0
+	for _, date := range dates {
+		if year := Year(date); year != 0 && (earliest == 0 || year < earliest) {
+			earliest = year
+		}
+	}
+	return earliest
+}
@@ -0,0 +1,89 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		// Exact formats
+		{"1998", date(1998, time.January, 1), true},
+		{"2004-03-15", date(2004, time.March, 15), true},
+		{"2004-03", date(2004, time.March, 1), true},
+		{"March 15, 2004", date(2004, time.March, 15), true},
+		{"Mar 15, 2004", date(2004, time.March, 15), true},
+		{"15 March 2004", date(2004, time.March, 15), true},
+		{"15 Mar 2004", date(2004, time.March, 15), true},
+		{"03/15/2004", date(2004, time.March, 15), true},
+		{"2004/03/15", date(2004, time.March, 15), true},
+		{"  1998\n", date(1998, time.January, 1), true},
+
+		// Partial dates fall on the first of the month or year
+		{"March 2004", date(2004, time.March, 1), true},
+		{"Mar 2004", date(2004, time.March, 1), true},
+
+		// Fuzzy strings yield the year found in them
+		{"c1998", date(1998, time.January, 1), true},
+		{"[1987?]", date(1987, time.January, 1), true},
+		{"Spring 2004", date(2004, time.January, 1), true},
+		{"1st ed. 1965, reprinted 1987", date(1965, time.January, 1), true},
+		{"2004-13-45", date(2004, time.January, 1), true},
+
+		// Nothing that names a year
+		{"", time.Time{}, false},
+		{"unknown", time.Time{}, false},
+		{"n.d.", time.Time{}, false},
+		{"c0999", time.Time{}, false},
+		{"c2100", time.Time{}, false},
+		{"vol. 12", time.Time{}, false},
+		{"ISBN 9780261103573", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.in)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestYear(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"2004-03-15", 2004},
+		{"c1998", 1998},
+		{"unknown", 0},
+	}
+	for _, tt := range tests {
+		if got := Year(tt.in); got != tt.want {
+			t.Errorf("Year(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEarliestYear(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"unknown", ""}, 0},
+		{[]string{"2004", "c1998", "March 2001"}, 1998},
+		{[]string{"n.d.", "Spring 2004"}, 2004},
+	}
+	for _, tt := range tests {
+		if got := EarliestYear(tt.in); got != tt.want {
+			t.Errorf("EarliestYear(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
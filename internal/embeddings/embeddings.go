@@ -0,0 +1,46 @@
+// Package embeddings maps subject strings to vectors whose cosine similarity
+// reflects how related the subjects are, so "sci-fi" and "science fiction"
+// can be matched though they differ as strings.
+package embeddings
+
+import (
+	"context"
+	"math"
+)
+
+// Embedder embeds texts as vectors. Implementations return unit vectors, one
+// per text in order, all of the same length.
+type Embedder interface {
+	// Name identifies the embedder in logs and cache keys.
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// Similarity returns the cosine similarity of two unit vectors, 0 when their
+// lengths differ. Rounding never takes it past 1.
+func Similarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return min(dot, 1)
+}
+
+// normalize scales v to unit length in place, leaving a zero vector as is.
+func normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
@@ -0,0 +1,84 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"be-takehome-2024/internal/httpclient"
+)
+
+// HTTPEmbedder embeds texts with an external model behind an
+// OpenAI-compatible embeddings API, such as a hosted service or a local
+// model server.
+type HTTPEmbedder struct {
+	client *http.Client
+	url    string
+	apiKey string
+	model  string
+}
+
+// NewHTTPEmbedder returns an embedder posting to the embeddings endpoint at
+// url. The API key is optional, for servers that need none.
+func NewHTTPEmbedder(client *http.Client, url, apiKey, model string) *HTTPEmbedder {
+	return &HTTPEmbedder{client: client, url: url, apiKey: apiKey, model: model}
+}
+
+func (e *HTTPEmbedder) Name() string { return "http:" + e.model }
+
+type embeddingsRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(embeddingsRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding embeddings request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := httpclient.CheckStatus(resp, "embeddings API"); err != nil {
+		return nil, err
+	}
+	var result embeddingsResponse
+	if err := httpclient.DecodeJSON(resp.Body, &result); err != nil {
+		return nil, err
+	}
+
+	// The API returns an embedding per input, each marked with its position
+	vectors := make([][]float64, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings API returned an embedding for input %d of %d", item.Index, len(texts))
+		}
+		vectors[item.Index] = normalize(item.Embedding)
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("embeddings API returned no embedding for '%s'", texts[i])
+		}
+	}
+	return vectors, nil
+}
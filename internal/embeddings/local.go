@@ -0,0 +1,122 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// localDimensions is the length of the local embedder's vectors.
+const localDimensions = 512
+
+// trigramWeight is how much a word's character trigrams count relative to
+// the word itself, so variants such as "mystery" and "mysteries" stay close.
+const trigramWeight = 0.35
+
+// stopWords carry no meaning of their own in a subject heading.
+var stopWords = map[string]bool{"and": true, "the": true, "of": true, "in": true, "a": true, "an": true}
+
+// genericWords appear in so many subject headings that sharing them says
+// little, so they count for less than other words.
+var genericWords = map[string]float64{
+	"fiction":    0.5,
+	"general":    0.1,
+	"story":      0.4,
+	"literature": 0.5,
+	"novel":      0.3,
+	"book":       0.2,
+}
+
+// LocalEmbedder embeds subjects without a model, hashing their words and the
+// words' character trigrams into a fixed-size vector. Subjects sharing words,
+// or abbreviations of them, come out similar; synonyms sharing neither don't,
+// for which an external model is needed.
+type LocalEmbedder struct {
+	// Alias, if set, returns the subject a lowercase subject, word, or pair
+	// of words is an alias of, such as "science fiction" for "sf", so that
+	// abbreviations and alternate spellings are embedded as what they stand
+	// for.
+	Alias func(string) (string, bool)
+}
+
+func (LocalEmbedder) Name() string { return "local" }
+
+func (e LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vector := make([]float64, localDimensions)
+		for _, word := range e.words(text) {
+			weight := 1.0
+			if generic, ok := genericWords[word]; ok {
+				weight = generic
+			}
+			vector[bucket(word)] += weight
+			padded := " " + word + " "
+			for j := 0; j+3 <= len(padded); j++ {
+				vector[bucket("#"+padded[j:j+3])] += weight * trigramWeight
+			}
+		}
+		vectors[i] = normalize(vector)
+	}
+	return vectors, nil
+}
+
+// words splits a subject into lowercase, singular words, expanding aliases
+// and leaving out stop words.
+func (e LocalEmbedder) words(text string) []string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if alias, ok := e.alias(text); ok {
+		text = alias
+	}
+	tokens := tokenize(text)
+	var expanded []string
+	for i := 0; i < len(tokens); i++ {
+		if i+1 < len(tokens) {
+			if alias, ok := e.alias(tokens[i] + " " + tokens[i+1]); ok {
+				expanded = append(expanded, tokenize(alias)...)
+				i++
+				continue
+			}
+		}
+		if alias, ok := e.alias(tokens[i]); ok {
+			expanded = append(expanded, tokenize(alias)...)
+		} else if !stopWords[tokens[i]] {
+			expanded = append(expanded, singular(tokens[i]))
+		}
+	}
+	return expanded
+}
+
+func (e LocalEmbedder) alias(text string) (string, bool) {
+	if e.Alias == nil {
+		return "", false
+	}
+	return e.Alias(text)
+}
+
+// tokenize splits text into its runs of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// singular crudely strips a plural ending, so "mysteries" and "mystery" are
+// the same word.
+func singular(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+// bucket hashes a feature to a vector index.
+func bucket(feature string) int {
+	h := fnv.New32a()
+	h.Write([]byte(feature))
+	return int(h.Sum32() % localDimensions)
+}
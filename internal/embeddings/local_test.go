@@ -0,0 +1,101 @@
+package embeddings
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testAliases stands in for the subject curation's aliases.
+var testAliases = map[string]string{
+	"sci-fi": "science fiction",
+	"sci fi": "science fiction",
+	"sf":     "science fiction",
+	"ya":     "young adult",
+	"ww2":    "world war, 1939-1945",
+}
+
+func testEmbedder() LocalEmbedder {
+	return LocalEmbedder{Alias: func(subject string) (string, bool) {
+		alias, ok := testAliases[subject]
+		return alias, ok
+	}}
+}
+
+func similarity(t *testing.T, e LocalEmbedder, a, b string) float64 {
+	t.Helper()
+	vectors, err := e.Embed(context.Background(), []string{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Similarity(vectors[0], vectors[1])
+}
+
+func TestLocalEmbedderWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Science Fiction", []string{"science", "fiction"}},
+		{"sci-fi", []string{"science", "fiction"}},
+		{"SF", []string{"science", "fiction"}},
+		{"Sci-Fi Thrillers", []string{"science", "fiction", "thriller"}},
+		{"YA fantasy", []string{"young", "adult", "fantasy"}},
+		{"History of WW2", []string{"history", "world", "war", "1939", "1945"}},
+		{"Mysteries and Thrillers", []string{"mystery", "thriller"}},
+		{"Classics", []string{"classic"}},
+		{"Business", []string{"business"}},
+	}
+	e := testEmbedder()
+	for _, tt := range tests {
+		if got := e.words(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("words(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLocalEmbedderWithoutAliases(t *testing.T) {
+	got := LocalEmbedder{}.words("Sci-Fi")
+	if want := []string{"sci", "fi"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("words = %q, want %q", got, want)
+	}
+}
+
+func TestLocalEmbedderUnitVectors(t *testing.T) {
+	vectors, err := testEmbedder().Embed(context.Background(), []string{"fantasy", "science fiction", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 3 {
+		t.Fatalf("got %d vectors, want 3", len(vectors))
+	}
+	for i, vector := range vectors[:2] {
+		if len(vector) != localDimensions {
+			t.Errorf("vector %d has length %d, want %d", i, len(vector), localDimensions)
+		}
+		var norm float64
+		for _, x := range vector {
+			norm += x * x
+		}
+		if math.Abs(norm-1) > 1e-9 {
+			t.Errorf("vector %d has squared norm %v, want 1", i, norm)
+		}
+	}
+}
+
+func TestLocalEmbedderSimilarity(t *testing.T) {
+	e := testEmbedder()
+	if got := similarity(t, e, "sci-fi", "Science Fiction"); math.Abs(got-1) > 1e-9 {
+		t.Errorf("alias similarity = %v, want 1", got)
+	}
+	close := similarity(t, e, "mysteries", "mystery and detective stories")
+	far := similarity(t, e, "mysteries", "cooking")
+	if close <= far {
+		t.Errorf("related similarity %v is not above unrelated %v", close, far)
+	}
+	// Sharing only a generic word says little
+	if got := similarity(t, e, "fantasy fiction", "historical fiction"); got >= 0.5 {
+		t.Errorf("generic word similarity = %v, want under 0.5", got)
+	}
+}
@@ -0,0 +1,128 @@
+// Package events publishes domain events, such as a user being created, to
+// a message bus, so other systems can follow what happens without polling
+// the API. Events are published through the task queue, which retries them
+// while the bus is unavailable.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/queue"
+)
+
+// Event types.
+const (
+	// UserCreated is published for each user created, one at a time or by import.
+	UserCreated = "user.created"
+	// RecommendationComputed is published for each pair or group
+	// recommendation computed, whether for a request, a refresh, or a
+	// subscription; not for stored recommendations served again.
+	RecommendationComputed = "recommendation.computed"
+	// FeedbackReceived is published for each read book a user logs and each
+	// vote a group member casts or withdraws on a work to read next.
+	FeedbackReceived = "feedback.received"
+)
+
+// Event is the JSON message published for an occurrence.
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OrgID      int         `json:"org_id,omitempty"`
+	Data       interface{} `json:"data"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+// Bus is a message bus events are published to.
+type Bus interface {
+	// Publish sends a message to a subject, or topic.
+	Publish(ctx context.Context, subject string, message []byte) error
+}
+
+// taskPublish is the queue task kind publishing one event.
+const taskPublish = "events.publish"
+
+// publishTask is the payload of a publish task.
+type publishTask struct {
+	Subject string          `json:"subject"`
+	Message json.RawMessage `json:"message"`
+}
+
+func init() {
+	queue.Handle(taskPublish, queue.Options{MaxAttempts: 5, Backoff: time.Second, Timeout: 10 * time.Second}, runPublish)
+}
+
+var (
+	mu     sync.RWMutex
+	bus    Bus
+	prefix string
+)
+
+// Use publishes events to b, each to the subject made of prefix and its
+// type. Until it is called events are dropped.
+func Use(b Bus, subjectPrefix string) {
+	mu.Lock()
+	defer mu.Unlock()
+	bus, prefix = b, subjectPrefix
+}
+
+func current() (Bus, string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return bus, prefix
+}
+
+// Publish queues an event for the bus, if there is one. Failures are logged,
+// so publishing never fails the operation it reports.
+func Publish(eventType string, orgID int, data interface{}) {
+	b, subjectPrefix := current()
+	if b == nil {
+		return
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		log.Printf("Error generating event ID: %v", err)
+		return
+	}
+	message, err := json.Marshal(Event{ID: id, Type: eventType, OrgID: orgID, Data: data, OccurredAt: time.Now().UTC()})
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	task := publishTask{Subject: subjectPrefix + eventType, Message: message}
+	if _, err := queue.Enqueue(context.Background(), taskPublish, 0, task); err != nil {
+		log.Printf("Error queueing %s event: %v", eventType, err)
+	}
+}
+
+// runPublish makes one attempt at publishing a queued event.
+func runPublish(ctx context.Context, task queue.Task) (interface{}, error) {
+	var t publishTask
+	if err := json.Unmarshal(task.Payload, &t); err != nil {
+		return nil, queue.Permanent(fmt.Errorf("error decoding event: %v", err))
+	}
+	b, _ := current()
+	if b == nil {
+		return nil, queue.Permanent(fmt.Errorf("no message bus configured"))
+	}
+	if err := b.Publish(ctx, t.Subject, t.Message); err != nil {
+		return nil, fmt.Errorf("error publishing to %s: %v", t.Subject, err)
+	}
+	return nil, nil
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
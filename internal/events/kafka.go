@@ -0,0 +1,55 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// kafkaBus publishes to Kafka through a REST proxy, such as Confluent's,
+// each subject being a topic.
+type kafkaBus struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewKafkaREST returns a bus publishing to Kafka through the REST proxy at
+// rawURL, such as "http://localhost:8082".
+func NewKafkaREST(client *http.Client, rawURL string) (Bus, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST proxy URL '%s'", rawURL)
+	}
+	return &kafkaBus{client: client, baseURL: strings.TrimSuffix(rawURL, "/")}, nil
+}
+
+func (b *kafkaBus) Publish(ctx context.Context, subject string, message []byte) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"value": json.RawMessage(message)}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/topics/"+url.PathEscape(subject), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
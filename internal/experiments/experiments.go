@@ -0,0 +1,130 @@
+package experiments
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"be-takehome-2024/internal/config"
+)
+
+// Variant is one arm of an experiment, served by a recommendation strategy.
+type Variant struct {
+	Name     string
+	Strategy string
+	Weight   int
+}
+
+// Experiment splits user pairs between strategy variants.
+type Experiment struct {
+	Name     string
+	Variants []Variant
+}
+
+// Assignment records which variant of an experiment served a request.
+type Assignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// Parse reads an experiment definition of the form
+// "name:variant=strategy/weight,variant=strategy/weight". The weight may be
+// omitted and defaults to 1, and the variant name defaults to the strategy.
+// For example: "strategy-2024:control=subject-intersection/50,collaborative/50".
+func Parse(spec string) (*Experiment, error) {
+	name, arms, ok := strings.Cut(spec, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("experiment %q must be of the form name:variants", spec)
+	}
+
+	exp := &Experiment{Name: name}
+	for _, arm := range strings.Split(arms, ",") {
+		arm = strings.TrimSpace(arm)
+		if arm == "" {
+			continue
+		}
+
+		variant := Variant{Weight: 1}
+		if label, rest, ok := strings.Cut(arm, "="); ok {
+			variant.Name = strings.TrimSpace(label)
+			arm = rest
+		}
+		strategy, weight, hasWeight := strings.Cut(arm, "/")
+		variant.Strategy = strings.TrimSpace(strategy)
+		if hasWeight {
+			w, err := strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("experiment %q: invalid weight %q", name, weight)
+			}
+			variant.Weight = w
+		}
+		if variant.Strategy == "" {
+			return nil, fmt.Errorf("experiment %q: variant is missing a strategy", name)
+		}
+		if variant.Name == "" {
+			variant.Name = variant.Strategy
+		}
+		exp.Variants = append(exp.Variants, variant)
+	}
+
+	if exp.totalWeight() == 0 {
+		return nil, fmt.Errorf("experiment %q has no weighted variants", name)
+	}
+	return exp, nil
+}
+
+// Assign deterministically buckets a user pair into a variant. The pair is
+// unordered, so swapping the users yields the same variant.
+func (e *Experiment) Assign(user1ID, user2ID int) Variant {
+	if user1ID > user2ID {
+		user1ID, user2ID = user2ID, user1ID
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d:%d", e.Name, user1ID, user2ID)
+	bucket := int(h.Sum32() % uint32(e.totalWeight()))
+
+	for _, variant := range e.Variants {
+		if bucket < variant.Weight {
+			return variant
+		}
+		bucket -= variant.Weight
+	}
+	// Unreachable while the weights sum to totalWeight
+	return e.Variants[len(e.Variants)-1]
+}
+
+func (e *Experiment) totalWeight() int {
+	total := 0
+	for _, variant := range e.Variants {
+		total += variant.Weight
+	}
+	return total
+}
+
+var (
+	activeOnce sync.Once
+	active     *Experiment
+)
+
+// Active returns the experiment configured for this process, or nil when no
+// experiment is running. An invalid definition is logged and ignored.
+func Active() *Experiment {
+	activeOnce.Do(func() {
+		spec := config.Get().Experiment
+		if spec == "" {
+			return
+		}
+		exp, err := Parse(spec)
+		if err != nil {
+			log.Printf("Ignoring invalid experiment: %v", err)
+			return
+		}
+		log.Printf("Running experiment %s with %d variants", exp.Name, len(exp.Variants))
+		active = exp
+	})
+	return active
+}
@@ -0,0 +1,132 @@
+// Package features evaluates feature flags, so new behaviors can be rolled
+// out gradually or to chosen organizations and API keys. Flags are stored in
+// the database and managed through the admin API.
+package features
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/database"
+)
+
+// Flags gating behaviors under rollout.
+const (
+	// SeriesGrouping keeps recommended books from the same series together.
+	SeriesGrouping = "series_grouping"
+	// CollaborativeStrategy makes the collaborative strategy selectable.
+	CollaborativeStrategy = "collaborative_strategy"
+)
+
+// Defaults are the states of the known flags while they have no stored rollout.
+var Defaults = map[string]bool{
+	SeriesGrouping:        true,
+	CollaborativeStrategy: true,
+}
+
+// refreshInterval is how long stored flags are used before being read again,
+// so changes made by other instances take effect within it.
+const refreshInterval = 30 * time.Second
+
+// Subject is who a flag is evaluated for. Unit identifies the entity bucketed
+// into percentage rollouts, e.g. a user pair, so it gets a stable answer.
+type Subject struct {
+	OrgID    int
+	APIKeyID int
+	Unit     string
+}
+
+var (
+	mu       sync.Mutex
+	flags    map[string]database.FeatureFlag
+	loadedAt time.Time
+	// generation counts invalidations, so flags read before one are not kept
+	generation int
+)
+
+// Enabled reports whether the flag is on for the subject. Flags without a
+// stored rollout take their default, and unknown flags are off.
+func Enabled(db *sql.DB, name string, s Subject) bool {
+	flag, ok := lookup(db, name)
+	if !ok {
+		return Defaults[name]
+	}
+	if !flag.Enabled {
+		return false
+	}
+	if slices.Contains(flag.OrgIDs, s.OrgID) || (s.APIKeyID != 0 && slices.Contains(flag.APIKeyIDs, s.APIKeyID)) {
+		return true
+	}
+	return bucket(name, s) < flag.Percentage
+}
+
+// Invalidate makes the next evaluation read the stored flags again.
+func Invalidate() {
+	mu.Lock()
+	defer mu.Unlock()
+	flags = nil
+	generation++
+}
+
+// Names returns the known flags and any stored ones, sorted.
+func Names(stored []database.FeatureFlag) []string {
+	var names []string
+	for name := range Defaults {
+		names = append(names, name)
+	}
+	for _, flag := range stored {
+		if _, ok := Defaults[flag.Name]; !ok {
+			names = append(names, flag.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the stored rollout of a flag, reading the flags again once
+// they are older than refreshInterval. On error the previous flags are used.
+// The flags are read without holding the lock, so evaluations elsewhere
+// don't wait on the database.
+func lookup(db *sql.DB, name string) (database.FeatureFlag, bool) {
+	mu.Lock()
+	current, gen := flags, generation
+	stale := flags == nil || time.Since(loadedAt) > refreshInterval
+	mu.Unlock()
+
+	if stale {
+		stored, err := database.ListFeatureFlags(db)
+		if err != nil {
+			log.Printf("Error loading feature flags: %v", err)
+		} else {
+			current = make(map[string]database.FeatureFlag, len(stored))
+			for _, flag := range stored {
+				current[flag.Name] = flag
+			}
+			mu.Lock()
+			if generation == gen {
+				flags, loadedAt = current, time.Now()
+			}
+			mu.Unlock()
+		}
+	}
+	flag, ok := current[name]
+	return flag, ok
+}
+
+// bucket places the subject in one of 100 buckets for a flag. Hashing the
+// flag name with the unit keeps different flags' rollouts independent.
+func bucket(name string, s Subject) int {
+	unit := s.Unit
+	if unit == "" {
+		unit = fmt.Sprintf("org:%d/key:%d", s.OrgID, s.APIKeyID)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + unit))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/scheduler"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/validation"
+)
+
+// maxAuditEntries caps the number of audit entries returned per query.
+const maxAuditEntries = 1000
+
+// AdminAuditHandler handles GET /admin/audit, filtering by action, actor, and
+// an RFC 3339 since/until time range.
+func AdminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v := validation.New()
+	filter := database.AuditFilter{
+		Action: query.Get("action"),
+		Actor:  query.Get("actor"),
+		Since:  v.Time(query, "since"),
+		Until:  v.Time(query, "until"),
+		Limit:  v.Int(query, "limit", 100, 1, maxAuditEntries),
+	}
+	v.Check(filter.Since.IsZero() || filter.Until.IsZero() || !filter.Until.Before(filter.Since), "until", "must not be before 'since'")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	entries, err := database.QueryAudit(db, filter)
+	if err != nil {
+		log.Printf("Error querying audit log: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error querying audit log.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+}
+
+// analyticsWindows are the time windows analytics can be summarized over.
+var analyticsWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// AdminAnalyticsHandler handles GET /admin/analytics, summarizing request
+// volume, the most recommended subjects and works, how often stored
+// recommendations were served, and recommendation latency over the 'window'
+// (1h, 24h, 7d, or 30d). 'limit' caps the lists of subjects and works.
+func AdminAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v := validation.New()
+	window := v.Enum(query, "window", "24h", "1h", "24h", "7d", "30d")
+	limit := v.Int(query, "limit", 10, 1, 100)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	analytics, err := database.GetAnalytics(db, time.Now().Add(-analyticsWindows[window]), limit)
+	if err != nil {
+		log.Printf("Error computing analytics: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error computing analytics.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"window": window, "analytics": analytics})
+}
+
+// AdminCacheStatsHandler handles GET /admin/cache, reporting statistics for every cache.
+func AdminCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := make(map[string]cache.Stats)
+	for _, name := range cache.Names() {
+		if store, ok := cache.Lookup(name); ok {
+			stats[name] = store.Stats()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"caches": stats})
+}
+
+// AdminCacheFlushHandler handles DELETE /admin/cache and DELETE /admin/cache/{name},
+// emptying every cache or just the named one.
+func AdminCacheFlushHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		cache.FlushAll()
+		log.Printf("Flushed all caches")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	store, ok := cache.Lookup(name)
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Unknown cache '%s'.", name)
+		return
+	}
+	store.Flush()
+	log.Printf("Flushed cache %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminCacheDeleteKeyHandler handles DELETE /admin/cache/{name}/{key}.
+func AdminCacheDeleteKeyHandler(w http.ResponseWriter, r *http.Request) {
+	name, key := r.PathValue("name"), r.PathValue("key")
+	store, ok := cache.Lookup(name)
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Unknown cache '%s'.", name)
+		return
+	}
+	if !store.Delete(key) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Key not cached.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminCacheInvalidateHandler handles POST /admin/cache/invalidate, purging the
+// cached data for an author, a subject, and/or a pair of users.
+func AdminCacheInvalidateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AuthorKey  string `json:"author_key"`
+		AuthorName string `json:"author_name"`
+		Subject    string `json:"subject"`
+		UserIDs    []int  `json:"user_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	v.Check(req.AuthorKey != "" || req.AuthorName != "" || req.Subject != "" || len(req.UserIDs) > 0,
+		"author_key", "or one of 'author_name', 'subject', or 'user_ids' is required")
+	v.Check(req.AuthorKey == "" || authorKeyPattern.MatchString(req.AuthorKey), "author_key", "must be an Open Library author key such as OL23919A")
+	for i, userID := range req.UserIDs {
+		v.Check(userID > 0, "user_ids["+strconv.Itoa(i)+"]", "must be a positive integer")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	invalidated := make(map[string]bool)
+	if req.AuthorKey != "" || req.AuthorName != "" {
+		invalidated["author"] = services.InvalidateAuthor(req.AuthorKey, req.AuthorName)
+	}
+	if req.Subject != "" {
+		invalidated["subject"] = services.InvalidateSubject(req.Subject)
+	}
+	if len(req.UserIDs) > 0 {
+		db, err := database.Open()
+		if err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+			return
+		}
+		defer db.Close()
+
+		// A user's stored profile is the cached result of their author and subject lookups
+		for _, userID := range req.UserIDs {
+			removed, err := database.DeleteUserProfile(db, userID)
+			if err != nil {
+				log.Printf("Error deleting profile for user ID %d: %v", userID, err)
+				writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error invalidating user profiles.")
+				return
+			}
+			invalidated["user:"+strconv.Itoa(userID)] = removed
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"invalidated": invalidated})
+}
+
+// AdminReloadConfigHandler handles POST /admin/config/reload, reloading the
+// configuration and reporting the tunables now in effect.
+func AdminReloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.Reload()
+	if err != nil {
+		log.Printf("Error reloading configuration: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Configuration could not be reloaded.")
+		return
+	}
+	log.Printf("Reloaded configuration")
+	// Pick up subject rules changed through other instances too
+	if err := LoadSubjectCuration(); err != nil {
+		log.Printf("Error reloading subject curation: %v", err)
+	}
+
+	cacheTTLs := make(map[string]string, len(cfg.CacheTTLs))
+	for name, ttl := range cfg.CacheTTLs {
+		cacheTTLs[name] = ttl.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recency_windows":      cfg.RecencyWindows,
+		"cache_ttls":           cacheTTLs,
+		"api_key_daily_quota":  cfg.APIKeyDailyQuota,
+		"upstream_call_budget": cfg.UpstreamCallBudget,
+		"pair_result_max_age":  cfg.PairResultMaxAge.String(),
+	})
+}
+
+// AdminJobsHandler handles GET /admin/jobs, reporting each background job's
+// schedule and the outcome of its last run.
+func AdminJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": scheduler.Jobs()})
+}
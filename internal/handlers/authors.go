@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+// authorKeyPattern matches Open Library author keys such as "OL23919A".
+var authorKeyPattern = regexp.MustCompile(`^OL\d+A$`)
+
+// AuthorWorksHandler handles GET /authors/{key}/works.
+func AuthorWorksHandler(w http.ResponseWriter, r *http.Request) {
+	author, ok := parseAuthorKey(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	works, err := services.GetAuthorWorks(r.Context(), author)
+	if errors.Is(err, httpclient.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Author not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching works for author '%s': %v", author.Key, err)
+		writeUpstreamProblem(w, r, err, "Error fetching author works.")
+		return
+	}
+
+	start, end := paginate(len(works), limit, offset)
+	response := map[string]interface{}{
+		"author_key": author.Key,
+		"total":      len(works),
+		"limit":      limit,
+		"offset":     offset,
+		"works":      works[start:end],
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AuthorSubjectsHandler handles GET /authors/{key}/subjects.
+func AuthorSubjectsHandler(w http.ResponseWriter, r *http.Request) {
+	author, ok := parseAuthorKey(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	subjects, err := services.GetAuthorSubjects(r.Context(), author)
+	if errors.Is(err, httpclient.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Author not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching subjects for author '%s': %v", author.Key, err)
+		writeUpstreamProblem(w, r, err, "Error fetching author subjects.")
+		return
+	}
+
+	start, end := paginate(len(subjects), limit, offset)
+	response := map[string]interface{}{
+		"author_key": author.Key,
+		"total":      len(subjects),
+		"limit":      limit,
+		"offset":     offset,
+		"subjects":   subjects[start:end],
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseAuthorKey validates the {key} path value, writing a 400 if it is malformed.
+func parseAuthorKey(w http.ResponseWriter, r *http.Request) (models.Author, bool) {
+	key := r.PathValue("key")
+	if !authorKeyPattern.MatchString(key) {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Author key must be an Open Library author key like 'OL23919A'.")
+		return models.Author{}, false
+	}
+	return models.Author{Key: key}, true
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/backup"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/validation"
+)
+
+// AdminBackupHandler handles POST /admin/backup, snapshotting the database to
+// a file in the backup directory or an s3://bucket/key location. Without a
+// location, the backup gets a timestamped file name.
+func AdminBackupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Location string `json:"location"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	if req.Location == "" {
+		req.Location = backup.DefaultName(time.Now())
+	}
+	location, ok := backupLocation(w, r, req.Location)
+	if !ok {
+		return
+	}
+
+	res, err := backup.Save(r.Context(), location)
+	if err != nil {
+		log.Printf("Error backing up the database to %s: %v", location, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error backing up the database.")
+		return
+	}
+	log.Printf("Backed up the database to %s (%d bytes)", res.Location, res.Bytes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+// AdminRestoreHandler handles POST /admin/restore, replacing the database
+// with a backup in the backup directory or at an s3://bucket/key location.
+func AdminRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Location string `json:"location"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	v.Check(req.Location != "", "location", "is required")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	location, ok := backupLocation(w, r, req.Location)
+	if !ok {
+		return
+	}
+
+	res, err := backup.Load(r.Context(), location)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Backup not found.")
+		return
+	case errors.Is(err, database.ErrInvalidBackup):
+		writeProblem(w, r, http.StatusUnprocessableEntity, problemValidation, "Backup is not a database of the current schema.")
+		return
+	case err != nil:
+		log.Printf("Error restoring the database from %s: %v", location, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error restoring the database.")
+		return
+	}
+	log.Printf("Restored the database from %s (%d bytes)", res.Location, res.Bytes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// backupLocation resolves a location given to an admin endpoint. File
+// names are confined to the backup directory, so the endpoints cannot
+// read or write elsewhere on disk.
+func backupLocation(w http.ResponseWriter, r *http.Request, location string) (string, bool) {
+	if backup.IsRemote(location) {
+		return location, true
+	}
+	v := validation.New()
+	v.Check(filepath.Base(location) == location && location != "." && location != ".." && !strings.HasSuffix(location, ".partial"),
+		"location", "must be a file name or an s3://bucket/key URL")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return "", false
+	}
+	return filepath.Join(config.Get().BackupDir, location), true
+}
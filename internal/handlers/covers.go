@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"be-takehome-2024/internal/services"
+)
+
+// CoversHandler handles GET /covers/{cover_id}/{size}, proxying Open Library
+// cover images through the local cache.
+func CoversHandler(w http.ResponseWriter, r *http.Request) {
+	coverID, err := strconv.Atoi(r.PathValue("cover_id"))
+	if err != nil || coverID <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Cover ID must be a positive integer.")
+		return
+	}
+
+	size := strings.ToUpper(r.PathValue("size"))
+	if size != "S" && size != "M" && size != "L" {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Size must be one of S, M, or L.")
+		return
+	}
+
+	data, err := services.GetCover(r.Context(), coverID, size)
+	if errors.Is(err, services.ErrCoverNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Cover not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error serving cover %d-%s: %v", coverID, size, err)
+		writeUpstreamProblem(w, r, err, "Error fetching cover image.")
+		return
+	}
+
+	// Cover IDs are immutable, so clients and CDNs may cache them for a long time
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=2592000, immutable")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/features"
+	"be-takehome-2024/internal/validation"
+)
+
+// flagNamePattern matches feature flag names.
+var flagNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// featureSubject returns who feature flags are evaluated for on this request,
+// bucketing percentage rollouts by unit.
+func featureSubject(r *http.Request, unit string) features.Subject {
+	t := requestTenant(r)
+	s := features.Subject{OrgID: t.OrgID, Unit: unit}
+	if t.APIKey != nil {
+		s.APIKeyID = t.APIKey.ID
+	}
+	return s
+}
+
+// AdminListFeaturesHandler handles GET /admin/features, listing every known or
+// stored flag with its rollout, or its default when it has none.
+func AdminListFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	stored, err := database.ListFeatureFlags(db)
+	if err != nil {
+		log.Printf("Error listing feature flags: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing feature flags.")
+		return
+	}
+	byName := make(map[string]database.FeatureFlag)
+	for _, flag := range stored {
+		byName[flag.Name] = flag
+	}
+
+	var flags []interface{}
+	for _, name := range features.Names(stored) {
+		if flag, ok := byName[name]; ok {
+			flags = append(flags, flag)
+		} else {
+			flags = append(flags, map[string]interface{}{"name": name, "default": features.Defaults[name]})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"features": flags})
+}
+
+// AdminSetFeatureHandler handles PUT /admin/features/{name}, replacing the
+// flag's rollout. Percentage defaults to 100, turning the flag on for everyone.
+func AdminSetFeatureHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled    *bool `json:"enabled"`
+		Percentage *int  `json:"percentage"`
+		OrgIDs     []int `json:"org_ids"`
+		APIKeyIDs  []int `json:"api_key_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	name := r.PathValue("name")
+	percentage := 100
+	if req.Percentage != nil {
+		percentage = *req.Percentage
+	}
+	v := validation.New()
+	v.Check(flagNamePattern.MatchString(name), "name", "must be lowercase letters, digits, and underscores")
+	v.Check(req.Enabled != nil, "enabled", "is required")
+	v.Check(percentage >= 0 && percentage <= 100, "percentage", "must be an integer between %d and %d", 0, 100)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	flag, err := database.SaveFeatureFlag(db, database.FeatureFlag{
+		Name:       name,
+		Enabled:    *req.Enabled,
+		Percentage: percentage,
+		OrgIDs:     req.OrgIDs,
+		APIKeyIDs:  req.APIKeyIDs,
+	})
+	if err != nil {
+		log.Printf("Error saving feature flag %s: %v", name, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error saving feature flag.")
+		return
+	}
+	features.Invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"feature": flag})
+}
+
+// AdminDeleteFeatureHandler handles DELETE /admin/features/{name}, returning
+// the flag to its default.
+func AdminDeleteFeatureHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	deleted, err := database.DeleteFeatureFlag(db, r.PathValue("name"))
+	if err != nil {
+		log.Printf("Error deleting feature flag: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error deleting feature flag.")
+		return
+	}
+	if !deleted {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Feature flag not found.")
+		return
+	}
+	features.Invalidate()
+	w.WriteHeader(http.StatusNoContent)
+}
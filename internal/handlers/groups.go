@@ -0,0 +1,635 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/events"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/recommend"
+	"be-takehome-2024/internal/reqlog"
+	"be-takehome-2024/internal/timing"
+	"be-takehome-2024/internal/validation"
+)
+
+// maxGroupMembers caps a group's size, since recommending for it builds
+// every member's subject profile.
+const maxGroupMembers = 20
+
+// CreateGroupHandler handles POST /groups, creating a book club of users in
+// the request's organization.
+func CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string `json:"name"`
+		MemberIDs []int  `json:"member_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	v := validation.New()
+	v.Required("name", req.Name)
+	v.Check(len(req.MemberIDs) >= 1 && len(req.MemberIDs) <= maxGroupMembers, "member_ids", "must have between %d and %d items", 1, maxGroupMembers)
+	for i, userID := range req.MemberIDs {
+		v.Check(userID >= 1, "member_ids["+strconv.Itoa(i)+"]", "must be a positive integer")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	for _, userID := range req.MemberIDs {
+		if !checkUserInTenant(w, r, db, userID) {
+			return
+		}
+	}
+	group, err := database.CreateGroup(db, requestTenant(r).OrgID, req.Name, req.MemberIDs)
+	if err != nil {
+		log.Printf("Error creating group %s: %v", req.Name, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating group.")
+		return
+	}
+
+	log.Printf("Created group ID %d with %d members", group.ID, len(group.MemberIDs))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"group": group})
+}
+
+// GetGroupHandler handles GET /groups/{id}.
+func GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"group": group})
+}
+
+// JoinGroupHandler handles POST /groups/{id}/members, adding a user of the
+// request's organization to the group.
+func JoinGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	v.Check(req.UserID >= 1, "user_id", "must be a positive integer")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok || !checkUserInTenant(w, r, db, req.UserID) {
+		return
+	}
+	if len(group.MemberIDs) >= maxGroupMembers {
+		writeProblem(w, r, http.StatusConflict, problemConflict, "Group %d already has the maximum of %d members.", group.ID, maxGroupMembers)
+		return
+	}
+
+	added, err := database.AddGroupMember(db, group.ID, req.UserID)
+	if err != nil {
+		log.Printf("Error adding user ID %d to group %d: %v", req.UserID, group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating group.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if added {
+		group.MemberIDs = append(group.MemberIDs, req.UserID)
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"group": group})
+}
+
+// LeaveGroupHandler handles DELETE /groups/{id}/members/{user_id}, removing a
+// member and withdrawing their votes.
+func LeaveGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil || userID <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "User ID must be a positive integer.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok {
+		return
+	}
+	removed, err := database.RemoveGroupMember(db, group.ID, userID)
+	if err != nil {
+		log.Printf("Error removing user ID %d from group %d: %v", userID, group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating group.")
+		return
+	}
+	if !removed {
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User ID %d is not a member of group %d.", userID, group.ID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GroupRecommendationsHandler handles GET /groups/{id}/recommendations,
+// recommending books from the subjects most of the group shares. It takes
+// the same options as /recommendations, less the strategy, semantic_subjects,
+// and rollup.
+func GroupRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+	v := validation.New()
+	opts := parseRecommendationOptions(v, r.URL.Query())
+	checkSubjectMatching(v, opts, "")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok {
+		return
+	}
+	if len(group.MemberIDs) < 2 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Group %d needs at least two members to be recommended books.", group.ID)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Each pair of members may cost as much as a pair recommendation
+	callBudget := config.Get().UpstreamCallBudget * ((len(group.MemberIDs) + 1) / 2)
+	calls := budget.New(callBudget)
+	if opts.CacheOnly {
+		calls.SetCacheOnly()
+	}
+	ctx = budget.WithBudget(ctx, calls)
+	timings := timing.New()
+	ctx = timing.WithTimings(ctx, timings)
+	// Report the stages to the detail log however the request ends
+	defer func() { reqlog.FromContext(ctx).SetStages(timings.Milliseconds()) }()
+
+	result, err := recommend.RecommendGroup(ctx, db, recommend.GroupRequest{
+		OrgID:       requestTenant(r).OrgID,
+		GroupID:     group.ID,
+		MemberIDs:   group.MemberIDs,
+		Weighting:   opts.Weighting,
+		Books:       opts.Books,
+		TopSubjects: opts.TopSubjects,
+		Scoring:     opts.Scoring,
+		Audience:    opts.Audience,
+		FavoriteCap: favoriteAuthorsCap(requestTenant(r).APIKey),
+	})
+	var noMatch *recommend.NoMatchError
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		log.Printf("Recommendation for group %d abandoned: client disconnected", group.ID)
+		return
+	case err != nil && calls.Exceeded():
+		writeProblem(w, r, http.StatusServiceUnavailable, problemBudgetExceeded,
+			"The request needed more than %d upstream calls.", callBudget)
+		return
+	case err != nil && calls.CacheMissed():
+		log.Printf("Cache-only recommendation missed the cache: %v", err)
+		writeProblem(w, r, http.StatusServiceUnavailable, problemNotCached, "The data needed is not cached.")
+		return
+	case errors.As(err, &noMatch) && noMatch.Diagnostics != nil:
+		writeNoMatch(w, r, noMatch, "", calls, timings, requestStart)
+		return
+	case errors.As(err, &noMatch):
+		writeProblem(w, r, http.StatusNotFound, problemNoCommonSubject, "%s", err.Error())
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		writeProblem(w, r, http.StatusGatewayTimeout, problemTimeout, "Request timed out.")
+		return
+	case err != nil:
+		writeFailure(w, r, err, fmt.Sprintf("recommending books for group %d", group.ID))
+		return
+	}
+	// Members vote on the stored recommendation, so it must be complete
+	if !result.Partial {
+		if err := recommend.SaveGroup(db, group.ID, result); err != nil {
+			log.Printf("Error storing recommendation for group %d: %v", group.ID, err)
+		}
+	}
+	reqlog.FromContext(ctx).SetSubject(result.Subject)
+
+	// Prepare the response, in the client's language
+	lang := requestLanguage(r)
+	subjectNames := localizeSubjects(db, lang, result.Subject, result.Books)
+	for i, book := range result.Books {
+		if book.Subject != "" {
+			result.Books[i].SubjectName = subjectNames[book.Subject]
+		}
+	}
+	response := map[string]interface{}{
+		"group_id":           group.ID,
+		"common_subject":     subjectNames[result.Subject],
+		"common_subject_key": result.Subject,
+		"subjects":           result.Subjects,
+		"recommendations":    result.Books,
+		"as_of":              result.AsOf,
+	}
+	if len(result.LeftOut) > 0 {
+		response["left_out"] = result.LeftOut
+	}
+	if result.Partial {
+		response["partial"] = true
+	}
+	if len(result.Warnings) > 0 {
+		response["warnings"] = localizeWarnings(lang, result.Warnings)
+	}
+	if opts.IncludeAuthorBios {
+		response["author_bios"] = recommendedAuthorBios(ctx, result.Books)
+	}
+
+	meta := responseMeta{
+		UpstreamCalls: calls.UpstreamCalls(),
+		CacheHits:     calls.CacheHits(),
+		TimingsMS:     timings.Milliseconds(),
+		ComputedAt:    result.AsOf,
+	}
+	if !result.SubjectsAsOf.IsZero() {
+		meta.SubjectsComputedAt = &result.SubjectsAsOf
+	}
+	meta.TimingsMS["total"] = float64(time.Since(requestStart).Microseconds()) / 1000
+	response["meta"] = meta
+
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// VoteGroupRecommendationHandler handles POST
+// /groups/{id}/recommendations/{work_key}/vote, where a member votes for one
+// of the group's latest recommendations as its next read. The work joins
+// the reading list, tagged with the score of the subject it was recommended
+// from, and the tally is returned.
+func VoteGroupRecommendationHandler(w http.ResponseWriter, r *http.Request) {
+	key := workKey(r.PathValue("work_key"))
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	v.Check(req.UserID >= 1, "user_id", "must be a positive integer")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok || !checkGroupMember(w, r, group, req.UserID) {
+		return
+	}
+	latest, err := recommend.LoadGroup(db, group.ID)
+	if err != nil {
+		log.Printf("Error loading recommendation for group %d: %v", group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+		return
+	}
+	var (
+		book    models.Work
+		subject recommend.GroupSubject
+	)
+	if latest != nil {
+		book, subject, ok = latest.Book(key)
+	}
+	if latest == nil || !ok {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Work '%s' is not among group %d's latest recommendations.", key, group.ID)
+		return
+	}
+
+	entry := database.ReadingListEntry{
+		WorkKey:      book.Key,
+		Title:        book.Title,
+		Authors:      book.Authors,
+		AddedBy:      req.UserID,
+		Subject:      subject.Subject,
+		SubjectScore: subject.Score,
+	}
+	if entry.Authors == nil {
+		entry.Authors = []string{}
+	}
+	err = database.AddReadingListEntry(db, group.ID, entry)
+	if err == nil {
+		err = database.VoteReadingListEntry(db, group.ID, entry.WorkKey, req.UserID)
+	}
+	if err != nil {
+		log.Printf("Error recording vote of user ID %d on %s in group %d: %v", req.UserID, key, group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating reading list.")
+		return
+	}
+	publishVote(group, entry.WorkKey, req.UserID, "vote")
+	writeTally(w, r, db, group.ID)
+}
+
+// GroupTallyHandler handles GET /groups/{id}/recommendations/tally, ranking
+// the works members voted for. Ties on votes go to the work from the higher
+// scoring subject; the first ranked work is the group's pick.
+func GroupTallyHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok {
+		return
+	}
+	writeTally(w, r, db, group.ID)
+}
+
+// writeTally responds with the group's voted works, highest ranked first,
+// and its pick if any work has votes.
+func writeTally(w http.ResponseWriter, r *http.Request, db *sql.DB, groupID int) {
+	entries, err := database.GetReadingList(db, groupID)
+	if err != nil {
+		log.Printf("Error loading reading list of group %d: %v", groupID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading reading list.")
+		return
+	}
+	tally := []database.ReadingListEntry{}
+	for _, entry := range entries {
+		if entry.Votes > 0 {
+			tally = append(tally, entry)
+		}
+	}
+	response := map[string]interface{}{"tally": tally}
+	if len(tally) > 0 {
+		response["pick"] = tally[0]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetReadingListHandler handles GET /groups/{id}/reading-list, most voted first.
+func GetReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok {
+		return
+	}
+	entries, err := database.GetReadingList(db, group.ID)
+	if err != nil {
+		log.Printf("Error loading reading list of group %d: %v", group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading reading list.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"reading_list": entries})
+}
+
+// AddReadingListHandler handles POST /groups/{id}/reading-list, where a
+// member puts a work, typically a group recommendation, on the shared list.
+func AddReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		WorkKey string   `json:"work_key"`
+		Title   string   `json:"title"`
+		Authors []string `json:"authors"`
+		UserID  int      `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	entry := database.ReadingListEntry{
+		WorkKey: workKey(req.WorkKey),
+		Title:   strings.TrimSpace(req.Title),
+		Authors: []string{},
+		AddedBy: req.UserID,
+	}
+	for _, author := range req.Authors {
+		if author = strings.TrimSpace(author); author != "" {
+			entry.Authors = append(entry.Authors, author)
+		}
+	}
+	v := validation.New()
+	checkWorkKey(v, "work_key", entry.WorkKey)
+	v.Required("title", entry.Title)
+	v.Check(req.UserID >= 1, "user_id", "must be a positive integer")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok || !checkGroupMember(w, r, group, req.UserID) {
+		return
+	}
+	if err := database.AddReadingListEntry(db, group.ID, entry); err != nil {
+		log.Printf("Error adding %s to the reading list of group %d: %v", entry.WorkKey, group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating reading list.")
+		return
+	}
+	writeReadingList(w, r, db, group.ID, http.StatusCreated)
+}
+
+// RemoveReadingListHandler handles DELETE
+// /groups/{id}/reading-list/{work_key}?user_id=, removing a work from the
+// reading list on behalf of a member.
+func RemoveReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	key := workKey(r.PathValue("work_key"))
+	v := validation.New()
+	userID := v.RequiredInt(r.URL.Query(), "user_id", 1, math.MaxInt)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok || !checkGroupMember(w, r, group, userID) {
+		return
+	}
+	removed, err := database.RemoveReadingListEntry(db, group.ID, key)
+	if err != nil {
+		log.Printf("Error removing %s from the reading list of group %d: %v", key, group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating reading list.")
+		return
+	}
+	if !removed {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Work '%s' is not on the group's reading list.", key)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VoteReadingListHandler handles PUT and DELETE on
+// /groups/{id}/reading-list/{work_key}/votes/{user_id}, casting or
+// withdrawing a member's vote to read the work next. It responds with the
+// reordered reading list.
+func VoteReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	key := workKey(r.PathValue("work_key"))
+	userID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil || userID <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "User ID must be a positive integer.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	group, ok := loadGroup(w, r, db)
+	if !ok || !checkGroupMember(w, r, group, userID) {
+		return
+	}
+
+	kind := "vote"
+	if r.Method == http.MethodDelete {
+		kind = "unvote"
+		_, err = database.UnvoteReadingListEntry(db, group.ID, key, userID)
+	} else {
+		err = database.VoteReadingListEntry(db, group.ID, key, userID)
+	}
+	if errors.Is(err, database.ErrReadingListEntryNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Work '%s' is not on the group's reading list.", key)
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording vote of user ID %d on %s in group %d: %v", userID, key, group.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating reading list.")
+		return
+	}
+	publishVote(group, key, userID, kind)
+	writeReadingList(w, r, db, group.ID, http.StatusOK)
+}
+
+// publishVote publishes a member's vote on a work, of kind "vote" or "unvote",
+// as feedback.
+func publishVote(group database.Group, workKey string, userID int, kind string) {
+	events.Publish(events.FeedbackReceived, group.OrgID, map[string]interface{}{
+		"kind":     kind,
+		"user_id":  userID,
+		"group_id": group.ID,
+		"work_key": workKey,
+	})
+}
+
+// writeReadingList responds with the group's reading list.
+func writeReadingList(w http.ResponseWriter, r *http.Request, db *sql.DB, groupID, status int) {
+	entries, err := database.GetReadingList(db, groupID)
+	if err != nil {
+		log.Printf("Error loading reading list of group %d: %v", groupID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading reading list.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"reading_list": entries})
+}
+
+// loadGroup returns the group named by the {id} path value, writing a 404
+// unless it belongs to the request's organization.
+func loadGroup(w http.ResponseWriter, r *http.Request, db *sql.DB) (database.Group, bool) {
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || groupID <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Group ID must be a positive integer.")
+		return database.Group{}, false
+	}
+	group, err := database.GetGroup(db, requestTenant(r).OrgID, groupID)
+	if errors.Is(err, database.ErrGroupNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Group %d not found.", groupID)
+		return database.Group{}, false
+	}
+	if err != nil {
+		log.Printf("Error loading group %d: %v", groupID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+		return database.Group{}, false
+	}
+	return group, true
+}
+
+// checkGroupMember writes a 403 unless the user is a member of the group.
+func checkGroupMember(w http.ResponseWriter, r *http.Request, group database.Group, userID int) bool {
+	for _, memberID := range group.MemberIDs {
+		if memberID == userID {
+			return true
+		}
+	}
+	writeProblem(w, r, http.StatusForbidden, problemForbidden, "User ID %d is not a member of group %d.", userID, group.ID)
+	return false
+}
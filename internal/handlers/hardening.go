@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"be-takehome-2024/internal/config"
+)
+
+// Hardened sets standard security headers on every response served by next,
+// and rejects requests whose URL, query parameters, or body exceed the
+// configured limits before they reach it. Bodies sent without a length are
+// cut off at the limit, failing to decode.
+func Hardened(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setSecurityHeaders(w, r)
+
+		cfg := config.Get()
+		if cfg.MaxURLLength > 0 && len(r.RequestURI) > cfg.MaxURLLength {
+			writeProblem(w, r, http.StatusRequestURITooLong, problemRequestTooLarge, "The URL exceeds %d characters.", cfg.MaxURLLength)
+			return
+		}
+		if cfg.MaxQueryParamLength > 0 {
+			if name, ok := longQueryParam(r.URL, cfg.MaxQueryParamLength); ok {
+				writeProblem(w, r, http.StatusRequestURITooLong, problemRequestTooLarge, "Query parameter %s exceeds %d characters.", name, cfg.MaxQueryParamLength)
+				return
+			}
+		}
+		if cfg.MaxRequestBodyBytes > 0 {
+			if r.ContentLength > int64(cfg.MaxRequestBodyBytes) {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, problemRequestTooLarge, "The request body exceeds %d bytes.", cfg.MaxRequestBodyBytes)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxRequestBodyBytes))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setSecurityHeaders sets headers keeping browsers from sniffing, framing, or
+// running responses as anything but the API's JSON, and from leaking its URLs
+// as referrers. Over TLS, browsers are also told to keep to HTTPS.
+func setSecurityHeaders(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	header.Set("Referrer-Policy", "no-referrer")
+	if r.TLS != nil {
+		header.Set("Strict-Transport-Security", "max-age=31536000")
+	}
+}
+
+// longQueryParam returns the name of the first query parameter whose name or
+// value is longer than max characters, shortened if the name itself is.
+func longQueryParam(u *url.URL, max int) (string, bool) {
+	for name, values := range u.Query() {
+		long := len(name) > max
+		for _, value := range values {
+			long = long || len(value) > max
+		}
+		if long {
+			if len(name) > 32 {
+				name = name[:32] + "…"
+			}
+			return strings.ToValidUTF8(name, ""), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/metrics"
+	"be-takehome-2024/internal/queue"
+	"be-takehome-2024/internal/scheduler"
+	"be-takehome-2024/internal/services"
+)
+
+// ReadyzHandler reports whether the server is ready for traffic. It returns
+// 503 while the startup warm-up is still running.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !services.Ready() {
+		writeProblem(w, r, http.StatusServiceUnavailable, problemNotReady, "Warming up.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
+
+// AdminStatusHandler handles GET /admin/status, summarizing in one document
+// what degrades service: whether the live provider is skipping Open Library,
+// recent calls to each upstream, task queue depths, cache sizes, and
+// background job health. Status is "degraded", with the issues listed, when
+// any of them needs attention.
+func AdminStatusHandler(w http.ResponseWriter, r *http.Request) {
+	issues := []string{}
+	if !services.Ready() {
+		issues = append(issues, "warming up")
+	}
+
+	provider := services.LiveProvider.Health()
+	if provider.State == "open" {
+		issues = append(issues, fmt.Sprintf("%s skipped until %s (%s)", provider.Primary, provider.DownUntil.Format(time.RFC3339), provider.DownReason))
+	}
+
+	window, upstreams := metrics.Upstreams()
+
+	queueDepths := make(map[string]int)
+	for _, status := range []string{queue.StatusQueued, queue.StatusRunning, queue.StatusDead} {
+		tasks, err := queue.List(r.Context(), queue.Filter{Status: status})
+		if err != nil {
+			log.Printf("Error listing %s tasks: %v", status, err)
+			issues = append(issues, "task queue unavailable")
+			break
+		}
+		queueDepths[status] = len(tasks)
+	}
+	if queueDepths[queue.StatusDead] > 0 {
+		issues = append(issues, fmt.Sprintf("%d dead-lettered tasks", queueDepths[queue.StatusDead]))
+	}
+
+	caches := make(map[string]cache.Stats)
+	for _, name := range cache.Names() {
+		if store, ok := cache.Lookup(name); ok {
+			caches[name] = store.Stats()
+		}
+	}
+
+	jobs := scheduler.Jobs()
+	for _, job := range jobs {
+		if job.Enabled && job.LastError != "" {
+			issues = append(issues, fmt.Sprintf("job %s failed its last run", job.Name))
+		}
+	}
+
+	status := "ok"
+	if len(issues) > 0 {
+		status = "degraded"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"issues":   issues,
+		"provider": provider,
+		"upstreams": map[string]interface{}{
+			"window": window.String(),
+			"usage":  upstreams,
+		},
+		"queue":  queueDepths,
+		"caches": caches,
+		"jobs":   jobs,
+	})
+}
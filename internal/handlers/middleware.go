@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/metrics"
+	"be-takehome-2024/internal/random"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/reqlog"
+)
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Audited records each call of the handler in the audit log under the given action.
+func Audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		params := make(map[string]string)
+		for key, values := range r.URL.Query() {
+			params[key] = strings.Join(values, ",")
+		}
+		entry := database.AuditEntry{
+			Action:     action,
+			Actor:      clientIP(r),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Params:     params,
+			Status:     rec.status,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+
+		db, err := database.Open()
+		if err != nil {
+			log.Printf("Error opening database for audit log: %v", err)
+			return
+		}
+		defer db.Close()
+		if err := database.RecordAudit(db, entry); err != nil {
+			log.Printf("Error recording audit entry for %s: %v", action, err)
+		}
+	}
+}
+
+// Measured records the route, status, and latency of every request served by
+// next, a mux, in the metrics. Requests matching no route are recorded under
+// the route "unmatched".
+func Measured(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// The mux sets the pattern it matched; the method is its own label
+		route := r.Pattern
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(route, r.Method, rec.status, time.Since(start))
+	})
+}
+
+// DetailLogged logs the details of a sample of the requests served by next,
+// and of every request slower than the configured threshold: the stage
+// timings, chosen subject, author resolution outcomes, and upstream calls
+// recorded while serving it. It must wrap Measured, which reads the route the
+// mux matched from the request this passes on.
+func DetailLogged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get()
+		sampled := cfg.DetailLogSampleRate > 0 && random.Float64() < cfg.DetailLogSampleRate
+		start := time.Now()
+		details := reqlog.New()
+		r = r.WithContext(reqlog.WithRecord(r.Context(), details))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		elapsed := time.Since(start)
+		slow := elapsed >= cfg.SlowRequestThreshold
+		if !sampled && !slow {
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		reason := "sampled"
+		if slow {
+			reason = "slow"
+		}
+		// Keep URLs' ampersands readable in the log
+		var encoded bytes.Buffer
+		enc := json.NewEncoder(&encoded)
+		enc.SetEscapeHTML(false)
+		err := enc.Encode(struct {
+			Reason     string  `json:"reason"`
+			Method     string  `json:"method"`
+			Path       string  `json:"path"`
+			Route      string  `json:"route,omitempty"`
+			Status     int     `json:"status"`
+			DurationMS float64 `json:"duration_ms"`
+			reqlog.Details
+		}{reason, r.Method, redactQuery(r.URL, "user1", "user2", "username").RequestURI(), r.Pattern, rec.status, float64(elapsed.Microseconds()) / 1000, redactDetails(details.Details())})
+		if err != nil {
+			log.Printf("Error encoding request details: %v", err)
+			return
+		}
+		log.Printf("Request details: %s", bytes.TrimSpace(encoded.Bytes()))
+	})
+}
+
+// redactDetails hides the names of users' favorite authors, and the searches
+// for them, in logged request details.
+func redactDetails(details reqlog.Details) reqlog.Details {
+	for i, author := range details.Authors {
+		details.Authors[i].Name = redact.Name(author.Name)
+	}
+	for i, call := range details.UpstreamCalls {
+		if u, err := url.Parse(call.URL); err == nil {
+			details.UpstreamCalls[i].URL = redactQuery(u, "q").String()
+		}
+	}
+	return details
+}
+
+// redactQuery returns a copy of u with the values of the query parameters
+// redacted, since they may name a user or their favorite authors. Numeric
+// IDs are kept.
+func redactQuery(u *url.URL, params ...string) *url.URL {
+	query := u.Query()
+	redacted := *u
+	for _, param := range params {
+		if _, err := strconv.Atoi(query.Get(param)); err != nil && query.Has(param) {
+			query.Set(param, redact.Name(query.Get(param)))
+			redacted.RawQuery = query.Encode()
+		}
+	}
+	return &redacted
+}
+
+// RequireAdmin rejects requests that do not carry the configured admin token.
+// Admin endpoints are disabled entirely when no token is configured.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.Get().AdminToken
+		if token == "" {
+			writeProblem(w, r, http.StatusForbidden, problemForbidden, "Admin API is disabled.")
+			return
+		}
+		if !isAdmin(r) {
+			writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "Invalid admin token.")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether the request carries the configured admin token.
+func isAdmin(r *http.Request) bool {
+	token := config.Get().AdminToken
+	if token == "" {
+		return false
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// clientIP returns the remote address without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
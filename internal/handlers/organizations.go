@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/validation"
+)
+
+// slugPattern matches organization slugs, as sent in the X-Organization header.
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// AdminCreateOrganizationHandler handles POST /admin/organizations.
+func AdminCreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	v := validation.New()
+	v.Required("name", req.Name)
+	v.Check(slugPattern.MatchString(req.Slug), "slug", "must be lowercase letters, digits, and hyphens")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if _, err := database.GetOrganizationBySlug(db, req.Slug); err == nil {
+		writeProblem(w, r, http.StatusConflict, problemConflict, "Organization '%s' already exists.", req.Slug)
+		return
+	}
+	org, err := database.CreateOrganization(db, req.Name, req.Slug)
+	if err != nil {
+		log.Printf("Error creating organization %s: %v", req.Slug, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating organization.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"organization": org})
+}
+
+// AdminListOrganizationsHandler handles GET /admin/organizations.
+func AdminListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	orgs, err := database.ListOrganizations(db)
+	if err != nil {
+		log.Printf("Error listing organizations: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing organizations.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"organizations": orgs})
+}
+
+// AdminCreateAPIKeyHandler handles POST /admin/organizations/{id}/api-keys,
+// optionally with a daily request quota overriding the default and as a
+// premium key. The key is only returned here.
+func AdminCreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Organization ID must be a valid integer.")
+		return
+	}
+	var req struct {
+		Name       string `json:"name"`
+		DailyQuota *int   `json:"daily_quota"`
+		Premium    bool   `json:"premium"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	v := validation.New()
+	v.Required("name", req.Name)
+	v.Check(req.DailyQuota == nil || *req.DailyQuota >= 0, "daily_quota", "must be a non-negative integer, or 0 for unlimited")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if _, err := database.GetOrganization(db, orgID); errors.Is(err, database.ErrOrganizationNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Organization not found.")
+		return
+	} else if err != nil {
+		log.Printf("Error loading organization %d: %v", orgID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating API key.")
+		return
+	}
+
+	apiKey, key, err := database.CreateAPIKey(db, orgID, req.Name, req.DailyQuota, req.Premium)
+	if err != nil {
+		log.Printf("Error creating API key for organization %d: %v", orgID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating API key.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// AdminRevokeAPIKeyHandler handles DELETE /admin/api-keys/{id}.
+func AdminRevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "API key ID must be a valid integer.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	revoked, err := database.RevokeAPIKey(db, id)
+	if err != nil {
+		log.Printf("Error revoking API key %d: %v", id, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error revoking API key.")
+		return
+	}
+	if !revoked {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "API key not found.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
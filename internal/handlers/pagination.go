@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+
+	"be-takehome-2024/internal/validation"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePagination reads the optional limit and offset query parameters.
+func parsePagination(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+	v := validation.New()
+	limit = v.Int(query, "limit", defaultPageLimit, 1, maxPageLimit)
+	offset = v.Int(query, "offset", 0, 0, math.MaxInt)
+	return limit, offset, v.Err()
+}
+
+// paginate returns the bounds of the requested page within a slice of length n.
+func paginate(n, limit, offset int) (start, end int) {
+	if offset > n {
+		offset = n
+	}
+	end = offset + limit
+	if end > n {
+		end = n
+	}
+	return offset, end
+}
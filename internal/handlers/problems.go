@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/providers"
+	"be-takehome-2024/internal/validation"
+)
+
+// Problem types identify each class of error, so clients can branch on the
+// type rather than parse the detail message. They are URI references
+// relative to the API's base URL.
+const (
+	problemBadRequest           = "/problems/bad-request"
+	problemValidation           = "/problems/validation-error"
+	problemUnauthorized         = "/problems/unauthorized"
+	problemForbidden            = "/problems/forbidden"
+	problemNotFound             = "/problems/not-found"
+	problemUserNotFound         = "/problems/user-not-found"
+	problemNoCommonSubject      = "/problems/no-common-subject"
+	problemConflict             = "/problems/conflict"
+	problemPreconditionFailed   = "/problems/precondition-failed"
+	problemPreconditionRequired = "/problems/precondition-required"
+	problemQuotaExceeded        = "/problems/quota-exceeded"
+	problemInternal             = "/problems/internal-error"
+	problemUpstreamUnavailable  = "/problems/upstream-unavailable"
+	problemNotReady             = "/problems/not-ready"
+	problemTimeout              = "/problems/timeout"
+	problemBudgetExceeded       = "/problems/upstream-budget-exceeded"
+	problemNotCached            = "/problems/not-cached"
+	problemRequestTooLarge      = "/problems/request-too-large"
+)
+
+// requestLanguage returns the language to respond in, from the Accept-Language header.
+func requestLanguage(r *http.Request) string {
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// problemTitles are the short, unchanging summaries of each problem type.
+var problemTitles = map[string]string{
+	problemBadRequest:           "Bad request",
+	problemValidation:           "Invalid request parameters",
+	problemUnauthorized:         "Unauthorized",
+	problemForbidden:            "Forbidden",
+	problemNotFound:             "Not found",
+	problemUserNotFound:         "User not found",
+	problemNoCommonSubject:      "No common subject",
+	problemConflict:             "Conflict",
+	problemPreconditionFailed:   "Precondition failed",
+	problemPreconditionRequired: "Precondition required",
+	problemQuotaExceeded:        "Quota exceeded",
+	problemInternal:             "Internal server error",
+	problemUpstreamUnavailable:  "Upstream service unavailable",
+	problemNotReady:             "Service not ready",
+	problemTimeout:              "Request timed out",
+	problemBudgetExceeded:       "Upstream call budget exceeded",
+	problemNotCached:            "Data not cached",
+	problemRequestTooLarge:      "Request too large",
+}
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists the invalid fields of a validation-error problem.
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// writeProblem responds with an application/problem+json error of the given
+// type, its detail formatted in the client's language.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, problemType, format string, args ...interface{}) {
+	lang := requestLanguage(r)
+	writeProblemBody(w, lang, problem{Type: problemType, Status: status, Detail: i18n.T(lang, format, args...)})
+}
+
+// writeUpstreamProblem responds to a request failed by an upstream: with 503
+// and the upstream's Retry-After when it rate limited the service, so clients
+// back off, and with 502 otherwise.
+func writeUpstreamProblem(w http.ResponseWriter, r *http.Request, err error, format string, args ...interface{}) {
+	if !errors.Is(err, httpclient.ErrRateLimited) {
+		writeProblem(w, r, http.StatusBadGateway, problemUpstreamUnavailable, format, args...)
+		return
+	}
+	if wait := httpclient.RetryAfter(err); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	writeProblem(w, r, http.StatusServiceUnavailable, problemUpstreamUnavailable, format, args...)
+}
+
+// writeFailure responds to a request failed by err in none of the ways its
+// handler reports itself: as an upstream problem when an upstream call
+// caused it, and with 500 otherwise. The detail is fixed either way, and err
+// is only logged, as what went wrong inside is no business of the client's.
+func writeFailure(w http.ResponseWriter, r *http.Request, err error, action string) {
+	log.Printf("Error %s: %v", action, err)
+	if fromUpstream(err) {
+		writeUpstreamProblem(w, r, err, "A book data service failed to respond.")
+		return
+	}
+	writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Internal server error.")
+}
+
+// fromUpstream reports whether err came from an upstream call: a response
+// without a 200 status or in an unexpected schema, or a network failure.
+func fromUpstream(err error) bool {
+	var (
+		statusErr *httpclient.StatusError
+		netErr    net.Error
+	)
+	return errors.As(err, &statusErr) || errors.Is(err, providers.ErrSchemaDrift) || errors.As(err, &netErr)
+}
+
+func writeProblemBody(w http.ResponseWriter, lang string, p problem) {
+	p.Title = i18n.T(lang, problemTitles[p.Type])
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+)
+
+// usageHistoryDays is how many days of usage GET /me/usage reports.
+const usageHistoryDays = 30
+
+// dailyQuota returns the number of requests the API key may make per day,
+// or zero when it is unlimited.
+func dailyQuota(apiKey *database.APIKey) int {
+	if apiKey.DailyQuota != nil {
+		return *apiKey.DailyQuota
+	}
+	return config.Get().APIKeyDailyQuota
+}
+
+// nextUsageDay returns when the current usage day ends.
+func nextUsageDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// EnforceQuota counts each request made with an API key against the key's
+// daily quota, rejecting requests with 429 once it is used up. It must wrap
+// a handler already wrapped by WithTenant. Requests without an API key are
+// counted against their client address, under API_KEY_DAILY_QUOTA, except
+// the admin's, which are not metered.
+func EnforceQuota(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := requestTenant(r)
+		apiKey := t.APIKey
+		if apiKey == nil && t.Admin {
+			next(w, r)
+			return
+		}
+
+		db, err := database.Open()
+		if err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+			return
+		}
+		now := time.Now()
+		day := database.UsageDay(now)
+		var (
+			quota, used int
+			ok          bool
+		)
+		if apiKey != nil {
+			quota = dailyQuota(apiKey)
+			used, ok, err = database.IncrementAPIKeyUsage(db, apiKey.ID, day, quota)
+		} else {
+			quota = config.Get().APIKeyDailyQuota
+			used, ok, err = database.IncrementAnonymousUsage(db, clientIP(r), day, quota)
+		}
+		db.Close()
+		if err != nil {
+			log.Printf("Error recording usage of %s: %v", usageOwner(apiKey), err)
+		} else if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(nextUsageDay(now).Sub(now).Seconds())+1))
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(quota))
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			writeProblem(w, r, http.StatusTooManyRequests, problemQuotaExceeded, "Daily request quota exceeded.")
+			return
+		} else if quota > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(quota))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(quota-used, 0)))
+		}
+		next(w, r)
+	}
+}
+
+// usageOwner names who a request's usage is counted against, for logs.
+func usageOwner(apiKey *database.APIKey) string {
+	if apiKey == nil {
+		return "anonymous client"
+	}
+	return "API key " + strconv.Itoa(apiKey.ID)
+}
+
+// MeUsageHandler handles GET /me/usage, reporting the calling API key's
+// request count and quota for today along with its recent daily usage.
+func MeUsageHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := requestTenant(r).APIKey
+	if apiKey == nil {
+		writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "An API key is required.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	now := time.Now()
+	day := database.UsageDay(now)
+	used, err := database.GetAPIKeyUsage(db, apiKey.ID, day)
+	if err != nil {
+		log.Printf("Error loading usage of API key %d: %v", apiKey.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading usage.")
+		return
+	}
+	history, err := database.GetAPIKeyUsageHistory(db, apiKey.ID, database.UsageDay(now.AddDate(0, 0, -usageHistoryDays+1)))
+	if err != nil {
+		log.Printf("Error loading usage history of API key %d: %v", apiKey.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading usage.")
+		return
+	}
+
+	today := map[string]interface{}{
+		"day":       day,
+		"requests":  used,
+		"resets_at": nextUsageDay(now),
+	}
+	if quota := dailyQuota(apiKey); quota > 0 {
+		today["quota"] = quota
+		today["remaining"] = max(quota-used, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_key": apiKey,
+		"today":   today,
+		"history": history,
+	})
+}
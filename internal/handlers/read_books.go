@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/events"
+	"be-takehome-2024/internal/validation"
+)
+
+// maxRating is the highest rating a read book may be given, the lowest being 1.
+const maxRating = 5
+
+// LogReadBookHandler handles POST /users/{id}/read-books, logging a work the
+// user has read, optionally with when they finished it and their rating.
+// Read works are left out of the user's future recommendations.
+func LogReadBookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		WorkKey    string `json:"work_key"`
+		FinishedOn string `json:"finished_on"`
+		Rating     *int   `json:"rating"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	book := database.ReadBook{
+		WorkKey:    workKey(req.WorkKey),
+		FinishedOn: strings.TrimSpace(req.FinishedOn),
+		Rating:     req.Rating,
+	}
+	v := validation.New()
+	checkWorkKey(v, "work_key", book.WorkKey)
+	if book.FinishedOn != "" {
+		finished, err := time.Parse(time.DateOnly, book.FinishedOn)
+		v.Check(err == nil, "finished_on", "must be a date such as 2024-06-30")
+		v.Check(err != nil || !finished.After(time.Now()), "finished_on", "must not be in the future")
+	}
+	v.Check(book.Rating == nil || (*book.Rating >= 1 && *book.Rating <= maxRating), "rating", "must be an integer between %d and %d", 1, maxRating)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	book, err = database.SaveReadBook(db, userID, book)
+	if err != nil {
+		log.Printf("Error logging read book %s for user ID %d: %v", book.WorkKey, userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error logging read book.")
+		return
+	}
+	events.Publish(events.FeedbackReceived, requestTenant(r).OrgID, map[string]interface{}{
+		"kind":        "read_book",
+		"user_id":     userID,
+		"work_key":    book.WorkKey,
+		"rating":      book.Rating,
+		"finished_on": book.FinishedOn,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"read_book": book})
+}
+
+// ListReadBooksHandler handles GET /users/{id}/read-books, most recently logged first.
+func ListReadBooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	books, err := database.ListReadBooks(db, userID)
+	if err != nil {
+		log.Printf("Error listing read books for user ID %d: %v", userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing read books.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"read_books": books})
+}
+
+// DeleteReadBookHandler handles DELETE /users/{id}/read-books/{work_key},
+// making the work eligible for recommendation again.
+func DeleteReadBookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+	key := workKey(r.PathValue("work_key"))
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	deleted, err := database.DeleteReadBook(db, userID, key)
+	if err != nil {
+		log.Printf("Error deleting read book %s for user ID %d: %v", key, userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error deleting read book.")
+		return
+	}
+	if !deleted {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Work '%s' is not in the user's read books.", key)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// workKey normalizes a work key, accepting Open Library's "/works/" form.
+func workKey(raw string) string {
+	return strings.TrimPrefix(strings.TrimSpace(raw), "/works/")
+}
+
+// checkWorkKey validates a normalized work key, as returned with recommendations.
+func checkWorkKey(v *validation.Validator, field, key string) {
+	if key == "" {
+		v.Add(field, "is required")
+		return
+	}
+	v.Check(!strings.ContainsAny(key, "/ "), field, "must be a work key such as OL45883W")
+}
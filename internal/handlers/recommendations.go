@@ -1,172 +1,622 @@
 package handlers
 
 import (
-    "context"
-    "database/sql"
-    "encoding/json"
-    "fmt"
-    "log"
-    "net/http"
-    "strconv"
-    "time"
-
-    "be-takehome-2024/internal/database"
-    "be-takehome-2024/internal/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/experiments"
+	"be-takehome-2024/internal/features"
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/langdetect"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/recommend"
+	"be-takehome-2024/internal/reqlog"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/timing"
+	"be-takehome-2024/internal/validation"
 )
 
+// maxRecommendations caps the 'limit' parameter, since every book costs an upstream description fetch.
+const maxRecommendations = 10
+
+// maxTopSubjects caps the 'top_subjects' parameter, since each subject is a separate upstream fetch.
+const maxTopSubjects = 5
+
+// maxDescriptionSentences caps the 'description_sentences' parameter.
+const maxDescriptionSentences = 10
+
+// maxUnboundedDeadline caps the 'deadline_ms' parameter on routes without a
+// timeout; elsewhere, it is capped at the route's timeout.
+const maxUnboundedDeadline = time.Hour
+
 // RecommendationsHandler handles the /recommendations endpoint.
 func RecommendationsHandler(w http.ResponseWriter, r *http.Request) {
-    // Set a timeout for the request context
-    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-    defer cancel()
-
-    // Parse query parameters
-    user1IDStr := r.URL.Query().Get("user1")
-    user2IDStr := r.URL.Query().Get("user2")
-
-    if user1IDStr == "" || user2IDStr == "" {
-        http.Error(w, "Both 'user1' and 'user2' query parameters are required.", http.StatusBadRequest)
-        return
-    }
-
-    // Validate and convert user IDs
-    user1ID, err1 := strconv.Atoi(user1IDStr)
-    user2ID, err2 := strconv.Atoi(user2IDStr)
-
-    if err1 != nil || err2 != nil {
-        http.Error(w, "User IDs must be valid integers.", http.StatusBadRequest)
-        return
-    }
-
-    // Open the database
-    db, err := sql.Open("sqlite3", "./user.db")
-    if err != nil {
-        http.Error(w, "Database connection error.", http.StatusInternalServerError)
-        return
-    }
-    defer db.Close()
-
-    // Channels to collect subjects and errors
-    type subjectResult struct {
-        Aggregate map[string]int
-        Err       error
-    }
-    resultsCh := make(chan subjectResult, 2)
-
-    // Fetch subjects for both users concurrently
-	go func() {
-		// Fetch favorite authors for user1
-		user1Authors, err := database.GetUserFavoriteAuthors(db, user1ID)
-		if err != nil {
-			resultsCh <- subjectResult{nil, fmt.Errorf("User1: %v", err)}
-			return
+	requestStart := time.Now()
+
+	// The request's context carries its route's timeout
+	ctx := r.Context()
+
+	// Cap the upstream calls made on the request's behalf
+	calls := budget.New(config.Get().UpstreamCallBudget)
+	ctx = budget.WithBudget(ctx, calls)
+
+	// Time the request's stages for the response's meta block
+	timings := timing.New()
+	ctx = timing.WithTimings(ctx, timings)
+	// Report the stages to the detail log however the request ends
+	defer func() { reqlog.FromContext(ctx).SetStages(timings.Milliseconds()) }()
+
+	// Parse query parameters, reporting every invalid one at once
+	query := r.URL.Query()
+	v := validation.New()
+	user1 := userParam(v, query, "user1")
+	// A persona stands in for the second user, so a single user can be paired
+	persona := v.Enum(query, "persona", "", database.PersonaSlugs()...)
+	var user2 userRef
+	if persona == "" {
+		user2 = userParam(v, query, "user2")
+	} else {
+		v.Check(!query.Has("user2"), "user2", "cannot be combined with persona")
+	}
+	opts := parseRecommendationOptions(v, query)
+	deadline := deadlineParam(v, r)
+
+	// Select the recommendation strategy; 'mode' is kept as an alias for older clients.
+	strategyName := v.Enum(query, "strategy", "", recommend.Names()...)
+	if query.Get("strategy") == "" {
+		if query.Get("mode") == "intersection" {
+			strategyName = "subject-intersection"
+		} else {
+			strategyName = v.Enum(query, "mode", "", recommend.Names()...)
 		}
-		if len(user1Authors) == 0 {
-			resultsCh <- subjectResult{nil, fmt.Errorf("No favorite authors found for user ID %d.", user1ID)}
-			return
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if deadline > 0 {
+		calls.SetDeadline(requestStart.Add(deadline))
+	}
+	if opts.CacheOnly {
+		calls.SetCacheOnly()
+	}
+
+	// Open the database
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	// Both users must belong to the requesting organization
+	orgID := requestTenant(r).OrgID
+	user1ID, ok := resolveUser(w, r, db, user1)
+	if !ok {
+		return
+	}
+	var user2ID int
+	if persona != "" {
+		user2ID, ok = resolvePersona(w, r, db, persona)
+	} else {
+		user2ID, ok = resolveUser(w, r, db, user2)
+	}
+	if !ok {
+		return
+	}
+
+	// Pairs in a running experiment get their variant's strategy unless one is requested
+	var assignment *experiments.Assignment
+	if strategyName == "" {
+		strategyName = config.Get().DefaultStrategy
+		if exp := experiments.Active(); exp != nil {
+			variant := exp.Assign(user1ID, user2ID)
+			if _, ok := recommend.Get(variant.Strategy); ok {
+				strategyName = variant.Strategy
+				assignment = &experiments.Assignment{Experiment: exp.Name, Variant: variant.Name}
+			} else {
+				log.Printf("Experiment %s variant %s uses unknown strategy '%s'", exp.Name, variant.Name, variant.Strategy)
+			}
 		}
-	
-		// log.Printf("User1 authors: %v", user1Authors)
-	
-		// Resolve author keys for user1
-		user1AuthorKeys, err := services.ResolveAuthorKeys(ctx, user1Authors)
-		if err != nil {
-			resultsCh <- subjectResult{nil, fmt.Errorf("User1: %v", err)}
+	}
+	recommender, ok := recommend.Get(strategyName)
+	if !ok {
+		log.Printf("Default strategy '%s' is not registered", strategyName)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Recommendation strategy unavailable.")
+		return
+	}
+
+	// Apply the features rolled out to this pair
+	subject := featureSubject(r, fmt.Sprintf("pair:%d-%d", min(user1ID, user2ID), max(user1ID, user2ID)))
+	if recommender.Name() == "collaborative" && !features.Enabled(db, features.CollaborativeStrategy, subject) {
+		if assignment == nil {
+			writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Strategy '%s' is not enabled.", recommender.Name())
 			return
 		}
-	
-		for _, author := range user1AuthorKeys {
-			log.Printf("User1 author: Name=%s, Key=%s, WorkCount=%d", author.Name, author.Key, author.WorkCount)
+		// Pairs assigned to the variant get the default strategy until it is
+		recommender, _ = recommend.Get(config.Get().DefaultStrategy)
+		assignment = nil
+	}
+	v = validation.New()
+	checkSubjectMatching(v, opts, recommender.Name())
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	opts.Books.GroupSeries = features.Enabled(db, features.SeriesGrouping, subject)
+
+	req := recommend.PairRequest{
+		OrgID:            orgID,
+		User1ID:          user1ID,
+		User2ID:          user2ID,
+		Strategy:         recommender.Name(),
+		Weighting:        opts.Weighting,
+		Books:            opts.Books,
+		TopSubjects:      opts.TopSubjects,
+		Scoring:          opts.Scoring,
+		Audience:         opts.Audience,
+		FavoriteCap:      favoriteAuthorsCap(requestTenant(r).APIKey),
+		AuthorBios:       opts.IncludeAuthorBios,
+		SemanticSubjects: opts.SemanticSubjects,
+		Rollup:           opts.Rollup,
+		MinConfidence:    opts.MinConfidence,
+	}
+
+	// Serve the stored recommendation while it is recent, or however old it
+	// is when nothing can be fetched, computing one otherwise
+	maxAge := config.Get().PairResultMaxAge
+	if opts.CacheOnly {
+		maxAge = math.MaxInt64
+	}
+	result, err := recommend.LoadPair(db, req, maxAge)
+	if err != nil {
+		log.Printf("Error loading stored recommendation: %v", err)
+	}
+	stored := result != nil
+	if stored {
+		calls.CacheHit()
+	} else if preferAsync(r) && !opts.CacheOnly {
+		// Compute the recommendation in the background for the client to poll
+		task := recommend.PairTask{Request: req}
+		if assignment != nil {
+			task.Experiment, task.Variant = assignment.Experiment, assignment.Variant
 		}
-	
-		// Get subject counts for user1
-		user1SubjectResult, err := services.GetSubjectAuthorCounts(ctx, user1AuthorKeys)
-		if err != nil {
-			resultsCh <- subjectResult{nil, fmt.Errorf("User1: %v", err)}
+		enqueueAsync(w, r, recommend.TaskPair, task)
+		return
+	} else {
+		computed, err := recommend.RecommendPair(ctx, db, req)
+		var noMatch *recommend.NoMatchError
+		switch {
+		case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+			// The client disconnected; there is no one to respond to
+			log.Printf("Recommendation for users %d and %d abandoned: client disconnected", user1ID, user2ID)
 			return
-		}
-		
-		resultsCh <- subjectResult{user1SubjectResult.Aggregate, nil}
-	}()
-	
-	go func() {
-		// Fetch favorite authors for user2
-		user2Authors, err := database.GetUserFavoriteAuthors(db, user2ID)
-		if err != nil {
-			resultsCh <- subjectResult{nil, fmt.Errorf("User2: %v", err)}
+		case err != nil && calls.Exceeded():
+			writeProblem(w, r, http.StatusServiceUnavailable, problemBudgetExceeded,
+				"The request needed more than %d upstream calls.", config.Get().UpstreamCallBudget)
 			return
-		}
-		if len(user2Authors) == 0 {
-			resultsCh <- subjectResult{nil, fmt.Errorf("No favorite authors found for user ID %d.", user2ID)}
+		case err != nil && calls.CacheMissed():
+			log.Printf("Cache-only recommendation missed the cache: %v", err)
+			writeProblem(w, r, http.StatusServiceUnavailable, problemNotCached, "The data needed is not cached.")
 			return
-		}
-	
-		// log.Printf("User2 authors: %v", user2Authors)
-	
-		// Resolve author keys for user2
-		user2AuthorKeys, err := services.ResolveAuthorKeys(ctx, user2Authors)
-		if err != nil {
-			resultsCh <- subjectResult{nil, fmt.Errorf("User2: %v", err)}
+		case err != nil && calls.Expired():
+			writeProblem(w, r, http.StatusGatewayTimeout, problemTimeout, "No recommendation could be assembled within %d ms.", deadline.Milliseconds())
+			return
+		case errors.As(err, &noMatch) && noMatch.Diagnostics != nil:
+			writeNoMatch(w, r, noMatch, recommender.Name(), calls, timings, requestStart)
+			return
+		case errors.As(err, &noMatch):
+			writeProblem(w, r, http.StatusNotFound, problemNoCommonSubject, "%s", err.Error())
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			writeProblem(w, r, http.StatusGatewayTimeout, problemTimeout, "Request timed out.")
+			return
+		case err != nil:
+			writeFailure(w, r, err, fmt.Sprintf("recommending books for users %d and %d", user1ID, user2ID))
 			return
 		}
-	
-		for _, author := range user2AuthorKeys {
-			log.Printf("User2 author: Name=%s, Key=%s, WorkCount=%d", author.Name, author.Key, author.WorkCount)
+		// A best-effort or cache-only result is only good enough for this request
+		if !computed.Partial && !opts.CacheOnly {
+			if err := recommend.SavePair(db, req, computed); err != nil {
+				log.Printf("Error storing recommendation: %v", err)
+			}
 		}
-	
-		// Get subject counts for user2
-		user2SubjectResult, err := services.GetSubjectAuthorCounts(ctx, user2AuthorKeys)
-		if err != nil {
-			resultsCh <- subjectResult{nil, fmt.Errorf("User2: %v", err)}
-			return
+		result = &computed
+	}
+	recommendedBooks := result.Books
+	reqlog.FromContext(ctx).SetSubject(result.Subject)
+
+	// Record the response for later analysis
+	entry := database.HistoryEntry{
+		User1ID:         user1ID,
+		User2ID:         user2ID,
+		OrgID:           orgID,
+		Strategy:        recommender.Name(),
+		Subject:         result.Subject,
+		Recommendations: recommendedBooks,
+		Stored:          stored,
+	}
+	if assignment != nil {
+		entry.Experiment = assignment.Experiment
+		entry.Variant = assignment.Variant
+	}
+	if err := database.RecordRecommendation(db, entry); err != nil {
+		log.Printf("Error recording recommendation history: %v", err)
+	}
+
+	// Prepare the response, in the client's language
+	lang := requestLanguage(r)
+	response := pairResponse(db, lang, result, recommender.Name())
+	if persona != "" {
+		response["persona"] = persona
+	}
+	if assignment != nil {
+		response["experiment"] = assignment
+	}
+	if req.AuthorBios {
+		response["author_bios"] = result.AuthorBios
+	}
+
+	// Report what the response cost and how fresh its data is
+	meta := responseMeta{
+		UpstreamCalls: calls.UpstreamCalls(),
+		CacheHits:     calls.CacheHits(),
+		Stored:        stored,
+		TimingsMS:     timings.Milliseconds(),
+		ComputedAt:    result.AsOf,
+	}
+	if !result.SubjectsAsOf.IsZero() {
+		meta.SubjectsComputedAt = &result.SubjectsAsOf
+	}
+	meta.TimingsMS["total"] = float64(time.Since(requestStart).Microseconds()) / 1000
+	response["meta"] = meta
+
+	// Send the JSON response
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdhocRecommendationsHandler handles POST /recommendations/adhoc,
+// recommending books for two readers given only by their favorite authors,
+// for demos and marketing pages. Nothing about the readers is stored.
+func AdhocRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	var body struct {
+		User1FavoriteAuthors []string `json:"user1_favorite_authors"`
+		User2FavoriteAuthors []string `json:"user2_favorite_authors"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	query := r.URL.Query()
+	v := validation.New()
+	checkFavoriteAuthors(v, "user1_favorite_authors", body.User1FavoriteAuthors)
+	checkFavoriteAuthors(v, "user2_favorite_authors", body.User2FavoriteAuthors)
+	opts := parseRecommendationOptions(v, query)
+	deadline := deadlineParam(v, r)
+	strategyName := v.Enum(query, "strategy", config.Get().DefaultStrategy, recommend.Names()...)
+	checkSubjectMatching(v, opts, strategyName)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	recommender, ok := recommend.Get(strategyName)
+	if !ok {
+		log.Printf("Default strategy '%s' is not registered", strategyName)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Recommendation strategy unavailable.")
+		return
+	}
+
+	ctx := r.Context()
+	calls := budget.New(config.Get().UpstreamCallBudget)
+	if deadline > 0 {
+		calls.SetDeadline(requestStart.Add(deadline))
+	}
+	if opts.CacheOnly {
+		calls.SetCacheOnly()
+	}
+	ctx = budget.WithBudget(ctx, calls)
+	timings := timing.New()
+	ctx = timing.WithTimings(ctx, timings)
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if recommender.Name() == "collaborative" && !features.Enabled(db, features.CollaborativeStrategy, featureSubject(r, "adhoc")) {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Strategy '%s' is not enabled.", recommender.Name())
+		return
+	}
+
+	req := recommend.PairRequest{
+		OrgID:            requestTenant(r).OrgID,
+		Strategy:         recommender.Name(),
+		Weighting:        opts.Weighting,
+		Books:            opts.Books,
+		TopSubjects:      opts.TopSubjects,
+		Scoring:          opts.Scoring,
+		Audience:         opts.Audience,
+		FavoriteCap:      favoriteAuthorsCap(requestTenant(r).APIKey),
+		AuthorBios:       opts.IncludeAuthorBios,
+		SemanticSubjects: opts.SemanticSubjects,
+		Rollup:           opts.Rollup,
+		MinConfidence:    opts.MinConfidence,
+	}
+	authors := [2][]string{trimAll(body.User1FavoriteAuthors), trimAll(body.User2FavoriteAuthors)}
+	result, err := recommend.RecommendAdhoc(ctx, db, req, authors)
+	var noMatch *recommend.NoMatchError
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		log.Printf("Ad hoc recommendation abandoned: client disconnected")
+		return
+	case err != nil && calls.Exceeded():
+		writeProblem(w, r, http.StatusServiceUnavailable, problemBudgetExceeded,
+			"The request needed more than %d upstream calls.", config.Get().UpstreamCallBudget)
+		return
+	case err != nil && calls.CacheMissed():
+		log.Printf("Cache-only recommendation missed the cache: %v", err)
+		writeProblem(w, r, http.StatusServiceUnavailable, problemNotCached, "The data needed is not cached.")
+		return
+	case err != nil && calls.Expired():
+		writeProblem(w, r, http.StatusGatewayTimeout, problemTimeout, "No recommendation could be assembled within %d ms.", deadline.Milliseconds())
+		return
+	case errors.As(err, &noMatch) && noMatch.Diagnostics != nil:
+		writeNoMatch(w, r, noMatch, recommender.Name(), calls, timings, requestStart)
+		return
+	case errors.As(err, &noMatch):
+		writeProblem(w, r, http.StatusNotFound, problemNoCommonSubject, "%s", err.Error())
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		writeProblem(w, r, http.StatusGatewayTimeout, problemTimeout, "Request timed out.")
+		return
+	case err != nil:
+		writeFailure(w, r, err, "recommending books for ad hoc readers")
+		return
+	}
+
+	lang := requestLanguage(r)
+	response := pairResponse(db, lang, &result, recommender.Name())
+	if req.AuthorBios {
+		response["author_bios"] = result.AuthorBios
+	}
+	meta := responseMeta{
+		UpstreamCalls: calls.UpstreamCalls(),
+		CacheHits:     calls.CacheHits(),
+		TimingsMS:     timings.Milliseconds(),
+		ComputedAt:    result.AsOf,
+	}
+	meta.TimingsMS["total"] = float64(time.Since(requestStart).Microseconds()) / 1000
+	response["meta"] = meta
+
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeNoMatch responds to a pair or group sharing no subject with an empty
+// list of recommendations and the diagnosis of why, so clients can explain it.
+func writeNoMatch(w http.ResponseWriter, r *http.Request, noMatch *recommend.NoMatchError, strategy string, calls *budget.Budget, timings *timing.Timings, requestStart time.Time) {
+	lang := requestLanguage(r)
+	meta := responseMeta{
+		UpstreamCalls: calls.UpstreamCalls(),
+		CacheHits:     calls.CacheHits(),
+		TimingsMS:     timings.Milliseconds(),
+		ComputedAt:    clock.Now().UTC(),
+	}
+	meta.TimingsMS["total"] = float64(time.Since(requestStart).Microseconds()) / 1000
+	response := map[string]interface{}{
+		"recommendations": []models.Work{},
+		"no_match": map[string]interface{}{
+			"reason":         i18n.T(lang, noMatch.Reason),
+			"users":          noMatch.Diagnostics.Users,
+			"nearest_misses": noMatch.Diagnostics.NearestMisses,
+		},
+		"meta": meta,
+	}
+	// Groups are recommended for without a strategy
+	if strategy != "" {
+		response["strategy"] = strategy
+	}
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// deadlineParam parses the optional 'deadline_ms' parameter: how long the
+// request may take before the recommendation is assembled from whatever has
+// been fetched. Zero means no deadline.
+func deadlineParam(v *validation.Validator, r *http.Request) time.Duration {
+	limit := routeTimeout(r.Pattern)
+	if limit <= 0 {
+		limit = maxUnboundedDeadline
+	}
+	return time.Duration(v.Int(r.URL.Query(), "deadline_ms", 0, 1, int(limit.Milliseconds()))) * time.Millisecond
+}
+
+// trimAll returns the strings with surrounding whitespace removed.
+func trimAll(values []string) []string {
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return trimmed
+}
+
+// pairResponse returns the body of a response carrying a pair
+// recommendation, with subjects named in lang.
+func pairResponse(db *sql.DB, lang string, result *recommend.PairResult, strategy string) map[string]interface{} {
+	subjectNames := localizeSubjects(db, lang, result.Subject, result.Books)
+	recommendedBooks := make([]models.Work, len(result.Books))
+	for i, book := range result.Books {
+		if book.Subject != "" {
+			book.SubjectName = subjectNames[book.Subject]
+		}
+		recommendedBooks[i] = book
+	}
+	response := map[string]interface{}{
+		"common_subject":     subjectNames[result.Subject],
+		"common_subject_key": result.Subject,
+		"recommendations":    recommendedBooks,
+		"strategy":           strategy,
+		"as_of":              result.AsOf,
+	}
+	if result.ColdStartFrom != "" {
+		response["degraded"] = true
+		response["fallback"] = result.ColdStartFrom
+	}
+	if len(result.Warnings) > 0 {
+		response["warnings"] = localizeWarnings(lang, result.Warnings)
+	}
+	if result.Match != nil {
+		response["match"] = result.Match
+		response["confidence"] = result.Match.Confidence
+	}
+	if result.Partial {
+		response["partial"] = true
+	}
+	return response
+}
+
+// recommendationOptions are the query parameters shaping a recommendation,
+// shared by user pairs and groups.
+type recommendationOptions struct {
+	Books             services.BookOptions
+	TopSubjects       int
+	Scoring           services.Scoring
+	Weighting         services.Weighting
+	Audience          services.Audience
+	IncludeAuthorBios bool
+	// SemanticSubjects and Rollup match a pair's related subjects, or those
+	// of the same genre, as well as identical ones. Only subject intersection
+	// matches them; other strategies and groups reject them.
+	SemanticSubjects bool
+	Rollup           services.GenreLevel
+	// MinConfidence is the least confidence in a pair's common subject to
+	// recommend from; below it the pair gets diagnostics instead.
+	MinConfidence float64
+	// CacheOnly answers from persisted caches and the local index alone,
+	// as the configuration can require of every request.
+	CacheOnly bool
+}
+
+// parseRecommendationOptions reads the recommendation options from the query,
+// recording any invalid ones in v.
+func parseRecommendationOptions(v *validation.Validator, query url.Values) recommendationOptions {
+	opts := recommendationOptions{
+		IncludeAuthorBios: v.Bool(query, "include_author_bios", false),
+		SemanticSubjects:  v.Bool(query, "semantic_subjects", false),
+		MinConfidence:     v.Float(query, "min_confidence", 0, 0, 1),
+		CacheOnly:         v.Bool(query, "cache_only", false) || config.Get().CacheOnly,
+		Rollup: services.GenreLevel(v.Enum(query, "rollup", "",
+			string(services.GenreLevelGenre), string(services.GenreLevelCategory))),
+		Books: services.BookOptions{
+			Diverse:            v.Bool(query, "diverse", false),
+			PreferSeriesStart:  v.Bool(query, "prefer_series_start", false),
+			RequireDescription: v.Bool(query, "require_description", false),
+			RawDescription:     v.Bool(query, "raw_description", false),
+		},
+		Audience: services.Audience(v.Enum(query, "audience", "",
+			string(services.AudienceChildren), string(services.AudienceYoungAdult), string(services.AudienceAdult))),
+	}
+	for _, format := range v.EnumList(query, "formats",
+		string(services.FormatEbook), string(services.FormatAudiobook), string(services.FormatPrint)) {
+		opts.Books.Formats = append(opts.Books.Formats, services.Format(format))
+	}
+	opts.Books.Count = v.Int(query, "limit", services.DefaultBookCount, 1, maxRecommendations)
+	opts.Books.DescriptionSentences = v.Int(query, "description_sentences", 0, 1, maxDescriptionSentences)
+	opts.Books.Language = v.Enum(query, "language", "", langdetect.Languages...)
+	opts.Books.ForeignDescriptions = services.ForeignDescriptions(v.Enum(query, "foreign_descriptions", string(services.ForeignDescriptionsFlag),
+		string(services.ForeignDescriptionsFlag), string(services.ForeignDescriptionsOmit)))
+	opts.TopSubjects = v.Int(query, "top_subjects", 1, 1, maxTopSubjects)
+	opts.Scoring = services.Scoring(v.Enum(query, "scoring", string(services.ScoringSum),
+		string(services.ScoringSum), string(services.ScoringMin), string(services.ScoringHarmonic)))
+	opts.Weighting = services.Weighting(v.Enum(query, "weighting", string(services.WeightingAuthors),
+		string(services.WeightingAuthors), string(services.WeightingWorkShare), string(services.WeightingRank)))
+	return opts
+}
+
+// checkSubjectMatching records an error for each option matching related
+// subjects when the strategy, or a group's recommendation when strategy is
+// "", matches only identical ones, rather than ignoring it.
+func checkSubjectMatching(v *validation.Validator, opts recommendationOptions, strategy string) {
+	exact := strategy != "subject-intersection"
+	v.Check(!exact || !opts.SemanticSubjects, "semantic_subjects", "applies only to the subject-intersection strategy")
+	v.Check(!exact || opts.Rollup == "", "rollup", "applies only to the subject-intersection strategy")
+}
+
+// localizeWarnings returns the warnings' text in lang.
+func localizeWarnings(lang string, messages []i18n.Message) []string {
+	warnings := make([]string, len(messages))
+	for i, warning := range messages {
+		warnings[i] = warning.Text(lang)
+	}
+	return warnings
+}
+
+// recommendedAuthorBios returns bios for the authors of the recommended books.
+func recommendedAuthorBios(ctx context.Context, books []models.Work) []models.AuthorBio {
+	stop := timing.Start(ctx, "author_bios")
+	defer stop()
+	return services.GetBookAuthorBios(ctx, books)
+}
+
+// favoriteAuthorsCap returns how many of each user's favorite authors a
+// request with the API key may draw on.
+func favoriteAuthorsCap(apiKey *database.APIKey) int {
+	if apiKey != nil && apiKey.Premium {
+		return config.Get().PremiumFavoriteAuthorsCap
+	}
+	return config.Get().FavoriteAuthorsCap
+}
+
+// responseMeta reports how a response was produced, for transparency.
+type responseMeta struct {
+	UpstreamCalls int  `json:"upstream_calls"`
+	CacheHits     int  `json:"cache_hits"`
+	Stored        bool `json:"stored"` // Served from a stored recommendation
+	// TimingsMS holds the duration of each stage that ran, e.g.
+	// author_resolution, subject_aggregation, book_fetch, and rank, and the total.
+	TimingsMS          map[string]float64 `json:"timings_ms"`
+	ComputedAt         time.Time          `json:"computed_at"`
+	SubjectsComputedAt *time.Time         `json:"subjects_computed_at,omitempty"`
+}
+
+// localizeSubjects returns the display names in lang of the common subject and
+// the subjects books were blended from. Canonical names are used on error.
+func localizeSubjects(db *sql.DB, lang, commonSubject string, books []models.Work) map[string]string {
+	subjects := []string{commonSubject}
+	for _, book := range books {
+		if book.Subject != "" && book.Subject != commonSubject {
+			subjects = append(subjects, book.Subject)
+		}
+	}
+
+	names, err := database.GetSubjectNames(db, lang, subjects)
+	if err != nil {
+		log.Printf("Error loading subject names for %s: %v", lang, err)
+		names = make(map[string]string)
+		for _, subject := range subjects {
+			names[subject] = subject
 		}
-		
-		resultsCh <- subjectResult{user2SubjectResult.Aggregate, nil}
-	}()
-	
-
-    // Collect results
-    var user1Subjects, user2Subjects map[string]int
-    for i := 0; i < 2; i++ {
-        select {
-        case res := <-resultsCh:
-            if res.Err != nil {
-                http.Error(w, res.Err.Error(), http.StatusInternalServerError)
-                return
-            }
-            if user1Subjects == nil {
-                user1Subjects = res.Aggregate
-            } else {
-                user2Subjects = res.Aggregate
-            }
-        case <-ctx.Done():
-            http.Error(w, "Request timed out.", http.StatusGatewayTimeout)
-            return
-        }
-    }
-
-    // Find the most common subject
-    commonSubject, err := services.FindMostCommonSubject(user1Subjects, user2Subjects)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusNotFound)
-        return
-    }
-    log.Printf("Common subject: %s", commonSubject)
-
-    // Fetch recommended books
-    recommendedBooks, err := services.GetRecommendedBooks(ctx, commonSubject)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    // Prepare the response
-    response := map[string]interface{}{
-        // "common_subject":  commonSubject,
-        "recommendations": recommendedBooks,
-    }
-
-    // Send the JSON response
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+	}
+	return names
 }
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/validation"
+)
+
+// curationKinds maps the lists named in admin paths to the kinds of rule
+// they hold.
+var curationKinds = map[string]string{
+	"stop-list": database.SubjectStop,
+	"aliases":   database.SubjectAlias,
+	"blocklist": database.SubjectBlock,
+}
+
+// maxCuratedSubjectLength caps the length of curated subjects and alias targets.
+const maxCuratedSubjectLength = 200
+
+// LoadSubjectCuration applies the stored subject curation rules, as at startup.
+func LoadSubjectCuration() error {
+	db, err := database.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return applySubjectRules(db)
+}
+
+// applySubjectRules reads the stored subject curation rules into the
+// normalization of subjects.
+func applySubjectRules(db *sql.DB) error {
+	stored, err := database.ListSubjectRules(db)
+	if err != nil {
+		return err
+	}
+	rules := services.SubjectRules{Stop: map[string]bool{}, Aliases: map[string]string{}, Block: map[string]bool{}}
+	for _, rule := range stored {
+		switch rule.Kind {
+		case database.SubjectStop:
+			rules.Stop[rule.Subject] = rule.Enabled
+		case database.SubjectBlock:
+			rules.Block[rule.Subject] = rule.Enabled
+		case database.SubjectAlias:
+			if rule.Enabled {
+				rules.Aliases[rule.Subject] = rule.Target
+			} else {
+				rules.Aliases[rule.Subject] = ""
+			}
+		}
+	}
+	services.SetSubjectRules(rules)
+	return nil
+}
+
+// AdminSubjectCurationHandler handles GET /admin/subjects/curation, listing
+// the stop-list, aliases, and blocklist in effect, built-in entries included,
+// and the stored rules changing them.
+func AdminSubjectCurationHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	rules, err := database.ListSubjectRules(db)
+	if err != nil {
+		log.Printf("Error listing subject rules: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing subject rules.")
+		return
+	}
+	if rules == nil {
+		rules = []database.SubjectRule{}
+	}
+	stop, aliases, block := services.SubjectCuration()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stop_list": stop,
+		"aliases":   aliases,
+		"blocklist": block,
+		"rules":     rules,
+	})
+}
+
+// AdminSetSubjectRuleHandler handles PUT /admin/subjects/curation/{list}/{subject},
+// adding the subject to the stop-list, aliases, or blocklist, or with
+// enabled false cancelling its built-in entry there. Aliases take the
+// subject they stand for as target; stop and block rules may have no body.
+// The change applies at once to subjects
+// counted from then on; profiles already computed keep theirs until they
+// are refreshed.
+func AdminSetSubjectRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target  string `json:"target"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	kind, ok := curationKinds[r.PathValue("list")]
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Subject list not found.")
+		return
+	}
+	rule := database.SubjectRule{
+		Kind:    kind,
+		Subject: strings.ToLower(strings.TrimSpace(r.PathValue("subject"))),
+		Target:  strings.ToLower(strings.TrimSpace(req.Target)),
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	v := validation.New()
+	v.Check(rule.Subject != "" && len(rule.Subject) <= maxCuratedSubjectLength, "subject", "must be between %d and %d characters", 1, maxCuratedSubjectLength)
+	if kind == database.SubjectAlias && rule.Enabled {
+		v.Check(rule.Target != "" && len(rule.Target) <= maxCuratedSubjectLength, "target", "must be between %d and %d characters", 1, maxCuratedSubjectLength)
+		v.Check(rule.Target != rule.Subject, "target", "must differ from the subject")
+	} else {
+		v.Check(rule.Target == "", "target", "is only allowed for enabled aliases")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	rule, err = database.SaveSubjectRule(db, rule)
+	if err != nil {
+		log.Printf("Error saving subject rule %s '%s': %v", rule.Kind, rule.Subject, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error saving subject rule.")
+		return
+	}
+	if err := applySubjectRules(db); err != nil {
+		log.Printf("Error applying subject rules: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rule": rule})
+}
+
+// AdminDeleteSubjectRuleHandler handles DELETE /admin/subjects/curation/{list}/{subject},
+// returning the subject to its built-in entry in the list, if any.
+func AdminDeleteSubjectRuleHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := curationKinds[r.PathValue("list")]
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Subject list not found.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	deleted, err := database.DeleteSubjectRule(db, kind, strings.ToLower(strings.TrimSpace(r.PathValue("subject"))))
+	if err != nil {
+		log.Printf("Error deleting subject rule: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error deleting subject rule.")
+		return
+	}
+	if !deleted {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Subject rule not found.")
+		return
+	}
+	if err := applySubjectRules(db); err != nil {
+		log.Printf("Error applying subject rules: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/recommend"
+	"be-takehome-2024/internal/validation"
+	"be-takehome-2024/internal/webhooks"
+)
+
+// CreateSubscriptionHandler handles POST /subscriptions, scheduling
+// recommendations for a user pair or a group of the request's organization
+// to be delivered to a callback URL every cadence. The first delivery is
+// made at the scheduler's next check. Deliveries are signed like webhook
+// events, and the signing secret is only returned here.
+func CreateSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		User1ID int    `json:"user1_id"`
+		User2ID int    `json:"user2_id"`
+		GroupID int    `json:"group_id"`
+		Cadence string `json:"cadence"`
+		URL     string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	if err := webhooks.CheckCallbackURL(r.Context(), req.URL); err != nil {
+		v.Check(false, "url", "must be an allowed http or https URL: %s", err.Error())
+	}
+	cadences := make([]string, 0, len(recommend.Cadences))
+	for cadence := range recommend.Cadences {
+		cadences = append(cadences, cadence)
+	}
+	sort.Strings(cadences)
+	v.Check(recommend.Cadences[req.Cadence] > 0, "cadence", "must be one of: %s", strings.Join(cadences, ", "))
+	if req.GroupID != 0 {
+		v.Check(req.GroupID >= 1, "group_id", "must be a positive integer")
+		v.Check(req.User1ID == 0 && req.User2ID == 0, "group_id", "cannot be combined with user1_id and user2_id")
+	} else {
+		v.Check(req.User1ID >= 1, "user1_id", "must be a positive integer")
+		v.Check(req.User2ID >= 1, "user2_id", "must be a positive integer")
+		v.Check(req.User1ID != req.User2ID, "user2_id", "must differ from user1_id")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		log.Printf("Error generating subscription secret: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating subscription.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	orgID := requestTenant(r).OrgID
+	if req.GroupID != 0 {
+		if _, err := database.GetGroup(db, orgID, req.GroupID); errors.Is(err, database.ErrGroupNotFound) {
+			writeProblem(w, r, http.StatusNotFound, problemNotFound, "Group %d not found.", req.GroupID)
+			return
+		} else if err != nil {
+			log.Printf("Error loading group %d: %v", req.GroupID, err)
+			writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+			return
+		}
+	} else if !checkUserInTenant(w, r, db, req.User1ID) || !checkUserInTenant(w, r, db, req.User2ID) {
+		return
+	}
+
+	sub, err := database.CreateSubscription(db, database.Subscription{
+		OrgID:     orgID,
+		User1ID:   req.User1ID,
+		User2ID:   req.User2ID,
+		GroupID:   req.GroupID,
+		Cadence:   req.Cadence,
+		URL:       req.URL,
+		Secret:    secret,
+		NextRunAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Error creating subscription: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating subscription.")
+		return
+	}
+
+	log.Printf("Created %s subscription ID %d", sub.Cadence, sub.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscription": sub,
+		"secret":       secret,
+	})
+}
+
+// ListSubscriptionsHandler handles GET /subscriptions, listing the
+// organization's subscriptions.
+func ListSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	subs, err := database.ListSubscriptions(db, requestTenant(r).OrgID)
+	if err != nil {
+		log.Printf("Error listing subscriptions: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing subscriptions.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"subscriptions": subs})
+}
+
+// GetSubscriptionHandler handles GET /subscriptions/{id}.
+func GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := subscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	sub, err := database.GetSubscription(db, requestTenant(r).OrgID, id)
+	writeSubscription(w, r, id, sub, err)
+}
+
+// PauseSubscriptionHandler handles POST /subscriptions/{id}/pause, stopping
+// deliveries until the subscription is resumed.
+func PauseSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	setSubscriptionPaused(w, r, true)
+}
+
+// ResumeSubscriptionHandler handles POST /subscriptions/{id}/resume. A
+// delivery that fell due while the subscription was paused is made at the
+// scheduler's next check.
+func ResumeSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	setSubscriptionPaused(w, r, false)
+}
+
+func setSubscriptionPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	id, ok := subscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	sub, err := database.SetSubscriptionPaused(db, requestTenant(r).OrgID, id, paused)
+	writeSubscription(w, r, id, sub, err)
+}
+
+// DeleteSubscriptionHandler handles DELETE /subscriptions/{id}.
+func DeleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := subscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	removed, err := database.DeleteSubscription(db, requestTenant(r).OrgID, id)
+	if err != nil {
+		log.Printf("Error deleting subscription %d: %v", id, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error deleting subscription.")
+		return
+	}
+	if !removed {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Subscription %d not found.", id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// subscriptionID parses the subscription ID path value, writing a 400 if it
+// is invalid.
+func subscriptionID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Subscription ID must be a positive integer.")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeSubscription writes the subscription, or the problem loading it.
+func writeSubscription(w http.ResponseWriter, r *http.Request, id int, sub database.Subscription, err error) {
+	if errors.Is(err, database.ErrSubscriptionNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Subscription %d not found.", id)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading subscription %d: %v", id, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"subscription": sub})
+}
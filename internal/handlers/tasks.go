@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/queue"
+	"be-takehome-2024/internal/validation"
+)
+
+// maxQueueTasks caps the number of tasks listed per query.
+const maxQueueTasks = 500
+
+// taskView is a task as reported to clients. Payloads may hold secrets, such
+// as a webhook's signing secret, so they are never shown.
+type taskView struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	RunAt       *time.Time      `json:"run_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+func newTaskView(task queue.Task) taskView {
+	view := taskView{
+		ID:          task.ID,
+		Kind:        task.Kind,
+		Status:      task.Status,
+		Attempts:    task.Attempts,
+		MaxAttempts: task.MaxAttempts,
+		LastError:   task.LastError,
+		Result:      task.Result,
+		CreatedAt:   task.CreatedAt,
+		FinishedAt:  task.FinishedAt,
+	}
+	if task.Status == queue.StatusQueued {
+		view.RunAt = &task.RunAt
+	}
+	return view
+}
+
+// preferAsync reports whether the client asked, with "Prefer: respond-async",
+// for a task to poll rather than to wait for the response.
+func preferAsync(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enqueueAsync queues a task for the requesting organization and responds
+// 202 Accepted, pointing the client at the task to poll.
+func enqueueAsync(w http.ResponseWriter, r *http.Request, kind string, payload interface{}) {
+	task, err := queue.Enqueue(r.Context(), kind, requestTenant(r).OrgID, payload)
+	if err != nil {
+		log.Printf("Error queueing %s task: %v", kind, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error queueing task.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/tasks/"+task.ID)
+	w.Header().Set("Preference-Applied", "respond-async")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(newTaskView(task))
+}
+
+// TaskHandler handles GET /tasks/{id}, reporting the status of a task the
+// requesting organization queued, and its result once it has succeeded.
+func TaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := queue.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, queue.ErrNotFound) || (err == nil && task.OrgID != requestTenant(r).OrgID) {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Task not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading task: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading task.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTaskView(task))
+}
+
+// AdminQueueHandler handles GET /admin/queue, listing tasks newest first,
+// optionally only those of a status or kind. Listing dead tasks shows the
+// dead-letter queue.
+func AdminQueueHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v := validation.New()
+	filter := queue.Filter{
+		Status: v.Enum(query, "status", "", queue.StatusQueued, queue.StatusRunning, queue.StatusSucceeded, queue.StatusDead),
+		Kind:   query.Get("kind"),
+		Limit:  v.Int(query, "limit", 100, 1, maxQueueTasks),
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	tasks, err := queue.List(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing tasks: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing tasks.")
+		return
+	}
+	views := make([]taskView, len(tasks))
+	for i, task := range tasks {
+		views[i] = newTaskView(task)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tasks": views})
+}
+
+// AdminQueueTaskHandler handles GET /admin/queue/{id}.
+func AdminQueueTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := queue.Get(r.Context(), r.PathValue("id"))
+	if !checkTask(w, r, err) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTaskView(task))
+}
+
+// AdminRetryTaskHandler handles POST /admin/queue/{id}/retry, requeueing a
+// dead-lettered task with a fresh set of attempts.
+func AdminRetryTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := queue.Retry(r.Context(), r.PathValue("id"))
+	if errors.Is(err, queue.ErrNotDead) {
+		writeProblem(w, r, http.StatusConflict, problemConflict, "Only dead-lettered tasks can be retried.")
+		return
+	}
+	if !checkTask(w, r, err) {
+		return
+	}
+	log.Printf("Retrying task %s (%s)", task.ID, task.Kind)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTaskView(task))
+}
+
+// AdminDiscardTaskHandler handles DELETE /admin/queue/{id}, removing a task
+// that is not running.
+func AdminDiscardTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := queue.Discard(r.Context(), id)
+	if errors.Is(err, queue.ErrRunning) {
+		writeProblem(w, r, http.StatusConflict, problemConflict, "The task is running.")
+		return
+	}
+	if !checkTask(w, r, err) {
+		return
+	}
+	log.Printf("Discarded task %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkTask responds to an error looking up a task, reporting whether there
+// was none.
+func checkTask(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Task not found.")
+		return false
+	case err != nil:
+		log.Printf("Error loading task: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error loading task.")
+		return false
+	}
+	return true
+}
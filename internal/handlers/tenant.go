@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"be-takehome-2024/internal/database"
+)
+
+// tenantContextKey is the request context key holding the resolved tenant.
+type tenantContextKey struct{}
+
+// tenant is the organization a request acts for, the API key that
+// authenticated it, if any, and whether it carries the admin token.
+type tenant struct {
+	OrgID  int
+	APIKey *database.APIKey
+	Admin  bool
+}
+
+// WithTenant resolves the request's organization from its X-API-Key header
+// or, failing that, the organization slug in its X-Organization header.
+// Requests carrying neither act for the default organization. Naming any
+// other organization takes one of its API keys or the admin token.
+func WithTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, slug := r.Header.Get("X-API-Key"), r.Header.Get("X-Organization")
+		t := tenant{OrgID: database.DefaultOrganizationID, Admin: isAdmin(r)}
+		if key == "" && slug == "" {
+			next(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, t)))
+			return
+		}
+
+		db, err := database.Open()
+		if err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+			return
+		}
+		defer db.Close()
+
+		if key != "" {
+			apiKey, err := database.LookupAPIKey(db, key)
+			if errors.Is(err, database.ErrAPIKeyNotFound) {
+				writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "Invalid API key.")
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up API key: %v", err)
+				writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error resolving organization.")
+				return
+			}
+			t = tenant{OrgID: apiKey.OrgID, APIKey: &apiKey, Admin: t.Admin}
+		}
+
+		if slug != "" {
+			org, err := database.GetOrganizationBySlug(db, slug)
+			if errors.Is(err, database.ErrOrganizationNotFound) || slug == database.PersonaOrganizationSlug {
+				writeProblem(w, r, http.StatusNotFound, problemNotFound, "Unknown organization '%s'.", slug)
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up organization %s: %v", slug, err)
+				writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error resolving organization.")
+				return
+			}
+			if t.APIKey != nil && t.APIKey.OrgID != org.ID {
+				writeProblem(w, r, http.StatusForbidden, problemForbidden, "API key does not belong to organization '%s'.", slug)
+				return
+			}
+			if t.APIKey == nil && !t.Admin && org.ID != database.DefaultOrganizationID {
+				writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "Acting for organization '%s' requires its API key or the admin token.", slug)
+				return
+			}
+			t.OrgID = org.ID
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, t)))
+	}
+}
+
+// Authenticated rejects requests that carry neither an API key nor the admin
+// token. It must be wrapped by WithTenant, which resolves both.
+func Authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if t := requestTenant(r); t.APIKey == nil && !t.Admin {
+			writeProblem(w, r, http.StatusUnauthorized, problemUnauthorized, "An API key or the admin token is required.")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestTenant returns the tenant resolved by WithTenant, or the default
+// organization for unwrapped handlers.
+func requestTenant(r *http.Request) tenant {
+	if t, ok := r.Context().Value(tenantContextKey{}).(tenant); ok {
+		return t
+	}
+	return tenant{OrgID: database.DefaultOrganizationID}
+}
+
+// checkUserInTenant writes a 404 unless the user belongs to the request's
+// organization, so other tenants' users are indistinguishable from missing ones.
+func checkUserInTenant(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) bool {
+	ok, err := database.UserInOrganization(db, userID, requestTenant(r).OrgID)
+	if err != nil {
+		log.Printf("Error checking organization of user ID %d: %v", userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+		return false
+	}
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User ID %d not found.", userID)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/config"
+)
+
+// TimeLimited serves requests with mux, answering with a timeout problem
+// once a request has taken longer than its route's configured timeout. The
+// handler's context is cancelled then too, and whatever it goes on to write
+// is discarded. Responses are buffered until the handler returns, so the
+// timeout can still be reported after the handler has started writing.
+func TimeLimited(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Record the route up front, since the mux sets it on the copy of
+		// the request it's given
+		_, r.Pattern = mux.Handler(r)
+		timeout := routeTimeout(r.Pattern)
+		if timeout <= 0 {
+			// Nor is the response bound by the server's write timeout
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			mux.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			for key, values := range tw.header {
+				w.Header()[key] = values
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.body.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			// A client that went away gets no response
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				writeProblem(w, r, http.StatusGatewayTimeout, problemTimeout, "Request timed out.")
+			}
+		}
+	})
+}
+
+// defaultRouteTimeouts are the routes whose timeout differs from the default
+// request timeout unless configured otherwise. Backups and restores run to
+// completion, however long the database takes to copy.
+var defaultRouteTimeouts = map[string]time.Duration{
+	"/admin/backup":  0,
+	"/admin/restore": 0,
+}
+
+// routeTimeout returns the timeout configured for the route of a mux pattern,
+// such as "GET /users/{id}", or its default, 0 for none.
+func routeTimeout(pattern string) time.Duration {
+	cfg := config.Get()
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	if timeout, ok := cfg.RouteTimeouts[pattern]; ok {
+		return timeout
+	}
+	if timeout, ok := defaultRouteTimeouts[pattern]; ok {
+		return timeout
+	}
+	return cfg.RequestTimeout
+}
+
+// timeoutWriter buffers a time-limited handler's response, refusing writes
+// once the request has timed out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/events"
+	"be-takehome-2024/internal/queue"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/validation"
+)
+
+// maxImportUsers caps how many users one import may create.
+const maxImportUsers = 1000
+
+// ListUsersHandler handles GET /users, listing the organization's users a
+// page at a time. 'username' looks up a single user; 'username_prefix'
+// filters by prefix, and 'sort' orders by id, -id, username, or -username.
+// Each page's next_cursor, passed as 'cursor', fetches the page after it.
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	v := validation.New()
+	username := strings.TrimSpace(query.Get("username"))
+	sorts := make([]string, len(database.UserSorts))
+	for i, sort := range database.UserSorts {
+		sorts[i] = string(sort)
+	}
+	filter := database.UserFilter{
+		OrgID:          requestTenant(r).OrgID,
+		UsernamePrefix: strings.TrimSpace(query.Get("username_prefix")),
+		Sort:           database.UserSort(v.Enum(query, "sort", string(database.UserSortID), sorts...)),
+		Limit:          v.Int(query, "limit", defaultPageLimit, 1, maxPageLimit),
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, ok := decodeUserCursor(raw)
+		v.Check(ok && cursor.Sort == filter.Sort, "cursor", "must be a next_cursor returned with the same sort")
+		filter.After = &cursor.UserCursor
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	// A username names at most one user
+	if username != "" {
+		users := []database.UserRecord{}
+		user, err := database.GetUserByUsername(db, filter.OrgID, username)
+		switch {
+		case err == nil:
+			users = append(users, user)
+		case !errors.Is(err, database.ErrUserNotFound):
+			log.Printf("Error looking up user %s: %v", redact.Name(username), err)
+			writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": users,
+		})
+		return
+	}
+
+	// Fetch one extra user to learn whether there is another page
+	limit := filter.Limit
+	filter.Limit++
+	users, err := database.ListUsers(db, filter)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing users.")
+		return
+	}
+	response := map[string]interface{}{}
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		response["next_cursor"] = encodeUserCursor(userPageCursor{
+			Sort:       filter.Sort,
+			UserCursor: database.UserCursor{ID: last.ID, Username: last.Username},
+		})
+	}
+	response["users"] = users
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// userPageCursor is the position after which a user listing page starts,
+// with the sort it belongs to. Clients see it only as an opaque string.
+type userPageCursor struct {
+	Sort database.UserSort `json:"sort"`
+	database.UserCursor
+}
+
+func encodeUserCursor(cursor userPageCursor) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeUserCursor(raw string) (userPageCursor, bool) {
+	var cursor userPageCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || json.Unmarshal(decoded, &cursor) != nil {
+		return userPageCursor{}, false
+	}
+	return cursor, true
+}
+
+// CreateUserHandler handles POST /users, creating a user with their favorite
+// authors in the request's organization.
+func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var user database.NewUser
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	checkNewUser(v, "", user)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	orgID := requestTenant(r).OrgID
+	userID, err := database.CreateUser(db, orgID, user)
+	var taken *database.UsernameTakenError
+	if errors.As(err, &taken) {
+		writeProblem(w, r, http.StatusConflict, problemConflict, "Username '%s' is already taken.", taken.Username)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating user %s: %v", redact.Name(user.Username), err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating user.")
+		return
+	}
+
+	log.Printf("Created user ID %d", userID)
+	record := newUserRecord(userID, orgID, user)
+	events.Publish(events.UserCreated, orgID, record)
+	w.Header().Set("ETag", userETag(1))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user": record,
+	})
+}
+
+// ImportUsersHandler handles POST /users/import, creating many users with
+// their favorite authors in the request's organization. Either every user is
+// created or, if any is invalid or fails, none are.
+func ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Users []database.NewUser `json:"users"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	v.Check(len(req.Users) >= 1 && len(req.Users) <= maxImportUsers, "users", "must have between %d and %d items", 1, maxImportUsers)
+	if len(req.Users) <= maxImportUsers {
+		for i, user := range req.Users {
+			checkNewUser(v, fmt.Sprintf("users[%d].", i), user)
+		}
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// Large imports may run in the background for the client to poll
+	orgID := requestTenant(r).OrgID
+	if preferAsync(r) {
+		enqueueAsync(w, r, taskImportUsers, importTask{OrgID: orgID, Users: req.Users})
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	userIDs, err := database.ImportUsers(db, orgID, req.Users)
+	var taken *database.UsernameTakenError
+	if errors.As(err, &taken) {
+		writeProblem(w, r, http.StatusConflict, problemConflict, "Username '%s' is already taken.", taken.Username)
+		return
+	}
+	if err != nil {
+		log.Printf("Error importing %d users: %v", len(req.Users), err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error importing users.")
+		return
+	}
+
+	log.Printf("Imported %d users", len(userIDs))
+	users := make([]database.UserRecord, len(userIDs))
+	for i, userID := range userIDs {
+		users[i] = newUserRecord(userID, orgID, req.Users[i])
+		events.Publish(events.UserCreated, orgID, users[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+	})
+}
+
+// taskImportUsers is the queue task kind importing users in the background.
+const taskImportUsers = "users.import"
+
+// importTask is the payload of a user import task.
+type importTask struct {
+	OrgID int                `json:"org_id"`
+	Users []database.NewUser `json:"users"`
+}
+
+func init() {
+	queue.Handle(taskImportUsers, queue.Options{MaxAttempts: 3, Backoff: 5 * time.Second, Timeout: time.Minute}, runImportTask)
+}
+
+// runImportTask imports a task's users, returning them as its result. An
+// import with a taken username fails without retries.
+func runImportTask(ctx context.Context, task queue.Task) (interface{}, error) {
+	var t importTask
+	if err := json.Unmarshal(task.Payload, &t); err != nil {
+		return nil, queue.Permanent(fmt.Errorf("error decoding import task: %v", err))
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	userIDs, err := database.ImportUsers(db, t.OrgID, t.Users)
+	var taken *database.UsernameTakenError
+	if errors.As(err, &taken) {
+		return nil, queue.Permanent(fmt.Errorf("username '%s' is already taken", taken.Username))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Imported %d users", len(userIDs))
+	users := make([]database.UserRecord, len(userIDs))
+	for i, userID := range userIDs {
+		users[i] = newUserRecord(userID, t.OrgID, t.Users[i])
+		events.Publish(events.UserCreated, t.OrgID, users[i])
+	}
+	return map[string]interface{}{"users": users}, nil
+}
+
+// UpdateUserHandler handles PUT /users/{id}, replacing a user's username and
+// favorite authors. The client sends the version it last read, as an If-Match
+// ETag or the body's 'version', so that of two concurrent edits the second
+// fails instead of silently overwriting the first. When both are sent they
+// must agree.
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		database.NewUser
+		Version *int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	checkNewUser(v, "", req.NewUser)
+	var version int
+	if req.Version != nil {
+		version = *req.Version
+		v.Check(version > 0, "version", "must be a positive integer")
+	}
+	if match := r.Header.Get("If-Match"); match != "" {
+		n, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(match, "W/"), `"`))
+		v.Check(err == nil && n > 0, "If-Match", "must be an ETag returned for the user")
+		v.Check(req.Version == nil || *req.Version == n, "version", "must match the version in If-Match")
+		version = n
+	}
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if version == 0 {
+		writeProblem(w, r, http.StatusPreconditionRequired, problemPreconditionRequired, "The user's current version is required, in If-Match or 'version'.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	newVersion, err := database.UpdateUser(db, userID, version, req.NewUser)
+	var taken *database.UsernameTakenError
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User not found.")
+		return
+	case errors.Is(err, database.ErrVersionConflict):
+		writeProblem(w, r, http.StatusPreconditionFailed, problemPreconditionFailed, "User ID %d has changed since version %d; fetch it again and retry.", userID, version)
+		return
+	case errors.As(err, &taken):
+		writeProblem(w, r, http.StatusConflict, problemConflict, "Username '%s' is already taken.", taken.Username)
+		return
+	case err != nil:
+		log.Printf("Error updating user ID %d: %v", userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating user.")
+		return
+	}
+
+	log.Printf("Updated user ID %d to version %d", userID, newVersion)
+	user := newUserRecord(userID, requestTenant(r).OrgID, req.NewUser)
+	user.Version = newVersion
+	w.Header().Set("ETag", userETag(newVersion))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user": user,
+	})
+}
+
+// userETag is the entity tag of a user at a version.
+func userETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// checkNewUser validates a user to create, prefixing its field names.
+func checkNewUser(v *validation.Validator, prefix string, user database.NewUser) {
+	v.Required(prefix+"username", user.Username)
+	// Numeric usernames would be mistaken for user IDs where either is accepted
+	_, err := strconv.Atoi(strings.TrimSpace(user.Username))
+	v.Check(err != nil, prefix+"username", "must not be a number")
+	checkFavoriteAuthors(v, prefix+"favorite_authors", user.FavoriteAuthors)
+}
+
+// checkFavoriteAuthors records in v whether a list of favorite authors, the
+// field, is invalid.
+func checkFavoriteAuthors(v *validation.Validator, field string, authors []string) {
+	v.Check(len(authors) >= 1 && len(authors) <= database.MaxFavoriteAuthors,
+		field, "must have between %d and %d items", 1, database.MaxFavoriteAuthors)
+	for i, name := range authors {
+		v.Required(fmt.Sprintf("%s[%d]", field, i), name)
+	}
+}
+
+// newUserRecord describes a user just created.
+func newUserRecord(userID, orgID int, user database.NewUser) database.UserRecord {
+	favorites := make([]string, len(user.FavoriteAuthors))
+	for i, name := range user.FavoriteAuthors {
+		favorites[i] = strings.TrimSpace(name)
+	}
+	return database.UserRecord{ID: userID, OrgID: orgID, Username: user.Username, FavoriteAuthors: favorites, Version: 1}
+}
+
+// DeleteUserDataHandler handles DELETE /users/{id}/data, erasing everything stored about a user.
+func DeleteUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	err = database.DeleteUserData(db, userID)
+	if errors.Is(err, database.ErrUserNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting data for user ID %d: %v", userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error deleting user data.")
+		return
+	}
+
+	log.Printf("Deleted all data for user ID %d", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportUserDataHandler handles GET /users/{id}/export, returning everything stored about a user.
+func ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	export, err := database.ExportUserData(db, userID)
+	if errors.Is(err, database.ErrUserNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error exporting data for user ID %d: %v", userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error exporting user data.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"user-"+strconv.Itoa(userID)+"-export.json\"")
+	json.NewEncoder(w).Encode(export)
+}
+
+// userRef is a user named in a request by ID or by username.
+type userRef struct {
+	ID       int
+	Username string
+}
+
+// userParam parses a required query parameter holding a user ID or, if it is
+// not a number, a username.
+func userParam(v *validation.Validator, query url.Values, field string) userRef {
+	raw := strings.TrimSpace(query.Get(field))
+	if raw == "" {
+		v.Add(field, "is required")
+		return userRef{}
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return userRef{Username: raw}
+	}
+	v.Check(id >= 1, field, "must be a positive integer")
+	return userRef{ID: id}
+}
+
+// resolveUser returns the ID of a user in the request's organization, writing
+// a 404 if there is no such user.
+func resolveUser(w http.ResponseWriter, r *http.Request, db *sql.DB, ref userRef) (int, bool) {
+	if ref.Username == "" {
+		return ref.ID, checkUserInTenant(w, r, db, ref.ID)
+	}
+	user, err := database.GetUserByUsername(db, requestTenant(r).OrgID, ref.Username)
+	if errors.Is(err, database.ErrUserNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User '%s' not found.", ref.Username)
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Error looking up user %s: %v", redact.Name(ref.Username), err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// resolvePersona returns the ID of the user standing in for a persona,
+// writing a 404 if the database has none.
+func resolvePersona(w http.ResponseWriter, r *http.Request, db *sql.DB, slug string) (int, bool) {
+	userID, err := database.GetPersonaUserID(db, slug)
+	if errors.Is(err, database.ErrUserNotFound) {
+		writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "Persona '%s' not found.", slug)
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Error looking up persona %s: %v", slug, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database error.")
+		return 0, false
+	}
+	return userID, true
+}
+
+// parseUserID validates the {id} path value, writing a 400 if it is malformed.
+func parseUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "User ID must be a positive integer.")
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/validation"
+)
+
+// writeValidationError responds 400 with every invalid field of the request.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrs validation.Errors
+	if !errors.As(err, &fieldErrs) {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "%s", err.Error())
+		return
+	}
+
+	lang := requestLanguage(r)
+	writeProblemBody(w, lang, problem{
+		Type:   problemValidation,
+		Status: http.StatusBadRequest,
+		Detail: i18n.T(lang, "One or more request parameters are invalid."),
+		Errors: fieldErrs.Localize(lang),
+	})
+}
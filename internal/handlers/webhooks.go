@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/validation"
+	"be-takehome-2024/internal/webhooks"
+)
+
+// CreateWebhookHandler handles POST /webhooks, registering a callback URL
+// notified when a pair's recommendations change. The signing secret is only
+// returned here.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL    string `json:"url"`
+		UserID int    `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	v := validation.New()
+	u, err := url.Parse(req.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	v.Check(req.UserID >= 0, "user_id", "must be a positive integer")
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating webhook.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if req.UserID != 0 {
+		if _, err := database.GetUser(db, req.UserID); err != nil {
+			writeProblem(w, r, http.StatusNotFound, problemUserNotFound, "User not found.")
+			return
+		}
+	}
+
+	hook, err := database.CreateWebhook(db, database.Webhook{URL: req.URL, Secret: secret, UserID: req.UserID})
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error creating webhook.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook": hook,
+		"secret":  secret,
+	})
+}
+
+// ListWebhooksHandler handles GET /webhooks.
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	hooks, err := database.ListWebhooks(db)
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing webhooks.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"webhooks": hooks})
+}
+
+// DeleteWebhookHandler handles DELETE /webhooks/{id}.
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Webhook ID must be a valid integer.")
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	removed, err := database.DeleteWebhook(db, id)
+	if err != nil {
+		log.Printf("Error deleting webhook %d: %v", id, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error deleting webhook.")
+		return
+	}
+	if !removed {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Webhook not found.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
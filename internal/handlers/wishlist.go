@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/validation"
+)
+
+// AddWishlistHandler handles POST /users/{id}/wishlist, saving a recommended
+// work for the user to read later. The title and authors are kept as given,
+// typically copied from the recommendation.
+func AddWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		WorkKey string   `json:"work_key"`
+		Title   string   `json:"title"`
+		Authors []string `json:"authors"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, problemBadRequest, "Request body must be a JSON object.")
+		return
+	}
+	entry := database.WishlistEntry{
+		WorkKey: workKey(req.WorkKey),
+		Title:   strings.TrimSpace(req.Title),
+		Authors: []string{},
+	}
+	for _, author := range req.Authors {
+		if author = strings.TrimSpace(author); author != "" {
+			entry.Authors = append(entry.Authors, author)
+		}
+	}
+	v := validation.New()
+	checkWorkKey(v, "work_key", entry.WorkKey)
+	v.Required("title", entry.Title)
+	if err := v.Err(); err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	entry, err = database.SaveWishlistEntry(db, userID, entry)
+	if err != nil {
+		log.Printf("Error adding %s to the wishlist of user ID %d: %v", req.WorkKey, userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating wishlist.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"wishlist_entry": entry})
+}
+
+// ListWishlistHandler handles GET /users/{id}/wishlist, most recently added first.
+func ListWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	entries, err := database.ListWishlist(db, userID)
+	if err != nil {
+		log.Printf("Error listing the wishlist of user ID %d: %v", userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error listing wishlist.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"wishlist": entries})
+}
+
+// RemoveWishlistHandler handles DELETE /users/{id}/wishlist/{work_key}.
+func RemoveWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+	key := workKey(r.PathValue("work_key"))
+
+	db, err := database.Open()
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Database connection error.")
+		return
+	}
+	defer db.Close()
+
+	if !checkUserInTenant(w, r, db, userID) {
+		return
+	}
+
+	deleted, err := database.DeleteWishlistEntry(db, userID, key)
+	if err != nil {
+		log.Printf("Error removing %s from the wishlist of user ID %d: %v", key, userID, err)
+		writeProblem(w, r, http.StatusInternalServerError, problemInternal, "Error updating wishlist.")
+		return
+	}
+	if !deleted {
+		writeProblem(w, r, http.StatusNotFound, problemNotFound, "Work '%s' is not in the user's wishlist.", key)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"be-takehome-2024/internal/config"
+)
+
+// DecodeJSON decodes a JSON response body into v as it streams in, without
+// buffering the whole body, and fails once more than the configured
+// UpstreamMaxResponseBytes are read. Large listings are a few megabytes.
+func DecodeJSON(body io.Reader, v interface{}) error {
+	limit := int64(config.Get().UpstreamMaxResponseBytes)
+	err := json.NewDecoder(http.MaxBytesReader(nil, io.NopCloser(body), limit)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return fmt.Errorf("response exceeds %d bytes", tooLarge.Limit)
+	case err != nil:
+		return fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fallbackDelay is how long a connection attempt runs before the next of the
+// host's addresses is tried alongside it, as net.Dialer does between address
+// families, so an unreachable address doesn't hold up every connection.
+const fallbackDelay = 300 * time.Millisecond
+
+// dnsCache resolves host names for outbound connections, keeping each
+// host's addresses for a TTL. A recommendation's fan-out opens many
+// connections to the same few hosts at once, which would otherwise each
+// resolve the host afresh. Concurrent lookups of a host share one query,
+// and a host's last addresses are reused if resolving it again fails.
+type dnsCache struct {
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	dialer     *net.Dialer
+	ttl        time.Duration
+	// next rotates the address connections start from, spreading them over
+	// the host's addresses
+	next atomic.Uint32
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry is a host's addresses, or a lookup of them in flight.
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+	// pending is closed when a lookup in flight completes.
+	pending chan struct{}
+	err     error
+}
+
+func newDNSCache(dialer *net.Dialer, ttl time.Duration) *dnsCache {
+	return &dnsCache{lookupHost: net.DefaultResolver.LookupHost, dialer: dialer, ttl: ttl, entries: make(map[string]*dnsEntry)}
+}
+
+// DialContext connects to addr through the host's cached addresses, starting
+// from a different one each time. Each address not connected within
+// fallbackDelay is raced against the next, and the first connection wins.
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	start := int(c.next.Add(1)-1) % len(addrs)
+	ordered := append(append([]string(nil), addrs[start:]...), addrs[:start]...)
+	return c.dialParallel(ctx, network, port, ordered)
+}
+
+// dialParallel connects to the first of addrs to accept, starting each
+// attempt once the one before has failed or fallbackDelay has passed.
+func (c *dnsCache) dialParallel(ctx context.Context, network, port string, addrs []string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type attempt struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan attempt, len(addrs))
+	dial := func(ip string) {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		results <- attempt{conn, err}
+	}
+
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+	var errs []error
+	started, finished := 0, 0
+	for finished < len(addrs) {
+		var fallback <-chan time.Time
+		if started < len(addrs) {
+			go dial(addrs[started])
+			started++
+			timer.Reset(fallbackDelay)
+			fallback = timer.C
+		}
+		select {
+		case result := <-results:
+			finished++
+			if result.err == nil {
+				// Close the connections of attempts still running
+				go func(running int) {
+					for ; running > 0; running-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(started - finished)
+				return result.conn, nil
+			}
+			errs = append(errs, result.err)
+			if ctx.Err() != nil {
+				return nil, errors.Join(errs...)
+			}
+		case <-fallback:
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// lookup returns the host's addresses, from the cache while they are fresh.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	if ok && entry.pending == nil && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.addrs, nil
+	}
+	if ok && entry.pending != nil {
+		// Wait for the lookup in flight
+		pending := entry.pending
+		c.mu.Unlock()
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if entry.err != nil && len(entry.addrs) == 0 {
+			return nil, entry.err
+		}
+		return entry.addrs, nil
+	}
+
+	var stale []string
+	if ok {
+		stale = entry.addrs
+	}
+	entry = &dnsEntry{addrs: stale, pending: make(chan struct{})}
+	c.entries[host] = entry
+	c.mu.Unlock()
+
+	// The lookup outlives a caller that gives up, since others may be waiting
+	lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.dialer.Timeout)
+	addrs, err := c.lookupHost(lookupCtx, host)
+	cancel()
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case err == nil && len(addrs) > 0:
+		entry.addrs, entry.expires = addrs, time.Now().Add(c.ttl)
+	case len(stale) > 0:
+		// Keep using the last addresses, and try resolving again shortly
+		entry.expires = time.Now().Add(min(c.ttl, 5*time.Second))
+	default:
+		entry.err = err
+		delete(c.entries, host)
+	}
+	close(entry.pending)
+	entry.pending = nil
+	if len(entry.addrs) == 0 {
+		return nil, err
+	}
+	return entry.addrs, nil
+}
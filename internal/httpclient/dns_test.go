@@ -0,0 +1,199 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLookup answers lookups from a fixed result, counting them.
+type fakeLookup struct {
+	calls   atomic.Int32
+	mu      sync.Mutex
+	addrs   []string
+	err     error
+	release chan struct{} // If set, lookups wait for it to be closed
+}
+
+func (f *fakeLookup) lookupHost(ctx context.Context, host string) ([]string, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addrs, f.err
+}
+
+func (f *fakeLookup) set(addrs []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addrs, f.err = addrs, err
+}
+
+func newTestCache(lookup *fakeLookup, ttl time.Duration) *dnsCache {
+	c := newDNSCache(&net.Dialer{Timeout: 5 * time.Second}, ttl)
+	c.lookupHost = lookup.lookupHost
+	return c
+}
+
+// listen returns the port of a listener on ip, or on 127.0.0.1 if empty,
+// accepting connections until the test ends. A port of "0" picks any.
+func listen(t *testing.T, ip, port string) string {
+	t.Helper()
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ = net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func TestDNSCacheReusesFreshAddresses(t *testing.T) {
+	lookup := &fakeLookup{addrs: []string{"192.0.2.1"}}
+	c := newTestCache(lookup, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		addrs, err := c.lookup(context.Background(), "example.org")
+		if err != nil || len(addrs) != 1 || addrs[0] != "192.0.2.1" {
+			t.Fatalf("lookup = %v, %v", addrs, err)
+		}
+	}
+	if calls := lookup.calls.Load(); calls != 1 {
+		t.Errorf("resolved %d times, want 1", calls)
+	}
+}
+
+func TestDNSCacheReusesStaleAddressesOnFailure(t *testing.T) {
+	lookup := &fakeLookup{addrs: []string{"192.0.2.1"}}
+	c := newTestCache(lookup, time.Millisecond)
+	if _, err := c.lookup(context.Background(), "example.org"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	lookup.set(nil, errors.New("server misbehaving"))
+	addrs, err := c.lookup(context.Background(), "example.org")
+	if err != nil || len(addrs) != 1 || addrs[0] != "192.0.2.1" {
+		t.Fatalf("lookup after failure = %v, %v, want the stale address", addrs, err)
+	}
+	if calls := lookup.calls.Load(); calls != 2 {
+		t.Errorf("resolved %d times, want 2", calls)
+	}
+}
+
+func TestDNSCacheFailsWithoutAddresses(t *testing.T) {
+	lookup := &fakeLookup{err: errors.New("server misbehaving")}
+	c := newTestCache(lookup, time.Minute)
+	if _, err := c.lookup(context.Background(), "example.org"); err == nil {
+		t.Fatal("lookup succeeded, want the resolver's error")
+	}
+	// The failure isn't cached
+	lookup.set([]string{"192.0.2.1"}, nil)
+	if _, err := c.lookup(context.Background(), "example.org"); err != nil {
+		t.Fatalf("lookup after recovery: %v", err)
+	}
+}
+
+func TestDNSCacheSharesConcurrentLookups(t *testing.T) {
+	lookup := &fakeLookup{addrs: []string{"192.0.2.1"}, release: make(chan struct{})}
+	c := newTestCache(lookup, time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.lookup(context.Background(), "example.org")
+			errs <- err
+		}()
+	}
+	// Let every lookup reach the cache before the query completes
+	time.Sleep(20 * time.Millisecond)
+	close(lookup.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := lookup.calls.Load(); calls != 1 {
+		t.Errorf("resolved %d times, want 1", calls)
+	}
+}
+
+func TestDNSCacheRotatesAddresses(t *testing.T) {
+	addrs := []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}
+	port := listen(t, addrs[0], "0")
+	for _, ip := range addrs[1:] {
+		listen(t, ip, port)
+	}
+	lookup := &fakeLookup{addrs: addrs}
+	c := newTestCache(lookup, time.Minute)
+
+	reached := make(map[string]bool)
+	for range addrs {
+		conn, err := c.DialContext(context.Background(), "tcp", net.JoinHostPort("example.org", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		reached[ip] = true
+		conn.Close()
+	}
+	if len(reached) != len(addrs) {
+		t.Errorf("connected to %v, want each of %v", reached, addrs)
+	}
+}
+
+func TestDNSCacheFallsBackFromUnreachableAddress(t *testing.T) {
+	port := listen(t, "", "0")
+	// 192.0.2.1 is reserved for documentation, so connecting to it hangs or
+	// fails rather than reaching the listener
+	lookup := &fakeLookup{addrs: []string{"192.0.2.1", "127.0.0.1"}}
+	c := newTestCache(lookup, time.Minute)
+
+	start := time.Now()
+	conn, err := c.DialContext(context.Background(), "tcp", net.JoinHostPort("example.org", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("connecting took %v, want the fallback within %v", elapsed, fallbackDelay)
+	}
+}
+
+func TestDNSCacheDialsIPsDirectly(t *testing.T) {
+	port := listen(t, "", "0")
+	lookup := &fakeLookup{err: errors.New("unexpected lookup")}
+	c := newTestCache(lookup, time.Minute)
+
+	conn, err := c.DialContext(context.Background(), "tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if calls := lookup.calls.Load(); calls != 0 {
+		t.Errorf("resolved %d times, want 0", calls)
+	}
+}
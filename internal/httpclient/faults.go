@@ -0,0 +1,95 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"be-takehome-2024/internal/random"
+)
+
+// Faults are upstream faults to inject into book data requests: Latency is
+// added to LatencyRate of them, and RateLimitRate, ServerErrorRate, and
+// MalformedRate are the fractions answered with an injected 429, an injected
+// 503, or truncated JSON.
+type Faults struct {
+	Latency         time.Duration
+	LatencyRate     float64
+	RateLimitRate   float64
+	ServerErrorRate float64
+	MalformedRate   float64
+}
+
+// injectedFaults are the faults the book providers' clients inject, or nil.
+var injectedFaults atomic.Pointer[Faults]
+
+// InjectFaults makes the book providers' clients, the books clients New
+// returns, inject f until the returned function restores the faults injected
+// before. It is a hook for resilience tests, to exercise the retry, fallback,
+// and partial-result paths; the server never injects faults.
+func InjectFaults(f Faults) (restore func()) {
+	previous := injectedFaults.Swap(&f)
+	return func() { injectedFaults.Store(previous) }
+}
+
+// faultTransport injects the faults set by InjectFaults into requests to
+// next, passing them through unchanged while none are.
+type faultTransport struct {
+	next http.RoundTripper
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f := injectedFaults.Load()
+	if f == nil {
+		return t.next.RoundTrip(req)
+	}
+	if f.Latency > 0 && random.Float64() < f.LatencyRate {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	// The response faults are exclusive, so each rate holds on its own
+	roll := random.Float64()
+	switch {
+	case roll < f.RateLimitRate:
+		resp := injectedResponse(req, http.StatusTooManyRequests, `{"error": "injected rate limit"}`)
+		resp.Header.Set("Retry-After", "1")
+		return resp, nil
+	case roll < f.RateLimitRate+f.ServerErrorRate:
+		return injectedResponse(req, http.StatusServiceUnavailable, `{"error": "injected server error"}`), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || random.Float64() >= f.MalformedRate {
+		return resp, err
+	}
+	// Cut the body off part way, as a dropped connection would
+	resp.Body.Close()
+	resp.Body = io.NopCloser(strings.NewReader(`{"docs": [{"key": "/injected`))
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// injectedResponse builds a JSON response that never reached the upstream.
+func injectedResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,85 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"be-takehome-2024/internal/config"
+)
+
+// upstream returns the URL of a server answering every request with a small
+// JSON document.
+func upstream(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"docs": []}`)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestInjectFaultsOnlyForBooks(t *testing.T) {
+	url := upstream(t)
+	client, books, err := New(&config.Config{OutboundIdleConnsPerHost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore := InjectFaults(Faults{ServerErrorRate: 1})
+	if status, _ := get(t, books, url); status != http.StatusServiceUnavailable {
+		t.Errorf("book request status = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+	if status, body := get(t, client, url); status != http.StatusOK || body != `{"docs": []}` {
+		t.Errorf("other request = %d %q, want it to reach the upstream unchanged", status, body)
+	}
+
+	restore()
+	if status, body := get(t, books, url); status != http.StatusOK || body != `{"docs": []}` {
+		t.Errorf("book request after restore = %d %q, want it to reach the upstream unchanged", status, body)
+	}
+}
+
+func TestFaultTransport(t *testing.T) {
+	url := upstream(t)
+	tests := []struct {
+		name       string
+		faults     Faults
+		wantStatus int
+		wantBody   string
+	}{
+		{"none", Faults{}, http.StatusOK, `{"docs": []}`},
+		// Latency needs both a duration and a rate to be a fault
+		{"latency without a rate", Faults{Latency: time.Hour}, http.StatusOK, `{"docs": []}`},
+		{"rate limit", Faults{RateLimitRate: 1}, http.StatusTooManyRequests, `{"error": "injected rate limit"}`},
+		{"server error", Faults{ServerErrorRate: 1}, http.StatusServiceUnavailable, `{"error": "injected server error"}`},
+		{"malformed", Faults{MalformedRate: 1}, http.StatusOK, `{"docs": [{"key": "/injected`},
+	}
+	client := &http.Client{Transport: &faultTransport{next: http.DefaultTransport}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer InjectFaults(tt.faults)()
+			status, body := get(t, client, url)
+			if status != tt.wantStatus || body != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
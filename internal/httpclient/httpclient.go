@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/config"
+)
+
+// New builds the HTTP clients used for outbound requests: books for the book
+// providers' requests, which injects any faults set by InjectFaults, and
+// client for every other request. They share connections. Proxy and CA
+// settings come only from the configuration, so ambient HTTP(S)_PROXY
+// variables are ignored unless the configuration passes them through.
+func New(cfg *config.Config) (client, books *http.Client, err error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Keep enough idle connections to serve a recommendation's fan-out to
+	// one host without reconnecting, over HTTP/2 where the host offers it
+	transport.MaxIdleConnsPerHost = cfg.OutboundIdleConnsPerHost
+	transport.MaxIdleConns = max(transport.MaxIdleConns, 4*cfg.OutboundIdleConnsPerHost)
+	transport.ForceAttemptHTTP2 = true
+	if cfg.OutboundDNSCacheTTL > 0 {
+		transport.DialContext = newDNSCache(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}, cfg.OutboundDNSCacheTTL).DialContext
+	}
+
+	proxy, err := proxyFunc(cfg.OutboundProxyURL, cfg.OutboundNoProxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport.Proxy = proxy
+
+	if cfg.OutboundCABundle != "" {
+		pool, err := loadCABundle(cfg.OutboundCABundle)
+		if err != nil {
+			return nil, nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	// Only requests that reach the upstream are made conditional
+	upstream := newRevalidatingTransport(cfg, transport)
+	client = newClient(cfg, upstream)
+	books = newClient(cfg, &faultTransport{next: upstream})
+	return client, books, nil
+}
+
+// newClient returns a client sending requests through next, charging every
+// request, faulty or not, to its caller's upstream call budget, and counting
+// and logging injected faults as upstream failures.
+func newClient(cfg *config.Config, next http.RoundTripper) *http.Client {
+	logged := &detailTransport{next: newMetricsTransport(cfg, next)}
+	return &http.Client{Transport: &budget.Transport{Next: logged}}
+}
+
+// proxyFunc routes requests through proxyURL except for hosts matching the
+// no-proxy list, which holds host names, ".domain" suffixes, or "*".
+func proxyFunc(proxyURL string, noProxy []string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(proxyURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid outbound proxy URL '%s'", proxyURL)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, pattern := range noProxy {
+			pattern = strings.ToLower(pattern)
+			switch {
+			case pattern == "*":
+				return nil, nil
+			case strings.HasPrefix(pattern, "."):
+				if strings.HasSuffix(host, pattern) || host == pattern[1:] {
+					return nil, nil
+				}
+			case host == pattern:
+				return nil, nil
+			}
+		}
+		return parsed, nil
+	}, nil
+}
+
+// loadCABundle returns the system roots extended with the PEM certificates in path.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle '%s'", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/metrics"
+)
+
+// metricsTransport records each upstream call and whether it failed. A call
+// fails on a transport error, a 5xx status, or rate limiting; other client
+// errors, like a 404 for an unknown work, are answers rather than failures.
+type metricsTransport struct {
+	next http.RoundTripper
+	// upstreams names the known upstream hosts, keeping the upstream label
+	// to a fixed set. Other hosts, such as webhook receivers, are "other".
+	upstreams map[string]string
+}
+
+func newMetricsTransport(cfg *config.Config, next http.RoundTripper) *metricsTransport {
+	t := &metricsTransport{next: next, upstreams: map[string]string{
+		"www.googleapis.com":    "google_books",
+		"www.wikidata.org":      "wikidata",
+		"en.wikipedia.org":      "wikipedia",
+		"commons.wikimedia.org": "wikimedia_commons",
+	}}
+	// The API is added last, since a local stand-in may serve covers too
+	for _, upstream := range [][2]string{{"blob_store", cfg.BlobStoreEndpoint}, {"openlibrary_covers", cfg.OpenLibraryCoversURL}, {"openlibrary", cfg.OpenLibraryBaseURL}} {
+		if u, err := url.Parse(upstream[1]); err == nil && u.Host != "" {
+			t.upstreams[strings.ToLower(u.Host)] = upstream[0]
+		}
+	}
+	return t
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	upstream, ok := t.upstreams[strings.ToLower(req.URL.Host)]
+	if !ok {
+		upstream = "other"
+	}
+	resp, err := t.next.RoundTrip(req)
+	failed := err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	metrics.ObserveUpstream(upstream, failed)
+	return resp, err
+}
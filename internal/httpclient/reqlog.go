@@ -0,0 +1,50 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/reqlog"
+)
+
+// detailTransport lists each upstream call in the request details of its
+// context, for verbose request logging.
+type detailTransport struct {
+	next http.RoundTripper
+}
+
+func (t *detailTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := reqlog.FromContext(req.Context())
+	if rec == nil {
+		return t.next.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	rec.Upstream(req.Method, redactURL(req.URL), status, time.Since(start), err)
+	return resp, err
+}
+
+// redactURL hides the values of query parameters that may hold credentials,
+// such as a Google Books API key.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for name := range query {
+		if lower := strings.ToLower(name); lower == "key" || strings.Contains(lower, "token") || strings.Contains(lower, "secret") {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+	copied := *u
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
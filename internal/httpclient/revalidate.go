@@ -0,0 +1,139 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/config"
+)
+
+// maxValidatedBodyBytes caps the size of the responses kept for
+// revalidation; larger ones are fetched in full each time.
+const maxValidatedBodyBytes = 1 << 20
+
+// validated is an upstream response kept with its validators, to be served
+// again when the upstream reports it unchanged.
+type validated struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// Size is the response's size in the cache, counted from its fields rather
+// than by encoding bodies of up to maxValidatedBodyBytes on every Set.
+func (v validated) Size() int64 {
+	return int64(len(v.ETag) + len(v.LastModified) + len(v.ContentType) + len(v.Body))
+}
+
+// validatedResponses holds Open Library responses by URL, long after the
+// caches of the data decoded from them expire, so refetching it costs the
+// upstream only a 304 when nothing changed.
+var validatedResponses = cache.New[validated]("upstream_validated", 24*time.Hour)
+
+// revalidatingTransport makes GETs to Open Library conditional on the
+// ETag or Last-Modified of the last response to the same URL, and answers a
+// 304 with that response, as a 200, so callers never see the difference.
+type revalidatingTransport struct {
+	next  http.RoundTripper
+	hosts map[string]bool
+}
+
+// newRevalidatingTransport wraps next to revalidate Open Library API
+// responses, or returns next unchanged when revalidation is disabled.
+func newRevalidatingTransport(cfg *config.Config, next http.RoundTripper) http.RoundTripper {
+	if !cfg.UpstreamRevalidation {
+		return next
+	}
+	t := &revalidatingTransport{next: next, hosts: make(map[string]bool)}
+	if u, err := url.Parse(cfg.OpenLibraryBaseURL); err == nil && u.Host != "" {
+		t.hosts[strings.ToLower(u.Host)] = true
+	}
+	return t
+}
+
+func (t *revalidatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !t.hosts[strings.ToLower(req.URL.Host)] ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.next.RoundTrip(req)
+	}
+	key := req.URL.String()
+	stored, ok := validatedResponses.Get(key)
+	if ok {
+		req = req.Clone(req.Context())
+		if stored.ETag != "" {
+			req.Header.Set("If-None-Match", stored.ETag)
+		}
+		if stored.LastModified != "" {
+			req.Header.Set("If-Modified-Since", stored.LastModified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		// Keep the response for another TTL, under any validators the 304 updated
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			stored.ETag = etag
+		}
+		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+			stored.LastModified = lastModified
+		}
+		validatedResponses.Set(key, stored)
+		return storedResponse(req, resp, stored), nil
+	}
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+	fresh := validated{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), ContentType: resp.Header.Get("Content-Type")}
+	if fresh.ETag == "" && fresh.LastModified == "" {
+		return resp, nil
+	}
+
+	// Keep the body if it's small enough, handing it on whole either way
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxValidatedBodyBytes+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxValidatedBodyBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	fresh.Body = body
+	validatedResponses.Set(key, fresh)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// storedResponse turns a 304 for req into a 200 carrying the stored response.
+func storedResponse(req *http.Request, notModified *http.Response, stored validated) *http.Response {
+	header := notModified.Header.Clone()
+	if stored.ContentType != "" {
+		header.Set("Content-Type", stored.ContentType)
+	}
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(stored.Body)),
+		ContentLength: int64(len(stored.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kinds of unsuccessful upstream responses, matched with errors.Is against a
+// *StatusError.
+var (
+	ErrNotFound    = errors.New("upstream resource not found")
+	ErrRateLimited = errors.New("upstream rate limit reached")
+	ErrServerError = errors.New("upstream server error")
+)
+
+// StatusError is an upstream response without a 200 status.
+type StatusError struct {
+	Source     string // The URL or service the response came from, for messages
+	StatusCode int
+	Status     string
+	// RetryAfter is how long a rate limited or unavailable upstream asked
+	// clients to wait, or zero if it did not say.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received status %s from %s", e.Status, e.Source)
+}
+
+// Is matches the error against ErrNotFound, ErrRateLimited, or ErrServerError.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// maxErrorBodyBytes bounds how much of an error body is read and discarded,
+// so the connection can be reused without reading an arbitrarily large page.
+const maxErrorBodyBytes = 64 << 10
+
+// CheckStatus returns a *StatusError for a response without a 200 status,
+// such as an HTML error page, so it is never parsed as data. source names the
+// upstream in the error message.
+func CheckStatus(resp *http.Response, source string) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+	return &StatusError{
+		Source:     source,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// RetryAfter returns how long the upstream behind err asked clients to wait,
+// or zero if err is not a *StatusError saying so.
+func RetryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
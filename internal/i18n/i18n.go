@@ -0,0 +1,191 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the language messages are written in, used when the
+// client accepts nothing else the catalog has.
+const DefaultLanguage = "en"
+
+// Catalog provides translations of English message formats. Messages are
+// looked up by their English format string, as with gettext, so untranslated
+// messages fall back to readable English.
+type Catalog interface {
+	// Translate returns the format string for msgid in lang, if there is one.
+	Translate(lang, msgid string) (string, bool)
+	// Languages lists the languages with translations.
+	Languages() []string
+}
+
+// MapCatalog is a Catalog held in memory, keyed by language then msgid.
+type MapCatalog map[string]map[string]string
+
+func (c MapCatalog) Translate(lang, msgid string) (string, bool) {
+	translated, ok := c[lang][msgid]
+	return translated, ok && translated != ""
+}
+
+func (c MapCatalog) Languages() []string {
+	langs := make([]string, 0, len(c))
+	for lang := range c {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+//go:embed catalogs/*.json
+var builtin embed.FS
+
+var (
+	mu      sync.RWMutex
+	catalog Catalog = mustLoadBuiltin()
+)
+
+// SetCatalog replaces the catalog used for translations.
+func SetCatalog(c Catalog) {
+	mu.Lock()
+	defer mu.Unlock()
+	catalog = c
+}
+
+func current() Catalog {
+	mu.RLock()
+	defer mu.RUnlock()
+	return catalog
+}
+
+// mustLoadBuiltin reads the catalogs shipped with the service.
+func mustLoadBuiltin() MapCatalog {
+	c := make(MapCatalog)
+	entries, err := builtin.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := builtin.ReadFile("catalogs/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		if err := c.add(entry.Name(), data); err != nil {
+			panic(err)
+		}
+	}
+	return c
+}
+
+// LoadDir returns the built-in catalog extended with the <lang>.json files in
+// dir, each a JSON object from English format to translation. Files override
+// built-in translations.
+func LoadDir(dir string) (MapCatalog, error) {
+	c := mustLoadBuiltin()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.add(filepath.Base(path), data); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c MapCatalog) add(filename string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("error parsing message catalog %s: %v", filename, err)
+	}
+	lang := strings.ToLower(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	if c[lang] == nil {
+		c[lang] = make(map[string]string)
+	}
+	for msgid, translated := range messages {
+		c[lang][msgid] = translated
+	}
+	return nil
+}
+
+// T formats the message in lang, falling back to English when it has no translation.
+func T(lang, format string, args ...interface{}) string {
+	if translated, ok := current().Translate(lang, format); ok {
+		format = translated
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Message is a user-facing message kept untranslated until it is shown, for
+// values that are stored or passed between packages. Args are strings so the
+// message survives a JSON round trip unchanged.
+type Message struct {
+	Format string   `json:"format"`
+	Args   []string `json:"args,omitempty"`
+}
+
+// NewMessage returns a message, formatting each argument with %v.
+func NewMessage(format string, args ...interface{}) Message {
+	m := Message{Format: format}
+	for _, arg := range args {
+		m.Args = append(m.Args, fmt.Sprint(arg))
+	}
+	return m
+}
+
+// Text renders the message in lang. The format's verbs must all be %s.
+func (m Message) Text(lang string) string {
+	args := make([]interface{}, len(m.Args))
+	for i, arg := range m.Args {
+		args[i] = arg
+	}
+	return T(lang, m.Format, args...)
+}
+
+// Negotiate picks the best language for an Accept-Language header among
+// those in the catalog, defaulting to English.
+func Negotiate(acceptLanguage string) string {
+	supported := make(map[string]bool)
+	for _, lang := range current().Languages() {
+		supported[lang] = true
+	}
+	supported[DefaultLanguage] = true
+
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		// Match "es-MX" to "es" when there is no regional catalog
+		tag = strings.ToLower(tag)
+		base, _, _ := strings.Cut(tag, "-")
+		for _, candidate := range []string{tag, base} {
+			if supported[candidate] && q > bestQ {
+				best, bestQ = candidate, q
+				break
+			}
+		}
+	}
+	return best
+}
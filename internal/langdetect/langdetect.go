@@ -0,0 +1,117 @@
+// Package langdetect tells the language of a text, such as a book
+// description, from its script or, for Latin-script languages, from how
+// many of each language's commonest words it uses. It is meant for texts of
+// a sentence or more; shorter ones are usually left undetermined.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Languages are the ISO 639-1 codes of the languages Detect tells apart.
+var Languages = []string{"en", "es", "fr", "de", "it", "pt", "nl", "ru", "el", "ar", "he", "zh", "ja", "ko"}
+
+// scripts identifies languages written in a script of their own.
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+}
+
+// stopWords are the commonest words of each Latin-script language, left
+// out where they are as common in another.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "as", "for", "his", "her", "was", "on", "are", "by", "this", "be", "from", "they", "which", "their", "has", "have", "who", "an", "when", "into", "she", "he"},
+	"es": {"el", "la", "los", "las", "de", "del", "y", "que", "en", "un", "una", "por", "con", "para", "es", "su", "sus", "al", "lo", "como", "más", "pero", "se", "este", "esta", "sobre", "entre", "cuando", "muy", "sin"},
+	"fr": {"le", "la", "les", "de", "des", "du", "et", "est", "un", "une", "que", "qui", "dans", "pour", "pas", "sur", "au", "aux", "avec", "il", "elle", "ce", "cette", "son", "sa", "ses", "mais", "ou", "leur", "nous"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "dem", "des", "mit", "sich", "auf", "für", "von", "im", "auch", "als", "an", "er", "sie", "es", "wird", "aus", "bei", "nach", "wie", "einer"},
+	"it": {"il", "lo", "la", "gli", "le", "di", "e", "che", "un", "una", "per", "non", "con", "del", "della", "dei", "nel", "nella", "sono", "è", "si", "da", "alla", "come", "anche", "più", "ma", "suo", "sua", "questo"},
+	"pt": {"o", "a", "os", "as", "de", "do", "da", "dos", "das", "e", "que", "em", "um", "uma", "para", "com", "não", "por", "no", "na", "se", "mais", "seu", "sua", "como", "ao", "foi", "ele", "ela", "mas"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "op", "te", "zijn", "met", "voor", "niet", "aan", "er", "ook", "als", "maar", "door", "bij", "hij", "zij", "wordt", "naar", "uit", "over", "dit", "deze", "nog", "worden"},
+}
+
+// languagesOfWord maps each stop word to the languages it is common in.
+var languagesOfWord = func() map[string][]string {
+	index := make(map[string][]string)
+	for lang, words := range stopWords {
+		for _, word := range words {
+			index[word] = append(index[word], lang)
+		}
+	}
+	return index
+}()
+
+const (
+	// minScriptShare is the share of a text's letters that must be in a
+	// script for it to be told by that script.
+	minScriptShare = 0.3
+	// minStopWords is how many stop words a Latin-script text must use to be
+	// told at all.
+	minStopWords = 3
+	// minLead is how many times more stop words of its language a text must
+	// use than of any other.
+	minLead = 1.5
+)
+
+// Detect returns the ISO 639-1 code of the language text is in, or "" if it
+// can't be told.
+func Detect(text string) string {
+	var letters int
+	byScript := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scripts {
+			if unicode.Is(script.table, r) {
+				byScript[script.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Japanese mixes kana with Han characters, so any kana decides it
+	if byScript["ja"] > 0 && float64(byScript["ja"]+byScript["zh"]) >= minScriptShare*float64(letters) {
+		return "ja"
+	}
+	for _, script := range scripts {
+		if float64(byScript[script.lang]) >= minScriptShare*float64(letters) {
+			return script.lang
+		}
+	}
+
+	scores := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		for _, lang := range languagesOfWord[word] {
+			scores[lang]++
+		}
+	}
+	best, bestScore, runnerUp := "", 0, 0
+	for _, lang := range Languages {
+		switch score := scores[lang]; {
+		case score > bestScore:
+			best, bestScore, runnerUp = lang, score, bestScore
+		case score > runnerUp:
+			runnerUp = score
+		}
+	}
+	if bestScore < minStopWords || float64(bestScore) < minLead*float64(runnerUp) {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+)
+
+// cacheSnapshot is every registered cache's cumulative hits and misses at one time.
+type cacheSnapshot struct {
+	at     time.Time
+	hits   map[string]uint64
+	misses map[string]uint64
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w)
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func Write(w io.Writer) {
+	now := time.Now()
+	caches, since := snapshotCaches(now)
+
+	mu.Lock()
+	defer mu.Unlock()
+	windowLabel := formatWindow(window)
+
+	// Raw counters and the latency histogram
+	header(w, "bookrec_http_requests_total", "counter", "Requests served, by route, method, and status code.")
+	keys := make([]requestKey, 0, len(requests))
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, key := range keys {
+		sample(w, "bookrec_http_requests_total", float64(requests[key]),
+			"route", key.route, "method", key.method, "code", strconv.Itoa(key.code))
+	}
+
+	header(w, "bookrec_http_request_duration_seconds", "histogram", "Request latency, by route.")
+	for _, route := range sortedKeys(routes) {
+		if route == AllRoutes {
+			continue
+		}
+		c := routes[route].lifetime
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += c.buckets[i]
+			sample(w, "bookrec_http_request_duration_seconds_bucket", float64(cumulative), "route", route, "le", formatFloat(bound))
+		}
+		sample(w, "bookrec_http_request_duration_seconds_bucket", float64(c.total), "route", route, "le", "+Inf")
+		sample(w, "bookrec_http_request_duration_seconds_sum", c.sum, "route", route)
+		sample(w, "bookrec_http_request_duration_seconds_count", float64(c.total), "route", route)
+	}
+
+	header(w, "bookrec_upstream_requests_total", "counter", "Upstream calls, by upstream and outcome.")
+	for _, name := range sortedKeys(upstreams) {
+		c := upstreams[name].lifetime
+		sample(w, "bookrec_upstream_requests_total", float64(c.total-c.errors), "upstream", name, "outcome", "success")
+		sample(w, "bookrec_upstream_requests_total", float64(c.errors), "upstream", name, "outcome", "error")
+	}
+
+	header(w, "bookrec_upstream_schema_drift_total", "counter", "Upstream responses missing an expected field or with one of an unexpected type, by upstream, endpoint, and field.")
+	driftKeys := make([]driftKey, 0, len(drift))
+	for key := range drift {
+		driftKeys = append(driftKeys, key)
+	}
+	sort.Slice(driftKeys, func(i, j int) bool {
+		a, b := driftKeys[i], driftKeys[j]
+		if a.upstream != b.upstream {
+			return a.upstream < b.upstream
+		}
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		return a.field < b.field
+	})
+	for _, key := range driftKeys {
+		sample(w, "bookrec_upstream_schema_drift_total", float64(drift[key]),
+			"upstream", key.upstream, "endpoint", key.endpoint, "field", key.field)
+	}
+
+	header(w, "bookrec_pipeline_stage_runs_total", "counter", "Recommendation pipeline stage runs, by stage and outcome.")
+	for _, name := range sortedKeys(stages) {
+		c := stages[name].lifetime
+		sample(w, "bookrec_pipeline_stage_runs_total", float64(c.total-c.errors), "stage", name, "outcome", "success")
+		sample(w, "bookrec_pipeline_stage_runs_total", float64(c.errors), "stage", name, "outcome", "error")
+	}
+
+	header(w, "bookrec_pipeline_stage_duration_seconds", "histogram", "Recommendation pipeline stage latency, by stage.")
+	for _, name := range sortedKeys(stages) {
+		c := stages[name].lifetime
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += c.buckets[i]
+			sample(w, "bookrec_pipeline_stage_duration_seconds_bucket", float64(cumulative), "stage", name, "le", formatFloat(bound))
+		}
+		sample(w, "bookrec_pipeline_stage_duration_seconds_bucket", float64(c.total), "stage", name, "le", "+Inf")
+		sample(w, "bookrec_pipeline_stage_duration_seconds_sum", c.sum, "stage", name)
+		sample(w, "bookrec_pipeline_stage_duration_seconds_count", float64(c.total), "stage", name)
+	}
+
+	header(w, "bookrec_cache_requests_total", "counter", "Cache lookups, by cache and result.")
+	for _, name := range sortedKeys(caches.hits) {
+		sample(w, "bookrec_cache_requests_total", float64(caches.hits[name]), "cache", name, "result", "hit")
+		sample(w, "bookrec_cache_requests_total", float64(caches.misses[name]), "cache", name, "result", "miss")
+	}
+
+	// SLIs over the window. Series without events in the window are left
+	// out rather than reported as a misleading zero.
+	header(w, "bookrec_sli_request_success_ratio", "gauge", "Share of requests in the window not failing with a 5xx status, by route.")
+	for _, route := range sortedKeys(routes) {
+		if c := routes[route].recent(now); c.total > 0 {
+			sample(w, "bookrec_sli_request_success_ratio", float64(c.total-c.errors)/float64(c.total), "route", route, "window", windowLabel)
+		}
+	}
+
+	header(w, "bookrec_sli_request_latency_p95_seconds", "gauge", "95th percentile request latency in the window, by route.")
+	for _, route := range sortedKeys(routes) {
+		if c := routes[route].recent(now); c.total > 0 {
+			sample(w, "bookrec_sli_request_latency_p95_seconds", quantile(0.95, c.buckets), "route", route, "window", windowLabel)
+		}
+	}
+
+	header(w, "bookrec_sli_upstream_error_ratio", "gauge", "Share of upstream calls in the window that failed, by upstream.")
+	for _, name := range sortedKeys(upstreams) {
+		if c := upstreams[name].recent(now); c.total > 0 {
+			sample(w, "bookrec_sli_upstream_error_ratio", float64(c.errors)/float64(c.total), "upstream", name, "window", windowLabel)
+		}
+	}
+
+	header(w, "bookrec_sli_cache_hit_ratio", "gauge", "Share of cache lookups in the window that hit, by cache.")
+	for _, name := range sortedKeys(caches.hits) {
+		hits, misses := caches.hits[name], caches.misses[name]
+		if since != nil && hits >= since.hits[name] && misses >= since.misses[name] {
+			hits -= since.hits[name]
+			misses -= since.misses[name]
+		}
+		if hits+misses > 0 {
+			sample(w, "bookrec_sli_cache_hit_ratio", float64(hits)/float64(hits+misses), "cache", name, "window", windowLabel)
+		}
+	}
+}
+
+// snapshotCaches records the caches' current counts, dropping snapshots that
+// have aged out of the window, and returns the current counts and the
+// snapshot the window is measured from. Without an earlier snapshot, or for a
+// cache whose counts went down since, the lifetime counts are used.
+func snapshotCaches(now time.Time) (cacheSnapshot, *cacheSnapshot) {
+	snapshot := cacheSnapshot{at: now, hits: make(map[string]uint64), misses: make(map[string]uint64)}
+	for _, name := range cache.Names() {
+		if store, ok := cache.Lookup(name); ok {
+			stats := store.Stats()
+			snapshot.hits[name] = stats.Hits
+			snapshot.misses[name] = stats.Misses
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Keep the newest snapshot at or before the window's start to measure from
+	for len(cacheSnapshots) > 1 && !cacheSnapshots[1].at.After(now.Add(-window)) {
+		cacheSnapshots = cacheSnapshots[1:]
+	}
+	var since *cacheSnapshot
+	if len(cacheSnapshots) > 0 {
+		oldest := cacheSnapshots[0]
+		since = &oldest
+	}
+	cacheSnapshots = append(cacheSnapshots, snapshot)
+	return snapshot, since
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one sample with its labels, given as name and value pairs.
+func sample(w io.Writer, name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(w, "%s %s\n", b.String(), formatFloat(value))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatWindow renders a window as a Prometheus duration, e.g. "5m".
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
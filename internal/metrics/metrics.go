@@ -0,0 +1,280 @@
+// Package metrics counts requests, upstream calls, and cache lookups and
+// exposes them in the Prometheus text format. Besides the raw counters and
+// latency histogram, it publishes ready-made SLI gauges computed over a
+// sliding window, so SLO alerts can compare them to a target directly:
+//
+//	bookrec_sli_request_success_ratio{route,window}
+//	bookrec_sli_request_latency_p95_seconds{route,window}
+//	bookrec_sli_upstream_error_ratio{upstream,window}
+//	bookrec_sli_cache_hit_ratio{cache,window}
+//
+// Request SLIs are also published across all routes, with route="*".
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/config"
+)
+
+// slotSize is the granularity of the sliding windows.
+const slotSize = 10 * time.Second
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// AllRoutes is the route label of request SLIs computed across every route.
+const AllRoutes = "*"
+
+// counts are the events recorded in one slot of a window, or in total.
+type counts struct {
+	total  uint64
+	errors uint64
+	// buckets holds how many latencies fell in each range up to one of
+	// latencyBuckets, and above them all in the final entry. It is nil for
+	// series without latencies.
+	buckets []uint64
+	sum     float64
+}
+
+func (c *counts) add(other counts) {
+	c.total += other.total
+	c.errors += other.errors
+	c.sum += other.sum
+	if other.buckets != nil {
+		if c.buckets == nil {
+			c.buckets = make([]uint64, len(latencyBuckets)+1)
+		}
+		for i, n := range other.buckets {
+			c.buckets[i] += n
+		}
+	}
+}
+
+// series is a counter, with optional latencies, that also keeps the counts of
+// the last window in slots.
+type series struct {
+	lifetime counts
+	slots    []counts
+	starts   []int64 // Unix start of each slot, to detect stale ones
+}
+
+func newSeries(window time.Duration) *series {
+	n := max(int(window/slotSize), 1)
+	return &series{slots: make([]counts, n), starts: make([]int64, n)}
+}
+
+// slot returns the slot for now, clearing it if it last held an older period.
+func (s *series) slot(now time.Time) *counts {
+	start := now.Truncate(slotSize).Unix()
+	i := int(start/int64(slotSize.Seconds())) % len(s.slots)
+	if s.starts[i] != start {
+		s.starts[i] = start
+		s.slots[i] = counts{}
+	}
+	return &s.slots[i]
+}
+
+func (s *series) record(now time.Time, event counts) {
+	s.lifetime.add(event)
+	s.slot(now).add(event)
+}
+
+// recent returns the counts within the window ending now.
+func (s *series) recent(now time.Time) counts {
+	var c counts
+	oldest := now.Truncate(slotSize).Add(-slotSize * time.Duration(len(s.slots)-1)).Unix()
+	for i := range s.slots {
+		if s.starts[i] >= oldest {
+			c.add(s.slots[i])
+		}
+	}
+	return c
+}
+
+// requestKey identifies a request series.
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+// driftKey identifies a schema drift series.
+type driftKey struct {
+	upstream string
+	endpoint string
+	field    string
+}
+
+var (
+	mu sync.Mutex
+	// window is the span the SLI gauges cover.
+	window = 5 * time.Minute
+	// requests counts the requests served with each status code.
+	requests = make(map[requestKey]uint64)
+	// routes holds each route's, and all routes', windowed successes and latencies.
+	routes    = make(map[string]*series)
+	upstreams = make(map[string]*series)
+	// drift counts upstream responses departing from the expected schema, by field.
+	drift = make(map[driftKey]uint64)
+	// stages holds each recommendation pipeline stage's runs, failures, and latencies.
+	stages = make(map[string]*series)
+	// cacheSnapshots are the caches' cumulative counts at recent scrapes,
+	// oldest first, from which their windowed hit ratios are derived.
+	cacheSnapshots []cacheSnapshot
+)
+
+func init() {
+	applyWindow(config.Get())
+	config.OnReload(applyWindow)
+}
+
+// applyWindow sets the span the SLI gauges cover from the configuration. A
+// changed window discards the windowed counts recorded so far; the lifetime
+// counters are kept.
+func applyWindow(cfg *config.Config) {
+	w := cfg.SLIWindow
+	mu.Lock()
+	defer mu.Unlock()
+	if w <= 0 || w == window {
+		return
+	}
+	window = w
+	for _, m := range []map[string]*series{routes, upstreams, stages} {
+		for key, s := range m {
+			fresh := newSeries(w)
+			fresh.lifetime = s.lifetime
+			m[key] = fresh
+		}
+	}
+	cacheSnapshots = nil
+}
+
+// ObserveRequest records a served request. Responses with a 5xx status count
+// against the success ratio; client errors do not.
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	now := time.Now()
+	event := counts{total: 1, buckets: make([]uint64, len(latencyBuckets)+1), sum: duration.Seconds()}
+	if status >= 500 {
+		event.errors = 1
+	}
+	event.buckets[bucketIndex(duration.Seconds())] = 1
+
+	mu.Lock()
+	defer mu.Unlock()
+	requests[requestKey{route: route, method: method, code: status}]++
+	for _, name := range []string{route, AllRoutes} {
+		r, ok := routes[name]
+		if !ok {
+			r = newSeries(window)
+			routes[name] = r
+		}
+		r.record(now, event)
+	}
+}
+
+// ObserveUpstream records a call to an upstream service and whether it failed.
+func ObserveUpstream(upstream string, failed bool) {
+	event := counts{total: 1}
+	if failed {
+		event.errors = 1
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := upstreams[upstream]
+	if !ok {
+		s = newSeries(window)
+		upstreams[upstream] = s
+	}
+	s.record(time.Now(), event)
+}
+
+// UpstreamUsage is the calls made to an upstream service within the window.
+type UpstreamUsage struct {
+	Calls  uint64 `json:"calls"`
+	Errors uint64 `json:"errors"`
+	// CallsPerMinute is the average rate of calls over the window.
+	CallsPerMinute float64 `json:"calls_per_minute"`
+}
+
+// Upstreams returns the window the usage covers and each upstream's usage
+// within it.
+func Upstreams() (time.Duration, map[string]UpstreamUsage) {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	usage := make(map[string]UpstreamUsage, len(upstreams))
+	for name, s := range upstreams {
+		c := s.recent(now)
+		usage[name] = UpstreamUsage{Calls: c.total, Errors: c.errors, CallsPerMinute: float64(c.total) / window.Minutes()}
+	}
+	return window, usage
+}
+
+// ObserveSchemaDrift records an upstream response from endpoint whose field
+// was missing or of an unexpected type.
+func ObserveSchemaDrift(upstream, endpoint, field string) {
+	mu.Lock()
+	defer mu.Unlock()
+	drift[driftKey{upstream: upstream, endpoint: endpoint, field: field}]++
+}
+
+// ObserveStage records a run of a recommendation pipeline stage, how long it
+// took, and whether it failed.
+func ObserveStage(stage string, failed bool, duration time.Duration) {
+	event := counts{total: 1, buckets: make([]uint64, len(latencyBuckets)+1), sum: duration.Seconds()}
+	if failed {
+		event.errors = 1
+	}
+	event.buckets[bucketIndex(duration.Seconds())] = 1
+
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := stages[stage]
+	if !ok {
+		s = newSeries(window)
+		stages[stage] = s
+	}
+	s.record(time.Now(), event)
+}
+
+func bucketIndex(seconds float64) int {
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			return i
+		}
+	}
+	return len(latencyBuckets)
+}
+
+// quantile estimates the q quantile of the latencies counted in buckets,
+// interpolating linearly within the bucket it falls in as Prometheus'
+// histogram_quantile does. Latencies beyond the last bound report that bound.
+func quantile(q float64, buckets []uint64) float64 {
+	var total uint64
+	for _, n := range buckets {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen uint64
+	for i, n := range buckets {
+		if float64(seen+n) < rank || n == 0 {
+			seen += n
+			continue
+		}
+		if i == len(latencyBuckets) {
+			return latencyBuckets[len(latencyBuckets)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = latencyBuckets[i-1]
+		}
+		return lower + (latencyBuckets[i]-lower)*(rank-float64(seen))/float64(n)
+	}
+	return latencyBuckets[len(latencyBuckets)-1]
+}
@@ -0,0 +1,10 @@
+package models
+
+// AuthorBio is a short biography and portrait for an author, sourced from
+// Wikidata and Wikipedia.
+type AuthorBio struct {
+	Name       string  `json:"name"`
+	WikidataID string  `json:"wikidata_id,omitempty"`
+	Bio        *string `json:"bio"`
+	PhotoURL   *string `json:"photo_url"`
+}
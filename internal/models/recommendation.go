@@ -0,0 +1,8 @@
+package models
+
+// Recommendation is the books recommended for some users and the subject
+// they were chosen from.
+type Recommendation struct {
+	Subject string `json:"subject"`
+	Books   []Work `json:"books"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "sort"
+
+// Subject is a subject recommendations are drawn from, such as
+// "science_fiction", with its score for the users it was chosen for.
+type Subject struct {
+	Key   string  `json:"subject"`
+	Score float64 `json:"score"`
+	// Members is, for groups, how many members share the subject.
+	Members int `json:"members,omitempty"`
+}
+
+// SubjectProfile is a user's interest in each subject, keyed by subject. It
+// marshals as a JSON object from subject to weight.
+type SubjectProfile map[string]float64
+
+// Subjects returns the profile's subjects in sorted order, so sums over them
+// do not depend on map order.
+func (p SubjectProfile) Subjects() []string {
+	subjects := make([]string, 0, len(p))
+	for subject := range p {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Top returns up to n subjects with the highest weights, ties broken alphabetically.
+func (p SubjectProfile) Top(n int) []string {
+	ranked := p.Subjects()
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return p[ranked[i]] > p[ranked[j]]
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
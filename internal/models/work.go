@@ -1,7 +1,68 @@
 package models
 
 type Work struct {
-	Title            string   `json:"title"`
-	Authors          []string `json:"authors"`
-	Description      *string   `json:"description"`
-}
\ No newline at end of file
+	Key            string   `json:"key,omitempty"` // Provider's work key, e.g. OL45883W
+	Title          string   `json:"title"`
+	Authors        []string `json:"authors"`
+	Description    *string  `json:"description"`
+	PublishYear    int      `json:"publish_year"`
+	Subject        string   `json:"subject,omitempty"`         // Set when books are blended from several subjects
+	SubjectName    string   `json:"subject_name,omitempty"`    // Subject's display name in the requester's language
+	Series         string   `json:"series,omitempty"`          // Series the book belongs to, if known
+	SeriesPosition int      `json:"series_position,omitempty"` // Position in the series, or 0 if unknown
+	Formats        []string `json:"formats,omitempty"`         // Formats the book is available in, when filtering by format
+	// DescriptionSource is the field the description came from: the work's
+	// own description, or an excerpt or first sentence standing in for it
+	DescriptionSource  string `json:"description_source,omitempty"`
+	DescriptionMissing bool   `json:"description_missing,omitempty"` // Set when the work has no description text
+	// DescriptionLanguage is the language the description was detected to be
+	// in, when a language is requested and it could be told
+	DescriptionLanguage string `json:"description_language,omitempty"`
+	// DescriptionForeign is set when the description isn't in the requested language
+	DescriptionForeign bool `json:"description_foreign,omitempty"`
+}
+
+// Where a work's description text came from.
+const (
+	DescriptionSourceDescription   = "description"
+	DescriptionSourceExcerpt       = "excerpt"
+	DescriptionSourceFirstSentence = "first_sentence"
+	DescriptionSourceEdition       = "edition" // An edition's description, in the requested language
+)
+
+// Description is the text describing a work, and which of its fields the
+// text came from.
+type Description struct {
+	Text   string
+	Source string
+}
+
+// AuthorWork is a single entry from an author's list of works.
+type AuthorWork struct {
+	Title    string   `json:"title"`
+	Key      string   `json:"key"`
+	Subjects []string `json:"subjects"`
+}
+
+// SubjectWork is a work listed under a subject. Description is only set when
+// the provider returns it inline with the listing.
+type SubjectWork struct {
+	Title            string
+	Key              string
+	Authors          []string
+	FirstPublishYear int
+	EditionCount     int
+	Description      *string
+	Ebook            bool     // An ebook of the work can be read or borrowed
+	Subjects         []string // The work's own subjects, when the listing includes them
+	Subject          string   // The subject the work was fetched for, when blending subjects
+}
+
+// Edition is a single published edition of a work.
+type Edition struct {
+	Key            string
+	PhysicalFormat string   // e.g. "Paperback", "Audio CD", "ebook"; often empty
+	Series         []string // Series statements, e.g. "The Stormlight Archive ; 1"
+	Languages      []string // ISO 639-1 codes of the languages the edition is in, when known
+	Description    string   // The edition's own description, if it has one
+}
@@ -0,0 +1,98 @@
+// Package olindex is a local index of Open Library's authors and works,
+// loaded from its bulk data dumps, so large deployments can serve author and
+// subject queries without the live API.
+package olindex
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// schema creates the index's tables. Keys are stored without their "/works/"
+// or "/authors/" prefix, and subjects lowercased.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS authors (
+		key TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		work_count INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_authors_name ON authors(name COLLATE NOCASE)`,
+	`CREATE TABLE IF NOT EXISTS works (
+		key TEXT PRIMARY KEY,
+		title TEXT NOT NULL,
+		first_publish_year INTEGER NOT NULL DEFAULT 0,
+		description TEXT,
+		description_source TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS work_authors (
+		work_key TEXT NOT NULL,
+		author_key TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (work_key, author_key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_work_authors_author ON work_authors(author_key)`,
+	`CREATE TABLE IF NOT EXISTS work_subjects (
+		work_key TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		PRIMARY KEY (work_key, subject)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_work_subjects_subject ON work_subjects(subject, work_key)`,
+	`CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+}
+
+// dumpDateLayout is how the dumps record when each record was last modified.
+const dumpDateLayout = "2006-01-02T15:04:05.999999999"
+
+// Open returns a handle to the index at path for reading.
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	// Fail at startup, not on the first request, if the index is missing
+	var works int
+	if err := db.QueryRow("SELECT COUNT(*) FROM works LIMIT 1").Scan(&works); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error reading Open Library index %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// DumpDate returns when the newest record loaded into the index was last
+// modified, or the zero time if nothing has been loaded or the index
+// predates recording it.
+func DumpDate(db *sql.DB) (time.Time, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM meta WHERE key = 'dump_date'").Scan(&value)
+	if err == sql.ErrNoRows || (err != nil && strings.Contains(err.Error(), "no such table")) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(dumpDateLayout, value)
+}
+
+// Create returns a handle to the index at path for loading, creating it and
+// its tables if needed.
+func Create(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// Loading is one long write nothing else reads, so favor speed over durability
+	for _, statement := range append([]string{`PRAGMA journal_mode = WAL`, `PRAGMA synchronous = OFF`}, schema...) {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating Open Library index %s: %v", path, err)
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,243 @@
+package olindex
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/dates"
+	"be-takehome-2024/internal/models"
+)
+
+// batchSize is how many records are loaded per transaction.
+const batchSize = 10000
+
+// maxRecordBytes bounds a dump line; a few works have very long descriptions.
+const maxRecordBytes = 16 << 20
+
+// LoadAuthors loads the authors of an Open Library authors dump, returning
+// how many were loaded. Authors already in the index are updated.
+func LoadAuthors(ctx context.Context, db *sql.DB, dump io.Reader) (int, error) {
+	return load(ctx, db, dump, "/type/author", func(tx *sql.Tx, data []byte) (bool, error) {
+		var record struct {
+			Key  string `json:"key"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil || record.Key == "" || record.Name == "" {
+			return false, nil
+		}
+		_, err := tx.Exec(`
+			INSERT INTO authors(key, name) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET name = excluded.name
+		`, strings.TrimPrefix(record.Key, "/authors/"), record.Name)
+		return true, err
+	})
+}
+
+// workRecord is the part of a works dump record the index keeps.
+type workRecord struct {
+	Key     string `json:"key"`
+	Title   string `json:"title"`
+	Authors []struct {
+		// Author is an object with a key, or in older records the key itself
+		Author interface{} `json:"author"`
+		Key    string      `json:"key"`
+	} `json:"authors"`
+	Subjects         []string    `json:"subjects"`
+	FirstPublishDate string      `json:"first_publish_date"`
+	Description      interface{} `json:"description"`
+	Excerpts         []struct {
+		Excerpt interface{} `json:"excerpt"`
+	} `json:"excerpts"`
+	FirstSentence interface{} `json:"first_sentence"`
+}
+
+// LoadWorks loads the works of an Open Library works dump, with their
+// authors and subjects, returning how many were loaded. Works already in the
+// index are replaced. Run CountWorks once every dump is loaded.
+func LoadWorks(ctx context.Context, db *sql.DB, dump io.Reader) (int, error) {
+	return load(ctx, db, dump, "/type/work", func(tx *sql.Tx, data []byte) (bool, error) {
+		var record workRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.Key == "" || record.Title == "" {
+			return false, nil
+		}
+		key := strings.TrimPrefix(record.Key, "/works/")
+
+		var description, source *string
+		if d := workDescription(record); d != nil {
+			description, source = &d.Text, &d.Source
+		}
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO works(key, title, first_publish_year, description, description_source)
+			VALUES (?, ?, ?, ?, ?)
+		`, key, record.Title, dates.Year(record.FirstPublishDate), description, source); err != nil {
+			return false, err
+		}
+
+		for _, table := range []string{"work_authors", "work_subjects"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE work_key = ?", key); err != nil {
+				return false, err
+			}
+		}
+		for i, author := range record.Authors {
+			authorKey := author.Key
+			switch v := author.Author.(type) {
+			case string:
+				authorKey = v
+			case map[string]interface{}:
+				if k, ok := v["key"].(string); ok {
+					authorKey = k
+				}
+			}
+			if authorKey == "" {
+				continue
+			}
+			if _, err := tx.Exec("INSERT OR IGNORE INTO work_authors(work_key, author_key, position) VALUES (?, ?, ?)",
+				key, strings.TrimPrefix(authorKey, "/authors/"), i); err != nil {
+				return false, err
+			}
+		}
+		for _, subject := range record.Subjects {
+			if subject = strings.ToLower(strings.TrimSpace(subject)); subject == "" {
+				continue
+			}
+			if _, err := tx.Exec("INSERT OR IGNORE INTO work_subjects(work_key, subject) VALUES (?, ?)", key, subject); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// CountWorks sets each author's work count from the works loaded.
+func CountWorks(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE authors SET work_count = (SELECT COUNT(*) FROM work_authors WHERE author_key = authors.key)`)
+	return err
+}
+
+// load reads a dump's tab-separated records, passing the JSON of each of
+// the given type to insert, a batch of records per transaction. insert
+// reports whether it loaded the record; malformed records are skipped.
+func load(ctx context.Context, db *sql.DB, dump io.Reader, recordType string, insert func(tx *sql.Tx, data []byte) (bool, error)) (int, error) {
+	scanner := bufio.NewScanner(dump)
+	scanner.Buffer(make([]byte, 64<<10), maxRecordBytes)
+
+	var (
+		tx                       *sql.Tx
+		loaded, skipped, inBatch int
+		latest                   string // The newest record's last modified time, which sorts as text
+		err                      error
+	)
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		err := tx.Commit()
+		tx, inBatch = nil, 0
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for scanner.Scan() {
+		// Each line is: type, key, revision, last modified, JSON record
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(fields) != 5 || fields[0] != recordType {
+			continue
+		}
+		if tx == nil {
+			if err := ctx.Err(); err != nil {
+				return loaded, err
+			}
+			if tx, err = db.Begin(); err != nil {
+				return loaded, err
+			}
+		}
+		ok, err := insert(tx, []byte(fields[4]))
+		if err != nil {
+			return loaded, fmt.Errorf("error loading %s: %v", fields[1], err)
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		loaded++
+		if fields[3] > latest {
+			latest = fields[3]
+		}
+		if inBatch++; inBatch == batchSize {
+			if err := commit(); err != nil {
+				return loaded, err
+			}
+			if loaded%(batchSize*10) == 0 {
+				log.Printf("Loaded %d %s records", loaded, recordType)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return loaded, fmt.Errorf("error reading dump: %v", err)
+	}
+	if err := commit(); err != nil {
+		return loaded, err
+	}
+	if err := recordDumpDate(db, latest); err != nil {
+		return loaded, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d malformed %s records", skipped, recordType)
+	}
+	return loaded, nil
+}
+
+// recordDumpDate notes modified as the dump date, if it is a valid time
+// newer than the one recorded.
+func recordDumpDate(db *sql.DB, modified string) error {
+	if _, err := time.Parse(dumpDateLayout, modified); err != nil {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT INTO meta(key, value) VALUES ('dump_date', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value WHERE excluded.value > meta.value
+	`, modified)
+	return err
+}
+
+// workDescription returns a work's description or, lacking one, its first
+// excerpt or first sentence, as the live provider does.
+func workDescription(record workRecord) *models.Description {
+	if text := textValue(record.Description); text != "" {
+		return &models.Description{Text: text, Source: models.DescriptionSourceDescription}
+	}
+	for _, excerpt := range record.Excerpts {
+		if text := textValue(excerpt.Excerpt); text != "" {
+			return &models.Description{Text: text, Source: models.DescriptionSourceExcerpt}
+		}
+	}
+	if text := textValue(record.FirstSentence); text != "" {
+		return &models.Description{Text: text, Source: models.DescriptionSourceFirstSentence}
+	}
+	return nil
+}
+
+// textValue extracts the text of a field Open Library records either as a
+// plain string or as a typed text object, or "" if it has none.
+func textValue(field interface{}) string {
+	switch v := field.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if val, ok := v["value"].(string); ok {
+			return val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package olindex
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"be-takehome-2024/internal/models"
+)
+
+// createIndex returns an index created in a temporary directory, and its path.
+func createIndex(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openlibrary.db")
+	db, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+// loadFixture loads a dump in testdata with load, returning how many records
+// were loaded.
+func loadFixture(t *testing.T, db *sql.DB, name string, load func(context.Context, *sql.DB, io.Reader) (int, error)) int {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n, err := load(context.Background(), db, f)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return n
+}
+
+func TestLoad(t *testing.T) {
+	db, _ := createIndex(t)
+	if n := loadFixture(t, db, "authors.txt", LoadAuthors); n != 3 {
+		t.Errorf("loaded %d authors, want 3", n)
+	}
+	if n := loadFixture(t, db, "works.txt", LoadWorks); n != 4 {
+		t.Errorf("loaded %d works, want 4", n)
+	}
+	if err := CountWorks(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// The malformed records' later dates are left out
+	dumpDate, err := DumpDate(db)
+	if want := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC); err != nil || !dumpDate.Equal(want) {
+		t.Errorf("DumpDate = %v, %v, want %v", dumpDate, err, want)
+	}
+
+	workCounts := map[string]int{}
+	rows, err := db.Query("SELECT key, work_count FROM authors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			t.Fatal(err)
+		}
+		workCounts[key] = count
+	}
+	if want := map[string]int{"OL1A": 2, "OL2A": 1, "OL3A": 1}; !reflect.DeepEqual(workCounts, want) {
+		t.Errorf("work counts = %v, want %v", workCounts, want)
+	}
+
+	var title string
+	var year int
+	if err := db.QueryRow("SELECT title, first_publish_year FROM works WHERE key = 'OL2W'").Scan(&title, &year); err != nil {
+		t.Fatal(err)
+	}
+	if title != "The Left Hand of Darkness" || year != 1969 {
+		t.Errorf("OL2W = %q, %d, want The Left Hand of Darkness, 1969", title, year)
+	}
+	if got := workSubjects(t, db, "OL1W"); !reflect.DeepEqual(got, []string{"fantasy", "wizards"}) {
+		t.Errorf("OL1W subjects = %q, want them lowercased, once each", got)
+	}
+	var authors int
+	if err := db.QueryRow("SELECT COUNT(*) FROM work_authors WHERE work_key = 'OL3W'").Scan(&authors); err != nil || authors != 2 {
+		t.Errorf("OL3W has %d authors, %v, want 2", authors, err)
+	}
+}
+
+func TestLoadReplacesWorks(t *testing.T) {
+	db, _ := createIndex(t)
+	loadFixture(t, db, "works.txt", LoadWorks)
+
+	update := "/type/work\t/works/OL1W\t6\t2022-01-01T00:00:00\t" +
+		`{"key": "/works/OL1W", "title": "A Wizard of Earthsea", "subjects": ["Magic"], "first_publish_date": "1968"}` + "\n"
+	if _, err := LoadWorks(context.Background(), db, strings.NewReader(update)); err != nil {
+		t.Fatal(err)
+	}
+	if got := workSubjects(t, db, "OL1W"); !reflect.DeepEqual(got, []string{"magic"}) {
+		t.Errorf("OL1W subjects = %q, want only the reloaded one", got)
+	}
+	var description sql.NullString
+	if err := db.QueryRow("SELECT description FROM works WHERE key = 'OL1W'").Scan(&description); err != nil || description.Valid {
+		t.Errorf("OL1W description = %v, %v, want none", description, err)
+	}
+	// An older dump doesn't move the dump date back
+	dumpDate, err := DumpDate(db)
+	if want := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC); err != nil || !dumpDate.Equal(want) {
+		t.Errorf("DumpDate = %v, %v, want %v", dumpDate, err, want)
+	}
+}
+
+func TestLoadStopsWhenCancelled(t *testing.T) {
+	db, _ := createIndex(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f, err := os.Open(filepath.Join("testdata", "works.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := LoadWorks(ctx, db, f); err != context.Canceled || n != 0 {
+		t.Errorf("LoadWorks = %d, %v, want 0, context.Canceled", n, err)
+	}
+}
+
+func TestDumpDateOfEmptyIndex(t *testing.T) {
+	db, path := createIndex(t)
+	dumpDate, err := DumpDate(db)
+	if err != nil || !dumpDate.IsZero() {
+		t.Errorf("DumpDate = %v, %v, want the zero time", dumpDate, err)
+	}
+	// Open succeeds on an empty index, and fails on a missing one
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("Open of a missing index succeeded")
+	}
+}
+
+func TestWorkDescription(t *testing.T) {
+	tests := []struct {
+		name   string
+		record workRecord
+		want   *models.Description
+	}{
+		{"none", workRecord{}, nil},
+		{"plain description", workRecord{Description: "Plain."}, &models.Description{Text: "Plain.", Source: models.DescriptionSourceDescription}},
+		{"typed description", workRecord{Description: map[string]interface{}{"type": "/type/text", "value": "Typed."}},
+			&models.Description{Text: "Typed.", Source: models.DescriptionSourceDescription}},
+		{"first sentence", workRecord{Description: "", FirstSentence: "It begins."},
+			&models.Description{Text: "It begins.", Source: models.DescriptionSourceFirstSentence}},
+	}
+	for _, tt := range tests {
+		if got := workDescription(tt.record); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: workDescription = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// workSubjects returns a work's subjects in the index, sorted.
+func workSubjects(t *testing.T, db *sql.DB, key string) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT subject FROM work_subjects WHERE work_key = ? ORDER BY subject", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var subjects []string
+	for rows.Next() {
+		var subject string
+		if err := rows.Scan(&subject); err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects
+}
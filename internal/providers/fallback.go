@@ -0,0 +1,202 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+)
+
+const (
+	// primaryFailureThreshold is the number of consecutive primary failures
+	// after which the primary is considered down.
+	primaryFailureThreshold = 5
+	// primaryCooldown is how long requests skip a down primary before trying it again.
+	primaryCooldown = 30 * time.Second
+)
+
+// FallbackProvider serves requests from a primary provider and falls back to a
+// secondary one when the primary errors or returns no data. After repeated
+// primary failures it skips the primary for a cooldown period.
+type FallbackProvider struct {
+	primary   BookProvider
+	secondary BookProvider
+
+	mu         sync.Mutex
+	failures   int
+	downUntil  time.Time
+	downReason string
+}
+
+// Health is a fallback provider's view of its primary, for operational status.
+type Health struct {
+	Primary   string `json:"primary"`
+	Secondary string `json:"secondary"`
+	// State is "closed" while the primary is tried, "open" while it is skipped.
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	// DownUntil and DownReason, "rate_limited" or "failures", tell how long
+	// and why an open primary is skipped.
+	DownUntil  *time.Time `json:"down_until,omitempty"`
+	DownReason string     `json:"down_reason,omitempty"`
+}
+
+// NewFallbackProvider returns a provider that prefers primary over secondary.
+func NewFallbackProvider(primary, secondary BookProvider) *FallbackProvider {
+	return &FallbackProvider{primary: primary, secondary: secondary}
+}
+
+func (p *FallbackProvider) Name() string {
+	return p.primary.Name() + "+" + p.secondary.Name()
+}
+
+func (p *FallbackProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	if p.primaryAvailable() {
+		authors, err := p.primary.SearchAuthors(ctx, name)
+		p.record(ctx, err)
+		if err == nil && len(authors) > 0 {
+			return authors, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // The caller gave up; don't try the secondary
+		}
+		p.logFallback("author search", redact.Name(name), err)
+	}
+	return p.secondary.SearchAuthors(ctx, name)
+}
+
+func (p *FallbackProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	if IsGoogleKey(author.Key) {
+		// Found by the secondary, so only it knows the author
+		return p.secondary.AuthorWorks(ctx, author, limit, sampling)
+	}
+	if p.primaryAvailable() {
+		works, err := p.primary.AuthorWorks(ctx, author, limit, sampling)
+		p.record(ctx, err)
+		if err == nil || errors.Is(err, httpclient.ErrNotFound) {
+			// The author is looked up by the primary's own key, so its not found is final
+			return works, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		p.logFallback("author works", redact.Name(author.Name), err)
+	}
+	return p.secondary.AuthorWorks(ctx, author, limit, sampling)
+}
+
+func (p *FallbackProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	return p.subjectWorks(ctx, subject, func(provider BookProvider) ([]models.SubjectWork, error) {
+		return provider.SubjectWorks(ctx, subject, limit)
+	})
+}
+
+func (p *FallbackProvider) SubjectWorksSince(ctx context.Context, subject string, year, limit int) ([]models.SubjectWork, error) {
+	return p.subjectWorks(ctx, subject, func(provider BookProvider) ([]models.SubjectWork, error) {
+		return SubjectWorksSince(ctx, provider, subject, year, limit)
+	})
+}
+
+// subjectWorks fetches a subject's works from the primary, or the secondary
+// when the primary fails or has none.
+func (p *FallbackProvider) subjectWorks(ctx context.Context, subject string, fetch func(BookProvider) ([]models.SubjectWork, error)) ([]models.SubjectWork, error) {
+	if p.primaryAvailable() {
+		works, err := fetch(p.primary)
+		p.record(ctx, err)
+		if err == nil && len(works) > 0 {
+			return works, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		p.logFallback("subject works", subject, err)
+	}
+	return fetch(p.secondary)
+}
+
+func (p *FallbackProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	if IsGoogleKey(workKey) {
+		return p.secondary.WorkDescription(ctx, workKey)
+	}
+	if p.primaryAvailable() {
+		description, err := p.primary.WorkDescription(ctx, workKey)
+		p.record(ctx, err)
+		if err == nil || errors.Is(err, httpclient.ErrNotFound) {
+			// The work is looked up by the primary's own key, so its not found is final
+			return description, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		p.logFallback("work description", workKey, err)
+	}
+	return p.secondary.WorkDescription(ctx, workKey)
+}
+
+// primaryAvailable reports whether the primary should be tried.
+func (p *FallbackProvider) primaryAvailable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return clock.Now().After(p.downUntil)
+}
+
+// Health reports whether the primary is being skipped, and why.
+func (p *FallbackProvider) Health() Health {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health := Health{Primary: p.primary.Name(), Secondary: p.secondary.Name(), State: "closed", ConsecutiveFailures: p.failures}
+	if clock.Now().Before(p.downUntil) {
+		downUntil := p.downUntil.UTC()
+		health.State, health.DownUntil, health.DownReason = "open", &downUntil, p.downReason
+	}
+	return health
+}
+
+// record tracks consecutive primary failures and marks the primary down once
+// the threshold is reached.
+func (p *FallbackProvider) record(ctx context.Context, err error) {
+	if b := budget.FromContext(ctx); ctx.Err() != nil || b.Exceeded() || b.CacheOnly() || errors.Is(err, budget.ErrDeadline) {
+		// The caller gave up, ran out of budget or time, or made no calls;
+		// that says nothing about the primary's health.
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err == nil, errors.Is(err, httpclient.ErrNotFound):
+		// A missing record is an answer, not a sign of trouble
+		p.failures = 0
+		return
+	case errors.Is(err, httpclient.ErrRateLimited):
+		// Stop sending the primary requests it will refuse, for as long as it asked
+		cooldown := httpclient.RetryAfter(err)
+		if cooldown <= 0 {
+			cooldown = primaryCooldown
+		}
+		log.Printf("Provider %s marked down for %v after being rate limited", p.primary.Name(), cooldown)
+		p.downUntil, p.downReason = clock.Now().Add(cooldown), "rate_limited"
+		p.failures = 0
+		return
+	}
+	p.failures++
+	if p.failures >= primaryFailureThreshold {
+		log.Printf("Provider %s marked down for %v after %d failures", p.primary.Name(), primaryCooldown, p.failures)
+		p.downUntil, p.downReason = clock.Now().Add(primaryCooldown), "failures"
+		p.failures = 0
+	}
+}
+
+func (p *FallbackProvider) logFallback(operation, target string, err error) {
+	if err != nil {
+		log.Printf("Falling back to %s for %s '%s': %v", p.secondary.Name(), operation, target, err)
+	} else {
+		log.Printf("Falling back to %s for %s '%s': no data", p.secondary.Name(), operation, target)
+	}
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/models"
+)
+
+// countingProvider fails every call, counting them and cancelling the
+// context's caller on the first if cancel is set.
+type countingProvider struct {
+	calls  int
+	cancel context.CancelFunc
+}
+
+func (p *countingProvider) fail(ctx context.Context) error {
+	p.calls++
+	if p.cancel != nil {
+		p.cancel()
+		return ctx.Err()
+	}
+	return errors.New("unavailable")
+}
+
+func (p *countingProvider) Name() string { return "counting" }
+
+func (p *countingProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	return nil, p.fail(ctx)
+}
+
+func (p *countingProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	return nil, p.fail(ctx)
+}
+
+func (p *countingProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	return nil, p.fail(ctx)
+}
+
+func (p *countingProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	return nil, p.fail(ctx)
+}
+
+func TestFallbackProviderSkipsSecondaryWhenCancelled(t *testing.T) {
+	calls := map[string]func(p BookProvider, ctx context.Context) error{
+		"SearchAuthors": func(p BookProvider, ctx context.Context) error {
+			_, err := p.SearchAuthors(ctx, "Ursula K. Le Guin")
+			return err
+		},
+		"AuthorWorks": func(p BookProvider, ctx context.Context) error {
+			_, err := p.AuthorWorks(ctx, models.Author{Key: "OL26320A"}, 10, SampleDefault)
+			return err
+		},
+		"SubjectWorks": func(p BookProvider, ctx context.Context) error {
+			_, err := p.SubjectWorks(ctx, "fantasy", 10)
+			return err
+		},
+		"WorkDescription": func(p BookProvider, ctx context.Context) error {
+			_, err := p.WorkDescription(ctx, "OL27448W")
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			primary, secondary := &countingProvider{cancel: cancel}, &countingProvider{}
+			err := call(NewFallbackProvider(primary, secondary), ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("error = %v, want context.Canceled", err)
+			}
+			if secondary.calls != 0 {
+				t.Errorf("secondary called %d times after cancellation, want 0", secondary.calls)
+			}
+		})
+	}
+}
+
+func TestFallbackProviderFallsBackOnFailure(t *testing.T) {
+	primary, secondary := &countingProvider{}, &countingProvider{}
+	NewFallbackProvider(primary, secondary).SubjectWorks(context.Background(), "fantasy", 10)
+	if primary.calls != 1 || secondary.calls != 1 {
+		t.Errorf("primary called %d times and secondary %d, want once each", primary.calls, secondary.calls)
+	}
+}
+
+func TestFallbackProviderRoutesGoogleKeysToSecondary(t *testing.T) {
+	primary, secondary := &countingProvider{}, &countingProvider{}
+	p := NewFallbackProvider(primary, secondary)
+	p.AuthorWorks(context.Background(), models.Author{Key: googleKeyPrefix + "Ursula K. Le Guin"}, 10, SampleDefault)
+	p.WorkDescription(context.Background(), googleKeyPrefix+"earthsea")
+	if primary.calls != 0 || secondary.calls != 2 {
+		t.Errorf("primary called %d times and secondary %d, want only the secondary, twice", primary.calls, secondary.calls)
+	}
+}
+
+func TestFallbackProviderRetriesPrimaryAfterCooldown(t *testing.T) {
+	now := clock.NewFrozen(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	clock.Use(now)
+	defer clock.Use(clock.Real)
+
+	primary, secondary := &countingProvider{}, &countingProvider{}
+	p := NewFallbackProvider(primary, secondary)
+	for i := 0; i < primaryFailureThreshold+1; i++ {
+		p.SubjectWorks(context.Background(), "fantasy", 10)
+	}
+	if primary.calls != primaryFailureThreshold || p.Health().State != "open" {
+		t.Fatalf("primary called %d times, state %s, want %d calls and open", primary.calls, p.Health().State, primaryFailureThreshold)
+	}
+
+	now.Advance(primaryCooldown + time.Second)
+	if state := p.Health().State; state != "closed" {
+		t.Errorf("state after the cooldown = %s, want closed", state)
+	}
+	p.SubjectWorks(context.Background(), "fantasy", 10)
+	if primary.calls != primaryFailureThreshold+1 {
+		t.Errorf("primary called %d times after the cooldown, want it tried again", primary.calls-primaryFailureThreshold)
+	}
+}
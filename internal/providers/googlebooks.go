@@ -0,0 +1,184 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"be-takehome-2024/internal/dates"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+)
+
+// googleKeyPrefix marks author and work keys that belong to Google Books, so
+// they are never confused with Open Library keys.
+const googleKeyPrefix = "gb:"
+
+// IsGoogleKey reports whether an author or work key belongs to Google Books,
+// which Open Library knows nothing about.
+func IsGoogleKey(key string) bool {
+	return strings.HasPrefix(key, googleKeyPrefix)
+}
+
+// googleMaxResults is the largest page size the volumes API accepts.
+const googleMaxResults = 40
+
+// GoogleBooksProvider fetches data from the Google Books volumes API. Google
+// Books has no author entity, so authors are identified by name.
+type GoogleBooksProvider struct {
+	client *http.Client
+	apiKey string
+}
+
+// NewGoogleBooksProvider returns a Google Books provider using the given HTTP
+// client. The API key is optional; without one requests are subject to the
+// anonymous quota.
+func NewGoogleBooksProvider(client *http.Client, apiKey string) *GoogleBooksProvider {
+	return &GoogleBooksProvider{client: client, apiKey: apiKey}
+}
+
+func (p *GoogleBooksProvider) Name() string { return "googlebooks" }
+
+type googleVolume struct {
+	ID         string `json:"id"`
+	VolumeInfo struct {
+		Title         string   `json:"title"`
+		Authors       []string `json:"authors"`
+		PublishedDate string   `json:"publishedDate"`
+		Description   string   `json:"description"`
+		Categories    []string `json:"categories"`
+	} `json:"volumeInfo"`
+	SaleInfo struct {
+		IsEbook bool `json:"isEbook"`
+	} `json:"saleInfo"`
+}
+
+type googleVolumes struct {
+	TotalItems int            `json:"totalItems"`
+	Items      []googleVolume `json:"items"`
+}
+
+// SearchAuthors looks up volumes by author and reports a single author entry
+// whose work count is the number of matching volumes.
+func (p *GoogleBooksProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	var result googleVolumes
+	if err := p.volumes(ctx, fmt.Sprintf("inauthor:%q", name), 1, &result); err != nil {
+		return nil, err
+	}
+	if result.TotalItems == 0 {
+		return nil, nil
+	}
+	return []models.Author{{
+		Name:      name,
+		Key:       googleKeyPrefix + name,
+		WorkCount: result.TotalItems,
+	}}, nil
+}
+
+// AuthorWorks returns the author's volumes, using their categories as subjects.
+// AuthorWorks returns the author's newest volumes, whatever the sampling, as
+// Google Books has no edition counts to sample by.
+func (p *GoogleBooksProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	var result googleVolumes
+	if err := p.volumes(ctx, fmt.Sprintf("inauthor:%q", author.Name), limit, &result); err != nil {
+		return nil, err
+	}
+
+	works := make([]models.AuthorWork, 0, len(result.Items))
+	for _, item := range result.Items {
+		works = append(works, models.AuthorWork{
+			Title:    item.VolumeInfo.Title,
+			Key:      googleKeyPrefix + item.ID,
+			Subjects: item.VolumeInfo.Categories,
+		})
+	}
+	return works, nil
+}
+
+// SubjectWorks returns the newest volumes in a subject with their descriptions inline.
+func (p *GoogleBooksProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	var result googleVolumes
+	if err := p.volumes(ctx, fmt.Sprintf("subject:%q", subject), limit, &result); err != nil {
+		return nil, err
+	}
+
+	works := make([]models.SubjectWork, 0, len(result.Items))
+	for _, item := range result.Items {
+		works = append(works, models.SubjectWork{
+			Title:            item.VolumeInfo.Title,
+			Key:              googleKeyPrefix + item.ID,
+			Authors:          item.VolumeInfo.Authors,
+			FirstPublishYear: dates.Year(item.VolumeInfo.PublishedDate),
+			Description:      googleDescription(item.VolumeInfo.Description),
+			Ebook:            item.SaleInfo.IsEbook,
+			Subjects:         item.VolumeInfo.Categories,
+		})
+	}
+	return works, nil
+}
+
+// WorkDescription fetches a single volume's description.
+func (p *GoogleBooksProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	if !IsGoogleKey(workKey) {
+		return nil, fmt.Errorf("work key '%s' is not a Google Books key", workKey)
+	}
+	volumeURL := "https://www.googleapis.com/books/v1/volumes/" + url.PathEscape(strings.TrimPrefix(workKey, googleKeyPrefix))
+	if p.apiKey != "" {
+		volumeURL += "?key=" + url.QueryEscape(p.apiKey)
+	}
+
+	var volume googleVolume
+	if err := p.getJSON(ctx, volumeURL, &volume); err != nil {
+		return nil, err
+	}
+	if volume.VolumeInfo.Description == "" {
+		return nil, nil
+	}
+	return &models.Description{Text: volume.VolumeInfo.Description, Source: models.DescriptionSourceDescription}, nil
+}
+
+// volumes runs a volumes search ordered by newest first.
+func (p *GoogleBooksProvider) volumes(ctx context.Context, query string, limit int, v interface{}) error {
+	if limit > googleMaxResults {
+		limit = googleMaxResults
+	}
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("maxResults", strconv.Itoa(limit))
+	params.Set("orderBy", "newest")
+	params.Set("printType", "books")
+	if p.apiKey != "" {
+		params.Set("key", p.apiKey)
+	}
+	return p.getJSON(ctx, "https://www.googleapis.com/books/v1/volumes?"+params.Encode(), v)
+}
+
+// getJSON performs a GET request and decodes a successful JSON response into v.
+func (p *GoogleBooksProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching Google Books: %w", redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if err := httpclient.CheckStatus(resp, "Google Books"); err != nil {
+		return err
+	}
+
+	return httpclient.DecodeJSON(resp.Body, v)
+}
+
+func googleDescription(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
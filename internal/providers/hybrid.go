@@ -0,0 +1,119 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+)
+
+// HybridProvider serves queries from a local index of Open Library's data
+// dumps, going to a live provider only for data newer than the dump: authors
+// and works added since it, and works first published in or after its year.
+type HybridProvider struct {
+	index *LocalIndexProvider
+	live  BookProvider
+}
+
+// NewHybridProvider returns a provider that prefers index over live.
+func NewHybridProvider(index *LocalIndexProvider, live BookProvider) *HybridProvider {
+	return &HybridProvider{index: index, live: live}
+}
+
+func (p *HybridProvider) Name() string {
+	return p.index.Name() + "+" + p.live.Name()
+}
+
+// SearchAuthors searches the index, adding the authors the live provider
+// finds that the dump doesn't have, such as those added since it. The
+// index's alone are served when the live provider fails.
+func (p *HybridProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	authors, err := p.index.SearchAuthors(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	live, err := p.live.SearchAuthors(ctx, name)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if len(authors) == 0 {
+			return nil, err
+		}
+		log.Printf("Serving author search from %s alone: %v", p.index.Name(), err)
+		return authors, nil
+	}
+	seen := make(map[string]bool, len(authors))
+	for _, author := range authors {
+		seen[author.Key] = true
+	}
+	for _, author := range live {
+		if !seen[author.Key] {
+			seen[author.Key] = true
+			authors = append(authors, author)
+		}
+	}
+	return authors, nil
+}
+
+// AuthorWorks returns the author's works from the index, or from the live
+// provider for authors whose works the dump doesn't have.
+func (p *HybridProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	works, err := p.index.AuthorWorks(ctx, author, limit, sampling)
+	if err != nil || len(works) > 0 {
+		return works, err
+	}
+	return p.live.AuthorWorks(ctx, author, limit, sampling)
+}
+
+// SubjectWorks returns the newest works filed under a subject, adding those
+// the live provider has first published since the dump's year to the
+// index's. Only those are asked of the live provider. The index's alone are
+// served when the live provider fails.
+func (p *HybridProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	works, err := p.index.SubjectWorks(ctx, subject, limit)
+	if err != nil {
+		return nil, err
+	}
+	since := p.index.DumpDate().Year()
+	live, err := SubjectWorksSince(ctx, p.live, subject, since, limit)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Serving subject works '%s' from %s alone: %v", subject, p.index.Name(), err)
+		return works, nil
+	}
+
+	seen := make(map[string]bool, len(works))
+	for _, work := range works {
+		seen[work.Key] = true
+	}
+	merged := works
+	for _, work := range live {
+		if work.FirstPublishYear >= since && !seen[work.Key] {
+			seen[work.Key] = true
+			merged = append(merged, work)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].FirstPublishYear > merged[j].FirstPublishYear
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged, nil
+}
+
+// WorkDescription returns the work's description from the index, or from
+// the live provider for works added since the dump.
+func (p *HybridProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	description, err := p.index.WorkDescription(ctx, workKey)
+	if errors.Is(err, httpclient.ErrNotFound) {
+		return p.live.WorkDescription(ctx, workKey)
+	}
+	return description, err
+}
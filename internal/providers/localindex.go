@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/olindex"
+)
+
+// localIndexSearchLimit caps the authors an author search returns.
+const localIndexSearchLimit = 20
+
+// listSeparator joins a work's subjects, or authors, in a single column; it
+// cannot appear in either.
+const listSeparator = "\x1f"
+
+// LocalIndexProvider serves author and subject queries from a local index of
+// Open Library's data dumps, loaded by cmd/ingest, rather than the live API.
+type LocalIndexProvider struct {
+	db *sql.DB
+	// dumpDate is when the newest record in the index was last modified
+	dumpDate time.Time
+}
+
+// NewLocalIndexProvider returns a provider reading the index at path.
+func NewLocalIndexProvider(path string) (*LocalIndexProvider, error) {
+	db, err := olindex.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dumpDate, err := olindex.DumpDate(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error reading dump date of Open Library index %s: %v", path, err)
+	}
+	return &LocalIndexProvider{db: db, dumpDate: dumpDate}, nil
+}
+
+// DumpDate returns when the newest record in the index was last modified, or
+// the zero time if the index is empty.
+func (p *LocalIndexProvider) DumpDate() time.Time { return p.dumpDate }
+
+func (p *LocalIndexProvider) Name() string { return "local_index" }
+
+// SearchAuthors returns the authors whose name is, or starts with, name,
+// ignoring case.
+func (p *LocalIndexProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT key, name, work_count FROM authors
+		WHERE name LIKE ? ESCAPE '\'
+		ORDER BY work_count DESC LIMIT ?
+	`, likeEscaper.Replace(strings.TrimSpace(name))+"%", localIndexSearchLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []models.Author{}
+	for rows.Next() {
+		var author models.Author
+		if err := rows.Scan(&author.Key, &author.Name, &author.WorkCount); err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	return authors, rows.Err()
+}
+
+// AuthorWorks returns the author's works, newest first when sampling recent
+// works. The dumps have no edition counts, so sampling by editions takes
+// works in index order.
+func (p *LocalIndexProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	order := "w.rowid"
+	if sampling == SampleRecent {
+		order = "w.first_publish_year DESC, w.rowid"
+	}
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT w.key, w.title, COALESCE((SELECT GROUP_CONCAT(s.subject, ?) FROM work_subjects s WHERE s.work_key = w.key), '')
+		FROM work_authors wa JOIN works w ON w.key = wa.work_key
+		WHERE wa.author_key = ?
+		ORDER BY `+order+` LIMIT ?
+	`, listSeparator, author.Key, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	works := []models.AuthorWork{}
+	for rows.Next() {
+		var work models.AuthorWork
+		var subjects string
+		if err := rows.Scan(&work.Key, &work.Title, &subjects); err != nil {
+			return nil, err
+		}
+		if subjects != "" {
+			work.Subjects = strings.Split(subjects, listSeparator)
+		}
+		works = append(works, work)
+	}
+	return works, rows.Err()
+}
+
+// SubjectWorks returns the newest works filed under a subject, with their
+// own descriptions inline.
+func (p *LocalIndexProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT w.key, w.title, w.first_publish_year,
+			CASE w.description_source WHEN 'description' THEN w.description END,
+			COALESCE((SELECT GROUP_CONCAT(name, ?) FROM (
+				SELECT a.name FROM work_authors wa JOIN authors a ON a.key = wa.author_key
+				WHERE wa.work_key = w.key ORDER BY wa.position
+			)), '')
+		FROM work_subjects s JOIN works w ON w.key = s.work_key
+		WHERE s.subject = ?
+		ORDER BY w.first_publish_year DESC, w.rowid LIMIT ?
+	`, listSeparator, strings.ToLower(strings.TrimSpace(subject)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	works := []models.SubjectWork{}
+	for rows.Next() {
+		var work models.SubjectWork
+		var description sql.NullString
+		var authors string
+		if err := rows.Scan(&work.Key, &work.Title, &work.FirstPublishYear, &description, &authors); err != nil {
+			return nil, err
+		}
+		if description.Valid {
+			work.Description = &description.String
+		}
+		if authors != "" {
+			work.Authors = strings.Split(authors, listSeparator)
+		}
+		works = append(works, work)
+	}
+	return works, rows.Err()
+}
+
+// WorkDescription returns the work's description, or the excerpt or first
+// sentence standing in for it, as loaded from the dump.
+func (p *LocalIndexProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	var text, source sql.NullString
+	err := p.db.QueryRowContext(ctx, "SELECT description, description_source FROM works WHERE key = ?", workKey).Scan(&text, &source)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("work %s is not in the local index: %w", workKey, httpclient.ErrNotFound)
+	}
+	if err != nil || !text.Valid {
+		return nil, err
+	}
+	return &models.Description{Text: text.String, Source: source.String}, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
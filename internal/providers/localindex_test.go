@@ -0,0 +1,185 @@
+package providers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/olindex"
+)
+
+// newTestIndex ingests the small dumps in olindex's testdata into a new
+// index, as cmd/ingest does, and returns a provider reading it.
+func newTestIndex(t *testing.T) *LocalIndexProvider {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openlibrary.db")
+	db, err := olindex.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, load := range map[string]func(context.Context, *sql.DB, io.Reader) (int, error){
+		"authors.txt": olindex.LoadAuthors,
+		"works.txt":   olindex.LoadWorks,
+	} {
+		f, err := os.Open(filepath.Join("..", "olindex", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = load(context.Background(), db, f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("loading %s: %v", name, err)
+		}
+	}
+	if err := olindex.CountWorks(db); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	p, err := NewLocalIndexProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.db.Close() })
+	return p
+}
+
+func TestLocalIndexDumpDate(t *testing.T) {
+	p := newTestIndex(t)
+	if want := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC); !p.DumpDate().Equal(want) {
+		t.Errorf("DumpDate = %v, want %v", p.DumpDate(), want)
+	}
+}
+
+func TestLocalIndexSearchAuthors(t *testing.T) {
+	p := newTestIndex(t)
+	tests := []struct {
+		name string
+		want []models.Author
+	}{
+		{"Terry Pratchett", []models.Author{{Key: "OL2A", Name: "Terry Pratchett", WorkCount: 1}}},
+		// Prefixes match, ignoring case, the authors with more works first
+		{" ursula ", []models.Author{
+			{Key: "OL1A", Name: "Ursula K. Le Guin", WorkCount: 2},
+			{Key: "OL3A", Name: "Ursula Vernon", WorkCount: 1},
+		}},
+		// Wildcards are matched literally
+		{"Ursula_", []models.Author{}},
+		{"%", []models.Author{}},
+		{"Neil Gaiman", []models.Author{}},
+	}
+	for _, tt := range tests {
+		got, err := p.SearchAuthors(context.Background(), tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchAuthors(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocalIndexAuthorWorks(t *testing.T) {
+	p := newTestIndex(t)
+	leGuin := models.Author{Key: "OL1A", Name: "Ursula K. Le Guin"}
+	earthsea := models.AuthorWork{Key: "OL1W", Title: "A Wizard of Earthsea", Subjects: []string{"fantasy", "wizards"}}
+	darkness := models.AuthorWork{Key: "OL2W", Title: "The Left Hand of Darkness", Subjects: []string{"science fiction"}}
+
+	tests := []struct {
+		sampling WorkSampling
+		limit    int
+		want     []models.AuthorWork
+	}{
+		{SampleDefault, 10, []models.AuthorWork{earthsea, darkness}},
+		{SampleRecent, 10, []models.AuthorWork{darkness, earthsea}},
+		{SampleRecent, 1, []models.AuthorWork{darkness}},
+	}
+	for _, tt := range tests {
+		got, err := p.AuthorWorks(context.Background(), leGuin, tt.limit, tt.sampling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			// Subjects come in no particular order
+			sort.Strings(got[i].Subjects)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AuthorWorks(%q, %d) = %+v, want %+v", tt.sampling, tt.limit, got, tt.want)
+		}
+	}
+
+	got, err := p.AuthorWorks(context.Background(), models.Author{Key: "OL404A"}, 10, SampleDefault)
+	if err != nil || len(got) != 0 {
+		t.Errorf("AuthorWorks of an unknown author = %+v, %v, want none", got, err)
+	}
+}
+
+func TestLocalIndexSubjectWorks(t *testing.T) {
+	p := newTestIndex(t)
+	got, err := p.SubjectWorks(context.Background(), " Fantasy ", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, work := range got {
+		keys = append(keys, work.Key)
+	}
+	// Newest first
+	if want := []string{"OL4W", "OL3W", "OL1W"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("SubjectWorks keys = %q, want %q", keys, want)
+	}
+
+	digger, omens, earthsea := got[0], got[1], got[2]
+	if digger.Description == nil || *digger.Description != "A wombat digs." || digger.FirstPublishYear != 2011 {
+		t.Errorf("Digger = %+v, want its description and year", digger)
+	}
+	// Only a work's own description is inline, not its first sentence; an
+	// author missing from the index is left out
+	if omens.Description != nil || !reflect.DeepEqual(omens.Authors, []string{"Terry Pratchett"}) {
+		t.Errorf("Good Omens = %+v, want no description and only Terry Pratchett", omens)
+	}
+	if !reflect.DeepEqual(earthsea.Authors, []string{"Ursula K. Le Guin"}) {
+		t.Errorf("A Wizard of Earthsea authors = %q", earthsea.Authors)
+	}
+
+	if got, err := p.SubjectWorks(context.Background(), "fantasy", 1); err != nil || len(got) != 1 || got[0].Key != "OL4W" {
+		t.Errorf("SubjectWorks with limit 1 = %+v, %v, want only OL4W", got, err)
+	}
+	if got, err := p.SubjectWorks(context.Background(), "poetry", 10); err != nil || len(got) != 0 {
+		t.Errorf("SubjectWorks of an unknown subject = %+v, %v, want none", got, err)
+	}
+}
+
+func TestLocalIndexWorkDescription(t *testing.T) {
+	p := newTestIndex(t)
+	tests := []struct {
+		key  string
+		want *models.Description
+	}{
+		{"OL1W", &models.Description{Text: "A boy becomes a wizard.", Source: models.DescriptionSourceDescription}},
+		{"OL2W", &models.Description{Text: "Light is the left hand of darkness.", Source: models.DescriptionSourceExcerpt}},
+		{"OL3W", &models.Description{Text: "In the beginning.", Source: models.DescriptionSourceFirstSentence}},
+	}
+	for _, tt := range tests {
+		got, err := p.WorkDescription(context.Background(), tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WorkDescription(%s) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+
+	if _, err := p.WorkDescription(context.Background(), "OL404W"); !errors.Is(err, httpclient.ErrNotFound) {
+		t.Errorf("WorkDescription of an unknown work: error = %v, want ErrNotFound", err)
+	}
+}
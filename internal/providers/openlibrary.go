@@ -0,0 +1,410 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"be-takehome-2024/internal/dates"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/sanitize"
+)
+
+// OpenLibraryProvider fetches data from the Open Library REST API. Every
+// Open Library URL the service uses is built here from the configured hosts.
+type OpenLibraryProvider struct {
+	client        *http.Client
+	baseURL       string
+	coversBaseURL string
+}
+
+// NewOpenLibraryProvider returns an Open Library provider using the given
+// HTTP client. baseURL serves the JSON API (e.g. "https://openlibrary.org")
+// and coversBaseURL serves cover images (e.g. "https://covers.openlibrary.org").
+func NewOpenLibraryProvider(client *http.Client, baseURL, coversBaseURL string) *OpenLibraryProvider {
+	return &OpenLibraryProvider{
+		client:        client,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		coversBaseURL: strings.TrimRight(coversBaseURL, "/"),
+	}
+}
+
+func (p *OpenLibraryProvider) Name() string { return "openlibrary" }
+
+// SearchAuthors queries the author search API.
+func (p *OpenLibraryProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	searchURL := p.baseURL + "/search/authors.json?q=" + url.QueryEscape(name)
+
+	var result struct {
+		Docs []struct {
+			Name      string `json:"name"`
+			Key       string `json:"key"`
+			WorkCount int    `json:"work_count"`
+		} `json:"docs"`
+	}
+	check := newSchemaCheck(p.Name(), "search_authors")
+	if err := p.getJSON(ctx, check, searchURL, &result); err != nil {
+		return nil, err
+	}
+	if result.Docs == nil {
+		return nil, check.missingField("docs")
+	}
+
+	authors := make([]models.Author, 0, len(result.Docs))
+	for _, doc := range result.Docs {
+		if !check.require("key", doc.Key != "") || !check.require("name", doc.Name != "") {
+			continue
+		}
+		authors = append(authors, models.Author{
+			Name: doc.Name,
+			// Ensure the key does not include leading slashes
+			Key:       strings.TrimPrefix(doc.Key, "/authors/"),
+			WorkCount: doc.WorkCount,
+		})
+	}
+	check.report(len(result.Docs))
+	return authors, nil
+}
+
+// AuthorWorks fetches the works listing for an author.
+func (p *OpenLibraryProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	if sampling != SampleDefault {
+		return p.sampleAuthorWorks(ctx, author, limit, sampling)
+	}
+	worksURL := fmt.Sprintf("%s/authors/%s/works.json?limit=%d", p.baseURL, url.PathEscape(author.Key), limit)
+
+	var result struct {
+		Entries []struct {
+			Title    string   `json:"title"`
+			Subjects []string `json:"subjects"`
+			Key      string   `json:"key"` // Work ID
+		} `json:"entries"`
+	}
+	check := newSchemaCheck(p.Name(), "author_works")
+	if err := p.getJSON(ctx, check, worksURL, &result); err != nil {
+		return nil, err
+	}
+	if result.Entries == nil {
+		return nil, check.missingField("entries")
+	}
+
+	works := make([]models.AuthorWork, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if !check.require("key", entry.Key != "") {
+			continue
+		}
+		works = append(works, models.AuthorWork{
+			Title:    entry.Title,
+			Key:      strings.TrimPrefix(entry.Key, "/works/"),
+			Subjects: entry.Subjects,
+		})
+	}
+	check.report(len(result.Entries))
+	return works, nil
+}
+
+// sampleAuthorWorks searches for the author's works in sampling order, since
+// the author works listing cannot be sorted.
+func (p *OpenLibraryProvider) sampleAuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	sort := "editions"
+	if sampling == SampleRecent {
+		sort = "new"
+	}
+	params := url.Values{}
+	params.Set("q", "author_key:"+author.Key)
+	params.Set("sort", sort)
+	params.Set("fields", "key,title,subject")
+	params.Set("limit", fmt.Sprint(limit))
+	searchURL := p.baseURL + "/search.json?" + params.Encode()
+
+	var result struct {
+		Docs []struct {
+			Key     string   `json:"key"`
+			Title   string   `json:"title"`
+			Subject []string `json:"subject"`
+		} `json:"docs"`
+	}
+	check := newSchemaCheck(p.Name(), "sample_author_works")
+	if err := p.getJSON(ctx, check, searchURL, &result); err != nil {
+		return nil, err
+	}
+	if result.Docs == nil {
+		return nil, check.missingField("docs")
+	}
+
+	works := make([]models.AuthorWork, 0, len(result.Docs))
+	for _, doc := range result.Docs {
+		if !check.require("key", doc.Key != "") {
+			continue
+		}
+		works = append(works, models.AuthorWork{
+			Title:    doc.Title,
+			Key:      strings.TrimPrefix(doc.Key, "/works/"),
+			Subjects: doc.Subject,
+		})
+	}
+	check.report(len(result.Docs))
+	return works, nil
+}
+
+// SubjectWorks fetches the newest works filed under a subject.
+func (p *OpenLibraryProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	return p.subjectWorks(ctx, subject, "", limit)
+}
+
+// SubjectWorksSince fetches the newest works filed under a subject first
+// published in or after year.
+func (p *OpenLibraryProvider) SubjectWorksSince(ctx context.Context, subject string, year, limit int) ([]models.SubjectWork, error) {
+	return p.subjectWorks(ctx, subject, fmt.Sprintf("%d-9999", year), limit)
+}
+
+// subjectWorks fetches the newest works filed under a subject, only those
+// published within a range of years, such as "2020-2024", if one is given.
+func (p *OpenLibraryProvider) subjectWorks(ctx context.Context, subject, publishedIn string, limit int) ([]models.SubjectWork, error) {
+	slug := url.PathEscape(strings.ReplaceAll(subject, " ", "_"))
+	subjectURL := fmt.Sprintf("%s/subjects/%s.json?limit=%d&sort=new", p.baseURL, slug, limit)
+	if publishedIn != "" {
+		subjectURL += "&published_in=" + url.QueryEscape(publishedIn)
+	}
+
+	var result struct {
+		Works []struct {
+			Title   string `json:"title"`
+			Authors []struct {
+				Name string `json:"name"`
+			} `json:"authors"`
+			Key              string   `json:"key"`
+			FirstPublishYear int      `json:"first_publish_year"`
+			PublishDate      []string `json:"publish_date"` // Editions' publish dates, in no set format
+			EditionCount     int      `json:"edition_count"`
+			HasFulltext      bool     `json:"has_fulltext"`
+			Subject          []string `json:"subject"`
+		} `json:"works"`
+	}
+	check := newSchemaCheck(p.Name(), "subject_works")
+	if err := p.getJSON(ctx, check, subjectURL, &result); err != nil {
+		return nil, err
+	}
+	if result.Works == nil {
+		return nil, check.missingField("works")
+	}
+
+	works := make([]models.SubjectWork, 0, len(result.Works))
+	for _, w := range result.Works {
+		if !check.require("key", w.Key != "") || !check.require("title", w.Title != "") {
+			continue
+		}
+		check.expect("first_publish_year", w.FirstPublishYear != 0)
+		var authors []string
+		for _, a := range w.Authors {
+			authors = append(authors, a.Name)
+		}
+		works = append(works, models.SubjectWork{
+			Title:            w.Title,
+			Key:              strings.TrimPrefix(w.Key, "/works/"),
+			Authors:          authors,
+			FirstPublishYear: w.FirstPublishYear,
+			EditionCount:     w.EditionCount,
+			Ebook:            w.HasFulltext,
+			Subjects:         w.Subject,
+		})
+	}
+	check.report(len(result.Works))
+	return works, nil
+}
+
+// WorkDescription fetches a work record and extracts its description. Many
+// works have none, so the first of their excerpts, or failing that their
+// first sentence, stands in for it.
+func (p *OpenLibraryProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	descURL := fmt.Sprintf("%s/works/%s.json", p.baseURL, url.PathEscape(workKey))
+
+	var result struct {
+		Description   interface{} `json:"description"`
+		FirstSentence interface{} `json:"first_sentence"`
+		Excerpts      []struct {
+			Excerpt interface{} `json:"excerpt"`
+		} `json:"excerpts"`
+	}
+	if err := p.getJSON(ctx, newSchemaCheck(p.Name(), "work"), descURL, &result); err != nil {
+		return nil, err
+	}
+
+	if text := textValue(result.Description); text != "" {
+		return &models.Description{Text: text, Source: models.DescriptionSourceDescription}, nil
+	}
+	for _, excerpt := range result.Excerpts {
+		if text := textValue(excerpt.Excerpt); text != "" {
+			return &models.Description{Text: text, Source: models.DescriptionSourceExcerpt}, nil
+		}
+	}
+	if text := textValue(result.FirstSentence); text != "" {
+		return &models.Description{Text: text, Source: models.DescriptionSourceFirstSentence}, nil
+	}
+	return nil, nil
+}
+
+// textValue extracts the text of a field Open Library returns either as a
+// plain string or as a typed text object, or "" if it has none.
+func textValue(field interface{}) string {
+	switch v := field.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if val, ok := v["value"].(string); ok {
+			return val
+		}
+	}
+	return ""
+}
+
+// SearchWorks returns up to limit works matching a free-text query, optionally
+// restricted to an author, in Open Library's relevance order.
+func (p *OpenLibraryProvider) SearchWorks(ctx context.Context, query, author string, limit int) ([]models.SubjectWork, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	if author != "" {
+		params.Set("author", author)
+	}
+	params.Set("fields", "key,title,author_name,first_publish_year,publish_date,edition_count,has_fulltext,subject")
+	params.Set("limit", fmt.Sprint(limit))
+	searchURL := p.baseURL + "/search.json?" + params.Encode()
+
+	var result struct {
+		Docs []struct {
+			Key              string   `json:"key"`
+			Title            string   `json:"title"`
+			AuthorName       []string `json:"author_name"`
+			FirstPublishYear int      `json:"first_publish_year"`
+			PublishDate      []string `json:"publish_date"` // Editions' publish dates, in no set format
+			EditionCount     int      `json:"edition_count"`
+			HasFulltext      bool     `json:"has_fulltext"`
+			Subject          []string `json:"subject"`
+		} `json:"docs"`
+	}
+	check := newSchemaCheck(p.Name(), "search_works")
+	if err := p.getJSON(ctx, check, searchURL, &result); err != nil {
+		return nil, err
+	}
+	if result.Docs == nil {
+		return nil, check.missingField("docs")
+	}
+
+	works := make([]models.SubjectWork, 0, len(result.Docs))
+	for _, doc := range result.Docs {
+		if !check.require("key", doc.Key != "") || !check.require("title", doc.Title != "") {
+			continue
+		}
+		// Date a work without a first publish year by its earliest edition
+		year := doc.FirstPublishYear
+		if year == 0 {
+			year = dates.EarliestYear(doc.PublishDate)
+		}
+		works = append(works, models.SubjectWork{
+			Title:            doc.Title,
+			Key:              strings.TrimPrefix(doc.Key, "/works/"),
+			Authors:          doc.AuthorName,
+			FirstPublishYear: year,
+			EditionCount:     doc.EditionCount,
+			Ebook:            doc.HasFulltext,
+			Subjects:         doc.Subject,
+		})
+	}
+	check.report(len(result.Docs))
+	return works, nil
+}
+
+// Editions returns up to limit editions of a work. Open Library records series
+// and physical formats on editions rather than works.
+func (p *OpenLibraryProvider) Editions(ctx context.Context, workKey string, limit int) ([]models.Edition, error) {
+	editionsURL := fmt.Sprintf("%s/works/%s/editions.json?limit=%d", p.baseURL, url.PathEscape(workKey), limit)
+
+	var result struct {
+		Entries []struct {
+			Key            string   `json:"key"`
+			PhysicalFormat string   `json:"physical_format"`
+			Series         []string `json:"series"`
+			Languages      []struct {
+				Key string `json:"key"`
+			} `json:"languages"`
+			Description interface{} `json:"description"`
+		} `json:"entries"`
+	}
+	check := newSchemaCheck(p.Name(), "editions")
+	if err := p.getJSON(ctx, check, editionsURL, &result); err != nil {
+		return nil, err
+	}
+	if result.Entries == nil {
+		return nil, check.missingField("entries")
+	}
+
+	editions := make([]models.Edition, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		check.expect("key", entry.Key != "")
+		edition := models.Edition{
+			Key:            strings.TrimPrefix(entry.Key, "/books/"),
+			PhysicalFormat: entry.PhysicalFormat,
+			Series:         entry.Series,
+			Description:    sanitize.Text(textValue(entry.Description)),
+		}
+		for _, language := range entry.Languages {
+			if code, ok := marcLanguages[strings.TrimPrefix(language.Key, "/languages/")]; ok {
+				edition.Languages = append(edition.Languages, code)
+			}
+		}
+		editions = append(editions, edition)
+	}
+	check.report(len(result.Entries))
+	return editions, nil
+}
+
+// marcLanguages maps the MARC codes Open Library identifies languages by to
+// their ISO 639-1 codes, for the languages descriptions are detected in.
+var marcLanguages = map[string]string{
+	"eng": "en", "spa": "es", "fre": "fr", "ger": "de", "ita": "it", "por": "pt", "dut": "nl",
+	"rus": "ru", "gre": "el", "ara": "ar", "heb": "he", "chi": "zh", "jpn": "ja", "kor": "ko",
+}
+
+// CoverURL returns the image URL of a cover in size "S", "M", or "L". With
+// default=false Open Library returns 404 instead of a blank placeholder.
+func (p *OpenLibraryProvider) CoverURL(coverID int, size string) string {
+	return fmt.Sprintf("%s/b/id/%d-%s.jpg?default=false", p.coversBaseURL, coverID, size)
+}
+
+// getJSON performs a GET request and decodes a successful JSON response into
+// v, reporting fields of an unexpected type to check.
+func (p *OpenLibraryProvider) getJSON(ctx context.Context, check *schemaCheck, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	// Errors end up in the logs, so a searched name is left out of them
+	source := redact.URL(url)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", source, redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if err := httpclient.CheckStatus(resp, source); err != nil {
+		return err
+	}
+
+	return check.decodeError(httpclient.DecodeJSON(resp.Body, v))
+}
+
+// redactURLError masks the query of the URL named by a failed request's
+// error, as redact.URL does.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redact.URL(urlErr.URL)
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"context"
+
+	"be-takehome-2024/internal/models"
+)
+
+// WorkSampling is which of an author's works are fetched when they have more
+// than the limit.
+type WorkSampling string
+
+const (
+	// SampleDefault takes works in the provider's own order.
+	SampleDefault WorkSampling = ""
+	// SampleRecent takes the author's newest works.
+	SampleRecent WorkSampling = "recent"
+	// SampleEditions takes the works with the most editions, usually the
+	// author's best known.
+	SampleEditions WorkSampling = "editions"
+)
+
+// recentSubjectWorksProvider is a provider that can fetch only the works in
+// a subject first published in or after a year.
+type recentSubjectWorksProvider interface {
+	SubjectWorksSince(ctx context.Context, subject string, year, limit int) ([]models.SubjectWork, error)
+}
+
+// SubjectWorksSince returns up to limit works in the subject first published
+// in or after year, newest first. Providers that can't ask for them alone
+// are asked for their newest works, which are then filtered.
+func SubjectWorksSince(ctx context.Context, p BookProvider, subject string, year, limit int) ([]models.SubjectWork, error) {
+	if recent, ok := p.(recentSubjectWorksProvider); ok {
+		return recent.SubjectWorksSince(ctx, subject, year, limit)
+	}
+	works, err := p.SubjectWorks(ctx, subject, limit)
+	if err != nil {
+		return nil, err
+	}
+	recent := works[:0:0]
+	for _, work := range works {
+		if work.FirstPublishYear >= year {
+			recent = append(recent, work)
+		}
+	}
+	return recent, nil
+}
+
+// BookProvider is an upstream source of author, works, and subject data.
+type BookProvider interface {
+	// Name identifies the provider in logs.
+	Name() string
+	// SearchAuthors returns the authors matching a name, unordered.
+	SearchAuthors(ctx context.Context, name string) ([]models.Author, error)
+	// AuthorWorks returns up to limit works written by the author, chosen by
+	// sampling when the author has more.
+	AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error)
+	// SubjectWorks returns up to limit works in the subject, newest first.
+	SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error)
+	// WorkDescription returns the description of a work, or nil if it has none.
+	WorkDescription(ctx context.Context, workKey string) (*models.Description, error)
+}
@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+)
+
+// testOpenLibrary is an Open Library provider using the books client, so
+// faults set by httpclient.InjectFaults reach it, pointed at a server
+// answering every subject with one work. It counts the subject requests
+// made to it.
+type testOpenLibrary struct {
+	*OpenLibraryProvider
+	calls int
+}
+
+func newTestOpenLibrary(t *testing.T) *testOpenLibrary {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"works": [{"key": "/works/OL27448W", "title": "A Wizard of Earthsea", "authors": [{"name": "Ursula K. Le Guin"}], "first_publish_year": 1968}]}`)
+	}))
+	t.Cleanup(server.Close)
+	_, books, err := httpclient.New(&config.Config{OutboundIdleConnsPerHost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testOpenLibrary{OpenLibraryProvider: NewOpenLibraryProvider(books, server.URL, server.URL)}
+}
+
+func (p *testOpenLibrary) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	p.calls++
+	return p.OpenLibraryProvider.SubjectWorks(ctx, subject, limit)
+}
+
+// secondaryProvider answers every subject with one work.
+type secondaryProvider struct {
+	countingProvider
+}
+
+func (p *secondaryProvider) Name() string { return "secondary" }
+
+func (p *secondaryProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	p.calls++
+	return []models.SubjectWork{{Key: "GB:earthsea", Title: "A Wizard of Earthsea"}}, nil
+}
+
+func TestFallbackProviderThroughInjectedFaults(t *testing.T) {
+	const calls = primaryFailureThreshold + 2
+	tests := []struct {
+		name   string
+		faults httpclient.Faults
+		// wantPrimary is the number of calls the primary is tried for before
+		// it is skipped.
+		wantPrimary int
+		wantReason  string
+	}{
+		{"server errors", httpclient.Faults{ServerErrorRate: 1}, primaryFailureThreshold, "failures"},
+		{"malformed JSON", httpclient.Faults{MalformedRate: 1}, primaryFailureThreshold, "failures"},
+		// A rate limited primary is skipped at once, for as long as it asked
+		{"rate limit", httpclient.Faults{RateLimitRate: 1}, 1, "rate_limited"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer httpclient.InjectFaults(tt.faults)()
+			primary, secondary := newTestOpenLibrary(t), &secondaryProvider{}
+			p := NewFallbackProvider(primary, secondary)
+			for i := 0; i < calls; i++ {
+				works, err := p.SubjectWorks(context.Background(), "fantasy", 10)
+				if err != nil || len(works) != 1 || works[0].Key != "GB:earthsea" {
+					t.Fatalf("call %d = %v, %v, want the secondary's work", i+1, works, err)
+				}
+			}
+			if primary.calls != tt.wantPrimary || secondary.calls != calls {
+				t.Errorf("primary called %d times and secondary %d, want %d and %d", primary.calls, secondary.calls, tt.wantPrimary, calls)
+			}
+			if health := p.Health(); health.State != "open" || health.DownReason != tt.wantReason {
+				t.Errorf("health = %s (%q), want open (%q)", health.State, health.DownReason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestFallbackProviderRetriesRecoveredPrimary(t *testing.T) {
+	primary, secondary := newTestOpenLibrary(t), &secondaryProvider{}
+	p := NewFallbackProvider(primary, secondary)
+
+	restore := httpclient.InjectFaults(httpclient.Faults{ServerErrorRate: 1})
+	for i := 0; i < primaryFailureThreshold-1; i++ {
+		p.SubjectWorks(context.Background(), "fantasy", 10)
+	}
+	restore()
+
+	works, err := p.SubjectWorks(context.Background(), "fantasy", 10)
+	if err != nil || len(works) != 1 || works[0].Key != "OL27448W" {
+		t.Errorf("SubjectWorks = %v, %v, want the primary's work", works, err)
+	}
+	if health := p.Health(); health.State != "closed" || health.ConsecutiveFailures != 0 {
+		t.Errorf("health = %s with %d consecutive failures, want closed with none", health.State, health.ConsecutiveFailures)
+	}
+}
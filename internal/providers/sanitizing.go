@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"context"
+
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/sanitize"
+)
+
+// SanitizingProvider strips control characters from the text another
+// provider returns, so it is clean before being cached or sent to clients.
+// Keys are left as they are, since they are sent back upstream.
+type SanitizingProvider struct {
+	next BookProvider
+}
+
+// NewSanitizingProvider returns a provider cleaning the text next returns.
+func NewSanitizingProvider(next BookProvider) *SanitizingProvider {
+	return &SanitizingProvider{next: next}
+}
+
+func (p *SanitizingProvider) Name() string {
+	return p.next.Name()
+}
+
+func (p *SanitizingProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	authors, err := p.next.SearchAuthors(ctx, name)
+	for i := range authors {
+		authors[i].Name = sanitize.Text(authors[i].Name)
+	}
+	return authors, err
+}
+
+func (p *SanitizingProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling WorkSampling) ([]models.AuthorWork, error) {
+	works, err := p.next.AuthorWorks(ctx, author, limit, sampling)
+	for i := range works {
+		works[i].Title = sanitize.Text(works[i].Title)
+		sanitizeAll(works[i].Subjects)
+	}
+	return works, err
+}
+
+func (p *SanitizingProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	works, err := p.next.SubjectWorks(ctx, subject, limit)
+	for i := range works {
+		work := &works[i]
+		work.Title = sanitize.Text(work.Title)
+		sanitizeAll(work.Authors)
+		sanitizeAll(work.Subjects)
+		if work.Description != nil {
+			description := sanitize.Text(*work.Description)
+			work.Description = &description
+		}
+	}
+	return works, err
+}
+
+func (p *SanitizingProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	description, err := p.next.WorkDescription(ctx, workKey)
+	if description != nil {
+		description.Text = sanitize.Text(description.Text)
+	}
+	return description, err
+}
+
+// sanitizeAll cleans each of values in place.
+func sanitizeAll(values []string) {
+	for i, value := range values {
+		values[i] = sanitize.Text(value)
+	}
+}
@@ -0,0 +1,103 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"be-takehome-2024/internal/metrics"
+)
+
+// ErrSchemaDrift means an upstream response no longer has the shape a
+// provider expects, such as a renamed or retyped field. It is returned
+// rather than an empty result, so an upstream API change fails loudly.
+var ErrSchemaDrift = errors.New("unexpected upstream response schema")
+
+// schemaCheck collects how one upstream response departs from its expected
+// schema, so each departure is logged and counted once per response rather
+// than once per item.
+type schemaCheck struct {
+	upstream string
+	endpoint string
+	missing  map[string]int
+	// usual are fields items may lack, which only point to drift when every
+	// item lacks them
+	usual map[string]bool
+}
+
+func newSchemaCheck(upstream, endpoint string) *schemaCheck {
+	return &schemaCheck{upstream: upstream, endpoint: endpoint, missing: make(map[string]int), usual: make(map[string]bool)}
+}
+
+// require notes field as missing from an item of the response unless
+// present, and reports present.
+func (c *schemaCheck) require(field string, present bool) bool {
+	if !present {
+		c.missing[field]++
+	}
+	return present
+}
+
+// expect notes field as missing from an item of the response unless
+// present. Unlike a required field, items may lack it; only a response whose
+// items all lack it is reported.
+func (c *schemaCheck) expect(field string, present bool) {
+	c.usual[field] = true
+	c.require(field, present)
+}
+
+// report logs and counts the fields found missing from the response's items,
+// out of total items.
+func (c *schemaCheck) report(total int) {
+	fields := make([]string, 0, len(c.missing))
+	for field, n := range c.missing {
+		if !c.usual[field] || n == total {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		log.Printf("Warning: %s %s response: %d of %d items lack '%s'", c.upstream, c.endpoint, c.missing[field], total, field)
+		metrics.ObserveSchemaDrift(c.upstream, c.endpoint, field)
+	}
+}
+
+// missingField reports a response lacking a top-level field it cannot be
+// used without, returning the error to fail with.
+func (c *schemaCheck) missingField(field string) error {
+	log.Printf("Warning: %s %s response lacks '%s'", c.upstream, c.endpoint, field)
+	metrics.ObserveSchemaDrift(c.upstream, c.endpoint, field)
+	return fmt.Errorf("%w: %s response lacks '%s'", ErrSchemaDrift, c.endpoint, field)
+}
+
+// decodeError reports a response whose field had an unexpected type,
+// returning the error to fail with. Other errors are returned as they are.
+func (c *schemaCheck) decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	field := fieldPath(typeErr.Field)
+	log.Printf("Warning: %s %s response has %s for '%s', expected %s", c.upstream, c.endpoint, typeErr.Value, field, typeErr.Type)
+	metrics.ObserveSchemaDrift(c.upstream, c.endpoint, field)
+	return fmt.Errorf("%w: %s response has %s for '%s'", ErrSchemaDrift, c.endpoint, typeErr.Value, field)
+}
+
+// fieldPath drops array indexes from a decoding error's field path, such as
+// "docs.0.work_count", so every item's field counts under the same label.
+func fieldPath(field string) string {
+	var parts []string
+	for _, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err != nil {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "(root)"
+	}
+	return strings.Join(parts, ".")
+}
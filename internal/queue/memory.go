@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryBackend keeps tasks in process. They are lost on restart, and each
+// instance has its own.
+type memoryBackend struct {
+	mu      sync.Mutex
+	tasks   map[string]memoryTask
+	pending readyHeap
+	// wake is closed, and replaced, whenever a task is scheduled.
+	wake chan struct{}
+}
+
+type memoryTask struct {
+	task    Task
+	expires time.Time // Zero for tasks kept until deleted
+}
+
+// NewMemoryBackend returns an empty in-process backend.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{tasks: make(map[string]memoryTask), wake: make(chan struct{})}
+}
+
+func (m *memoryBackend) Save(ctx context.Context, task Task, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := memoryTask{task: task}
+	if ttl > 0 {
+		stored.expires = time.Now().Add(ttl)
+	}
+	m.tasks[task.ID] = stored
+	m.dropExpired()
+	return nil
+}
+
+// dropExpired removes expired tasks. The caller must hold m.mu.
+func (m *memoryBackend) dropExpired() {
+	now := time.Now()
+	for id, stored := range m.tasks {
+		if !stored.expires.IsZero() && now.After(stored.expires) {
+			delete(m.tasks, id)
+		}
+	}
+}
+
+func (m *memoryBackend) Load(ctx context.Context, id string) (Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.tasks[id]
+	if !ok || (!stored.expires.IsZero() && time.Now().After(stored.expires)) {
+		return Task{}, ErrNotFound
+	}
+	return stored.task, nil
+}
+
+func (m *memoryBackend) Schedule(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending.remove(id)
+	heap.Push(&m.pending, readyTask{id: id, at: at})
+	close(m.wake)
+	m.wake = make(chan struct{})
+	return nil
+}
+
+// Claim ignores the lease, since claimed tasks cannot outlive the process.
+func (m *memoryBackend) Claim(ctx context.Context, lease time.Duration) (string, error) {
+	for {
+		m.mu.Lock()
+		wait := time.Hour
+		if len(m.pending) > 0 {
+			if wait = time.Until(m.pending[0].at); wait <= 0 {
+				next := heap.Pop(&m.pending).(readyTask)
+				m.mu.Unlock()
+				return next.id, nil
+			}
+		}
+		wake := m.wake
+		m.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+func (m *memoryBackend) Unschedule(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending.remove(id)
+	return nil
+}
+
+func (m *memoryBackend) List(ctx context.Context, filter Filter) ([]Task, error) {
+	m.mu.Lock()
+	m.dropExpired()
+	var tasks []Task
+	for _, stored := range m.tasks {
+		if matches(stored.task, filter) {
+			tasks = append(tasks, stored.task)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.After(tasks[j].CreatedAt) })
+	if filter.Limit > 0 && len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+	}
+	return tasks, nil
+}
+
+func (m *memoryBackend) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tasks, id)
+	return nil
+}
+
+// matches reports whether a task passes filter's status and kind.
+func matches(task Task, filter Filter) bool {
+	return (filter.Status == "" || task.Status == filter.Status) && (filter.Kind == "" || task.Kind == filter.Kind)
+}
+
+// readyTask is a scheduled task and when it may run.
+type readyTask struct {
+	id string
+	at time.Time
+}
+
+// readyHeap orders scheduled tasks by when they may run.
+type readyHeap []readyTask
+
+func (h readyHeap) Len() int           { return len(h) }
+func (h readyHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h readyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *readyHeap) Push(x any)        { *h = append(*h, x.(readyTask)) }
+func (h *readyHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// remove drops id from the heap, if scheduled.
+func (h *readyHeap) remove(id string) {
+	for i, t := range *h {
+		if t.id == id {
+			heap.Remove(h, i)
+			return
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// Package queue runs work in the background: async recommendations, bulk
+// user imports, and webhook notifications. Each task kind has a handler,
+// registered at startup, and its own retry policy; a task whose attempts run
+// out is dead-lettered, kept for an admin to inspect, retry, or discard.
+//
+// Tasks live in a Backend: in process by default, or in Redis so they are
+// shared by instances and survive restarts.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Task statuses.
+const (
+	StatusQueued    = "queued"    // Waiting to run, or to be retried
+	StatusRunning   = "running"   // Claimed by a worker
+	StatusSucceeded = "succeeded" // Done; its result is kept for a while
+	StatusDead      = "dead"      // Failed every attempt
+)
+
+var (
+	// ErrNotFound is returned for a task that does not exist or has expired.
+	ErrNotFound = errors.New("task not found")
+	// ErrUnknownKind is returned when enqueueing a kind without a handler.
+	ErrUnknownKind = errors.New("unknown task kind")
+	// ErrNotDead is returned when retrying a task that has not failed.
+	ErrNotDead = errors.New("task is not dead-lettered")
+	// ErrRunning is returned when discarding a task a worker is running.
+	ErrRunning = errors.New("task is running")
+)
+
+// Task is a unit of background work and its outcome.
+type Task struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// OrgID is the organization the task runs for, if any, which alone may
+	// look it up.
+	OrgID       int             `json:"org_id,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	// RunAt is when a queued task is next run.
+	RunAt      time.Time  `json:"run_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Filter selects tasks to list. Empty fields match every task.
+type Filter struct {
+	Status string
+	Kind   string
+	Limit  int
+}
+
+// Backend stores tasks and hands out those ready to run.
+type Backend interface {
+	// Save creates or replaces a task. Finished tasks may expire after ttl;
+	// a zero ttl keeps the task.
+	Save(ctx context.Context, task Task, ttl time.Duration) error
+	// Load returns a task, or ErrNotFound.
+	Load(ctx context.Context, id string) (Task, error)
+	// Schedule makes a saved task ready to be claimed at at.
+	Schedule(ctx context.Context, id string, at time.Time) error
+	// Claim blocks until a task is ready, or ctx is done, and returns its ID.
+	// A claimed task that is not finished or rescheduled within lease, say
+	// because its instance stopped, may be claimed again.
+	Claim(ctx context.Context, lease time.Duration) (string, error)
+	// Unschedule withdraws a task from those to be claimed.
+	Unschedule(ctx context.Context, id string) error
+	// List returns the tasks matching filter, newest first.
+	List(ctx context.Context, filter Filter) ([]Task, error)
+	// Delete removes a task.
+	Delete(ctx context.Context, id string) error
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler's error to dead-letter the task at once rather
+// than retry it.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Handler runs a task's payload, returning a result to keep with the task,
+// or nil. A returned error fails the attempt.
+type Handler func(ctx context.Context, task Task) (interface{}, error)
+
+// Options are a task kind's retry policy.
+type Options struct {
+	// MaxAttempts is how many times a task is tried before it is dead-lettered.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for each retry after.
+	Backoff time.Duration
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+}
+
+type kind struct {
+	handler Handler
+	opts    Options
+}
+
+var (
+	mu      sync.RWMutex
+	kinds           = make(map[string]kind)
+	backend Backend = NewMemoryBackend()
+	// resultTTL is how long succeeded tasks are kept.
+	resultTTL = 24 * time.Hour
+)
+
+// Handle registers the handler of a task kind. A zero timeout or backoff
+// defaults to a minute or a second.
+func Handle(name string, opts Options, handler Handler) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	kinds[name] = kind{handler: handler, opts: opts}
+}
+
+// Use makes the queue keep tasks in b, keeping succeeded tasks for ttl.
+// It must be called before Start or any Enqueue.
+func Use(b Backend, ttl time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	backend, resultTTL = b, ttl
+}
+
+func current() (Backend, time.Duration) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return backend, resultTTL
+}
+
+// Enqueue adds a task of a registered kind, run as soon as a worker is free.
+func Enqueue(ctx context.Context, kindName string, orgID int, payload interface{}) (Task, error) {
+	mu.RLock()
+	k, ok := kinds[kindName]
+	mu.RUnlock()
+	if !ok {
+		return Task{}, fmt.Errorf("%w: %s", ErrUnknownKind, kindName)
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return Task{}, fmt.Errorf("error encoding %s payload: %v", kindName, err)
+	}
+	id, err := newID()
+	if err != nil {
+		return Task{}, err
+	}
+
+	b, _ := current()
+	now := time.Now().UTC()
+	task := Task{
+		ID:          id,
+		Kind:        kindName,
+		OrgID:       orgID,
+		Payload:     encoded,
+		Status:      StatusQueued,
+		MaxAttempts: max(k.opts.MaxAttempts, 1),
+		CreatedAt:   now,
+		RunAt:       now,
+	}
+	if err := b.Save(ctx, task, 0); err != nil {
+		return Task{}, err
+	}
+	return task, b.Schedule(ctx, id, now)
+}
+
+// Get returns a task.
+func Get(ctx context.Context, id string) (Task, error) {
+	b, _ := current()
+	return b.Load(ctx, id)
+}
+
+// List returns the tasks matching filter, newest first.
+func List(ctx context.Context, filter Filter) ([]Task, error) {
+	b, _ := current()
+	return b.List(ctx, filter)
+}
+
+// Retry requeues a dead-lettered task with a fresh set of attempts.
+func Retry(ctx context.Context, id string) (Task, error) {
+	b, _ := current()
+	task, err := b.Load(ctx, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if task.Status != StatusDead {
+		return Task{}, ErrNotDead
+	}
+	now := time.Now().UTC()
+	task.Status, task.Attempts, task.RunAt, task.FinishedAt = StatusQueued, 0, now, nil
+	if err := b.Save(ctx, task, 0); err != nil {
+		return Task{}, err
+	}
+	return task, b.Schedule(ctx, id, now)
+}
+
+// Discard removes a task that is not running.
+func Discard(ctx context.Context, id string) error {
+	b, _ := current()
+	task, err := b.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if task.Status == StatusRunning {
+		return ErrRunning
+	}
+	if err := b.Unschedule(ctx, id); err != nil {
+		return err
+	}
+	return b.Delete(ctx, id)
+}
+
+// Start runs tasks on workers goroutines until ctx is cancelled.
+func Start(ctx context.Context, workers int) {
+	for range max(workers, 1) {
+		go work(ctx)
+	}
+}
+
+// work claims and runs tasks until ctx is cancelled.
+func work(ctx context.Context) {
+	for {
+		b, _ := current()
+		id, err := b.Claim(ctx, maxLease())
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Error claiming task: %v", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		run(ctx, id)
+	}
+}
+
+// maxLease is the longest any kind's attempt may take, so a claimed task is
+// not handed to another worker while it may still be running.
+func maxLease() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	lease := time.Minute
+	for _, k := range kinds {
+		lease = max(lease, k.opts.Timeout+time.Minute)
+	}
+	return lease
+}
+
+// run makes one attempt at a claimed task, then records its outcome: done,
+// scheduled for a retry, or dead-lettered.
+func run(ctx context.Context, id string) {
+	b, ttl := current()
+	task, err := b.Load(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		// Discarded while queued
+		b.Unschedule(ctx, id)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading task %s: %v", id, err)
+		return
+	}
+
+	mu.RLock()
+	k, ok := kinds[task.Kind]
+	mu.RUnlock()
+
+	task.Status = StatusRunning
+	task.Attempts++
+	if err := b.Save(ctx, task, 0); err != nil {
+		log.Printf("Error saving task %s: %v", id, err)
+		return
+	}
+
+	var result interface{}
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownKind, task.Kind)
+		task.Attempts = task.MaxAttempts
+	} else {
+		attemptCtx, cancel := context.WithTimeout(ctx, k.opts.Timeout)
+		result, err = k.handler(attemptCtx, task)
+		cancel()
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		task.Status, task.LastError, task.FinishedAt = StatusSucceeded, "", &now
+		if result != nil {
+			if task.Result, err = json.Marshal(result); err != nil {
+				log.Printf("Error encoding result of task %s: %v", id, err)
+			}
+		}
+	case task.Attempts < task.MaxAttempts && !errors.As(err, new(permanentError)):
+		backoff := k.opts.Backoff << (task.Attempts - 1)
+		task.Status, task.LastError, task.RunAt = StatusQueued, err.Error(), now.Add(backoff)
+		log.Printf("Task %s (%s) attempt %d failed, retrying in %v: %v", id, task.Kind, task.Attempts, backoff, err)
+		if err := b.Save(ctx, task, 0); err != nil {
+			log.Printf("Error saving task %s: %v", id, err)
+		}
+		if err := b.Schedule(ctx, id, task.RunAt); err != nil {
+			log.Printf("Error rescheduling task %s: %v", id, err)
+		}
+		return
+	default:
+		task.Status, task.LastError, task.FinishedAt = StatusDead, err.Error(), &now
+		log.Printf("Task %s (%s) dead-lettered after %d attempts: %v", id, task.Kind, task.Attempts, err)
+	}
+
+	keep := time.Duration(0)
+	if task.Status == StatusSucceeded {
+		keep = ttl
+	}
+	if err := b.Save(ctx, task, keep); err != nil {
+		log.Printf("Error saving task %s: %v", id, err)
+	}
+	if err := b.Unschedule(ctx, id); err != nil {
+		log.Printf("Error unscheduling task %s: %v", id, err)
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating task ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,342 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisBackend keeps tasks in Redis, shared by every instance using the same
+// prefix. Each task is a JSON string; two sorted sets index them, by when
+// they may next be claimed and by when they were created.
+type redisBackend struct {
+	client *redisClient
+	prefix string
+}
+
+// redisPollInterval is how often an idle worker checks for ready tasks.
+const redisPollInterval = 250 * time.Millisecond
+
+// listBatch is how many task IDs List reads at a time, and maxListScan how
+// many it reads at most looking for matches.
+const (
+	listBatch   = 100
+	maxListScan = 10000
+)
+
+// NewRedisBackend returns a backend keeping tasks in the Redis at rawURL,
+// such as "redis://:password@localhost:6379/0", under keys starting with
+// prefix.
+func NewRedisBackend(rawURL, prefix string) (Backend, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.do(context.Background(), "PING"); err != nil {
+		return nil, fmt.Errorf("error connecting to Redis: %v", err)
+	}
+	return &redisBackend{client: client, prefix: prefix}, nil
+}
+
+func (r *redisBackend) taskKey(id string) string { return r.prefix + "task:" + id }
+func (r *redisBackend) readyKey() string         { return r.prefix + "ready" }
+func (r *redisBackend) indexKey() string         { return r.prefix + "index" }
+
+func (r *redisBackend) Save(ctx context.Context, task Task, ttl time.Duration) error {
+	encoded, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", r.taskKey(task.ID), string(encoded)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := r.client.do(ctx, args...); err != nil {
+		return err
+	}
+	_, err = r.client.do(ctx, "ZADD", r.indexKey(), "NX", millis(task.CreatedAt), task.ID)
+	return err
+}
+
+func (r *redisBackend) Load(ctx context.Context, id string) (Task, error) {
+	reply, err := r.client.do(ctx, "GET", r.taskKey(id))
+	if err != nil {
+		return Task{}, err
+	}
+	if reply == nil {
+		return Task{}, ErrNotFound
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(reply.(string)), &task); err != nil {
+		return Task{}, fmt.Errorf("error decoding task %s: %v", id, err)
+	}
+	return task, nil
+}
+
+func (r *redisBackend) Schedule(ctx context.Context, id string, at time.Time) error {
+	_, err := r.client.do(ctx, "ZADD", r.readyKey(), millis(at), id)
+	return err
+}
+
+// Claim takes the first ready task, moving it a lease into the future so it
+// is claimed again should this instance stop before finishing it. Removing
+// the task from the ready set first decides between instances claiming it
+// at once: only one removes it.
+func (r *redisBackend) Claim(ctx context.Context, lease time.Duration) (string, error) {
+	for {
+		now := time.Now()
+		reply, err := r.client.do(ctx, "ZRANGEBYSCORE", r.readyKey(), "-inf", millis(now), "LIMIT", "0", "10")
+		if err != nil {
+			return "", err
+		}
+		for _, item := range reply.([]interface{}) {
+			id := item.(string)
+			removed, err := r.client.do(ctx, "ZREM", r.readyKey(), id)
+			if err != nil {
+				return "", err
+			}
+			if removed.(int64) == 1 {
+				if err := r.Schedule(ctx, id, now.Add(lease)); err != nil {
+					return "", err
+				}
+				return id, nil
+			}
+		}
+
+		select {
+		case <-time.After(redisPollInterval):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func (r *redisBackend) Unschedule(ctx context.Context, id string) error {
+	_, err := r.client.do(ctx, "ZREM", r.readyKey(), id)
+	return err
+}
+
+// List reads tasks newest first, dropping the index entries of tasks that
+// have expired.
+func (r *redisBackend) List(ctx context.Context, filter Filter) ([]Task, error) {
+	var tasks []Task
+	for start := 0; start < maxListScan; start += listBatch {
+		reply, err := r.client.do(ctx, "ZREVRANGE", r.indexKey(), strconv.Itoa(start), strconv.Itoa(start+listBatch-1))
+		if err != nil {
+			return nil, err
+		}
+		ids := reply.([]interface{})
+		if len(ids) == 0 {
+			break
+		}
+		keys := []string{"MGET"}
+		for _, id := range ids {
+			keys = append(keys, r.taskKey(id.(string)))
+		}
+		values, err := r.client.do(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+
+		expired := []string{"ZREM", r.indexKey()}
+		for i, value := range values.([]interface{}) {
+			if value == nil {
+				expired = append(expired, ids[i].(string))
+				continue
+			}
+			var task Task
+			if err := json.Unmarshal([]byte(value.(string)), &task); err != nil {
+				continue
+			}
+			if matches(task, filter) {
+				tasks = append(tasks, task)
+				if filter.Limit > 0 && len(tasks) == filter.Limit {
+					return tasks, nil
+				}
+			}
+		}
+		if len(expired) > 2 {
+			if _, err := r.client.do(ctx, expired...); err != nil {
+				return nil, err
+			}
+			// The remaining entries moved up into the removed ones' places
+			start -= len(expired) - 2
+		}
+		if len(ids) < listBatch {
+			break
+		}
+	}
+	return tasks, nil
+}
+
+func (r *redisBackend) Delete(ctx context.Context, id string) error {
+	if _, err := r.client.do(ctx, "DEL", r.taskKey(id)); err != nil {
+		return err
+	}
+	_, err := r.client.do(ctx, "ZREM", r.indexKey(), id)
+	return err
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// redisTimeout bounds a command whose context has no deadline.
+const redisTimeout = 5 * time.Second
+
+// redisClient speaks the Redis protocol over one connection, reconnecting
+// after a failure. Commands are sent one at a time.
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL '%s'", rawURL)
+	}
+	c := &redisClient{addr: u.Host, db: strings.TrimPrefix(u.Path, "/")}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply: a string, an int64, a slice of
+// replies, or nil.
+func (c *redisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(ctx, args)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state; start afresh next time
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// connect dials the server, authenticating and selecting the database.
+// The caller must hold c.mu.
+func (c *redisClient) connect(ctx context.Context) error {
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	conn, err := d.DialContext(dialCtx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != "" && c.db != "0" {
+		setup = append(setup, []string{"SELECT", c.db})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(ctx, args); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *redisClient) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	c.conn.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch kind, rest := line[0], line[1:]; kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply '%s'", line)
+	}
+}
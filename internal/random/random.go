@@ -0,0 +1,42 @@
+// Package random is the source of the service's random choices, such as
+// scheduler jitter, log sampling, and injected faults, so deterministic runs
+// can seed it and make the same choices every time.
+package random
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+var (
+	mu sync.Mutex
+	// source is nil until seeded, using the runtime's random source.
+	source *rand.Rand
+)
+
+// Seed makes every following choice derive from seed.
+func Seed(seed uint64) {
+	mu.Lock()
+	defer mu.Unlock()
+	source = rand.New(rand.NewPCG(seed, seed))
+}
+
+// Float64 returns a number in [0.0, 1.0).
+func Float64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if source == nil {
+		return rand.Float64()
+	}
+	return source.Float64()
+}
+
+// Int64N returns a number in [0, n). It panics if n <= 0.
+func Int64N(n int64) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if source == nil {
+		return rand.Int64N(n)
+	}
+	return source.Int64N(n)
+}
@@ -0,0 +1,123 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/timing"
+)
+
+// RecommendAdhoc runs the requested strategy's pipeline for two readers given
+// only by their favorite authors, such as visitors to a demo page. Nothing is
+// stored about them: their authors are resolved and their subjects counted
+// afresh, and the result is neither saved nor published. The request's user
+// IDs are ignored.
+func RecommendAdhoc(ctx context.Context, db *sql.DB, req PairRequest, authors [2][]string) (PairResult, error) {
+	recommender, ok := Get(req.Strategy)
+	if !ok {
+		return PairResult{}, fmt.Errorf("unknown strategy '%s'", req.Strategy)
+	}
+	req.User1ID, req.User2ID = 0, 0
+
+	state := &State{
+		DB:      db,
+		Request: req,
+		Users: [2]*UserState{
+			{Label: "Reader1", authors: authors[0]},
+			{Label: "Reader2", authors: authors[1]},
+		},
+	}
+	pipeline := recommender.Pipeline().
+		Replace(StageResolveAuthors, NewStage(StageResolveAuthors, resolveAdhocAuthors)).
+		Replace(StageBuildProfiles, NewStage(StageBuildProfiles, buildAdhocProfiles)).
+		forRequest(req)
+	if err := pipeline.Run(ctx, state); err != nil {
+		return PairResult{}, err
+	}
+	pair := state.Result
+	pair.AsOf = clock.Now().UTC()
+	pair.Partial = partial(ctx)
+	return pair, nil
+}
+
+// resolveAdhocAuthors resolves each reader's favorite authors by name. A
+// reader with none found cannot stand in for a stored profile the way a
+// user can, so there is nothing to recommend.
+func resolveAdhocAuthors(ctx context.Context, s *State) error {
+	favoriteCap := s.Request.favoriteCap()
+	return forEachUser(ctx, s, func(user *UserState) error {
+		reader := 1
+		if user == s.Users[1] {
+			reader = 2
+		}
+		names := user.authors
+		var warnings []i18n.Message
+		if len(names) > favoriteCap {
+			warnings = append(warnings, i18n.NewMessage("Only the first %s of the %s favorite authors of reader %s were used.", favoriteCap, len(names), reader))
+			names = names[:favoriteCap]
+		}
+
+		stop := timing.Start(ctx, "author_resolution")
+		resolved, err := services.ResolveAuthorKeysByName(ctx, names)
+		stop()
+		var multi *services.MultiError
+		if errors.As(err, &multi) {
+			for _, err := range multi.Errors() {
+				var authorErr *services.AuthorError
+				if !errors.As(err, &authorErr) || !errors.Is(authorErr, services.ErrAuthorNotFound) {
+					return fmt.Errorf("%s: %w", user.Label, err)
+				}
+				warnings = append(warnings, i18n.NewMessage("Favorite author '%s' of reader %s could not be found.", authorErr.Author, reader))
+			}
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", user.Label, err)
+		}
+
+		var found []models.Author
+		for _, name := range names {
+			if author, ok := resolved[name]; ok {
+				found = append(found, author)
+				log.Printf("%s author: Name=%s, Key=%s, WorkCount=%d", user.Label, redact.Name(author.Name), author.Key, author.WorkCount)
+			}
+		}
+		if len(found) == 0 {
+			return &NoMatchError{Reason: fmt.Sprintf("None of the favorite authors of reader %d could be found.", reader)}
+		}
+		user.resolution = resolution{Authors: found, Warnings: warnings}
+		return nil
+	})
+}
+
+// buildAdhocProfiles counts the subjects of each reader's resolved authors,
+// without materializing them, and settles how books are chosen for the pair.
+func buildAdhocProfiles(ctx context.Context, s *State) error {
+	err := forEachUser(ctx, s, func(user *UserState) error {
+		stop := timing.Start(ctx, "subject_aggregation")
+		result, err := services.GetSubjectAuthorCounts(ctx, user.resolution.Authors)
+		stop()
+		if err != nil {
+			return fmt.Errorf("%s: %w", user.Label, err)
+		}
+		user.profile = profile{
+			Weights:      result.Profile(s.Request.Weighting),
+			ComputedAt:   clock.Now().UTC(),
+			Warnings:     user.resolution.Warnings,
+			AuthorCounts: services.AuthorCountProfile(result.Aggregate),
+			Authors:      result.Authors,
+			WorkCounts:   services.AuthorCountProfile(result.WorkCount),
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return combineProfiles(s)
+}
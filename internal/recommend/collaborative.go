@@ -0,0 +1,59 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+func init() { Register(collaborativeRecommender{}) }
+
+// collaborativeRecommender recommends from the subjects favored by other users
+// whose stored profiles are most similar to the pair's combined profile.
+type collaborativeRecommender struct{}
+
+func (collaborativeRecommender) Name() string { return "collaborative" }
+
+func (collaborativeRecommender) Pipeline() Pipeline {
+	return DefaultPipeline(NewStage(StageSelectSubject, selectCollaborativeSubject))
+}
+
+// selectCollaborativeSubject selects the subject similar users favor, and
+// favors their favorite authors' books.
+func selectCollaborativeSubject(ctx context.Context, s *State) error {
+	req := s.Request
+	profiles, err := database.GetUserProfiles(s.DB, req.OrgID)
+	if err != nil {
+		return fmt.Errorf("error loading user profiles: %v", err)
+	}
+	profiles = filterProfiles(profiles, s.Books.Audience)
+	pairProfile := services.CombineProfiles(s.User1Subjects, s.User2Subjects)
+	neighbors := services.FindSimilarUsers(pairProfile, profiles, req.User1ID, req.User2ID)
+	if len(neighbors) == 0 {
+		return &NoMatchError{Reason: "No similar users found for collaborative recommendations", Diagnostics: diagnoseNoMatch(ctx, s)}
+	}
+
+	subject, err := services.FindCollaborativeSubject(neighbors, profiles)
+	if err != nil {
+		return &NoMatchError{Reason: err.Error(), Diagnostics: diagnoseNoMatch(ctx, s)}
+	}
+	log.Printf("Collaborative subject: %s (from %d similar users)", subject, len(neighbors))
+	s.Subjects = []models.Subject{{Key: subject}}
+
+	// Prefer books by the similar users' favorite authors
+	var favoredAuthors []string
+	for _, neighbor := range neighbors {
+		authors, err := database.GetUserFavoriteAuthors(s.DB, neighbor.UserID, req.favoriteCap())
+		if err != nil {
+			log.Printf("Error loading favorite authors for user ID %d: %v", neighbor.UserID, err)
+			continue
+		}
+		favoredAuthors = append(favoredAuthors, authors...)
+	}
+	s.Books.FavoredAuthors = favoredAuthors
+	return nil
+}
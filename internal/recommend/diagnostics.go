@@ -0,0 +1,69 @@
+package recommend
+
+import (
+	"context"
+	"log"
+
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+const (
+	// diagnosticTopSubjects is how many of each user's subjects a no-match
+	// diagnosis lists.
+	diagnosticTopSubjects = 10
+	// diagnosticNearMisses is how many near misses a no-match diagnosis lists.
+	diagnosticNearMisses = 5
+)
+
+// Diagnostics explain why a pair's or group's interests never met, so a
+// client can show them and suggest favorite authors to add.
+type Diagnostics struct {
+	Users []UserDiagnostics `json:"users"`
+	// NearestMisses are the most similar pairs of different subjects among
+	// a pair's top subjects, found with semantic matching only.
+	NearestMisses []services.SubjectPair `json:"nearest_misses"`
+}
+
+// UserDiagnostics are one user's side of a no-match diagnosis.
+type UserDiagnostics struct {
+	UserID      int              `json:"user_id,omitempty"` // Unset for readers given only by their favorite authors
+	TopSubjects []models.Subject `json:"top_subjects"`
+	// ColdStart is set when the user's subjects stand in for a profile they lack.
+	ColdStart bool `json:"cold_start,omitempty"`
+}
+
+// userDiagnostics returns a user's side of a no-match diagnosis, and the
+// keys of their top subjects.
+func userDiagnostics(userID int, profile models.SubjectProfile, coldStart bool) (UserDiagnostics, []string) {
+	user := UserDiagnostics{UserID: userID, TopSubjects: []models.Subject{}, ColdStart: coldStart}
+	top := profile.Top(diagnosticTopSubjects)
+	for _, key := range top {
+		user.TopSubjects = append(user.TopSubjects, models.Subject{Key: key, Score: profile[key]})
+	}
+	return user, top
+}
+
+// diagnoseNoMatch explains why the pair's subject profiles share no subject,
+// or none with enough confidence. Near misses are only looked for with
+// semantic matching, and left out if the subjects can't be embedded.
+func diagnoseNoMatch(ctx context.Context, s *State) *Diagnostics {
+	diagnostics := &Diagnostics{Users: make([]UserDiagnostics, 2), NearestMisses: []services.SubjectPair{}}
+	var top [2][]string
+	for i, profile := range []models.SubjectProfile{s.User1Subjects, s.User2Subjects} {
+		diagnostics.Users[i], top[i] = userDiagnostics(s.Users[i].ID, profile, s.Users[i].ColdStart)
+	}
+	if !s.Request.SemanticSubjects {
+		return diagnostics
+	}
+
+	misses, err := services.NearestSubjects(ctx, top[0], top[1], diagnosticNearMisses)
+	if err != nil {
+		log.Printf("Error finding near misses between the users' subjects: %v", err)
+		return diagnostics
+	}
+	if misses != nil {
+		diagnostics.NearestMisses = misses
+	}
+	return diagnostics
+}
@@ -0,0 +1,204 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/events"
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/timing"
+)
+
+// GroupRequest identifies a group recommendation and the options it was made with.
+type GroupRequest struct {
+	OrgID       int
+	GroupID     int
+	MemberIDs   []int
+	Weighting   services.Weighting
+	Books       services.BookOptions
+	TopSubjects int
+	Scoring     services.Scoring
+	Audience    services.Audience
+	FavoriteCap int
+}
+
+// GroupSubject is a subject a group's recommendation drew on, with its score
+// and how many members share it.
+type GroupSubject struct {
+	Subject string  `json:"subject"`
+	Score   float64 `json:"score"`
+	Members int     `json:"members"`
+}
+
+// GroupResult is a recommendation for a group.
+type GroupResult struct {
+	models.Recommendation
+	Subjects []GroupSubject `json:"subjects"`
+	// LeftOut are the members without usable favorite authors, whose
+	// interests the recommendation could not reflect.
+	LeftOut  []int          `json:"left_out,omitempty"`
+	Warnings []i18n.Message `json:"warnings,omitempty"`
+	AsOf     time.Time      `json:"as_of"`
+	// SubjectsAsOf is when the oldest of the members' subject profiles was computed.
+	SubjectsAsOf time.Time `json:"subjects_as_of,omitempty"`
+	// Partial is set as for a PairResult.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// RecommendGroup builds every member's subject profile and recommends books
+// from the subjects most of the group shares, leaving out books any member
+// has read. Members without usable favorite authors are left out, with a
+// warning; at least two members must remain.
+func RecommendGroup(ctx context.Context, db *sql.DB, req GroupRequest) (GroupResult, error) {
+	type memberResult struct {
+		profile   profile
+		coldStart bool
+		err       error
+	}
+	results := make([]memberResult, len(req.MemberIDs))
+	var wg sync.WaitGroup
+	for i, userID := range req.MemberIDs {
+		wg.Add(1)
+		go func(i, userID int) {
+			defer wg.Done()
+			label := fmt.Sprintf("Member %d", userID)
+			p, err := userProfile(ctx, db, label, userID, req.Weighting, req.FavoriteCap)
+			switch {
+			case errors.Is(err, services.ErrNoAuthorsResolved):
+				log.Printf("%s: %v", label, err)
+				results[i] = memberResult{coldStart: true}
+			case err != nil:
+				results[i] = memberResult{err: fmt.Errorf("%s: %w", label, err)}
+			default:
+				results[i] = memberResult{profile: p}
+			}
+		}(i, userID)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return GroupResult{}, err
+	}
+
+	var (
+		group    GroupResult
+		profiles []models.SubjectProfile
+		// Every member's side of a diagnosis, should the group share nothing
+		diagnostics = &Diagnostics{NearestMisses: []services.SubjectPair{}}
+	)
+	for i, res := range results {
+		userID := req.MemberIDs[i]
+		switch {
+		case res.err != nil:
+			return GroupResult{}, res.err
+		case res.coldStart:
+			member, _ := userDiagnostics(userID, nil, true)
+			diagnostics.Users = append(diagnostics.Users, member)
+			group.LeftOut = append(group.LeftOut, userID)
+			group.Warnings = append(group.Warnings, i18n.NewMessage("No favorite authors could be resolved for user ID %s; the group's recommendations leave them out.", userID))
+			continue
+		}
+		if computedAt := res.profile.ComputedAt; !computedAt.IsZero() && (group.SubjectsAsOf.IsZero() || computedAt.Before(group.SubjectsAsOf)) {
+			group.SubjectsAsOf = computedAt
+		}
+		group.Warnings = append(group.Warnings, res.profile.Warnings...)
+		profile := req.Audience.FilterProfile(res.profile.Weights)
+		profiles = append(profiles, profile)
+		member, _ := userDiagnostics(userID, profile, false)
+		diagnostics.Users = append(diagnostics.Users, member)
+	}
+	if len(profiles) < 2 {
+		return GroupResult{}, &NoMatchError{Reason: "Fewer than two members of the group have favorite authors that could be resolved.", Diagnostics: diagnostics}
+	}
+
+	subjects, err := services.FindTopGroupSubjects(profiles, max(req.TopSubjects, 1), req.Scoring)
+	if err != nil {
+		return GroupResult{}, &NoMatchError{Reason: err.Error(), Diagnostics: diagnostics}
+	}
+	for _, subject := range subjects {
+		group.Subjects = append(group.Subjects, GroupSubject{Subject: subject.Key, Score: subject.Score, Members: subject.Members})
+	}
+	log.Printf("Group %d: top subject %s, shared by %d of %d members", req.GroupID, subjects[0].Key, subjects[0].Members, len(profiles))
+
+	// Leave out books any member has already read
+	books := req.Books
+	books.Audience = req.Audience
+	read, err := database.GetReadWorkKeys(db, req.MemberIDs...)
+	if err != nil {
+		log.Printf("Error loading read books of group %d: %v", req.GroupID, err)
+	}
+	books.ExcludeWorks = read
+
+	stop := timing.Start(ctx, "book_fetch")
+	if len(subjects) > 1 {
+		group.Books, err = services.GetBlendedBooks(ctx, subjects, books)
+	} else {
+		group.Books, err = services.GetRecommendedBooks(ctx, subjects[0].Key, books)
+	}
+	stop()
+	if err != nil {
+		return GroupResult{}, err
+	}
+	group.Subject = subjects[0].Key
+	group.AsOf = clock.Now().UTC()
+	group.Partial = partial(ctx)
+	events.Publish(events.RecommendationComputed, req.OrgID, map[string]interface{}{
+		"group_id":        req.GroupID,
+		"subject":         group.Subject,
+		"recommendations": group.Books,
+		"as_of":           group.AsOf,
+	})
+	return group, nil
+}
+
+// SaveGroup stores a group's latest recommendation, which members can then vote on.
+func SaveGroup(db *sql.DB, groupID int, result GroupResult) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding group recommendation: %v", err)
+	}
+	return database.SaveGroupRecommendation(db, groupID, string(encoded))
+}
+
+// LoadGroup returns a group's latest recommendation, or nil if it has none.
+func LoadGroup(db *sql.DB, groupID int) (*GroupResult, error) {
+	stored, err := database.GetGroupRecommendation(db, groupID)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	var result GroupResult
+	if err := json.Unmarshal([]byte(stored.Result), &result); err != nil {
+		return nil, fmt.Errorf("error decoding stored group recommendation: %v", err)
+	}
+	return &result, nil
+}
+
+// Book returns the recommended book with the given work key, and the
+// subject it was recommended from with that subject's score.
+func (g GroupResult) Book(workKey string) (models.Work, GroupSubject, bool) {
+	for _, book := range g.Books {
+		if book.Key != workKey {
+			continue
+		}
+		subject := book.Subject
+		if subject == "" {
+			subject = g.Subject
+		}
+		for _, s := range g.Subjects {
+			if s.Subject == subject {
+				return book, s, true
+			}
+		}
+		return book, GroupSubject{Subject: subject}, true
+	}
+	return models.Work{}, GroupSubject{}, false
+}
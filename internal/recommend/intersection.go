@@ -0,0 +1,90 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+func init() { Register(intersectionRecommender{}) }
+
+// intersectionRecommender recommends recent books from the subject most
+// common to both users' favorite authors, or blends books from the top few
+// common subjects when the request asks for more than one.
+type intersectionRecommender struct{}
+
+func (intersectionRecommender) Name() string { return "subject-intersection" }
+
+func (intersectionRecommender) Pipeline() Pipeline {
+	return DefaultPipeline(NewStage(StageSelectSubject, selectCommonSubjects))
+}
+
+// selectCommonSubjects selects the most common subject, or the top common
+// subjects to blend. Subjects rolled up to the same genre, and with semantic
+// matching related subjects, count as common. A top subject matched with
+// less than the requested confidence counts as no match.
+func selectCommonSubjects(ctx context.Context, s *State) error {
+	req := s.Request
+	var err error
+	if s.User1Subjects, s.User2Subjects, err = relateSubjects(ctx, req, s.User1Subjects, s.User2Subjects); err != nil {
+		return err
+	}
+	user1, user2 := &s.Users[0].profile, &s.Users[1].profile
+	if user1.AuthorCounts, user2.AuthorCounts, err = relateSubjects(ctx, req, user1.AuthorCounts, user2.AuthorCounts); err != nil {
+		return err
+	}
+	if user1.WorkCounts, user2.WorkCounts, err = relateSubjects(ctx, req, user1.WorkCounts, user2.WorkCounts); err != nil {
+		return err
+	}
+	workCounts := services.CombineProfiles(user1.WorkCounts, user2.WorkCounts)
+
+	if req.TopSubjects > 1 {
+		subjects, err := services.FindTopCommonSubjects(s.User1Subjects, s.User2Subjects, workCounts, req.TopSubjects, req.Scoring)
+		if err != nil {
+			return &NoMatchError{Reason: err.Error(), Diagnostics: diagnoseNoMatch(ctx, s)}
+		}
+		log.Printf("Blending %d common subjects, top: %s", len(subjects), subjects[0].Key)
+		s.Subjects = subjects
+	} else {
+		// Find the most common subject
+		commonSubject, err := services.FindMostCommonSubject(s.User1Subjects, s.User2Subjects, workCounts, req.Scoring)
+		if err != nil {
+			return &NoMatchError{Reason: err.Error(), Diagnostics: diagnoseNoMatch(ctx, s)}
+		}
+		log.Printf("Common subject: %s", commonSubject)
+		s.Subjects = []models.Subject{{Key: commonSubject}}
+	}
+
+	if confidence := subjectConfidence(s, s.Subjects[0].Key); confidence < req.MinConfidence {
+		return &NoMatchError{
+			Reason: fmt.Sprintf("The confidence of %.2f in the common subject '%s' is below the minimum of %.2f.",
+				confidence, s.Subjects[0].Key, req.MinConfidence),
+			Diagnostics: diagnoseNoMatch(ctx, s),
+		}
+	}
+	return nil
+}
+
+// relateSubjects rolls a pair's profiles up to the requested genre level
+// and, with semantic matching, relates their subjects. Profiles that can't
+// be related are matched exactly.
+func relateSubjects(ctx context.Context, req PairRequest, profile1, profile2 models.SubjectProfile) (models.SubjectProfile, models.SubjectProfile, error) {
+	profile1 = services.RollUpProfile(profile1, req.Rollup)
+	profile2 = services.RollUpProfile(profile2, req.Rollup)
+	if !req.SemanticSubjects {
+		return profile1, profile2, nil
+	}
+	related1, related2, err := services.RelateProfiles(ctx, profile1, profile2)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		// Exact matching still gives a recommendation
+		log.Printf("Error relating subjects, matching them exactly: %v", err)
+		return profile1, profile2, nil
+	}
+	return related1, related2, nil
+}
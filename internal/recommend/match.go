@@ -0,0 +1,94 @@
+package recommend
+
+import (
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+// matchTopSubjects is how many of each user's subjects, and of the subjects
+// they share, a match lists.
+const matchTopSubjects = 5
+
+// Match is how a pair's interests meet, enough for copy such as "you both
+// love science fiction" without further requests.
+type Match struct {
+	Users [2]UserMatch `json:"users"`
+	// SharedSubjects are the subjects in both users' profiles, best first.
+	SharedSubjects []models.Subject `json:"shared_subjects"`
+	// Confidence, from 0 to 1, is the smaller of the users' author shares.
+	Confidence float64 `json:"confidence"`
+}
+
+// UserMatch is one user's side of a match.
+type UserMatch struct {
+	UserID      int              `json:"user_id,omitempty"` // Unset for readers given only by their favorite authors
+	TopSubjects []models.Subject `json:"top_subjects"`
+	// Weight is the user's weight for the recommended subject, and
+	// Contribution their share of the pair's combined weight for it.
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"`
+	// AuthorShare is the share of the user's favorite authors writing in the
+	// recommended subject.
+	AuthorShare float64 `json:"author_share"`
+	// ColdStart is set when the user's subjects stand in for a profile they lack.
+	ColdStart bool `json:"cold_start,omitempty"`
+}
+
+// pairMatch breaks down how the pair's subject profiles meet at the
+// recommended subject.
+func pairMatch(s *State) *Match {
+	subject := s.Result.Subject
+	profiles := [2]models.SubjectProfile{s.User1Subjects, s.User2Subjects}
+
+	match := &Match{SharedSubjects: []models.Subject{}, Confidence: subjectConfidence(s, subject)}
+	if shared, err := services.FindTopCommonSubjects(profiles[0], profiles[1], services.CombineProfiles(s.Users[0].profile.WorkCounts, s.Users[1].profile.WorkCounts), matchTopSubjects, s.Request.Scoring); err == nil {
+		match.SharedSubjects = shared
+	}
+	combined := profiles[0][subject] + profiles[1][subject]
+	for i, user := range s.Users {
+		profile := profiles[i]
+		side := UserMatch{
+			UserID:      user.ID,
+			TopSubjects: []models.Subject{},
+			Weight:      profile[subject],
+			AuthorShare: authorShare(user.profile, subject),
+			ColdStart:   user.ColdStart,
+		}
+		for _, key := range profile.Top(matchTopSubjects) {
+			side.TopSubjects = append(side.TopSubjects, models.Subject{Key: key, Score: profile[key]})
+		}
+		if combined > 0 {
+			side.Contribution = profile[subject] / combined
+		}
+		match.Users[i] = side
+	}
+	return match
+}
+
+// subjectConfidence is how confident a match on the subject is: the smaller
+// of the users' shares of favorite authors writing in it, so a subject many
+// of both users' authors write in is a surer match than one a single author
+// on either side touches.
+func subjectConfidence(s *State, subject string) float64 {
+	confidence := 1.0
+	for _, user := range s.Users {
+		confidence = min(confidence, authorShare(user.profile, subject))
+	}
+	return confidence
+}
+
+// authorShare is the share of the authors a profile was counted from that
+// write in the subject. Counts stored before the number of authors was
+// recorded are judged against the user's most written-in subject instead.
+func authorShare(p profile, subject string) float64 {
+	total := float64(p.Authors)
+	if total == 0 {
+		for _, count := range p.AuthorCounts {
+			total = max(total, count)
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return min(p.AuthorCounts[subject]/total, 1)
+}
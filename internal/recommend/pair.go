@@ -0,0 +1,350 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/events"
+	"be-takehome-2024/internal/i18n"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/reqlog"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/timing"
+)
+
+// PairRequest is a recommendation request for a user pair, with everything
+// needed to compute it again later.
+type PairRequest struct {
+	OrgID       int                  `json:"org_id"`
+	User1ID     int                  `json:"user1_id"`
+	User2ID     int                  `json:"user2_id"`
+	Strategy    string               `json:"strategy"`
+	Weighting   services.Weighting   `json:"weighting"`
+	Books       services.BookOptions `json:"books"`
+	TopSubjects int                  `json:"top_subjects"`
+	Scoring     services.Scoring     `json:"scoring"`
+	Audience    services.Audience    `json:"audience,omitempty"`
+	// FavoriteCap is how many of each user's favorite authors are used.
+	FavoriteCap int `json:"favorite_cap"`
+	// AuthorBios enriches the recommendation with bios of the recommended authors.
+	AuthorBios bool `json:"author_bios,omitempty"`
+	// SemanticSubjects treats related subjects, such as "sci-fi" and "science
+	// fiction", as common to the pair.
+	SemanticSubjects bool `json:"semantic_subjects,omitempty"`
+	// Rollup, when set, matches subjects by their genre at that level of the
+	// genre taxonomy, so "epic fantasy" and "urban fantasy" meet at "fantasy".
+	Rollup services.GenreLevel `json:"rollup,omitempty"`
+	// MinConfidence is the least confidence in the common subject, from 0 to
+	// 1, that a recommendation is made with.
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+}
+
+// PairResult is a recommendation for a user pair.
+type PairResult struct {
+	models.Recommendation
+	// ColdStartFrom names the stand-in subjects used for a user without a
+	// profile, or is empty when both users had one.
+	ColdStartFrom string         `json:"cold_start_from,omitempty"`
+	Warnings      []i18n.Message `json:"warnings,omitempty"`
+	AsOf          time.Time      `json:"as_of"`
+	// SubjectsAsOf is when the older of the users' subject profiles was computed.
+	SubjectsAsOf time.Time `json:"subjects_as_of,omitempty"`
+	// AuthorBios are the recommended authors' bios, when the request asks for them.
+	AuthorBios []models.AuthorBio `json:"author_bios,omitempty"`
+	// Match is how the users' interests meet at the subject.
+	Match *Match `json:"match,omitempty"`
+	// Partial is set when the request's deadline cut upstream calls off, or
+	// a cache-only request found data missing from the caches, so the
+	// recommendation was assembled from what could be had.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// RecommendPair runs the requested strategy's pipeline for the pair.
+func RecommendPair(ctx context.Context, db *sql.DB, req PairRequest) (PairResult, error) {
+	recommender, ok := Get(req.Strategy)
+	if !ok {
+		return PairResult{}, fmt.Errorf("unknown strategy '%s'", req.Strategy)
+	}
+
+	state := &State{
+		DB:      db,
+		Request: req,
+		Users: [2]*UserState{
+			{ID: req.User1ID, Label: "User1"},
+			{ID: req.User2ID, Label: "User2"},
+		},
+	}
+	if err := recommender.Pipeline().forRequest(req).Run(ctx, state); err != nil {
+		return PairResult{}, err
+	}
+	pair := state.Result
+	pair.AsOf = clock.Now().UTC()
+	pair.Partial = partial(ctx)
+	events.Publish(events.RecommendationComputed, req.OrgID, map[string]interface{}{
+		"user1_id":        req.User1ID,
+		"user2_id":        req.User2ID,
+		"strategy":        req.Strategy,
+		"subject":         pair.Subject,
+		"recommendations": pair.Books,
+		"as_of":           pair.AsOf,
+	})
+	return pair, nil
+}
+
+// partial reports whether the request's recommendation is missing data, cut
+// off by its deadline or not cached for a cache-only request.
+func partial(ctx context.Context) bool {
+	b := budget.FromContext(ctx)
+	return b.Expired() || b.CacheMissed()
+}
+
+// favoriteCap returns the request's favorite author cap, or the configured
+// one for requests stored before it was recorded.
+func (req PairRequest) favoriteCap() int {
+	if req.FavoriteCap > 0 {
+		return req.FavoriteCap
+	}
+	return config.Get().FavoriteAuthorsCap
+}
+
+// profile is a user's subject weights, when they were computed, and warnings
+// about favorite authors left out of them.
+type profile struct {
+	Weights    models.SubjectProfile
+	ComputedAt time.Time
+	Warnings   []i18n.Message
+	// AuthorCounts are how many of the Authors counted write in each subject,
+	// for judging how confident a match on the subject is.
+	AuthorCounts models.SubjectProfile
+	Authors      int
+	// WorkCounts are how many of the authors' works carry each subject, for
+	// breaking ties between equally scored subjects.
+	WorkCounts models.SubjectProfile
+}
+
+// resolution is what a user's subject profile is built from: their stored
+// subject counts while fresh, or their resolved favorite authors otherwise,
+// with warnings about favorite authors left out.
+type resolution struct {
+	Stored   *database.UserSubjects
+	Authors  []models.Author
+	Warnings []i18n.Message
+}
+
+// subjectCounts are a user's subject counts and when they were computed.
+type subjectCounts struct {
+	Result     services.SubjectAuthorResult
+	ComputedAt time.Time
+}
+
+// computeResolution finds what a user's subject profile is built from, using
+// their first favoriteCap favorite authors. The error wraps
+// services.ErrNoAuthorsResolved when the user has no favorite authors or none
+// of them could be found.
+func computeResolution(ctx context.Context, db *sql.DB, label string, userID, favoriteCap int) (resolution, error) {
+	// Note when some of the user's favorite authors are left out
+	var warnings []i18n.Message
+	if count, err := database.CountUserFavorites(db, userID); err != nil {
+		log.Printf("Error counting favorite authors for user ID %d: %v", userID, err)
+	} else if count > favoriteCap {
+		warnings = append(warnings, i18n.NewMessage("Only the first %s of the %s favorite authors of user ID %s were used.", favoriteCap, count, userID))
+	}
+
+	// Use the materialized subject counts while they are fresh and drawn from as many authors
+	stored, err := database.GetUserSubjects(db, userID)
+	if err != nil {
+		log.Printf("Error loading subjects for user ID %d: %v", userID, err)
+	} else if stored.Fresh(storedTTL(ctx, config.Get().UserSubjectsTTL)) && stored.FavoriteCap == favoriteCap {
+		log.Printf("%s: Using subjects computed at %v", label, stored.ComputedAt)
+		budget.CacheHit(ctx)
+		return resolution{Stored: stored, Warnings: warnings}, nil
+	}
+
+	// Fetch favorite authors, reusing stored resolutions
+	stop := timing.Start(ctx, "author_resolution")
+	authorKeys, notFound, err := resolveFavoriteAuthors(ctx, db, userID, favoriteCap)
+	stop()
+	if err != nil {
+		return resolution{}, err
+	}
+	warnings = append(warnings, notFound...)
+	if len(authorKeys) == 0 {
+		log.Printf("%s: No favorite authors found for user ID %d", label, userID)
+		return resolution{}, fmt.Errorf("%w: user ID %d has no favorite authors", services.ErrNoAuthorsResolved, userID)
+	}
+
+	for _, author := range authorKeys {
+		log.Printf("%s author: Name=%s, Key=%s, WorkCount=%d", label, redact.Name(author.Name), author.Key, author.WorkCount)
+	}
+	return resolution{Authors: authorKeys, Warnings: warnings}, nil
+}
+
+// computeSubjectCounts counts the subjects of a user's resolved favorite
+// authors, materializing them for later requests, or returns the stored
+// counts the resolution found.
+func computeSubjectCounts(ctx context.Context, db *sql.DB, userID, favoriteCap int, res resolution) (subjectCounts, error) {
+	if stored := res.Stored; stored != nil {
+		return subjectCounts{
+			Result:     services.SubjectAuthorResult{Aggregate: stored.AuthorCounts, WorkShare: stored.WorkShare, RankWeight: stored.RankWeight, WorkCount: stored.WorkCounts, Authors: stored.Authors},
+			ComputedAt: stored.ComputedAt,
+		}, nil
+	}
+
+	// Get subject counts
+	stop := timing.Start(ctx, "subject_aggregation")
+	result, err := services.GetSubjectAuthorCounts(ctx, res.Authors)
+	stop()
+	if err != nil {
+		return subjectCounts{}, err
+	}
+	if b := budget.FromContext(ctx); b.Expired() || b.CacheOnly() {
+		// Counts missing authors cut off by the deadline, or drawn from stale
+		// caches, aren't worth keeping
+		return subjectCounts{Result: result, ComputedAt: clock.Now().UTC()}, nil
+	}
+
+	// Materialize the counts, and store the profile for collaborative recommendations
+	if err := database.SaveUserSubjects(db, userID, database.UserSubjects{
+		AuthorCounts: result.Aggregate,
+		WorkShare:    result.WorkShare,
+		RankWeight:   result.RankWeight,
+		WorkCounts:   result.WorkCount,
+		FavoriteCap:  favoriteCap,
+		Authors:      result.Authors,
+	}); err != nil {
+		log.Printf("Error saving subjects for user ID %d: %v", userID, err)
+	}
+	if err := database.SaveUserProfile(db, userID, services.AuthorCountProfile(result.Aggregate)); err != nil {
+		log.Printf("Error saving profile for user ID %d: %v", userID, err)
+	}
+
+	return subjectCounts{Result: result, ComputedAt: clock.Now().UTC()}, nil
+}
+
+// storedTTL returns how long stored data stays fresh: ttl, or forever for a
+// cache-only request, which has nothing to replace it with.
+func storedTTL(ctx context.Context, ttl time.Duration) time.Duration {
+	if budget.FromContext(ctx).CacheOnly() {
+		return math.MaxInt64
+	}
+	return ttl
+}
+
+// resolveFavoriteAuthors returns the Open Library authors for a user's first
+// limit favorites, in the user's order of preference. Stored resolutions are used
+// while fresh; the rest are searched for and the results stored for next
+// time. Favorites the search does not find are left out, with a warning for
+// each.
+func resolveFavoriteAuthors(ctx context.Context, db *sql.DB, userID, limit int) ([]models.Author, []i18n.Message, error) {
+	favorites, err := database.GetUserFavorites(db, userID, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var stale []string
+	ttl := storedTTL(ctx, config.Get().AuthorResolutionTTL)
+	for _, favorite := range favorites {
+		if !favorite.Fresh(ttl) {
+			stale = append(stale, favorite.Name)
+		}
+	}
+	if len(stale) == 0 {
+		recordAuthorOutcomes(ctx, userID, favorites, ttl, nil, nil)
+		return favoriteAuthors(favorites, ttl, nil), nil, nil
+	}
+
+	resolved, err := services.ResolveAuthorKeysByName(ctx, stale)
+	recordAuthorOutcomes(ctx, userID, favorites, ttl, resolved, err)
+	warnings, onlyNotFound := notFoundWarnings(err, userID)
+	if err != nil && !onlyNotFound {
+		return nil, nil, err
+	}
+	for name, author := range resolved {
+		if err := database.SaveAuthorResolution(db, name, author.Key, author.WorkCount); err != nil {
+			log.Printf("Error saving resolution of author '%s': %v", redact.Name(name), err)
+		}
+	}
+	return favoriteAuthors(favorites, ttl, resolved), warnings, nil
+}
+
+// favoriteAuthors returns the authors for favorites in order, from their
+// stored resolution while fresh and from resolved otherwise, skipping those
+// with neither.
+func favoriteAuthors(favorites []database.FavoriteAuthor, ttl time.Duration, resolved map[string]models.Author) []models.Author {
+	var authors []models.Author
+	for _, favorite := range favorites {
+		if favorite.Fresh(ttl) {
+			authors = append(authors, models.Author{Name: favorite.Name, Key: favorite.Key, WorkCount: favorite.WorkCount})
+		} else if author, ok := resolved[favorite.Name]; ok {
+			authors = append(authors, author)
+		}
+	}
+	return authors
+}
+
+// recordAuthorOutcomes notes in the request's detail log how each favorite
+// author was resolved, given the authors resolved and the resolution error.
+func recordAuthorOutcomes(ctx context.Context, userID int, favorites []database.FavoriteAuthor, ttl time.Duration, resolved map[string]models.Author, err error) {
+	rec := reqlog.FromContext(ctx)
+	if rec == nil {
+		return
+	}
+	notFound := make(map[string]bool)
+	var multi *services.MultiError
+	if errors.As(err, &multi) {
+		for _, err := range multi.Errors() {
+			var authorErr *services.AuthorError
+			if errors.As(err, &authorErr) && errors.Is(authorErr, services.ErrAuthorNotFound) {
+				notFound[authorErr.Author] = true
+			}
+		}
+	}
+	for _, favorite := range favorites {
+		switch author, ok := resolved[favorite.Name]; {
+		case favorite.Fresh(ttl):
+			rec.Author(userID, favorite.Name, reqlog.AuthorStored, favorite.Key)
+		case ok:
+			rec.Author(userID, favorite.Name, reqlog.AuthorResolved, author.Key)
+		case notFound[favorite.Name]:
+			rec.Author(userID, favorite.Name, reqlog.AuthorNotFound, "")
+		default:
+			rec.Author(userID, favorite.Name, reqlog.AuthorFailed, "")
+		}
+	}
+}
+
+// notFoundWarnings returns a warning for each author an author resolution
+// error reports as not found. onlyNotFound is false when the error also
+// holds other failures.
+func notFoundWarnings(err error, userID int) (warnings []i18n.Message, onlyNotFound bool) {
+	var multi *services.MultiError
+	if !errors.As(err, &multi) {
+		return nil, err == nil
+	}
+	for _, err := range multi.Errors() {
+		var authorErr *services.AuthorError
+		if !errors.As(err, &authorErr) || !errors.Is(authorErr, services.ErrAuthorNotFound) {
+			return nil, false
+		}
+		warnings = append(warnings, i18n.NewMessage("Favorite author '%s' of user ID %s could not be found.", authorErr.Author, userID))
+	}
+	return warnings, true
+}
+
+// coldStartWarning explains which stand-in subjects were used for a user without a profile.
+func coldStartWarning(userID int, source string) i18n.Message {
+	if source == services.ColdStartPopularSubjects {
+		return i18n.NewMessage("No favorite authors could be resolved for user ID %s; recommending from popular subjects.", userID)
+	}
+	return i18n.NewMessage("No favorite authors could be resolved for user ID %s; recommending from the other user's top subjects.", userID)
+}
@@ -0,0 +1,310 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/metrics"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/timing"
+)
+
+// The stages of the default pipeline, in order.
+const (
+	StageResolveAuthors  = "resolve_authors"
+	StageBuildProfiles   = "build_profiles"
+	StageSelectSubject   = "select_subject"
+	StageFetchCandidates = "fetch_candidates"
+	StageRank            = "rank"
+	StageEnrich          = "enrich"
+	StageAuthorBios      = "author_bios"
+)
+
+// State is a pair recommendation as it passes through a pipeline. Each stage
+// reads what earlier stages filled in and fills in its own part.
+type State struct {
+	DB      *sql.DB
+	Request PairRequest
+	// Users are the pair's two users, in request order.
+	Users [2]*UserState
+
+	// User1Subjects and User2Subjects are the users' subject weights, set by
+	// build_profiles.
+	User1Subjects models.SubjectProfile
+	User2Subjects models.SubjectProfile
+	// Books is how books are chosen once subjects are selected.
+	Books services.BookOptions
+	// Subjects are the subjects books are recommended from, best first, set
+	// by select_subject.
+	Subjects []models.Subject
+	// Candidates are the works books are chosen from, best first, set by
+	// fetch_candidates.
+	Candidates []models.SubjectWork
+	// Result is the recommendation, set by rank and enrich.
+	Result PairResult
+}
+
+// UserState is one user of a pair as it passes through a pipeline.
+type UserState struct {
+	ID    int
+	Label string // How logs and errors refer to the user
+	// ColdStart is set when no favorite authors could be resolved for the user.
+	ColdStart bool
+
+	// authors are the favorite authors of a reader given by them rather than
+	// by a stored user
+	authors []string
+
+	resolution resolution
+	profile    profile
+}
+
+// Stage is one step of a recommendation pipeline.
+type Stage interface {
+	// Name identifies the stage in metrics and to Replace and Skip.
+	Name() string
+	Run(ctx context.Context, s *State) error
+}
+
+// NewStage returns a stage running fn.
+func NewStage(name string, fn func(ctx context.Context, s *State) error) Stage {
+	return stageFunc{name: name, fn: fn}
+}
+
+type stageFunc struct {
+	name string
+	fn   func(ctx context.Context, s *State) error
+}
+
+func (f stageFunc) Name() string                            { return f.name }
+func (f stageFunc) Run(ctx context.Context, s *State) error { return f.fn(ctx, s) }
+
+// Pipeline is the stages computing a recommendation, run in order.
+type Pipeline []Stage
+
+// DefaultPipeline returns the standard stages, choosing subjects with
+// selectSubject.
+func DefaultPipeline(selectSubject Stage) Pipeline {
+	return Pipeline{
+		NewStage(StageResolveAuthors, resolveAuthors),
+		NewStage(StageBuildProfiles, buildProfiles),
+		selectSubject,
+		NewStage(StageFetchCandidates, fetchCandidates),
+		NewStage(StageRank, rank),
+		NewStage(StageEnrich, enrich),
+		NewStage(StageAuthorBios, authorBios),
+	}
+}
+
+// Replace returns the pipeline with the stage named name swapped for stage.
+func (p Pipeline) Replace(name string, stage Stage) Pipeline {
+	replaced := make(Pipeline, len(p))
+	for i, existing := range p {
+		if existing.Name() == name {
+			existing = stage
+		}
+		replaced[i] = existing
+	}
+	return replaced
+}
+
+// Skip returns the pipeline without the stage named name.
+func (p Pipeline) Skip(name string) Pipeline {
+	var kept Pipeline
+	for _, stage := range p {
+		if stage.Name() != name {
+			kept = append(kept, stage)
+		}
+	}
+	return kept
+}
+
+// forRequest returns the pipeline without the stages the request does not
+// ask for: the author bios stage, unless it asks for bios.
+func (p Pipeline) forRequest(req PairRequest) Pipeline {
+	if !req.AuthorBios {
+		return p.Skip(StageAuthorBios)
+	}
+	return p
+}
+
+// Run runs the stages in order, stopping at the first to fail. Each stage's
+// duration and outcome is recorded in the metrics; a stage finding nothing
+// to recommend does not count as failed.
+func (p Pipeline) Run(ctx context.Context, s *State) error {
+	for _, stage := range p {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := stage.Run(ctx, s)
+		var noMatch *NoMatchError
+		metrics.ObserveStage(stage.Name(), err != nil && !errors.As(err, &noMatch), time.Since(start))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachUser runs fn for each of the pair's users concurrently, returning
+// the first user's error, if any, before the second's.
+func forEachUser(ctx context.Context, s *State, fn func(user *UserState) error) error {
+	errs := make([]error, len(s.Users))
+	var wg sync.WaitGroup
+	for i, user := range s.Users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(user)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveAuthors resolves each user's favorite authors, or finds their fresh
+// stored subjects. Users with none resolved are marked for a cold start.
+func resolveAuthors(ctx context.Context, s *State) error {
+	return forEachUser(ctx, s, func(user *UserState) error {
+		res, err := resolveUser(ctx, s.DB, user.Label, user.ID, s.Request.favoriteCap())
+		switch {
+		case errors.Is(err, services.ErrNoAuthorsResolved):
+			log.Printf("%s: %v", user.Label, err)
+			user.ColdStart = true
+		case err != nil:
+			return fmt.Errorf("%s: %w", user.Label, err)
+		default:
+			user.resolution = res
+		}
+		return nil
+	})
+}
+
+// buildProfiles builds the users' subject profiles, standing in for a user
+// without one, and settles how books are chosen for the pair.
+func buildProfiles(ctx context.Context, s *State) error {
+	req := s.Request
+	err := forEachUser(ctx, s, func(user *UserState) error {
+		if user.ColdStart {
+			return nil
+		}
+		p, err := buildProfile(ctx, s.DB, user.ID, req.Weighting, req.favoriteCap(), user.resolution)
+		if err != nil {
+			return fmt.Errorf("%s: %w", user.Label, err)
+		}
+		user.profile = p
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := combineProfiles(s); err != nil {
+		return err
+	}
+
+	// Leave out books either user has already read
+	read, err := database.GetReadWorkKeys(s.DB, req.User1ID, req.User2ID)
+	if err != nil {
+		log.Printf("Error loading read books of users %d and %d: %v", req.User1ID, req.User2ID, err)
+	}
+	s.Books.ExcludeWorks = read
+	return nil
+}
+
+// combineProfiles sets the pair's subject profiles from the users', standing
+// in for a user without one, and settles how books are chosen for the pair.
+func combineProfiles(s *State) error {
+	req := s.Request
+	user1, user2 := s.Users[0], s.Users[1]
+	s.User1Subjects, s.User2Subjects = user1.profile.Weights, user2.profile.Weights
+
+	// Fall back to stand-in subjects when one user has no usable favorite authors
+	pair := &s.Result
+	for _, user := range s.Users {
+		if computedAt := user.profile.ComputedAt; !computedAt.IsZero() && (pair.SubjectsAsOf.IsZero() || computedAt.Before(pair.SubjectsAsOf)) {
+			pair.SubjectsAsOf = computedAt
+		}
+		pair.Warnings = append(pair.Warnings, user.profile.Warnings...)
+	}
+	switch {
+	case user1.ColdStart && user2.ColdStart:
+		return &NoMatchError{Reason: "No favorite authors could be resolved for either user."}
+	case user1.ColdStart:
+		s.User1Subjects, pair.ColdStartFrom = services.ColdStartProfile(s.User2Subjects, config.Get().ColdStartSubjects)
+		pair.Warnings = append(pair.Warnings, coldStartWarning(user1.ID, pair.ColdStartFrom))
+	case user2.ColdStart:
+		s.User2Subjects, pair.ColdStartFrom = services.ColdStartProfile(s.User1Subjects, config.Get().ColdStartSubjects)
+		pair.Warnings = append(pair.Warnings, coldStartWarning(user2.ID, pair.ColdStartFrom))
+	}
+
+	// Only consider subjects, and books, suited to the requested audience
+	s.User1Subjects = req.Audience.FilterProfile(s.User1Subjects)
+	s.User2Subjects = req.Audience.FilterProfile(s.User2Subjects)
+	s.Books = req.Books
+	s.Books.Audience = req.Audience
+	return nil
+}
+
+// fetchCandidates fetches the works of the selected subjects.
+func fetchCandidates(ctx context.Context, s *State) error {
+	stop := timing.Start(ctx, "book_fetch")
+	defer stop()
+	works, err := services.FetchCandidates(ctx, s.Subjects)
+	if budget.CutShort(ctx, err) {
+		// Out of time; a best-effort recommendation goes without books
+		log.Printf("Out of time fetching candidates: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.Candidates = works
+	return nil
+}
+
+// rank chooses the recommended books from the candidates.
+func rank(ctx context.Context, s *State) error {
+	stop := timing.Start(ctx, "rank")
+	defer stop()
+	books, err := services.ChooseBooks(ctx, s.Subjects, s.Candidates, s.Books)
+	if budget.CutShort(ctx, err) {
+		log.Printf("Out of time choosing books: %v", err)
+		books = []models.Work{}
+	} else if err != nil {
+		return err
+	}
+	s.Result.Recommendation = models.Recommendation{Subject: s.Subjects[0].Key, Books: books}
+	return nil
+}
+
+// enrich adds how the pair's interests meet.
+func enrich(ctx context.Context, s *State) error {
+	s.Result.Match = pairMatch(s)
+	return nil
+}
+
+// authorBios adds bios of the recommended authors.
+func authorBios(ctx context.Context, s *State) error {
+	stop := timing.Start(ctx, "author_bios")
+	defer stop()
+	s.Result.AuthorBios = services.GetBookAuthorBios(ctx, s.Result.Books)
+	return nil
+}
@@ -0,0 +1,167 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/services"
+)
+
+// Planner shares the work behind subject profiles between the
+// recommendations of a batch, such as a pair refresh, so a user in many of
+// its pairs or groups has their favorite authors resolved and their subjects
+// counted once. Requests running at the same time share the work being done
+// for them whether or not they are in a batch.
+type Planner struct {
+	// keep holds on to finished results for the rest of the batch; without
+	// it they are only shared while being computed
+	keep bool
+
+	mu      sync.Mutex
+	planned map[any]*planned
+}
+
+// resolutionKey identifies a user's resolution: the same user's differs by
+// how many favorite authors it draws on, whether a deadline may have cut it
+// short, and whether it was drawn from caches alone.
+type resolutionKey struct {
+	userID      int
+	favoriteCap int
+	bestEffort  bool
+	cacheOnly   bool
+}
+
+func newResolutionKey(ctx context.Context, userID, favoriteCap int) resolutionKey {
+	b := budget.FromContext(ctx)
+	return resolutionKey{userID: userID, favoriteCap: favoriteCap, bestEffort: b.HasDeadline(), cacheOnly: b.CacheOnly()}
+}
+
+// countsKey identifies a user's subject counts, built from the resolution
+// with the same key.
+type countsKey resolutionKey
+
+// planned is a result being, or done being, computed.
+type planned struct {
+	done  chan struct{}
+	value any
+	err   error
+	// truncated is set when the computing request's deadline cut upstream
+	// calls off, so the result may be missing data
+	truncated bool
+}
+
+// NewPlanner returns a planner for one batch of recommendations.
+func NewPlanner() *Planner {
+	return &Planner{keep: true, planned: make(map[any]*planned)}
+}
+
+// inFlight shares the results being computed between concurrent requests.
+var inFlight = &Planner{planned: make(map[any]*planned)}
+
+type plannerKey struct{}
+
+// WithPlanner returns a context whose recommendations share profiles
+// through p.
+func WithPlanner(ctx context.Context, p *Planner) context.Context {
+	return context.WithValue(ctx, plannerKey{}, p)
+}
+
+func plannerFrom(ctx context.Context) *Planner {
+	if p, ok := ctx.Value(plannerKey{}).(*Planner); ok {
+		return p
+	}
+	return inFlight
+}
+
+// share returns the result for key, calling compute only if no other
+// recommendation in the batch, or running at the same time, has it.
+func share[V any](ctx context.Context, key any, compute func() (V, error)) (V, error) {
+	p := plannerFrom(ctx)
+
+	p.mu.Lock()
+	entry, shared := p.planned[key]
+	if !shared {
+		entry = &planned{done: make(chan struct{})}
+		p.planned[key] = entry
+	}
+	p.mu.Unlock()
+
+	if shared {
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+		// A result abandoned by the recommendation computing it, or cut off by
+		// its budget, is computed again within this one's
+		if !isRequestError(entry.err) || ctx.Err() != nil {
+			// A result cut short by another request's deadline makes this
+			// one partial too, however long its own deadline
+			if entry.truncated {
+				budget.FromContext(ctx).Expire()
+			}
+			value, _ := entry.value.(V)
+			return value, entry.err
+		}
+		return compute()
+	}
+
+	value, err := compute()
+	entry.value, entry.err = value, err
+	entry.truncated = budget.FromContext(ctx).Expired()
+	close(entry.done)
+	// Results cut short are only shared with the requests already waiting
+	if !p.keep || isRequestError(err) || entry.truncated {
+		p.mu.Lock()
+		delete(p.planned, key)
+		p.mu.Unlock()
+	}
+	return value, err
+}
+
+// userProfile returns a user's subject profile, sharing its resolution and
+// subject counts through the context's planner.
+func userProfile(ctx context.Context, db *sql.DB, label string, userID int, weighting services.Weighting, favoriteCap int) (profile, error) {
+	res, err := resolveUser(ctx, db, label, userID, favoriteCap)
+	if err != nil {
+		return profile{}, err
+	}
+	return buildProfile(ctx, db, userID, weighting, favoriteCap, res)
+}
+
+// resolveUser returns what a user's profile is built from.
+func resolveUser(ctx context.Context, db *sql.DB, label string, userID, favoriteCap int) (resolution, error) {
+	return share(ctx, newResolutionKey(ctx, userID, favoriteCap), func() (resolution, error) {
+		return computeResolution(ctx, db, label, userID, favoriteCap)
+	})
+}
+
+// buildProfile returns a user's subject profile from their resolution.
+func buildProfile(ctx context.Context, db *sql.DB, userID int, weighting services.Weighting, favoriteCap int, res resolution) (profile, error) {
+	counts, err := share(ctx, countsKey(newResolutionKey(ctx, userID, favoriteCap)), func() (subjectCounts, error) {
+		return computeSubjectCounts(ctx, db, userID, favoriteCap, res)
+	})
+	if err != nil {
+		return profile{}, err
+	}
+	return profile{
+		Weights:      counts.Result.Profile(weighting),
+		ComputedAt:   counts.ComputedAt,
+		Warnings:     res.Warnings,
+		AuthorCounts: services.AuthorCountProfile(counts.Result.Aggregate),
+		Authors:      counts.Result.Authors,
+		WorkCounts:   services.AuthorCountProfile(counts.Result.WorkCount),
+	}, nil
+}
+
+// isRequestError reports whether err came from the limits of the request
+// computing a result, its context or upstream call budget, rather than from
+// the result itself.
+func isRequestError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, budget.ErrExceeded) || errors.Is(err, budget.ErrDeadline)
+}
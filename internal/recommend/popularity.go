@@ -0,0 +1,81 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+func init() { Register(popularityRecommender{}) }
+
+// popularityRecommender is a fallback that recommends from the subject most
+// popular across all stored profiles. It prefers subjects either user already
+// reads, so it still produces something when the pair shares no subject.
+type popularityRecommender struct{}
+
+func (popularityRecommender) Name() string { return "popularity" }
+
+func (popularityRecommender) Pipeline() Pipeline {
+	return DefaultPipeline(NewStage(StageSelectSubject, selectPopularSubject))
+}
+
+// selectPopularSubject selects the most popular subject, preferring those
+// the pair reads.
+func selectPopularSubject(ctx context.Context, s *State) error {
+	profiles, err := database.GetUserProfiles(s.DB, s.Request.OrgID)
+	if err != nil {
+		return fmt.Errorf("error loading user profiles: %v", err)
+	}
+	profiles = filterProfiles(profiles, s.Books.Audience)
+
+	// Combine the profiles in user order, so the sums do not depend on map order
+	userIDs := make([]int, 0, len(profiles))
+	for userID := range profiles {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+	var all []models.SubjectProfile
+	for _, userID := range userIDs {
+		all = append(all, profiles[userID])
+	}
+	popularity := services.CombineProfiles(all...)
+	pairProfile := services.CombineProfiles(s.User1Subjects, s.User2Subjects)
+
+	subject := mostPopular(popularity, pairProfile)
+	if subject == "" {
+		// Neither user reads anything popular; take the overall favorite
+		subject = mostPopular(popularity, nil)
+	}
+	if subject == "" {
+		return &NoMatchError{Reason: "No popular subjects found", Diagnostics: diagnoseNoMatch(ctx, s)}
+	}
+	log.Printf("Popular subject: %s", subject)
+	s.Subjects = []models.Subject{{Key: subject}}
+	return nil
+}
+
+// mostPopular returns the subject with the highest popularity, restricted to
+// subjects in filter when filter is non-nil. Ties break alphabetically.
+func mostPopular(popularity, filter models.SubjectProfile) string {
+	var (
+		best      string
+		bestCount float64
+	)
+	for subject, count := range popularity {
+		if filter != nil {
+			if _, ok := filter[subject]; !ok {
+				continue
+			}
+		}
+		if count > bestCount || (count == bestCount && subject < best) {
+			best = subject
+			bestCount = count
+		}
+	}
+	return best
+}
@@ -0,0 +1,80 @@
+package recommend
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/services"
+)
+
+// NoMatchError means the users' tastes gave the strategy nothing to recommend
+// from, as opposed to an operational failure.
+type NoMatchError struct {
+	Reason string
+	// Diagnostics explain the outcome when the pair or group shares no subject.
+	Diagnostics *Diagnostics
+}
+
+func (e *NoMatchError) Error() string { return e.Reason }
+
+// Recommender is a recommendation algorithm.
+type Recommender interface {
+	// Name is the identifier clients pass as the strategy parameter.
+	Name() string
+	// Pipeline returns the stages computing the strategy's recommendations,
+	// usually DefaultPipeline with the strategy's way of selecting subjects.
+	Pipeline() Pipeline
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Recommender)
+)
+
+// Register makes a strategy selectable by name. Registering a name twice replaces the earlier strategy.
+// The name must be listed in config.Strategies, so it can be configured as the default.
+func Register(r Recommender) {
+	if !slices.Contains(config.Strategies, r.Name()) {
+		panic(fmt.Sprintf("recommend: strategy %q is missing from config.Strategies", r.Name()))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	registry[r.Name()] = r
+}
+
+// Get returns the strategy registered under name.
+func Get(name string) (Recommender, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Names returns the registered strategy names in sorted order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// filterProfiles restricts stored profiles to the subjects suiting an audience,
+// so strategies learning from other users respect it too.
+func filterProfiles(profiles map[int]models.SubjectProfile, audience services.Audience) map[int]models.SubjectProfile {
+	if audience == "" {
+		return profiles
+	}
+	filtered := make(map[int]models.SubjectProfile, len(profiles))
+	for userID, profile := range profiles {
+		filtered[userID] = audience.FilterProfile(profile)
+	}
+	return filtered
+}
@@ -0,0 +1,131 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/providers"
+	"be-takehome-2024/internal/services"
+)
+
+// openLibraryServer serves two authors sharing the subject "Fantasy", with
+// one recent, described work each, in Open Library's formats.
+func openLibraryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	work := func(key, title, author string) map[string]interface{} {
+		return map[string]interface{}{
+			"key": "/works/" + key, "title": title, "authors": []map[string]string{{"name": author}},
+			"first_publish_year": clock.Now().Year() - 1, "edition_count": 10, "subject": []string{"Fantasy"},
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body interface{}
+		switch path := r.URL.Path; {
+		case path == "/search/authors.json" && r.URL.Query().Get("q") == "Ursula K. Le Guin":
+			body = map[string]interface{}{"docs": []map[string]interface{}{{"key": "OL26320A", "name": "Ursula K. Le Guin", "work_count": 1}}}
+		case path == "/search/authors.json" && r.URL.Query().Get("q") == "Terry Pratchett":
+			body = map[string]interface{}{"docs": []map[string]interface{}{{"key": "OL25712A", "name": "Terry Pratchett", "work_count": 1}}}
+		case path == "/authors/OL26320A/works.json":
+			body = map[string]interface{}{"entries": []map[string]interface{}{{"key": "/works/OL59863W", "title": "A Wizard of Earthsea", "subjects": []string{"Fantasy"}}}}
+		case path == "/authors/OL25712A/works.json":
+			body = map[string]interface{}{"entries": []map[string]interface{}{{"key": "/works/OL453936W", "title": "Mort", "subjects": []string{"Fantasy"}}}}
+		case strings.HasPrefix(path, "/subjects/"):
+			body = map[string]interface{}{"works": []map[string]interface{}{
+				work("OL59863W", "A Wizard of Earthsea", "Ursula K. Le Guin"),
+				work("OL453936W", "Mort", "Terry Pratchett"),
+			}}
+		case strings.HasSuffix(path, "/editions.json"):
+			body = map[string]interface{}{"entries": []interface{}{}}
+		case strings.HasPrefix(path, "/works/"):
+			body = map[string]interface{}{"description": "A young wizard learns the true names of things."}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// useOpenLibrary makes the book provider, until the test ends, Open Library
+// at the server through the books client, so faults set by
+// httpclient.InjectFaults reach it, falling back to the same server through
+// a client that injects none.
+func useOpenLibrary(t *testing.T, server *httptest.Server) {
+	t.Helper()
+	client, books, err := httpclient.New(&config.Config{OutboundIdleConnsPerHost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := providers.NewOpenLibraryProvider(books, server.URL, server.URL)
+	secondary := providers.NewOpenLibraryProvider(client, server.URL, server.URL)
+	previousProvider, previousOpenLibrary := services.Provider, services.OpenLibrary
+	services.Provider = providers.NewFallbackProvider(primary, secondary)
+	services.OpenLibrary = primary
+	t.Cleanup(func() {
+		services.Provider, services.OpenLibrary = previousProvider, previousOpenLibrary
+		cache.FlushAll()
+	})
+	cache.FlushAll()
+}
+
+var resilienceRequest = PairRequest{Strategy: "subject-intersection", FavoriteCap: 10, Books: services.BookOptions{Count: 2}}
+
+var resilienceAuthors = [2][]string{{"Ursula K. Le Guin"}, {"Terry Pratchett"}}
+
+func TestRecommendAdhocThroughInjectedFaults(t *testing.T) {
+	server := openLibraryServer(t)
+	for name, faults := range map[string]httpclient.Faults{
+		"server errors":  {ServerErrorRate: 1},
+		"rate limit":     {RateLimitRate: 1},
+		"malformed JSON": {MalformedRate: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			useOpenLibrary(t, server)
+			defer httpclient.InjectFaults(faults)()
+
+			pair, err := RecommendAdhoc(context.Background(), nil, resilienceRequest, resilienceAuthors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pair.Subject != "fantasy" || len(pair.Books) != 2 || pair.Partial {
+				t.Errorf("recommendation = %q with %d books (partial %v), want the whole one for fantasy from the fallback",
+					pair.Subject, len(pair.Books), pair.Partial)
+			}
+		})
+	}
+}
+
+func TestRecommendAdhocPartialWhenCutOff(t *testing.T) {
+	useOpenLibrary(t, openLibraryServer(t))
+	// Warm the caches, then leave the candidates out of them
+	if _, err := RecommendAdhoc(context.Background(), nil, resilienceRequest, resilienceAuthors); err != nil {
+		t.Fatal(err)
+	}
+	subjectWorks, _ := cache.Lookup("subject_works")
+	subjectWorks.Flush()
+
+	defer httpclient.InjectFaults(httpclient.Faults{Latency: time.Minute, LatencyRate: 1})()
+	calls := budget.New(100)
+	calls.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	pair, err := RecommendAdhoc(budget.WithBudget(context.Background(), calls), nil, resilienceRequest, resilienceAuthors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Subject != "fantasy" || len(pair.Books) != 0 || !pair.Partial {
+		t.Errorf("recommendation = %q with %d books (partial %v), want a partial one for fantasy without books",
+			pair.Subject, len(pair.Books), pair.Partial)
+	}
+}
@@ -0,0 +1,138 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/webhooks"
+)
+
+// refreshTimeout bounds the recomputation of a single pair by the refresher.
+const refreshTimeout = 30 * time.Second
+
+// params encodes the request as the key its stored result is kept under.
+func (req PairRequest) params() (string, error) {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("error encoding pair request: %v", err)
+	}
+	return string(encoded), nil
+}
+
+// LoadPair returns the stored result for the request if it was computed
+// within maxAge, or nil otherwise. Serving a stored result keeps the pair in
+// the background refresh set.
+func LoadPair(db *sql.DB, req PairRequest, maxAge time.Duration) (*PairResult, error) {
+	params, err := req.params()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := database.GetPairRecommendation(db, req.User1ID, req.User2ID, params)
+	if err != nil || stored == nil || clock.Since(stored.ComputedAt) >= maxAge {
+		return nil, err
+	}
+
+	var result PairResult
+	if err := json.Unmarshal([]byte(stored.Result), &result); err != nil {
+		return nil, fmt.Errorf("error decoding stored recommendation: %v", err)
+	}
+	if err := database.MarkPairRequested(db, req.User1ID, req.User2ID, params); err != nil {
+		log.Printf("Error marking pair %d/%d requested: %v", req.User1ID, req.User2ID, err)
+	}
+	return &result, nil
+}
+
+// SavePair stores a computed result so later requests and the refresher can use it.
+func SavePair(db *sql.DB, req PairRequest, result PairResult) error {
+	params, err := req.params()
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding recommendation: %v", err)
+	}
+	return database.SavePairRecommendation(db, req.User1ID, req.User2ID, params, string(encoded))
+}
+
+// RefreshPairs recomputes and stores the recommendations of every pair
+// requested within the window, notifying webhooks of pairs whose
+// recommendations changed. Failures are logged and the previous result kept;
+// the error returned counts them.
+func RefreshPairs(ctx context.Context, window time.Duration) error {
+	db, err := database.Open()
+	if err != nil {
+		return fmt.Errorf("pair refresh skipped: %v", err)
+	}
+	defer db.Close()
+
+	pairs, err := database.GetRecentlyRequestedPairs(db, clock.Now().Add(-window))
+	if err != nil {
+		return fmt.Errorf("pair refresh skipped: %v", err)
+	}
+
+	// Compute each user's profile once, however many of the pairs they are in
+	ctx = WithPlanner(ctx, NewPlanner())
+
+	start := time.Now()
+	refreshed := 0
+	for _, pair := range pairs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var req PairRequest
+		if err := json.Unmarshal([]byte(pair.Params), &req); err != nil {
+			log.Printf("Pair refresh: error decoding request for %d/%d: %v", pair.User1ID, pair.User2ID, err)
+			continue
+		}
+
+		pairCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		result, err := RecommendPair(pairCtx, db, req)
+		cancel()
+		if err != nil {
+			log.Printf("Pair refresh: error recommending for %d/%d: %v", req.User1ID, req.User2ID, err)
+			continue
+		}
+		if err := SavePair(db, req, result); err != nil {
+			log.Printf("Pair refresh: error storing recommendation for %d/%d: %v", req.User1ID, req.User2ID, err)
+			continue
+		}
+		refreshed++
+
+		var previous PairResult
+		if err := json.Unmarshal([]byte(pair.Result), &previous); err != nil || changed(previous.Recommendation, result.Recommendation) {
+			webhooks.Publish(db, webhooks.EventRecommendationsUpdated, req.User1ID, req.User2ID, map[string]interface{}{
+				"strategy":        req.Strategy,
+				"subject":         result.Subject,
+				"recommendations": result.Books,
+				"as_of":           result.AsOf,
+			})
+		}
+	}
+	log.Printf("Refreshed %d of %d pair recommendations in %v", refreshed, len(pairs), time.Since(start))
+	if refreshed < len(pairs) {
+		return fmt.Errorf("%d of %d pair recommendations failed to refresh", len(pairs)-refreshed, len(pairs))
+	}
+	return nil
+}
+
+// changed reports whether a recommendation picks a different subject or books.
+func changed(before, after models.Recommendation) bool {
+	if before.Subject != after.Subject || len(before.Books) != len(after.Books) {
+		return true
+	}
+	for i := range before.Books {
+		if before.Books[i].Title != after.Books[i].Title {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/services"
+	"be-takehome-2024/internal/webhooks"
+)
+
+// Cadences maps each subscription cadence to the time between deliveries.
+var Cadences = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// subscriptionRetryDelay is how long a subscription whose run failed first
+// waits before it is tried again. The wait doubles with each further
+// failure, up to the subscription's cadence.
+const subscriptionRetryDelay = 30 * time.Minute
+
+// RunDueSubscriptions computes fresh recommendations for every active
+// subscription that is due and delivers them to its URL, then schedules its
+// next delivery a cadence later. A subscription whose recommendation or
+// delivery fails is retried with backoff instead of waiting a whole
+// cadence; the error returned counts them.
+func RunDueSubscriptions(ctx context.Context) error {
+	db, err := database.Open()
+	if err != nil {
+		return fmt.Errorf("subscription run skipped: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	subs, err := database.GetDueSubscriptions(db, now)
+	if err != nil {
+		return fmt.Errorf("subscription run skipped: %v", err)
+	}
+
+	// Compute each user's profile once, however many subscriptions they are in
+	ctx = WithPlanner(ctx, NewPlanner())
+
+	delivered := 0
+	for _, sub := range subs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		subCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		event, err := runSubscription(subCtx, db, sub)
+		cancel()
+		if err == nil {
+			// Check the URL again, in case its host now resolves elsewhere
+			err = webhooks.CheckCallbackURL(ctx, sub.URL)
+		}
+		if err == nil {
+			err = webhooks.Deliver(ctx, fmt.Sprintf("subscription %d", sub.ID), sub.URL, sub.Secret, event)
+		}
+		if err != nil {
+			delay := retryDelay(sub)
+			log.Printf("Subscription %d: %v; retrying in %v", sub.ID, err, delay)
+			if err := database.ScheduleSubscription(db, sub.ID, now.Add(delay), nil); err != nil {
+				log.Printf("Subscription %d: error rescheduling: %v", sub.ID, err)
+			}
+			continue
+		}
+		delivered++
+
+		// Keep to the original schedule rather than drifting by how late the check ran
+		next := sub.NextRunAt
+		for !next.After(now) {
+			next = next.Add(Cadences[sub.Cadence])
+		}
+		if err := database.ScheduleSubscription(db, sub.ID, next, &now); err != nil {
+			log.Printf("Subscription %d: error scheduling next run: %v", sub.ID, err)
+		}
+	}
+	if len(subs) > 0 {
+		log.Printf("Delivered %d of %d due subscriptions", delivered, len(subs))
+	}
+	if delivered < len(subs) {
+		return fmt.Errorf("%d of %d due subscriptions failed to deliver", len(subs)-delivered, len(subs))
+	}
+	return nil
+}
+
+// retryDelay returns how long a subscription waits after its latest failure.
+func retryDelay(sub database.Subscription) time.Duration {
+	delay := subscriptionRetryDelay
+	for range sub.Failures {
+		if delay >= Cadences[sub.Cadence] {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, max(Cadences[sub.Cadence], subscriptionRetryDelay))
+}
+
+// runSubscription recommends books for the subscription's pair or group,
+// storing the result as an on-demand request would, and returns the event
+// to deliver.
+func runSubscription(ctx context.Context, db *sql.DB, sub database.Subscription) (webhooks.Event, error) {
+	if Cadences[sub.Cadence] <= 0 {
+		return webhooks.Event{}, fmt.Errorf("unknown cadence '%s'", sub.Cadence)
+	}
+	event := webhooks.Event{Type: webhooks.EventRecommendationsScheduled, SubscriptionID: sub.ID}
+	favoriteCap := config.Get().FavoriteAuthorsCap
+
+	if sub.GroupID != 0 {
+		group, err := database.GetGroup(db, sub.OrgID, sub.GroupID)
+		if err != nil {
+			return webhooks.Event{}, fmt.Errorf("error loading group %d: %v", sub.GroupID, err)
+		}
+		if len(group.MemberIDs) < 2 {
+			return webhooks.Event{}, fmt.Errorf("group %d has fewer than two members", group.ID)
+		}
+		result, err := RecommendGroup(ctx, db, GroupRequest{
+			OrgID:       sub.OrgID,
+			GroupID:     group.ID,
+			MemberIDs:   group.MemberIDs,
+			Weighting:   services.WeightingAuthors,
+			Books:       services.BookOptions{Count: services.DefaultBookCount},
+			TopSubjects: 1,
+			Scoring:     services.ScoringSum,
+			FavoriteCap: favoriteCap,
+		})
+		if err != nil {
+			return webhooks.Event{}, err
+		}
+		if err := SaveGroup(db, group.ID, result); err != nil {
+			log.Printf("Subscription %d: error storing recommendation for group %d: %v", sub.ID, group.ID, err)
+		}
+		event.GroupID = group.ID
+		event.Data = map[string]interface{}{
+			"cadence":         sub.Cadence,
+			"subject":         result.Subject,
+			"subjects":        result.Subjects,
+			"recommendations": result.Books,
+			"as_of":           result.AsOf,
+		}
+		return event, nil
+	}
+
+	req := PairRequest{
+		OrgID:       sub.OrgID,
+		User1ID:     sub.User1ID,
+		User2ID:     sub.User2ID,
+		Strategy:    config.Get().DefaultStrategy,
+		Weighting:   services.WeightingAuthors,
+		Books:       services.BookOptions{Count: services.DefaultBookCount},
+		TopSubjects: 1,
+		Scoring:     services.ScoringSum,
+		FavoriteCap: favoriteCap,
+	}
+	result, err := RecommendPair(ctx, db, req)
+	if err != nil {
+		return webhooks.Event{}, err
+	}
+	if err := SavePair(db, req, result); err != nil {
+		log.Printf("Subscription %d: error storing recommendation for %d/%d: %v", sub.ID, req.User1ID, req.User2ID, err)
+	}
+	event.User1ID, event.User2ID = req.User1ID, req.User2ID
+	event.Data = map[string]interface{}{
+		"cadence":         sub.Cadence,
+		"strategy":        req.Strategy,
+		"subject":         result.Subject,
+		"recommendations": result.Books,
+		"as_of":           result.AsOf,
+	}
+	return event, nil
+}
@@ -0,0 +1,77 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/queue"
+)
+
+// TaskPair is the queue task kind computing a pair's recommendation in the
+// background, for clients that would rather poll than wait.
+const TaskPair = "recommendations.pair"
+
+// PairTask is the payload of a pair recommendation task.
+type PairTask struct {
+	Request PairRequest `json:"request"`
+	// Experiment and Variant are the pair's experiment assignment, if any,
+	// recorded in its history.
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+}
+
+func init() {
+	queue.Handle(TaskPair, queue.Options{MaxAttempts: 3, Backoff: 5 * time.Second, Timeout: time.Minute}, runPairTask)
+}
+
+// runPairTask computes, stores, and records a pair's recommendation,
+// returning it as the task's result. Pairs with nothing in common fail
+// without retries.
+func runPairTask(ctx context.Context, task queue.Task) (interface{}, error) {
+	var p PairTask
+	if err := json.Unmarshal(task.Payload, &p); err != nil {
+		return nil, queue.Permanent(fmt.Errorf("error decoding pair task: %v", err))
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx = budget.WithBudget(ctx, budget.New(config.Get().UpstreamCallBudget))
+	result, err := RecommendPair(ctx, db, p.Request)
+	var noMatch *NoMatchError
+	if errors.As(err, &noMatch) {
+		return nil, queue.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := SavePair(db, p.Request, result); err != nil {
+		return nil, fmt.Errorf("error storing recommendation: %v", err)
+	}
+	// The recommendation is stored, so a retry would only repeat the work
+	err = database.RecordRecommendation(db, database.HistoryEntry{
+		User1ID:         p.Request.User1ID,
+		User2ID:         p.Request.User2ID,
+		OrgID:           p.Request.OrgID,
+		Strategy:        p.Request.Strategy,
+		Subject:         result.Subject,
+		Recommendations: result.Books,
+		Experiment:      p.Experiment,
+		Variant:         p.Variant,
+	})
+	if err != nil {
+		log.Printf("Error recording recommendation history: %v", err)
+	}
+	return result, nil
+}
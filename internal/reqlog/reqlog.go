@@ -0,0 +1,144 @@
+// Package reqlog collects the details of a single request for verbose
+// logging: its stage timings, chosen subject, author resolution outcomes, and
+// upstream calls. The record travels in the request context, like the budget
+// and timings, and is written out only for sampled or slow requests.
+package reqlog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxUpstreamCalls caps the upstream calls kept in a record; the rest are
+// only counted.
+const maxUpstreamCalls = 100
+
+// Author resolution outcomes.
+const (
+	AuthorStored   = "stored"    // A fresh stored resolution was used
+	AuthorResolved = "resolved"  // Searched for and found
+	AuthorNotFound = "not_found" // Searched for and not found
+	AuthorFailed   = "failed"    // The search failed
+)
+
+// AuthorOutcome is how one favorite author of a user was resolved.
+type AuthorOutcome struct {
+	UserID  int    `json:"user_id"`
+	Name    string `json:"name"`
+	Outcome string `json:"outcome"`
+	Key     string `json:"key,omitempty"`
+}
+
+// UpstreamCall is one outbound request and its result.
+type UpstreamCall struct {
+	Method     string  `json:"method"`
+	URL        string  `json:"url"`
+	Status     int     `json:"status,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Record holds the details of one request. A nil *Record records nothing,
+// so callers need not check for one.
+type Record struct {
+	mu           sync.Mutex
+	subject      string
+	stages       map[string]float64
+	authors      []AuthorOutcome
+	calls        []UpstreamCall
+	droppedCalls int
+}
+
+// New returns an empty record.
+func New() *Record {
+	return &Record{}
+}
+
+type contextKey struct{}
+
+// WithRecord returns a context recording request details in rec.
+func WithRecord(ctx context.Context, rec *Record) context.Context {
+	return context.WithValue(ctx, contextKey{}, rec)
+}
+
+// FromContext returns the record of a context, or nil if it has none.
+func FromContext(ctx context.Context) *Record {
+	rec, _ := ctx.Value(contextKey{}).(*Record)
+	return rec
+}
+
+// SetSubject records the subject the response was chosen from.
+func (r *Record) SetSubject(subject string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subject = subject
+}
+
+// SetStages records the duration of each stage in milliseconds.
+func (r *Record) SetStages(stages map[string]float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages = stages
+}
+
+// Author records how a user's favorite author was resolved.
+func (r *Record) Author(userID int, name, outcome, key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authors = append(r.authors, AuthorOutcome{UserID: userID, Name: name, Outcome: outcome, Key: key})
+}
+
+// Upstream records an outbound request. A status of zero means no response
+// was received.
+func (r *Record) Upstream(method, url string, status int, duration time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) >= maxUpstreamCalls {
+		r.droppedCalls++
+		return
+	}
+	call := UpstreamCall{Method: method, URL: url, Status: status, DurationMS: float64(duration.Microseconds()) / 1000}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	r.calls = append(r.calls, call)
+}
+
+// Details is a record's contents, ready to be encoded.
+type Details struct {
+	Subject       string             `json:"subject,omitempty"`
+	StagesMS      map[string]float64 `json:"stages_ms,omitempty"`
+	Authors       []AuthorOutcome    `json:"authors,omitempty"`
+	UpstreamCalls []UpstreamCall     `json:"upstream_calls,omitempty"`
+	// UpstreamCallsDropped counts calls beyond those listed.
+	UpstreamCallsDropped int `json:"upstream_calls_dropped,omitempty"`
+}
+
+// Details returns a copy of what the record holds.
+func (r *Record) Details() Details {
+	if r == nil {
+		return Details{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Details{
+		Subject:              r.subject,
+		StagesMS:             r.stages,
+		Authors:              append([]AuthorOutcome(nil), r.authors...),
+		UpstreamCalls:        append([]UpstreamCall(nil), r.calls...),
+		UpstreamCallsDropped: r.droppedCalls,
+	}
+}
@@ -0,0 +1,138 @@
+// Package sanitize cleans text from upstream services before it reaches
+// clients, so a pathological payload can't carry control characters into
+// responses or bloat them with an endless description.
+package sanitize
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TruncationMarker ends text cut short by Truncate.
+const TruncationMarker = "…"
+
+// Text returns s as valid UTF-8 without control characters, other than line
+// breaks and tabs, or bidirectional formatting characters, which can make
+// text display differently from what it holds.
+func Text(s string) string {
+	clean := func(r rune) bool {
+		return r != '\n' && r != '\t' && (unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r))
+	}
+	if utf8.ValidString(s) && strings.IndexFunc(s, clean) < 0 {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if clean(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(s, ""))
+}
+
+// Truncate returns s cut to at most max characters, marker included, ending
+// at a word boundary when there is one near the cut. Zero means no limit.
+func Truncate(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	keep := max - utf8.RuneCountInString(TruncationMarker)
+	if keep <= 0 {
+		return TruncationMarker
+	}
+	cut := s
+	for i := range s {
+		if keep == 0 {
+			cut = s[:i]
+			break
+		}
+		keep--
+	}
+	// Back up to the last word boundary in the final fifth of the text kept
+	if space := strings.LastIndexAny(cut, " \n\t"); space > len(cut)*4/5 {
+		cut = cut[:space]
+	}
+	return strings.TrimRight(cut, " \n\t,;:") + TruncationMarker
+}
+
+var (
+	// htmlBreak matches HTML elements that end a line or paragraph.
+	htmlBreak = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li)\s*/?>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+	// markdownRef matches markdown reference definitions, e.g. "[1]: https://…".
+	markdownRef  = regexp.MustCompile(`(?m)^\s*\[[^\]]+\]:\s*\S+.*$`)
+	markdownLink = regexp.MustCompile(`\[([^\]]*)\](?:\([^)]*\)|\[[^\]]*\])`)
+	emphasis     = regexp.MustCompile(`\*\*|__`)
+	// sourceNote matches attributions left by markdown links, e.g. "(source)".
+	sourceNote = regexp.MustCompile(`(?i)[ \t]*\(\s*(source|from [^)]*)\s*\)`)
+	// boilerplate matches the rule or heading starting the list of contents
+	// or other editions Open Library appends to descriptions.
+	boilerplate = regexp.MustCompile(`(?im)^\s*(-{3,}|\*{3,}|(also )?contain(s|ed in):)`)
+	spaces      = regexp.MustCompile(`[ \t]+`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// Description returns a book description as plain text: HTML and markdown
+// markup removed, appended lists of contents and other boilerplate cut off,
+// and whitespace collapsed, keeping paragraph breaks.
+func Description(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+	s = markdownRef.ReplaceAllString(s, "")
+	s = markdownLink.ReplaceAllString(s, "$1")
+	s = emphasis.ReplaceAllString(s, "")
+	s = sourceNote.ReplaceAllString(s, "")
+	if loc := boilerplate.FindStringIndex(s); loc != nil {
+		s = s[:loc[0]]
+	}
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaces.ReplaceAllString(line, " "))
+	}
+	s = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// abbreviations end with a period without ending a sentence.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "st": true, "jr": true,
+	"sr": true, "vs": true, "etc": true, "vol": true, "no": true,
+}
+
+// FirstSentences returns the first n sentences of s, or all of it when it
+// has no more. Zero means all of it.
+func FirstSentences(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != '.' && c != '!' && c != '?' {
+			continue
+		}
+		end := i + 1
+		// Closing quotes and brackets belong to the sentence
+		for end < len(s) && strings.ContainsRune(`"')]`, rune(s[end])) {
+			end++
+		}
+		if strings.HasPrefix(s[end:], "”") || strings.HasPrefix(s[end:], "’") {
+			end += len("”")
+		}
+		if end < len(s) && s[end] != ' ' && s[end] != '\n' {
+			continue
+		}
+		if s[i] == '.' {
+			words := strings.Fields(s[:i])
+			if len(words) > 0 && (abbreviations[strings.ToLower(words[len(words)-1])] || len(words[len(words)-1]) == 1) {
+				continue // An abbreviation or initial, as in "Ursula K. Le Guin"
+			}
+		}
+		if n--; n == 0 {
+			return s[:end]
+		}
+	}
+	return s
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is when a job runs: a standard five-field cron expression, a
+// shorthand such as "@daily", or "@every <duration>". Cron expressions are
+// evaluated in UTC.
+type Schedule struct {
+	spec string
+	// every is the fixed period of an "@every" schedule, or zero for cron.
+	every time.Duration
+	// Bit sets of the allowed minutes, hours, days of the month, months, and
+	// days of the week.
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a day field starting with "*", such as "*" or
+	// "*/2"; as in cron, when neither does a day matching either runs the job.
+	domAny, dowAny bool
+}
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Parse parses a schedule. Cron fields are minute, hour, day of month,
+// month, and day of week, each a "*", a value, a range "a-b", or a list of
+// these, optionally stepped with "/n". Months and days of the week may be
+// given by their three-letter English names, and Sunday as 0 or 7.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid schedule '%s': @every needs a duration of at least 1s", spec)
+		}
+		return &Schedule{spec: spec, every: d}, nil
+	}
+	expr := spec
+	if full, ok := shorthands[spec]; ok {
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule '%s': want 5 fields, got %d", spec, len(fields))
+	}
+	s := &Schedule{spec: spec, domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*")}
+	var err error
+	// last is where "*" and "a/n" end: Saturday for the days of the week,
+	// whose 7 only names Sunday again
+	parsers := []struct {
+		field          string
+		min, max, last int
+		names          map[string]int
+		set            *uint64
+	}{
+		{fields[0], 0, 59, 59, nil, &s.minute},
+		{fields[1], 0, 23, 23, nil, &s.hour},
+		{fields[2], 1, 31, 31, nil, &s.dom},
+		{fields[3], 1, 12, 12, monthNames, &s.month},
+		{fields[4], 0, 7, 6, dayNames, &s.dow},
+	}
+	for _, p := range parsers {
+		if *p.set, err = parseField(p.field, p.min, p.max, p.last, p.names); err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %v", spec, err)
+		}
+	}
+	// Sunday may be written as 7
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parseField parses one comma-separated cron field of values from min to max
+// into a bit set, "*" and "a/n" running up to last.
+func parseField(field string, min, max, last int, names map[string]int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+			step = n
+		}
+
+		lo, hi := min, last
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = fieldValue(from, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = fieldValue(to, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if stepped {
+				// "a/n" runs from a to the end of the range
+				hi = last
+				if lo > last {
+					hi = lo
+				}
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range '%s'", rangePart)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func fieldValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("'%s' is not a value from %d to %d", s, min, max)
+	}
+	return v, nil
+}
+
+// String returns the schedule as it was written.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t the schedule runs.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// A schedule runs at least once every few years unless it names a day
+	// that never exists, such as February 30
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Monday
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want []time.Time
+	}{
+		{"30 6 * * *", []time.Time{
+			time.Date(2024, time.January, 1, 6, 30, 0, 0, time.UTC),
+			time.Date(2024, time.January, 2, 6, 30, 0, 0, time.UTC),
+		}},
+		// Odd days of the month
+		{"0 0 */2 * *", []time.Time{
+			time.Date(2024, time.January, 3, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+		}},
+		// A stepped day field starting with "*" is not a restriction to
+		// match either way: odd days that are also Fridays
+		{"0 0 */2 * fri", []time.Time{
+			time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 19, 0, 0, 0, 0, time.UTC),
+		}},
+		// Sunday, Tuesday, Thursday, and Saturday
+		{"0 0 * * */2", []time.Time{
+			time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 6, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC),
+		}},
+		// Monday, Wednesday, and Friday, not Sunday as 7
+		{"0 0 * * 1/2", []time.Time{
+			time.Date(2024, time.January, 3, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 8, 0, 0, 0, 0, time.UTC),
+		}},
+		// Both day fields restricted: the 15th or any Sunday
+		{"0 0 15 * 7", []time.Time{
+			time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@every 90m", []time.Time{
+			time.Date(2024, time.January, 1, 1, 30, 0, 0, time.UTC),
+			time.Date(2024, time.January, 1, 3, 0, 0, 0, time.UTC),
+		}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		next := from
+		for _, want := range tt.want {
+			if next = s.Next(next); !next.Equal(want) {
+				t.Errorf("%q: got %v, want %v", tt.spec, next, want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@every 10ms"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
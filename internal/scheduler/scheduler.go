@@ -0,0 +1,170 @@
+// Package scheduler runs the background jobs, such as the pair refresh and
+// the retention purge, on cron schedules. Jobs are registered by name at
+// startup and report the outcome of their last run for the admin API. Each
+// run is delayed by a random jitter, so instances sharing a schedule do not
+// all hit the upstreams at once.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/random"
+)
+
+// maxJitterShare caps a run's jitter at this share of the time between
+// runs, so frequent jobs are not delayed by most of their period.
+const maxJitterShare = 10
+
+// Status is a job's schedule and the outcome of its last run.
+type Status struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Enabled  bool   `json:"enabled"`
+	Running  bool   `json:"running"`
+	// NextRunAt is when the job next runs, before jitter; it is nil for
+	// disabled jobs.
+	NextRunAt      *time.Time `json:"next_run_at"`
+	LastStartedAt  *time.Time `json:"last_started_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	LastDurationMS float64    `json:"last_duration_ms"`
+	// LastError is the error of the last run, or empty if it succeeded.
+	LastError string `json:"last_error,omitempty"`
+	Runs      int    `json:"runs"`
+	Failures  int    `json:"failures"`
+}
+
+type job struct {
+	schedule *Schedule
+	run      func(context.Context) error
+
+	mu     sync.Mutex
+	status Status
+}
+
+var (
+	mu      sync.Mutex
+	jobs    = make(map[string]*job)
+	jitter  time.Duration
+	started bool
+)
+
+// Register adds a job running on schedule. A disabled job is listed with its
+// status but never run. It fails on an invalid schedule, one that never runs,
+// or a duplicate name.
+func Register(name, schedule string, enabled bool, run func(context.Context) error) error {
+	s, err := Parse(schedule)
+	if err != nil {
+		return err
+	}
+	if s.Next(time.Now()).IsZero() {
+		return fmt.Errorf("schedule '%s' of job %s never runs", schedule, name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := jobs[name]; ok {
+		return fmt.Errorf("job %s is already registered", name)
+	}
+	jobs[name] = &job{schedule: s, run: run, status: Status{Name: name, Schedule: s.String(), Enabled: enabled}}
+	return nil
+}
+
+// SetJitter sets the longest random delay added to each run.
+func SetJitter(d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	jitter = d
+}
+
+// Start runs every enabled job on its schedule until ctx is cancelled. Jobs
+// registered afterwards are not started.
+func Start(ctx context.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+	if started {
+		return
+	}
+	started = true
+	for _, j := range jobs {
+		if j.status.Enabled {
+			go j.loop(ctx, jitter)
+		}
+	}
+}
+
+// loop runs the job at each scheduled time. A run still going when the next
+// is due makes that one skipped rather than overlapped.
+func (j *job) loop(ctx context.Context, maxJitter time.Duration) {
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		j.mu.Lock()
+		j.status.NextRunAt = &next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next) + j.jitter(next, maxJitter))
+		select {
+		case <-timer.C:
+			j.runOnce(ctx)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// jitter returns a random delay of up to maxJitter, and at most a tenth of
+// the time from next to the run after it.
+func (j *job) jitter(next time.Time, maxJitter time.Duration) time.Duration {
+	if period := j.schedule.Next(next).Sub(next); period > 0 {
+		maxJitter = min(maxJitter, period/maxJitterShare)
+	}
+	if maxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(random.Int64N(int64(maxJitter)))
+}
+
+func (j *job) runOnce(ctx context.Context) {
+	start := time.Now().UTC()
+	j.mu.Lock()
+	j.status.Running = true
+	j.status.LastStartedAt = &start
+	j.mu.Unlock()
+
+	err := j.run(ctx)
+
+	finish := time.Now().UTC()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Running = false
+	j.status.LastFinishedAt = &finish
+	j.status.LastDurationMS = float64(finish.Sub(start).Microseconds()) / 1000
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		log.Printf("Job %s failed: %v", j.status.Name, err)
+	}
+}
+
+// Jobs returns the status of every registered job, by name.
+func Jobs() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+	statuses := make([]Status, 0, len(jobs))
+	for _, j := range jobs {
+		j.mu.Lock()
+		statuses = append(statuses, j.status)
+		j.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"strings"
+
+	"be-takehome-2024/internal/models"
+)
+
+// Audience is the readership a book or subject is written for.
+type Audience string
+
+const (
+	AudienceChildren   Audience = "children"
+	AudienceYoungAdult Audience = "young_adult"
+	AudienceAdult      Audience = "adult"
+)
+
+// Substrings of Open Library subject facets that mark the audience they are
+// written for. Subjects matching none of them are general.
+var (
+	childrenSubjectHints   = []string{"juvenile", "children", "picture book", "stories in rhyme", "board book"}
+	youngAdultSubjectHints = []string{"young adult", "teenage", "teen fiction", "teens"}
+	// Subjects only suitable for adults, even though not marked as such
+	adultSubjectHints = []string{"adult", "erotic", "thriller", "horror", "true crime", "crime fiction", "murder", "violence"}
+)
+
+// subjectAudience classifies a subject facet, returning "" for general subjects.
+func subjectAudience(subject string) Audience {
+	subject = strings.ToLower(subject)
+	switch {
+	case containsAny(subject, childrenSubjectHints):
+		return AudienceChildren
+	case containsAny(subject, youngAdultSubjectHints):
+		return AudienceYoungAdult
+	case containsAny(subject, adultSubjectHints):
+		return AudienceAdult
+	}
+	return ""
+}
+
+// Suits reports whether a subject may be recommended to the audience. General
+// subjects suit everyone; the rest only suit their own audience, except that
+// children's subjects also suit young adults.
+func (a Audience) Suits(subject string) bool {
+	if a == "" {
+		return true
+	}
+	switch subjectAudience(subject) {
+	case "":
+		return true
+	case AudienceChildren:
+		return a == AudienceChildren || a == AudienceYoungAdult
+	case AudienceYoungAdult:
+		return a == AudienceYoungAdult
+	default:
+		return a == AudienceAdult
+	}
+}
+
+// FilterProfile returns the subject weights of the subjects suiting the
+// audience. The profile is returned as is when no audience is set.
+func (a Audience) FilterProfile(profile models.SubjectProfile) models.SubjectProfile {
+	if a == "" || profile == nil {
+		return profile
+	}
+	filtered := make(models.SubjectProfile, len(profile))
+	for subject, weight := range profile {
+		if a.Suits(subject) {
+			filtered[subject] = weight
+		}
+	}
+	return filtered
+}
+
+// workAudience classifies a work by its subjects. Works with a children's
+// subject are for children, then those with a young adult subject are for
+// young adults; everything else is for adults.
+func workAudience(work models.SubjectWork) Audience {
+	audience := AudienceAdult
+	for _, subject := range work.Subjects {
+		switch subjectAudience(subject) {
+		case AudienceChildren:
+			return AudienceChildren
+		case AudienceYoungAdult:
+			audience = AudienceYoungAdult
+		}
+	}
+	return audience
+}
+
+// suitsWork reports whether a work may be recommended to the audience.
+func (a Audience) suitsWork(work models.SubjectWork) bool {
+	switch a {
+	case "":
+		return true
+	case AudienceChildren:
+		return workAudience(work) == AudienceChildren
+	default:
+		// A work's own subjects can still rule it out, e.g. a thriller for young adults
+		if workAudience(work) != a {
+			return false
+		}
+		for _, subject := range work.Subjects {
+			if !a.Suits(subject) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/sanitize"
+)
+
+// wikimediaUserAgent identifies the service to Wikimedia, whose API policy
+// requires a descriptive User-Agent.
+const wikimediaUserAgent = "be-takehome-2024/1.0 (book recommendations)"
+
+// Author bios rarely change, so lookups (including misses) are kept for a week.
+var authorBioCache = cache.New[models.AuthorBio]("author_bios", 7*24*time.Hour)
+
+// GetAuthorBios looks up a short bio and photo for each author concurrently.
+// Enrichment is best effort: authors that cannot be found are returned with
+// empty fields rather than failing the whole lookup.
+func GetAuthorBios(ctx context.Context, authors []string) []models.AuthorBio {
+	bios := make([]models.AuthorBio, len(authors))
+
+	var (
+		wg          sync.WaitGroup
+		concurrency = 5 // Wikimedia asks clients to keep parallelism low
+		sem         = make(chan struct{}, concurrency)
+	)
+
+	for i, name := range authors {
+		if bio, ok := authorBioCache.Get(name); ok {
+			budget.CacheHit(ctx)
+			bios[i] = bio
+			continue
+		}
+
+		// Acquire a semaphore slot, leaving the remaining bios empty once the caller gives up
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			for j := i; j < len(authors); j++ {
+				bios[j] = models.AuthorBio{Name: authors[j]}
+			}
+			wg.Wait()
+			return bios
+		}
+		wg.Add(1)
+
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }() // Release the semaphore slot
+
+			bio, err := fetchAuthorBio(ctx, name)
+			if err != nil {
+				log.Printf("Error fetching bio for author '%s': %v", redact.Name(name), err)
+				bios[i] = models.AuthorBio{Name: name}
+				return
+			}
+			authorBioCache.Set(name, bio)
+			bios[i] = bio
+		}(i, name)
+	}
+
+	wg.Wait()
+	return bios
+}
+
+// GetBookAuthorBios looks up bios for the authors of books, each once, in
+// the order they first appear.
+func GetBookAuthorBios(ctx context.Context, books []models.Work) []models.AuthorBio {
+	var authorNames []string
+	seen := make(map[string]bool)
+	for _, book := range books {
+		for _, name := range book.Authors {
+			if !seen[name] {
+				seen[name] = true
+				authorNames = append(authorNames, name)
+			}
+		}
+	}
+	return GetAuthorBios(ctx, authorNames)
+}
+
+// fetchAuthorBio resolves an author to a Wikidata entity and collects its
+// description, English Wikipedia summary, and image.
+func fetchAuthorBio(ctx context.Context, name string) (models.AuthorBio, error) {
+	bio := models.AuthorBio{Name: name}
+
+	// Find the Wikidata entity for the author
+	searchURL := "https://www.wikidata.org/w/api.php?" + url.Values{
+		"action":   {"wbsearchentities"},
+		"search":   {name},
+		"language": {"en"},
+		"type":     {"item"},
+		"limit":    {"1"},
+		"format":   {"json"},
+	}.Encode()
+	var search struct {
+		Search []struct {
+			ID string `json:"id"`
+		} `json:"search"`
+	}
+	if err := getWikimediaJSON(ctx, searchURL, &search); err != nil {
+		return bio, err
+	}
+	if len(search.Search) == 0 {
+		// Not an error: the author simply has no Wikidata entry.
+		return bio, nil
+	}
+	bio.WikidataID = search.Search[0].ID
+
+	// Fetch the entity for its description, Wikipedia link, and image
+	entityURL := fmt.Sprintf("https://www.wikidata.org/wiki/Special:EntityData/%s.json", bio.WikidataID)
+	var entityResult struct {
+		Entities map[string]struct {
+			Descriptions map[string]struct {
+				Value string `json:"value"`
+			} `json:"descriptions"`
+			Sitelinks map[string]struct {
+				Title string `json:"title"`
+			} `json:"sitelinks"`
+			Claims map[string][]struct {
+				Mainsnak struct {
+					Datavalue struct {
+						Value interface{} `json:"value"`
+					} `json:"datavalue"`
+				} `json:"mainsnak"`
+			} `json:"claims"`
+		} `json:"entities"`
+	}
+	if err := getWikimediaJSON(ctx, entityURL, &entityResult); err != nil {
+		return bio, err
+	}
+	entity, ok := entityResult.Entities[bio.WikidataID]
+	if !ok {
+		return bio, nil
+	}
+
+	if desc, ok := entity.Descriptions["en"]; ok && desc.Value != "" {
+		description := bioText(desc.Value)
+		bio.Bio = &description
+	}
+
+	// P18 is the Wikidata "image" property; its value is a Commons file name.
+	if images := entity.Claims["P18"]; len(images) > 0 {
+		if file, ok := images[0].Mainsnak.Datavalue.Value.(string); ok && file != "" {
+			photoURL := "https://commons.wikimedia.org/wiki/Special:FilePath/" + url.PathEscape(strings.ReplaceAll(file, " ", "_"))
+			bio.PhotoURL = &photoURL
+		}
+	}
+
+	// Prefer the longer Wikipedia summary over the one-line Wikidata description
+	if link, ok := entity.Sitelinks["enwiki"]; ok && link.Title != "" {
+		summaryURL := "https://en.wikipedia.org/api/rest_v1/page/summary/" + url.PathEscape(strings.ReplaceAll(link.Title, " ", "_"))
+		var summary struct {
+			Extract string `json:"extract"`
+		}
+		if err := getWikimediaJSON(ctx, summaryURL, &summary); err != nil {
+			log.Printf("Error fetching Wikipedia summary for '%s': %v", name, err)
+		} else if summary.Extract != "" {
+			extract := bioText(summary.Extract)
+			bio.Bio = &extract
+		}
+	}
+
+	return bio, nil
+}
+
+// bioText returns Wikimedia text cleaned and cut to the configured length
+// for clients.
+func bioText(text string) string {
+	return sanitize.Truncate(sanitize.Text(text), config.Get().DescriptionMaxLength)
+}
+
+func getWikimediaJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("User-Agent", wikimediaUserAgent)
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if err := httpclient.CheckStatus(resp, url); err != nil {
+		return err
+	}
+
+	return httpclient.DecodeJSON(resp.Body, v)
+}
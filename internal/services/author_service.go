@@ -2,21 +2,46 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/cache"
 	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
 )
 
-// ResolveAuthorKeys searches for authors and returns their Open Library keys concurrently.
+// An author's best search match rarely changes, so resolutions are kept for a day.
+var authorKeyCache = cache.New[models.Author]("author_keys", 24*time.Hour)
+
+// ErrNoAuthorsResolved is returned when the search found none of the given authors.
+var ErrNoAuthorsResolved = errors.New("none of the favorite authors could be found")
+
+// ResolveAuthorKeys searches for authors and returns their Open Library keys
+// concurrently. See ResolveAuthorKeysByName for the errors returned.
 func ResolveAuthorKeys(ctx context.Context, authors []string) ([]models.Author, error) {
+	resolved, err := ResolveAuthorKeysByName(ctx, authors)
+	authorKeys := make([]models.Author, 0, len(resolved))
+	for _, author := range resolved {
+		authorKeys = append(authorKeys, author)
+	}
+	return authorKeys, err
+}
+
+// ResolveAuthorKeysByName is ResolveAuthorKeys, keyed by the searched name.
+// The authors found are returned even on error, which is a *MultiError of an
+// *AuthorError per author that failed, wrapping ErrAuthorNotFound for those
+// the search did not find. It also wraps ErrNoAuthorsResolved when none of
+// the authors were found.
+func ResolveAuthorKeysByName(ctx context.Context, authors []string) (map[string]models.Author, error) {
 	var (
-		authorKeys []models.Author
+		authorKeys = make(map[string]models.Author)
+		errs       = &MultiError{}
+		notFound   int
 		mu         sync.Mutex
 		wg         sync.WaitGroup
 	)
@@ -25,12 +50,15 @@ func ResolveAuthorKeys(ctx context.Context, authors []string) ([]models.Author,
 	concurrency := 20
 	sem := make(chan struct{}, concurrency)
 
-	// Channel to collect errors from goroutines
-	errCh := make(chan error, len(authors))
-
 	for _, authorName := range authors {
+		// Acquire a semaphore slot, starting no more searches once the caller gives up
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return authorKeys, ctx.Err()
+		}
 		wg.Add(1)
-		sem <- struct{}{} // Acquire a semaphore slot
 
 		// Capture authorName
 		authorName := authorName
@@ -39,101 +67,68 @@ func ResolveAuthorKeys(ctx context.Context, authors []string) ([]models.Author,
 			defer wg.Done()
 			defer func() { <-sem }() // Release the semaphore slot
 
-			// Replace spaces with '+' for URL encoding
-			queryName := strings.ReplaceAll(authorName, " ", "+")
-
-			// Open Library Search API URL
-			searchURL := fmt.Sprintf("https://openlibrary.org/search/authors.json?q=%s", queryName)
-
-			// Create HTTP request with context
-			req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
-			if err != nil {
-				log.Printf("Error creating request for author '%s': %v", authorName, err)
-				errCh <- fmt.Errorf("Author '%s': %v", authorName, err)
-				return
-			}
-
-			// Perform the HTTP request
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				log.Printf("Error fetching data for author '%s': %v", authorName, err)
-				errCh <- fmt.Errorf("Author '%s': %v", authorName, err)
-				return
-			}
-			defer resp.Body.Close()
-
-			// Check the status code
-			if resp.StatusCode != http.StatusOK {
-				bodySnippet, _ := ioutil.ReadAll(resp.Body)
-				log.Printf("Non-OK HTTP status for author '%s': %s - %s", authorName, resp.Status, string(bodySnippet))
-				errCh <- fmt.Errorf("Author '%s': received status %s", authorName, resp.Status)
+			selectedAuthor, found, err := resolveAuthor(ctx, authorName)
+			if budget.CutShort(ctx, err) {
+				// Out of time; resolve the user from the authors found so far
+				log.Printf("Out of time resolving author '%s': %v", redact.Name(authorName), err)
 				return
 			}
-
-			// Read the response body
-			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
-				log.Printf("Error reading response for author '%s': %v", authorName, err)
-				errCh <- fmt.Errorf("Author '%s': %v", authorName, err)
-				return
-			}
-
-			// Parse the JSON response
-			var result struct {
-				Docs []struct {
-					Name      string `json:"name"`
-					Key       string `json:"key"`
-					WorkCount int    `json:"work_count"`
-				} `json:"docs"`
-			}
-			if err := json.Unmarshal(body, &result); err != nil {
-				log.Printf("Error parsing JSON for author '%s': %v", authorName, err)
-				errCh <- fmt.Errorf("Author '%s': %v", authorName, err)
+				log.Printf("Error fetching data for author '%s': %v", redact.Name(authorName), err)
+				errs.Add(&AuthorError{Author: authorName, Err: err})
 				return
 			}
 
 			// No authors found
-			if len(result.Docs) == 0 {
-				log.Printf("No authors found for '%s'.", authorName)
-				errCh <- fmt.Errorf("No authors found for '%s'", authorName)
+			if !found {
+				log.Printf("No authors found for '%s'.", redact.Name(authorName))
+				errs.Add(&AuthorError{Author: authorName, Err: ErrAuthorNotFound})
+				mu.Lock()
+				notFound++
+				mu.Unlock()
 				return
 			}
 
-			// Select the author with the highest work_count
-			var selectedAuthor models.Author
-			maxWorkCount := -1
-			for _, doc := range result.Docs {
-				if doc.WorkCount > maxWorkCount {
-					maxWorkCount = doc.WorkCount
-					// Ensure the key does not include leading slashes
-					key := strings.TrimPrefix(doc.Key, "/authors/")
-					selectedAuthor = models.Author{
-						Name:      doc.Name,
-						Key:       key,
-						WorkCount: doc.WorkCount,
-					}
-				}
-			}
-
 			// Append to the slice safely
 			mu.Lock()
-			authorKeys = append(authorKeys, selectedAuthor)
+			authorKeys[authorName] = selectedAuthor
 			mu.Unlock()
 		}()
 	}
 
 	// Wait for all goroutines to finish
 	wg.Wait()
-	close(errCh)
 
-	// Check for errors
-	if len(errCh) > 0 {
-		errMessages := []string{}
-		for err := range errCh {
-			errMessages = append(errMessages, err.Error())
-		}
-		return nil, fmt.Errorf(strings.Join(errMessages, "; "))
+	if len(authors) > 0 && notFound == len(authors) {
+		return authorKeys, fmt.Errorf("%w: %w", ErrNoAuthorsResolved, errs)
+	}
+	return authorKeys, errs.ErrorOrNil()
+}
+
+// resolveAuthor returns the search match with the highest work count for an
+// author name, using the cache when possible. found is false when the search
+// returned nothing.
+func resolveAuthor(ctx context.Context, name string) (author models.Author, found bool, err error) {
+	cacheKey := strings.ToLower(name)
+	if author, ok := authorKeyCache.Get(cacheKey); ok {
+		budget.CacheHit(ctx)
+		return author, true, nil
 	}
 
-	return authorKeys, nil
+	// Search for the author via the book provider
+	docs, err := Provider.SearchAuthors(ctx, name)
+	if err != nil || len(docs) == 0 {
+		return models.Author{}, false, err
+	}
+
+	// Select the author with the highest work_count
+	maxWorkCount := -1
+	for _, doc := range docs {
+		if doc.WorkCount > maxWorkCount {
+			maxWorkCount = doc.WorkCount
+			author = doc
+		}
+	}
+	authorKeyCache.Set(cacheKey, author)
+	return author, true, nil
 }
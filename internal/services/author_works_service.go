@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/providers"
+)
+
+// defaultWorksPerAuthor is the sample size of works fetched per author when
+// none is configured.
+const defaultWorksPerAuthor = 100
+
+// Works listings change slowly, so an hour-old listing is still a good sample.
+var authorWorksCache = cache.New[[]models.AuthorWork]("author_works", time.Hour)
+
+// AuthorSubject is a subject and the number of an author's works filed under it.
+type AuthorSubject struct {
+	Subject   string `json:"subject"`
+	WorkCount int    `json:"work_count"`
+}
+
+// GetAuthorWorks returns the sampled works for an author, using the cache
+// and blob store when possible. Prolific authors' works are sampled as
+// configured, so their subjects are counted from representative works.
+func GetAuthorWorks(ctx context.Context, author models.Author) ([]models.AuthorWork, error) {
+	cfg := config.Get()
+	limit := cfg.WorksPerAuthor
+	if limit <= 0 {
+		limit = defaultWorksPerAuthor
+	}
+	sampling := providers.SampleDefault
+	if author.WorkCount > limit {
+		sampling = providers.WorkSampling(cfg.WorksSampling)
+	}
+	key := fmt.Sprintf("%s:%d:%s", author.Key, limit, sampling)
+	return fetchThrough(ctx, authorWorksCache, "author_works", key, func() ([]models.AuthorWork, error) {
+		return Provider.AuthorWorks(ctx, author, limit, sampling)
+	})
+}
+
+// GetAuthorSubjects returns the subjects across an author's sampled works,
+// ordered by how many works carry each subject.
+func GetAuthorSubjects(ctx context.Context, author models.Author) ([]AuthorSubject, error) {
+	works, err := GetAuthorWorks(ctx, author)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, work := range works {
+		// Count each subject at most once per work
+		seen := make(map[string]bool)
+		for _, subject := range work.Subjects {
+			normalized := countedSubject(subject)
+			if normalized == "" || seen[normalized] {
+				continue
+			}
+			seen[normalized] = true
+			counts[normalized]++
+		}
+	}
+
+	subjects := make([]AuthorSubject, 0, len(counts))
+	for subject, count := range counts {
+		subjects = append(subjects, AuthorSubject{Subject: subject, WorkCount: count})
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].WorkCount != subjects[j].WorkCount {
+			return subjects[i].WorkCount > subjects[j].WorkCount
+		}
+		return subjects[i].Subject < subjects[j].Subject
+	})
+	return subjects, nil
+}
+
+// normalizeSubject canonicalizes a subject string for comparison, resolving
+// aliases to the subject they stand for.
+func normalizeSubject(subject string) string {
+	return canonicalSubject(strings.ToLower(strings.TrimSpace(subject)))
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/models"
+)
+
+// Weights of the signals used to rank works blended from several subjects.
+const (
+	blendSubjectWeight    = 0.5
+	blendRecencyWeight    = 0.3
+	blendPopularityWeight = 0.2
+)
+
+// GetBlendedBooks fetches candidate books from several subjects in parallel,
+// merges them, and ranks them by subject score, recency, and popularity
+// before choosing the recommendations.
+func GetBlendedBooks(ctx context.Context, subjects []models.Subject, opts BookOptions) ([]models.Work, error) {
+	works, err := blendedCandidates(ctx, subjects)
+	if err != nil {
+		return nil, err
+	}
+	return ChooseBooks(ctx, subjects, works, opts)
+}
+
+// blendedCandidates fetches the works of several subjects in parallel and
+// merges them in blended rank order.
+func blendedCandidates(ctx context.Context, subjects []models.Subject) ([]models.SubjectWork, error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		fetched = make(map[string][]models.SubjectWork)
+	)
+
+	errCh := make(chan error, len(subjects))
+
+	for _, subject := range subjects {
+		wg.Add(1)
+		go func(subject string) {
+			defer wg.Done()
+
+			works, err := getSubjectWorks(ctx, subject)
+			if err != nil {
+				log.Printf("Error fetching books for subject '%s': %v", subject, err)
+				errCh <- fmt.Errorf("subject '%s': %v", subject, err)
+				return
+			}
+
+			mu.Lock()
+			fetched[subject] = works
+			mu.Unlock()
+		}(subject.Key)
+	}
+
+	wg.Wait()
+	close(errCh)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// A subject that fails to load only narrows the blend
+	if len(fetched) == 0 {
+		errMessages := []string{}
+		for err := range errCh {
+			errMessages = append(errMessages, err.Error())
+		}
+		return nil, fmt.Errorf("error fetching books: %s", strings.Join(errMessages, "; "))
+	}
+
+	return rankBlendedWorks(subjects, fetched, clock.Now().Year()), nil
+}
+
+// rankBlendedWorks merges the works of each subject, keeping a work under its
+// highest-scoring subject, and orders them by their blended rank.
+func rankBlendedWorks(subjects []models.Subject, fetched map[string][]models.SubjectWork, currentYear int) []models.SubjectWork {
+	maxScore := 0.0
+	for _, subject := range subjects {
+		if subject.Score > maxScore {
+			maxScore = subject.Score
+		}
+	}
+
+	type rankedWork struct {
+		work models.SubjectWork
+		rank float64
+	}
+	var (
+		merged       []rankedWork
+		seen         = make(map[string]bool)
+		maxEditions  = 0
+		subjectScore = make(map[string]float64)
+	)
+	// Subjects are ordered by score, so the first subject to claim a work is its best
+	for _, subject := range subjects {
+		subjectScore[subject.Key] = subject.Score / maxScore
+		for _, work := range fetched[subject.Key] {
+			if seen[work.Key] {
+				continue
+			}
+			seen[work.Key] = true
+			work.Subject = subject.Key
+			merged = append(merged, rankedWork{work: work})
+			if work.EditionCount > maxEditions {
+				maxEditions = work.EditionCount
+			}
+		}
+	}
+
+	for i := range merged {
+		work := merged[i].work
+		recency := 0.0
+		if age := currentYear - work.FirstPublishYear; age >= 0 {
+			recency = 1 / float64(1+age)
+		}
+		popularity := 0.0
+		if maxEditions > 0 {
+			popularity = math.Log1p(float64(work.EditionCount)) / math.Log1p(float64(maxEditions))
+		}
+		merged[i].rank = blendSubjectWeight*subjectScore[work.Subject] +
+			blendRecencyWeight*recency +
+			blendPopularityWeight*popularity
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].rank > merged[j].rank })
+
+	works := make([]models.SubjectWork, len(merged))
+	for i, m := range merged {
+		works[i] = m.work
+	}
+	return works
+}
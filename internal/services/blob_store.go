@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/s3"
+)
+
+// maxBlobBytes caps how much of a stored payload is read.
+const maxBlobBytes = 32 << 20
+
+// blobWriteTimeout bounds storing a payload, which happens after the
+// request that fetched it may have finished.
+const blobWriteTimeout = 30 * time.Second
+
+// blobStore keeps large upstream payloads in a bucket of an S3-compatible
+// store, behind the in-memory and on-disk caches. A nil *blobStore stores
+// nothing.
+type blobStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+var blobs = newBlobStore(config.Get())
+
+func newBlobStore(cfg *config.Config) *blobStore {
+	if cfg.BlobStoreBucket == "" {
+		return nil
+	}
+	return &blobStore{
+		client: s3.New(HTTPClient, cfg.BlobStoreEndpoint, cfg.BlobStoreRegion, cfg.BlobStoreAccessKeyID, cfg.BlobStoreSecretAccessKey),
+		bucket: cfg.BlobStoreBucket,
+		prefix: cfg.BlobStorePrefix,
+	}
+}
+
+// objectKey returns the object key of the payload called name among those
+// of a kind, such as "author_works".
+func (b *blobStore) objectKey(kind, name string) string {
+	return b.prefix + kind + "/" + url.PathEscape(name)
+}
+
+// get returns a stored payload, or an error matching os.ErrNotExist.
+func (b *blobStore) get(ctx context.Context, kind, name string) ([]byte, error) {
+	if b == nil {
+		return nil, os.ErrNotExist
+	}
+	key := b.objectKey(kind, name)
+	// Reading storage is not an upstream call, so it is not charged to the budget
+	body, err := b.client.Get(budget.WithBudget(ctx, nil), b.bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, maxBlobBytes))
+}
+
+// put stores a payload in the background, logging any failure, so
+// responses are not held up by storage.
+func (b *blobStore) put(kind, name string, data []byte, contentType string) {
+	if b == nil {
+		return
+	}
+	key := b.objectKey(kind, name)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), blobWriteTimeout)
+		defer cancel()
+		if err := b.client.Put(ctx, b.bucket, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			log.Printf("Error storing blob %s: %v", key, err)
+		}
+	}()
+}
+
+// delete removes a stored payload, reporting whether that succeeded.
+func (b *blobStore) delete(kind, name string) bool {
+	if b == nil {
+		return false
+	}
+	key := b.objectKey(kind, name)
+	if err := b.client.Delete(context.Background(), b.bucket, key); err != nil {
+		log.Printf("Error deleting blob %s: %v", key, err)
+		return false
+	}
+	return true
+}
+
+// PurgeStoredPayloads deletes the payloads stored in the blob store before
+// the given time, returning how many were deleted. Without a blob store
+// there is nothing to purge.
+func PurgeStoredPayloads(ctx context.Context, before time.Time) (int64, error) {
+	b := blobs
+	if b == nil {
+		return 0, nil
+	}
+	objects, err := b.client.List(ctx, b.bucket, b.prefix)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, object := range objects {
+		if !object.LastModified.Before(before) {
+			continue
+		}
+		if err := b.client.Delete(ctx, b.bucket, object.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// storedPayload is a JSON payload in the blob store and when it was fetched.
+type storedPayload[V any] struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Value     V         `json:"value"`
+}
+
+// fetchThrough returns the value for key from mem, else from a payload in
+// the blob store fetched within mem's TTL, else from fetch, keeping what
+// fetch returns in both. When fetch fails, an older stored payload is served
+// in its place, so a bucket filled while online replays the upstream offline.
+func fetchThrough[V any](ctx context.Context, mem *cache.Cache[V], kind, key string, fetch func() (V, error)) (V, error) {
+	if value, ok := mem.Get(key); ok {
+		budget.CacheHit(ctx)
+		return value, nil
+	}
+
+	var stored *storedPayload[V]
+	data, err := blobs.get(ctx, kind, key+".json")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error reading stored %s for '%s': %v", kind, key, err)
+	}
+	if err == nil {
+		var payload storedPayload[V]
+		if err := json.Unmarshal(data, &payload); err != nil {
+			log.Printf("Error decoding stored %s for '%s': %v", kind, key, err)
+		} else {
+			stored = &payload
+		}
+	}
+	if stored != nil && clock.Since(stored.FetchedAt) < mem.TTL() {
+		budget.CacheHit(ctx)
+		mem.Set(key, stored.Value)
+		return stored.Value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		if stored != nil {
+			log.Printf("Serving %s for '%s' stored at %s: %v", kind, key, stored.FetchedAt.Format(time.RFC3339), err)
+			return stored.Value, nil
+		}
+		return value, err
+	}
+	mem.Set(key, value)
+	if blobs != nil {
+		if data, err := json.Marshal(storedPayload[V]{FetchedAt: clock.Now().UTC(), Value: value}); err == nil {
+			blobs.put(kind, key+".json", data, "application/json")
+		}
+	}
+	return value, nil
+}
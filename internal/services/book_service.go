@@ -1,130 +1,284 @@
 package services
 
 import (
-    "context"
-    "encoding/json"
-    "fmt"
-    "io/ioutil"
-    "log"
-    "net/http"
-    "strings"
-    "time"
-    "be-takehome-2024/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/clock"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+	"be-takehome-2024/internal/sanitize"
 )
 
-// GetRecommendedBooks fetches books in the common subject and returns the top three recent books.
-func GetRecommendedBooks(ctx context.Context, subject string) ([]models.Work, error) {
-    // Fetch books for the subject
-    subjectURL := fmt.Sprintf("https://openlibrary.org/subjects/%s.json?limit=50&sort=new", strings.ReplaceAll(subject, " ", "_"))
-
-    req, err := http.NewRequestWithContext(ctx, "GET", subjectURL, nil)
-    if err != nil {
-        return nil, fmt.Errorf("error creating request for subject '%s': %v", subject, err)
-    }
-
-    resp, err := http.DefaultClient.Do(req)
-    if err != nil {
-        return nil, fmt.Errorf("error fetching books for subject '%s': %v", subject, err)
-    }
-    defer resp.Body.Close()
-
-    body, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        return nil, fmt.Errorf("error reading books response for subject '%s': %v", subject, err)
-    }
-
-    var subjectResult struct {
-        Works []struct {
-            Title          string `json:"title"`
-            Authors        []struct {
-                Name string `json:"name"`
-            } `json:"authors"`
-            Key            string `json:"key"`
-            FirstPublishYear int   `json:"first_publish_year"` // Ensure this field is returned by API
-        } `json:"works"`
-    }
-
-    if err := json.Unmarshal(body, &subjectResult); err != nil {
-        return nil, fmt.Errorf("error parsing books JSON for subject '%s': %v", subject, err)
-    }
-
-    var recentBooks []models.Work
-    currentYear := time.Now().Year()
-    cutoffYear := currentYear - 2
-
-    for _, work := range subjectResult.Works {
-        // Only include books published in the last two years and exclude future years
-        if work.FirstPublishYear >= cutoffYear && work.FirstPublishYear <= currentYear {
-            if len(recentBooks) >= 3 {
-                break
-            }
-
-            workKey := strings.TrimPrefix(work.Key, "/works/")
-            description, err := fetchDescription(ctx, workKey)
-            if err != nil {
-                continue // Skip this book if we can't fetch the description
-            }
-
-            var authors []string
-            for _, a := range work.Authors {
-                authors = append(authors, a.Name)
-            }
-
-            // Log the book's title, authors, and publish year
-            log.Printf("Chosen Book: %s, Authors: %v, Published Year: %d", work.Title, authors, work.FirstPublishYear)
-
-            recentWork := models.Work{
-                Title:       work.Title,
-                Authors:     authors,
-                Description: description,
-            }
-
-            recentBooks = append(recentBooks, recentWork)
-        }
-    }
-
-    if len(recentBooks) == 0 {
-        return nil, fmt.Errorf("no books found for subject '%s' published in the last two years", subject)
-    }
-
-    return recentBooks, nil
+// DefaultBookCount is how many books are recommended when the request does not say.
+const DefaultBookCount = 3
+
+// booksPerSubject is how many of a subject's newest books are considered.
+const booksPerSubject = 50
+
+// New books appear in subject listings slowly, so an hour-old listing is still fresh.
+var subjectWorksCache = cache.New[[]models.SubjectWork]("subject_works", time.Hour)
+
+// BookOptions tunes how recommended books are chosen from a subject.
+type BookOptions struct {
+	// Count is the number of books to recommend; DefaultBookCount when zero.
+	Count int
+	// FavoredAuthors' recent books are chosen ahead of other recent books.
+	FavoredAuthors []string
+	// Diverse avoids recommending several books by the same author or from the same series.
+	Diverse bool
+	// PreferSeriesStart recommends the first book of a series in place of a later one.
+	PreferSeriesStart bool
+	// Formats, when set, only recommends books available in at least one of them.
+	Formats []Format
+	// Audience, when set, only recommends books written for it.
+	Audience Audience
+	// GroupSeries keeps books from the same series together, in series order.
+	GroupSeries bool
+	// RequireDescription only recommends books with description text, rather
+	// than flagging those without as missing one.
+	RequireDescription bool
+	// RawDescription returns descriptions as the provider has them, rather
+	// than cleaned of markup and boilerplate.
+	RawDescription bool
+	// DescriptionSentences, when set, shortens cleaned descriptions to their
+	// first sentences.
+	DescriptionSentences int
+	// Language, when set, is the ISO 639-1 code of the language descriptions
+	// are wanted in. Descriptions in another are replaced by an edition's in
+	// it where possible, and otherwise handled as ForeignDescriptions says.
+	Language            string
+	ForeignDescriptions ForeignDescriptions
+	// ExcludeWorks are keys of works never to recommend, such as those already read.
+	ExcludeWorks map[string]bool `json:"-"`
+}
+
+// clientDescription returns a description as sent to clients: cleaned up
+// unless the raw one is asked for, and cut to the configured length. A
+// description left empty by the cleanup is none at all.
+func (opts BookOptions) clientDescription(description *models.Description) *models.Description {
+	if description == nil {
+		return nil
+	}
+	text := description.Text
+	if !opts.RawDescription {
+		text = sanitize.FirstSentences(sanitize.Description(text), opts.DescriptionSentences)
+		if text == "" {
+			return nil
+		}
+	}
+	return &models.Description{Text: sanitize.Truncate(text, config.Get().DescriptionMaxLength), Source: description.Source}
+}
+
+// GetRecommendedBooks fetches books in the common subject and returns the most recent ones.
+func GetRecommendedBooks(ctx context.Context, subject string, opts BookOptions) ([]models.Work, error) {
+	subjects := []models.Subject{{Key: subject}}
+	works, err := FetchCandidates(ctx, subjects)
+	if err != nil {
+		return nil, err
+	}
+	return ChooseBooks(ctx, subjects, works, opts)
+}
+
+// FetchCandidates returns the works books are chosen from for the subjects,
+// best first: a single subject's newest works, or several subjects' works
+// in blended rank order.
+func FetchCandidates(ctx context.Context, subjects []models.Subject) ([]models.SubjectWork, error) {
+	if len(subjects) > 1 {
+		return blendedCandidates(ctx, subjects)
+	}
+	works, err := getSubjectWorks(ctx, subjects[0].Key)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching books for subject '%s': %w", subjects[0].Key, err)
+	}
+	return works, nil
+}
+
+// ChooseBooks picks the recommended books from the candidate works of the
+// subjects, in order.
+func ChooseBooks(ctx context.Context, subjects []models.Subject, works []models.SubjectWork, opts BookOptions) ([]models.Work, error) {
+	names := make([]string, len(subjects))
+	for i, subject := range subjects {
+		names[i] = subject.Key
+	}
+	label := fmt.Sprintf("subject '%s'", names[0])
+	if len(names) > 1 {
+		label = fmt.Sprintf("subjects '%s'", strings.Join(names, "', '"))
+	}
+	return chooseBooks(ctx, label, works, opts)
+}
+
+// chooseBooks picks the recommended books from ranked candidate works. The
+// label describes where the works came from, for logs and errors.
+func chooseBooks(ctx context.Context, label string, works []models.SubjectWork, opts BookOptions) ([]models.Work, error) {
+	// Works may be shared with the cache, so reorder a copy
+	works = append([]models.SubjectWork(nil), works...)
+
+	// Move books by favored authors to the front, keeping the newest-first order otherwise
+	if len(opts.FavoredAuthors) > 0 {
+		favored := make(map[string]bool)
+		for _, author := range opts.FavoredAuthors {
+			favored[strings.ToLower(author)] = true
+		}
+		sort.SliceStable(works, func(i, j int) bool {
+			return hasAnyAuthor(works[i], favored) && !hasAnyAuthor(works[j], favored)
+		})
+	}
+
+	count := opts.Count
+	if count <= 0 {
+		count = DefaultBookCount
+	}
+
+	// Prefer books published in the last two years, widening the window only
+	// while there are too few books to fill the recommendation
+	recencyWindows := config.Get().RecencyWindows
+	currentYear := clock.Now().Year()
+	attempted := make(map[string]bool)
+	var recentBooks []models.Work
+	for _, window := range recencyWindows {
+		if len(recentBooks) >= count {
+			break
+		}
+
+		// Only include books within the window and exclude future years
+		cutoffYear := currentYear - window
+		var candidates []models.SubjectWork
+		for _, work := range works {
+			if !attempted[work.Key] && !opts.ExcludeWorks[work.Key] && !blockedWork(work) && work.FirstPublishYear >= cutoffYear && work.FirstPublishYear <= currentYear && opts.Audience.suitsWork(work) {
+				candidates = append(candidates, work)
+			}
+		}
+		if window != recencyWindows[0] && len(candidates) > 0 {
+			log.Printf("Widening recency window for %s to %d years", label, window)
+		}
+
+		if opts.Diverse {
+			candidates = diversify(candidates)
+		}
+
+		for _, work := range candidates {
+			if len(recentBooks) >= count {
+				break
+			}
+			// Stop fetching descriptions and editions once the caller gives up
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			attempted[work.Key] = true
+
+			// Start readers at the beginning of a series rather than part way through
+			series := workSeries(ctx, work)
+			if opts.PreferSeriesStart && series.Position > 1 {
+				if first, ok := seriesStart(ctx, work, series); ok && !attempted[first.Key] && !opts.ExcludeWorks[first.Key] && !blockedWork(first) && opts.Audience.suitsWork(first) {
+					log.Printf("Recommending '%s' in place of '%s', book %d of %s", first.Title, work.Title, series.Position, series.Name)
+					attempted[first.Key] = true
+					first.Subject = work.Subject
+					work = first
+					series.Position = 1
+				}
+			}
+
+			// Skip books not available in any requested format
+			var formats map[Format]bool
+			if len(opts.Formats) > 0 {
+				var err error
+				formats, err = workFormats(ctx, work)
+				if err != nil {
+					log.Printf("Error fetching formats of work '%s': %v", work.Key, err)
+					continue
+				}
+				if !hasAnyFormat(formats, opts.Formats) {
+					continue
+				}
+			}
+
+			var description *models.Description
+			if work.Description != nil {
+				description = &models.Description{Text: *work.Description, Source: models.DescriptionSourceDescription}
+			} else {
+				var err error
+				description, err = fetchDescription(ctx, work.Key)
+				switch {
+				case errors.Is(err, httpclient.ErrNotFound):
+					continue // The work is gone, so don't recommend it
+				case err != nil:
+					// Recommend the book without a description rather than lose it to a passing failure
+					log.Printf("Error fetching description of work '%s': %v", work.Key, err)
+				}
+			}
+			description, language := opts.descriptionInLanguage(ctx, work, opts.clientDescription(description))
+			foreign := opts.Language != "" && language != "" && language != opts.Language
+			if foreign && opts.ForeignDescriptions == ForeignDescriptionsOmit {
+				description, language, foreign = nil, "", false
+			}
+			if description == nil && opts.RequireDescription {
+				continue
+			}
+
+			// Log the book's title, authors, and publish year
+			log.Printf("Chosen Book: %s, Authors: %v, Published Year: %d", work.Title, redact.Names(work.Authors), work.FirstPublishYear)
+
+			recentWork := models.Work{
+				Key:         work.Key,
+				Title:       work.Title,
+				Authors:     work.Authors,
+				PublishYear: work.FirstPublishYear,
+				Subject:     work.Subject,
+				Formats:     formatNames(formats),
+			}
+			if description != nil {
+				recentWork.Description = &description.Text
+				recentWork.DescriptionSource = description.Source
+				recentWork.DescriptionLanguage = language
+				recentWork.DescriptionForeign = foreign
+			} else {
+				recentWork.DescriptionMissing = true
+			}
+			if series.Name != "" {
+				recentWork.Series = series.Name
+				recentWork.SeriesPosition = series.Position
+			}
+
+			recentBooks = append(recentBooks, recentWork)
+		}
+	}
+
+	if len(recentBooks) == 0 {
+		return nil, fmt.Errorf("no books found for %s published in the last %d years", label, recencyWindows[len(recencyWindows)-1])
+	}
+
+	// Keep books from the same series together, so clients can suggest where to start
+	if opts.GroupSeries {
+		recentBooks = groupSeries(recentBooks)
+	}
+	return recentBooks, nil
 }
 
+// getSubjectWorks returns a subject's newest works, using the cache when possible.
+func getSubjectWorks(ctx context.Context, subject string) ([]models.SubjectWork, error) {
+	return fetchThrough(ctx, subjectWorksCache, "subject_works", subject, func() ([]models.SubjectWork, error) {
+		works, err := Provider.SubjectWorks(ctx, subject, booksPerSubject)
+		if errors.Is(err, httpclient.ErrNotFound) {
+			// An unknown subject has no works
+			return nil, nil
+		}
+		return works, err
+	})
+}
 
-func fetchDescription(ctx context.Context, workKey string) (*string, error) {
-    descURL := fmt.Sprintf("https://openlibrary.org/works/%s.json", workKey)
-    req, err := http.NewRequestWithContext(ctx, "GET", descURL, nil)
-    if err != nil {
-        return nil, fmt.Errorf("error creating request for description: %v", err)
-    }
-
-    resp, err := http.DefaultClient.Do(req)
-    if err != nil {
-        return nil, fmt.Errorf("error fetching description: %v", err)
-    }
-    defer resp.Body.Close()
-
-    body, err := ioutil.ReadAll(resp.Body)
-    if err != nil {
-        return nil, fmt.Errorf("error reading description: %v", err)
-    }
-
-    var descResult struct {
-        Description interface{} `json:"description"`
-    }
-    if err := json.Unmarshal(body, &descResult); err != nil {
-        return nil, fmt.Errorf("error parsing description JSON: %v", err)
-    }
-
-    var description *string
-    switch v := descResult.Description.(type) {
-    case string:
-        description = &v
-    case map[string]interface{}:
-        if val, ok := v["value"].(string); ok {
-            description = &val
-        }
-    }
-
-    return description, nil
-}
\ No newline at end of file
+func fetchDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	description, err := Provider.WorkDescription(ctx, workKey)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching description: %w", err)
+	}
+	return description, nil
+}
@@ -0,0 +1,26 @@
+package services
+
+import "strings"
+
+// InvalidateAuthor drops the cached works, bio and key resolution of an author. Either the
+// key or the name may be empty. It reports whether anything was removed.
+func InvalidateAuthor(key, name string) bool {
+	removed := false
+	if key != "" {
+		removed = authorWorksCache.Delete(key) || removed
+		removed = blobs.delete("author_works", key+".json") || removed
+	}
+	if name != "" {
+		removed = authorBioCache.Delete(name) || removed
+		removed = authorKeyCache.Delete(strings.ToLower(name)) || removed
+	}
+	return removed
+}
+
+// InvalidateSubject drops the cached book listing of a subject, reporting
+// whether it was cached.
+func InvalidateSubject(subject string) bool {
+	subject = normalizeSubject(subject)
+	removed := subjectWorksCache.Delete(subject)
+	return blobs.delete("subject_works", subject+".json") || removed
+}
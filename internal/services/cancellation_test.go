@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/providers"
+)
+
+// blockingProvider answers every call only once its context is done,
+// counting the calls started and still running.
+type blockingProvider struct {
+	started atomic.Int32
+	running atomic.Int32
+	// onCall, if set, is called with the number of calls started so far.
+	onCall func(started int32)
+}
+
+func (p *blockingProvider) block(ctx context.Context) error {
+	started := p.started.Add(1)
+	p.running.Add(1)
+	defer p.running.Add(-1)
+	if p.onCall != nil {
+		p.onCall(started)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (p *blockingProvider) Name() string { return "blocking" }
+
+func (p *blockingProvider) SearchAuthors(ctx context.Context, name string) ([]models.Author, error) {
+	return nil, p.block(ctx)
+}
+
+func (p *blockingProvider) AuthorWorks(ctx context.Context, author models.Author, limit int, sampling providers.WorkSampling) ([]models.AuthorWork, error) {
+	return nil, p.block(ctx)
+}
+
+func (p *blockingProvider) SubjectWorks(ctx context.Context, subject string, limit int) ([]models.SubjectWork, error) {
+	return nil, p.block(ctx)
+}
+
+func (p *blockingProvider) WorkDescription(ctx context.Context, workKey string) (*models.Description, error) {
+	return nil, p.block(ctx)
+}
+
+// useProvider makes p the book provider until the test ends.
+func useProvider(t *testing.T, p providers.BookProvider) {
+	t.Helper()
+	previous := Provider
+	Provider = p
+	t.Cleanup(func() { Provider = previous })
+}
+
+// fanOutSize is more than the fan-outs run at once, so some calls are still
+// to be started when the caller gives up.
+const fanOutSize = 50
+
+// cancelWhenSaturated returns a context cancelled once every slot of a
+// fan-out limited to concurrency calls is taken.
+func cancelWhenSaturated(t *testing.T, p *blockingProvider, concurrency int32) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	p.onCall = func(started int32) {
+		if started == concurrency {
+			cancel()
+		}
+	}
+	return ctx
+}
+
+// checkStopped fails the test unless the fan-out returned promptly with a
+// cancellation, stopped every call it made, and started none after the
+// context was cancelled.
+func checkStopped(t *testing.T, p *blockingProvider, concurrency int32, elapsed time.Duration, err error) {
+	t.Helper()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want promptly", elapsed)
+	}
+	if started := p.started.Load(); started != concurrency {
+		t.Errorf("started %d upstream calls, want %d", started, concurrency)
+	}
+	if running := p.running.Load(); running != 0 {
+		t.Errorf("%d upstream calls still running after returning", running)
+	}
+}
+
+func TestResolveAuthorKeysStopsWhenCancelled(t *testing.T) {
+	p := &blockingProvider{}
+	useProvider(t, p)
+	ctx := cancelWhenSaturated(t, p, 20)
+
+	authors := make([]string, fanOutSize)
+	for i := range authors {
+		authors[i] = fmt.Sprintf("Cancelled Author %d", i)
+	}
+	start := time.Now()
+	_, err := ResolveAuthorKeysByName(ctx, authors)
+	checkStopped(t, p, 20, time.Since(start), err)
+}
+
+func TestGetSubjectAuthorCountsStopsWhenCancelled(t *testing.T) {
+	p := &blockingProvider{}
+	useProvider(t, p)
+	ctx := cancelWhenSaturated(t, p, 20)
+
+	authors := make([]models.Author, fanOutSize)
+	for i := range authors {
+		authors[i] = models.Author{Name: fmt.Sprintf("Cancelled Author %d", i), Key: fmt.Sprintf("OL%dCANCELA", i)}
+	}
+	start := time.Now()
+	_, err := GetSubjectAuthorCounts(ctx, authors)
+	checkStopped(t, p, 20, time.Since(start), err)
+}
+
+func TestGetRecommendedBooksStopsWhenCancelled(t *testing.T) {
+	p := &blockingProvider{}
+	useProvider(t, p)
+	ctx := cancelWhenSaturated(t, p, 1)
+
+	start := time.Now()
+	_, err := GetRecommendedBooks(ctx, "cancelled subject", BookOptions{})
+	checkStopped(t, p, 1, time.Since(start), err)
+}
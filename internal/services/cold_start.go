@@ -0,0 +1,35 @@
+package services
+
+import "be-takehome-2024/internal/models"
+
+// Cold-start fallback sources reported to clients.
+const (
+	ColdStartPopularSubjects = "popular_subjects"
+	ColdStartPartnerSubjects = "partner_subjects"
+)
+
+// coldStartTopSubjects is how many of the partner's subjects stand in for a
+// user without a profile.
+const coldStartTopSubjects = 5
+
+// ColdStartProfile builds a stand-in subject profile for a user whose favorite
+// authors could not be resolved. It uses the popular subjects the partner also
+// reads, or failing that the partner's own top subjects, and reports which
+// source was used.
+func ColdStartProfile(partner models.SubjectProfile, popularSubjects []string) (models.SubjectProfile, string) {
+	profile := make(models.SubjectProfile)
+	for _, subject := range popularSubjects {
+		subject = normalizeSubject(subject)
+		if _, ok := partner[subject]; ok {
+			profile[subject] = 1
+		}
+	}
+	if len(profile) > 0 {
+		return profile, ColdStartPopularSubjects
+	}
+
+	for _, subject := range partner.Top(coldStartTopSubjects) {
+		profile[subject] = 1
+	}
+	return profile, ColdStartPartnerSubjects
+}
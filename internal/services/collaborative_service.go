@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"be-takehome-2024/internal/models"
+)
+
+// neighborCount is how many similar users contribute to a collaborative recommendation.
+const neighborCount = 3
+
+// Neighbor is another user whose subject profile resembles the target profile.
+type Neighbor struct {
+	UserID     int
+	Similarity float64
+}
+
+// FindSimilarUsers ranks stored profiles by cosine similarity to the target
+// profile and returns the closest neighbors, skipping the excluded user IDs
+// and users with nothing in common.
+func FindSimilarUsers(target models.SubjectProfile, profiles map[int]models.SubjectProfile, exclude ...int) []Neighbor {
+	excluded := make(map[int]bool)
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+
+	var neighbors []Neighbor
+	for userID, profile := range profiles {
+		if excluded[userID] {
+			continue
+		}
+		if similarity := cosineSimilarity(target, profile); similarity > 0 {
+			neighbors = append(neighbors, Neighbor{UserID: userID, Similarity: similarity})
+		}
+	}
+
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Similarity != neighbors[j].Similarity {
+			return neighbors[i].Similarity > neighbors[j].Similarity
+		}
+		return neighbors[i].UserID < neighbors[j].UserID
+	})
+	if len(neighbors) > neighborCount {
+		neighbors = neighbors[:neighborCount]
+	}
+	return neighbors
+}
+
+// FindCollaborativeSubject picks the subject most favored by the neighbors,
+// weighting each neighbor's subject counts by their similarity.
+func FindCollaborativeSubject(neighbors []Neighbor, profiles map[int]models.SubjectProfile) (string, error) {
+	scores := make(map[string]float64)
+	for _, neighbor := range neighbors {
+		for subject, count := range profiles[neighbor.UserID] {
+			scores[subject] += neighbor.Similarity * count
+		}
+	}
+
+	var (
+		bestSubject string
+		bestScore   float64
+	)
+	for subject, score := range scores {
+		if score > bestScore || (score == bestScore && subject < bestSubject) {
+			bestScore = score
+			bestSubject = subject
+		}
+	}
+
+	if bestSubject == "" {
+		return "", fmt.Errorf("No subjects found among similar users")
+	}
+	return bestSubject, nil
+}
+
+// CombineProfiles sums subject counts across profiles.
+func CombineProfiles(profiles ...models.SubjectProfile) models.SubjectProfile {
+	combined := make(models.SubjectProfile)
+	for _, profile := range profiles {
+		for subject, count := range profile {
+			combined[subject] += count
+		}
+	}
+	return combined
+}
+
+func cosineSimilarity(a, b models.SubjectProfile) float64 {
+	// Sum in a fixed order, since floating-point sums depend on it and equal
+	// similarities are told apart by user ID
+	var dot, normA, normB float64
+	for _, subject := range a.Subjects() {
+		countA := a[subject]
+		normA += countA * countA
+		if countB, ok := b[subject]; ok {
+			dot += countA * countB
+		}
+	}
+	for _, subject := range b.Subjects() {
+		normB += b[subject] * b[subject]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
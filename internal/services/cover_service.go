@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/httpclient"
+)
+
+// coverCacheDir is where proxied cover images are stored on disk.
+const coverCacheDir = "./cover_cache"
+
+// maxCoverBytes caps how much of an upstream cover image is read.
+const maxCoverBytes = 5 << 20
+
+// ErrCoverNotFound is returned when Open Library has no cover with the requested ID.
+var ErrCoverNotFound = errors.New("cover not found")
+
+// coverStore exposes the on-disk cover cache for inspection and invalidation.
+// Keys are "<cover_id>-<size>", e.g. "8739161-M".
+type coverStore struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+var covers = &coverStore{}
+
+func init() { cache.Register("covers", covers) }
+
+func (s *coverStore) Stats() cache.Stats {
+	var (
+		entries int
+		bytes   int64
+	)
+	files, _ := os.ReadDir(coverCacheDir)
+	for _, file := range files {
+		if info, err := file.Info(); err == nil && !file.IsDir() && filepath.Ext(file.Name()) == ".jpg" {
+			entries++
+			bytes += info.Size()
+		}
+	}
+	return cache.NewStats(entries, bytes, s.hits.Load(), s.misses.Load())
+}
+
+func (s *coverStore) Delete(key string) bool {
+	if filepath.Base(key) != key {
+		return false
+	}
+	removed := os.Remove(filepath.Join(coverCacheDir, key+".jpg")) == nil
+	return blobs.delete("covers", key+".jpg") || removed
+}
+
+func (s *coverStore) Flush() {
+	files, _ := os.ReadDir(coverCacheDir)
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".jpg" {
+			os.Remove(filepath.Join(coverCacheDir, file.Name()))
+		}
+	}
+}
+
+// GetCover returns a JPEG cover image of the given size ("S", "M", or "L"),
+// serving it from the local disk cache or the blob store when possible.
+func GetCover(ctx context.Context, coverID int, size string) ([]byte, error) {
+	name := fmt.Sprintf("%d-%s.jpg", coverID, size)
+	cachePath := filepath.Join(coverCacheDir, name)
+	if data, err := os.ReadFile(cachePath); err == nil {
+		covers.hits.Add(1)
+		return data, nil
+	}
+	covers.misses.Add(1)
+
+	if data, err := blobs.get(ctx, "covers", name); err == nil {
+		if err := writeCoverCache(cachePath, data); err != nil {
+			log.Printf("Error caching cover %d: %v", coverID, err)
+		}
+		return data, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error reading stored cover %d: %v", coverID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", OpenLibrary.CoverURL(coverID, size), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for cover %d: %v", coverID, err)
+	}
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching cover %d: %v", coverID, err)
+	}
+	defer resp.Body.Close()
+
+	if err := httpclient.CheckStatus(resp, fmt.Sprintf("cover %d", coverID)); err != nil {
+		if errors.Is(err, httpclient.ErrNotFound) {
+			return nil, ErrCoverNotFound
+		}
+		return nil, err
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(nil, resp.Body, maxCoverBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cover %d: %v", coverID, err)
+	}
+
+	if err := writeCoverCache(cachePath, data); err != nil {
+		// The image is still usable; it just won't be cached.
+		log.Printf("Error caching cover %d: %v", coverID, err)
+	}
+	blobs.put("covers", name, data, "image/jpeg")
+	return data, nil
+}
+
+// writeCoverCache writes the file atomically so concurrent readers never see
+// a partially written image.
+func writeCoverCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cover-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
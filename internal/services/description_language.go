@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"be-takehome-2024/internal/langdetect"
+	"be-takehome-2024/internal/models"
+)
+
+// ForeignDescriptions is what is done with a description not in the
+// requested language when no edition has one that is.
+type ForeignDescriptions string
+
+const (
+	// ForeignDescriptionsFlag sends the description, flagged as foreign.
+	ForeignDescriptionsFlag ForeignDescriptions = "flag"
+	// ForeignDescriptionsOmit leaves the description out, as if the work had none.
+	ForeignDescriptionsOmit ForeignDescriptions = "omit"
+)
+
+// descriptionInLanguage returns the description to send for a work in the
+// requested language, and the language it was detected to be in, or "" if
+// that can't be told. A description in another language is swapped for that
+// of an edition in the requested one when there is one.
+func (opts BookOptions) descriptionInLanguage(ctx context.Context, work models.SubjectWork, description *models.Description) (*models.Description, string) {
+	if description == nil || opts.Language == "" {
+		return description, ""
+	}
+	detected := langdetect.Detect(description.Text)
+	if detected == "" || detected == opts.Language {
+		return description, detected
+	}
+
+	editions, err := getWorkEditions(ctx, work.Key)
+	if err != nil {
+		log.Printf("Error fetching editions of work '%s' for a description in '%s': %v", work.Key, opts.Language, err)
+		return description, detected
+	}
+	for _, edition := range editions {
+		if !slices.Contains(edition.Languages, opts.Language) || edition.Description == "" {
+			continue
+		}
+		alternative := opts.clientDescription(&models.Description{Text: edition.Description, Source: models.DescriptionSourceEdition})
+		if alternative == nil {
+			continue
+		}
+		// Editions are sometimes tagged with the wrong language, so check the text too
+		if language := langdetect.Detect(alternative.Text); language == "" || language == opts.Language {
+			log.Printf("Using the '%s' description of edition '%s' of work '%s'", opts.Language, edition.Key, work.Key)
+			return alternative, opts.Language
+		}
+	}
+	return description, detected
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"strings"
+
+	"be-takehome-2024/internal/models"
+)
+
+// diversify reorders candidate works so that each author and each series is
+// represented once before any of them repeats. Within each group the original
+// order is kept, so the most relevant works still come first.
+func diversify(works []models.SubjectWork) []models.SubjectWork {
+	usedAuthors := make(map[string]bool)
+	usedSeries := make(map[string]bool)
+
+	var fresh, repeats []models.SubjectWork
+	for _, work := range works {
+		series, _ := detectSeries(work.Title)
+		if hasAnyAuthor(work, usedAuthors) || (series != "" && usedSeries[series]) {
+			repeats = append(repeats, work)
+			continue
+		}
+
+		fresh = append(fresh, work)
+		for _, author := range work.Authors {
+			usedAuthors[strings.ToLower(author)] = true
+		}
+		if series != "" {
+			usedSeries[series] = true
+		}
+	}
+	return append(fresh, repeats...)
+}
+
+// hasAnyAuthor reports whether any of the work's authors is in the set of lowercased names.
+func hasAnyAuthor(work models.SubjectWork, authors map[string]bool) bool {
+	for _, author := range work.Authors {
+		if authors[strings.ToLower(author)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/providers"
+)
+
+// editionsPerWork is how many of a work's editions are checked for series and format data.
+const editionsPerWork = 20
+
+// Editions are added slowly and rarely change, so they are kept for a week.
+var workEditionsCache = cache.New[[]models.Edition]("work_editions", 7*24*time.Hour)
+
+// getWorkEditions returns a work's editions, using the cache when possible.
+// Only Open Library lists editions, so works from other providers have none.
+func getWorkEditions(ctx context.Context, workKey string) ([]models.Edition, error) {
+	if providers.IsGoogleKey(workKey) {
+		return nil, nil
+	}
+	if editions, ok := workEditionsCache.Get(workKey); ok {
+		budget.CacheHit(ctx)
+		return editions, nil
+	}
+
+	editions, err := OpenLibrary.Editions(ctx, workKey, editionsPerWork)
+	if errors.Is(err, httpclient.ErrNotFound) {
+		// A work without an editions listing simply has no known series or formats
+		editions, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	workEditionsCache.Set(workKey, editions)
+	return editions, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrAuthorNotFound means an author search returned no matches.
+var ErrAuthorNotFound = errors.New("no authors found")
+
+// AuthorError is a failure concerning a single author.
+type AuthorError struct {
+	Author string
+	Err    error
+}
+
+func (e *AuthorError) Error() string {
+	return fmt.Sprintf("author '%s': %v", e.Author, e.Err)
+}
+
+func (e *AuthorError) Unwrap() error { return e.Err }
+
+// MultiError aggregates independent failures, such as one per author, keeping
+// each cause. errors.Is and errors.As match any of them. It is safe for
+// concurrent use, so fan-out goroutines can add to it directly.
+type MultiError struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// Add records a failure. Nil errors are ignored.
+func (m *MultiError) Add(err error) {
+	if err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errs = append(m.errs, err)
+}
+
+// Errors returns the recorded failures in the order they were added.
+func (m *MultiError) Errors() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]error(nil), m.errs...)
+}
+
+// Len returns the number of recorded failures.
+func (m *MultiError) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.errs)
+}
+
+func (m *MultiError) Error() string {
+	errs := m.Errors()
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (m *MultiError) Unwrap() []error { return m.Errors() }
+
+// ErrorOrNil returns m if it recorded any failure, and nil otherwise.
+func (m *MultiError) ErrorOrNil() error {
+	if m.Len() == 0 {
+		return nil
+	}
+	return m
+}
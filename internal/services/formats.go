@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"be-takehome-2024/internal/models"
+)
+
+// Format is a way of reading a book.
+type Format string
+
+const (
+	FormatEbook     Format = "ebook"
+	FormatAudiobook Format = "audiobook"
+	FormatPrint     Format = "print"
+)
+
+// Formats lists every format, in the order they are reported.
+var Formats = []Format{FormatEbook, FormatAudiobook, FormatPrint}
+
+// Substrings of Open Library physical formats, which are free text, identifying each format.
+var (
+	audiobookFormatHints = []string{"audio", "mp3", "cd", "cassette", "sound"}
+	ebookFormatHints     = []string{"ebook", "e-book", "electronic", "kindle", "epub", "online", "digital"}
+)
+
+// formatOf classifies an edition's physical format, returning "" when it is unknown.
+func formatOf(physicalFormat string) Format {
+	physicalFormat = strings.ToLower(strings.TrimSpace(physicalFormat))
+	if physicalFormat == "" {
+		return ""
+	}
+	for _, hint := range audiobookFormatHints {
+		if strings.Contains(physicalFormat, hint) {
+			return FormatAudiobook
+		}
+	}
+	for _, hint := range ebookFormatHints {
+		if strings.Contains(physicalFormat, hint) {
+			return FormatEbook
+		}
+	}
+	return FormatPrint
+}
+
+// workFormats returns the formats a work is available in, from its ebook
+// availability and its editions' physical formats. Editions without a
+// physical format are assumed to be in print.
+func workFormats(ctx context.Context, work models.SubjectWork) (map[Format]bool, error) {
+	formats := make(map[Format]bool)
+	if work.Ebook {
+		formats[FormatEbook] = true
+	}
+
+	editions, err := getWorkEditions(ctx, work.Key)
+	if err != nil {
+		return nil, err
+	}
+	for _, edition := range editions {
+		if format := formatOf(edition.PhysicalFormat); format != "" {
+			formats[format] = true
+		} else {
+			formats[FormatPrint] = true
+		}
+	}
+	return formats, nil
+}
+
+// formatNames lists the formats in the set, in the order of Formats.
+func formatNames(formats map[Format]bool) []string {
+	var names []string
+	for _, format := range Formats {
+		if formats[format] {
+			names = append(names, string(format))
+		}
+	}
+	return names
+}
+
+// hasAnyFormat reports whether any of the wanted formats is in the set.
+func hasAnyFormat(formats map[Format]bool, wanted []Format) bool {
+	for _, format := range wanted {
+		if formats[format] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package services
+
+import "be-takehome-2024/internal/models"
+
+// GenreLevel is a level of the genre taxonomy that subjects can be rolled up
+// to, so that adjacent subjects, such as epic and urban fantasy, match.
+type GenreLevel string
+
+const (
+	// GenreLevelGenre rolls subgenres up to their genre, e.g. "epic
+	// fantasy" to "fantasy".
+	GenreLevelGenre GenreLevel = "genre"
+	// GenreLevelCategory rolls every genre up to "fiction" or "nonfiction".
+	GenreLevelCategory GenreLevel = "category"
+)
+
+// genre is a node of the taxonomy: a category, a genre, or a subgenre.
+type genre struct {
+	// Parent is the key of the genre one level up, empty for a category.
+	Parent string
+	// Subjects are the Open Library subjects, lowercase and after aliasing,
+	// filed under the genre, besides its own key.
+	Subjects []string
+}
+
+// genres is the curated genre taxonomy, keyed by the Open Library subject
+// books of each genre are fetched from.
+var genres = map[string]genre{
+	"fiction": {},
+	"fantasy": {Parent: "fiction", Subjects: []string{"fiction, fantasy, general"}},
+	"epic fantasy": {Parent: "fantasy", Subjects: []string{
+		"high fantasy", "sword and sorcery", "fiction, fantasy, epic", "dragons"}},
+	"urban fantasy": {Parent: "fantasy", Subjects: []string{
+		"paranormal fiction", "fiction, fantasy, urban", "vampires", "werewolves"}},
+	"fairy tales":     {Parent: "fantasy", Subjects: []string{"fairy tales, adaptations"}},
+	"science fiction": {Parent: "fiction", Subjects: []string{"fiction, science fiction, general"}},
+	"space opera": {Parent: "science fiction", Subjects: []string{
+		"interplanetary voyages", "space warfare", "fiction, science fiction, space opera"}},
+	"cyberpunk":   {Parent: "science fiction", Subjects: []string{"fiction, science fiction, cyberpunk", "virtual reality"}},
+	"dystopias":   {Parent: "science fiction", Subjects: []string{"dystopian fiction", "dystopia", "fiction, dystopian"}},
+	"time travel": {Parent: "science fiction", Subjects: []string{"fiction, science fiction, time travel"}},
+	"detective and mystery stories": {Parent: "fiction", Subjects: []string{
+		"mystery", "mystery fiction", "fiction, mystery & detective, general"}},
+	"private investigators": {Parent: "detective and mystery stories", Subjects: []string{
+		"fiction, mystery & detective, hard-boiled", "detectives"}},
+	"cozy mysteries":        {Parent: "detective and mystery stories", Subjects: []string{"fiction, mystery & detective, cozy"}},
+	"thrillers":             {Parent: "fiction", Subjects: []string{"suspense", "suspense fiction", "thrillers (fiction)", "fiction, thrillers, general"}},
+	"spy stories":           {Parent: "thrillers", Subjects: []string{"espionage", "fiction, thrillers, espionage"}},
+	"horror":                {Parent: "fiction", Subjects: []string{"fiction, horror"}},
+	"ghost stories":         {Parent: "horror", Subjects: []string{"haunted houses"}},
+	"romance":               {Parent: "fiction", Subjects: []string{"fiction, romance, general"}},
+	"historical romance":    {Parent: "romance", Subjects: []string{"fiction, romance, historical", "regency fiction"}},
+	"historical fiction":    {Parent: "fiction", Subjects: []string{"fiction, historical", "fiction, historical, general"}},
+	"psychological fiction": {Parent: "fiction", Subjects: []string{"literary fiction", "fiction, literary", "domestic fiction"}},
+
+	"nonfiction": {},
+	"biography": {Parent: "nonfiction", Subjects: []string{
+		"autobiography", "memoir", "memoirs", "biography & autobiography", "biographies"}},
+	"history":          {Parent: "nonfiction", Subjects: []string{"world history"}},
+	"military history": {Parent: "history", Subjects: []string{"world war, 1914-1918", "world war, 1939-1945", "military art and science"}},
+	"science":          {Parent: "nonfiction", Subjects: []string{"popular science"}},
+	"astronomy":        {Parent: "science", Subjects: []string{"cosmology", "outer space"}},
+	"true crime":       {Parent: "nonfiction", Subjects: []string{"murder, case studies"}},
+	"self-help":        {Parent: "nonfiction", Subjects: []string{"self-help techniques", "self-actualization (psychology)"}},
+}
+
+// genreOfSubject maps each subject in the taxonomy to the key of the genre
+// it is filed under.
+var genreOfSubject = func() map[string]string {
+	index := make(map[string]string)
+	for key, g := range genres {
+		index[key] = key
+		for _, subject := range g.Subjects {
+			index[subject] = key
+		}
+	}
+	return index
+}()
+
+// genreDepth returns how far below its category a genre is: 0 for a
+// category, 1 for a genre, 2 for a subgenre.
+func genreDepth(key string) int {
+	depth := 0
+	for genres[key].Parent != "" {
+		key = genres[key].Parent
+		depth++
+	}
+	return depth
+}
+
+// rollUp returns the genre a subject is counted as at the level, or the
+// subject itself when the taxonomy doesn't file it or files it higher.
+func (level GenreLevel) rollUp(subject string) string {
+	key, ok := genreOfSubject[subject]
+	if !ok {
+		return subject
+	}
+	depth := 1
+	if level == GenreLevelCategory {
+		depth = 0
+	}
+	for genreDepth(key) > depth {
+		key = genres[key].Parent
+	}
+	return key
+}
+
+// RollUpProfile returns the profile with each subject the taxonomy files
+// counted as its genre at the level, or the profile itself when no level is
+// given. A genre takes the highest weight among the subjects rolled into
+// it, so rolling up doesn't inflate a user's interest in it.
+func RollUpProfile(profile models.SubjectProfile, level GenreLevel) models.SubjectProfile {
+	if level == "" {
+		return profile
+	}
+	rolled := make(models.SubjectProfile, len(profile))
+	for subject, weight := range profile {
+		key := level.rollUp(subject)
+		rolled[key] = max(rolled[key], weight)
+	}
+	return rolled
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"log"
+	"net/http"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/httpclient"
+	"be-takehome-2024/internal/providers"
+)
+
+// HTTPClient is used for every outbound request but the book providers', and
+// BookHTTPClient for theirs, so proxy and TLS settings apply uniformly while
+// injected faults reach only book data requests.
+var HTTPClient, BookHTTPClient = newHTTPClients()
+
+// OpenLibrary is the Open Library client, pointed at the configured target.
+var OpenLibrary = providers.NewOpenLibraryProvider(BookHTTPClient, config.Get().OpenLibraryBaseURL, config.Get().OpenLibraryCoversURL)
+
+// Provider is the upstream book data source used by all services. Open Library
+// is the default, with Google Books as a fallback when it is down or has no
+// data. When a local index of Open Library's data dumps is configured, it is
+// served from instead, with those only filling in data newer than the dump.
+// Editions, series, and covers are fetched from the live Open Library either
+// way. Text from any of them is stripped of control characters.
+var Provider providers.BookProvider = providers.NewSanitizingProvider(newProvider())
+
+// LiveProvider is the live data source behind Provider: Open Library, with
+// Google Books when it is down or has no data.
+var LiveProvider = providers.NewFallbackProvider(
+	OpenLibrary,
+	providers.NewGoogleBooksProvider(BookHTTPClient, config.Get().GoogleBooksAPIKey),
+)
+
+func newProvider() providers.BookProvider {
+	live := LiveProvider
+	path := config.Get().OpenLibraryIndexPath
+	if path == "" {
+		return live
+	}
+	index, err := providers.NewLocalIndexProvider(path)
+	if err != nil {
+		log.Fatalf("Invalid Open Library index: %v", err)
+	}
+	if config.Get().OpenLibraryIndexOnly {
+		return index
+	}
+	log.Printf("Serving from Open Library index %s, dumped %s, with live data newer than it", path, index.DumpDate().Format("2006-01-02"))
+	return providers.NewHybridProvider(index, live)
+}
+
+func newHTTPClients() (*http.Client, *http.Client) {
+	client, books, err := httpclient.New(config.Get())
+	if err != nil {
+		log.Fatalf("Invalid outbound HTTP configuration: %v", err)
+	}
+	return client, books
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"log"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/config"
+)
+
+func init() {
+	applyCacheSettings(config.Get())
+	config.OnReload(applyCacheSettings)
+}
+
+// applyCacheSettings sets every cache's TTL and size limits from the
+// configuration, restoring the default TTL of caches without an override.
+func applyCacheSettings(cfg *config.Config) {
+	for name := range cfg.CacheTTLs {
+		if _, ok := cache.Lookup(name); !ok {
+			log.Printf("Ignoring TTL for unknown cache '%s'", name)
+		}
+	}
+	for _, name := range cache.Names() {
+		cache.SetTTL(name, cfg.CacheTTLs[name])
+		cache.SetLimits(name, cfg.CacheMaxEntries, int64(cfg.CacheMaxBytes))
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/embeddings"
+	"be-takehome-2024/internal/models"
+)
+
+// Embedder embeds subjects for semantic subject matching, as configured.
+var Embedder embeddings.Embedder = newEmbedder()
+
+// subjectEmbeddingCache holds subjects' embeddings, which only change with
+// the embedder.
+var subjectEmbeddingCache = cache.New[[]float64]("subject_embeddings", 7*24*time.Hour)
+
+func newEmbedder() embeddings.Embedder {
+	cfg := config.Get()
+	if cfg.SubjectEmbedder == "http" {
+		if cfg.EmbeddingsURL == "" {
+			log.Fatalf("EMBEDDINGS_URL is required with SUBJECT_EMBEDDER=http")
+		}
+		return embeddings.NewHTTPEmbedder(HTTPClient, cfg.EmbeddingsURL, cfg.EmbeddingsAPIKey, cfg.EmbeddingsModel)
+	}
+	return embeddings.LocalEmbedder{Alias: subjectAlias}
+}
+
+// embedSubjects returns the embeddings of the subjects, embedding only those
+// not already cached.
+func embedSubjects(ctx context.Context, subjects []string) (map[string][]float64, error) {
+	vectors := make(map[string][]float64, len(subjects))
+	var missing []string
+	for _, subject := range subjects {
+		if vector, ok := subjectEmbeddingCache.Get(Embedder.Name() + ":" + subject); ok {
+			vectors[subject] = vector
+		} else {
+			missing = append(missing, subject)
+		}
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+	embedded, err := Embedder.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for i, subject := range missing {
+		vectors[subject] = embedded[i]
+		subjectEmbeddingCache.Set(Embedder.Name()+":"+subject, embedded[i])
+	}
+	return vectors, nil
+}
+
+// RelateProfiles returns the pair's profiles with each subject of either
+// added to the other when it has a related subject, one whose embedding is
+// at least the configured similarity. The added weight is that of the most
+// related subject scaled by the similarity, so an exact match still outweighs
+// a related one. Common subjects found in the related profiles are what the
+// users' interests share in meaning, not just in name.
+func RelateProfiles(ctx context.Context, user1Subjects, user2Subjects models.SubjectProfile) (models.SubjectProfile, models.SubjectProfile, error) {
+	subjects := make([]string, 0, len(user1Subjects)+len(user2Subjects))
+	for subject := range user1Subjects {
+		subjects = append(subjects, subject)
+	}
+	for subject := range user2Subjects {
+		if _, ok := user1Subjects[subject]; !ok {
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Strings(subjects)
+	vectors, err := embedSubjects(ctx, subjects)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	threshold := config.Get().SemanticSimilarity
+	relate := func(profile, other models.SubjectProfile) models.SubjectProfile {
+		related := make(models.SubjectProfile, len(profile))
+		for subject, weight := range profile {
+			related[subject] = weight
+		}
+		for subject := range other {
+			if _, ok := profile[subject]; ok {
+				continue
+			}
+			var best float64
+			for own, weight := range profile {
+				if similarity := embeddings.Similarity(vectors[subject], vectors[own]); similarity >= threshold {
+					best = max(best, similarity*weight)
+				}
+			}
+			if best > 0 {
+				related[subject] = best
+			}
+		}
+		return related
+	}
+	return relate(user1Subjects, user2Subjects), relate(user2Subjects, user1Subjects), nil
+}
+
+// SubjectPair is a subject of each of two users and how similar they are.
+type SubjectPair struct {
+	User1Subject string  `json:"user1_subject"`
+	User2Subject string  `json:"user2_subject"`
+	Similarity   float64 `json:"similarity"`
+}
+
+// NearestSubjects returns up to k pairs of a subject of each user, the most
+// similar first, whatever the configured similarity threshold. Pairs of
+// identical subjects are left out, as are those sharing no features.
+func NearestSubjects(ctx context.Context, user1Subjects, user2Subjects []string, k int) ([]SubjectPair, error) {
+	vectors, err := embedSubjects(ctx, append(append([]string{}, user1Subjects...), user2Subjects...))
+	if err != nil {
+		return nil, err
+	}
+	var pairs []SubjectPair
+	for _, subject1 := range user1Subjects {
+		for _, subject2 := range user2Subjects {
+			similarity := embeddings.Similarity(vectors[subject1], vectors[subject2])
+			if subject1 != subject2 && similarity > 0 {
+				pairs = append(pairs, SubjectPair{User1Subject: subject1, User2Subject: subject2, Similarity: similarity})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Similarity != pairs[j].Similarity {
+			return pairs[i].Similarity > pairs[j].Similarity
+		}
+		if pairs[i].User1Subject != pairs[j].User1Subject {
+			return pairs[i].User1Subject < pairs[j].User1Subject
+		}
+		return pairs[i].User2Subject < pairs[j].User2Subject
+	})
+	if len(pairs) > k {
+		pairs = pairs[:k]
+	}
+	return pairs, nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/cache"
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/providers"
+)
+
+// seriesInfo is a work's series and its position in it. Name is empty when the
+// work is not known to be in a series, and Position is 0 when it is unknown.
+type seriesInfo struct {
+	Name     string
+	Position int
+}
+
+// seriesSearchLimit is how many search results are checked for a series' first book.
+const seriesSearchLimit = 10
+
+// First books of series, keyed by author and normalized series name. Series
+// whose first book was not found are cached as a work with an empty key.
+var seriesStartCache = cache.New[models.SubjectWork]("series_starts", 7*24*time.Hour)
+
+var (
+	// "The Way of Kings (The Stormlight Archive, #1)" or "Title (Series Book 2)"
+	parenSeriesPattern = regexp.MustCompile(`(?i)^(.*?)\s*\(([^()]+?),?\s*(?:#|book\s+|vol\.?\s+|volume\s+)(\w+)\)\s*$`)
+	// "Book Two of the Wheel of Time" or "Volume 3 of Malazan"
+	ofSeriesPattern = regexp.MustCompile(`(?i)\b(?:book|volume|vol\.?|part)\s+(\w+)\s+of\s+(?:the\s+)?(.+?)\s*$`)
+	// "Wheel of Time: Book 4" or "Dune - Part Two"
+	suffixSeriesPattern = regexp.MustCompile(`(?i)^(.+?)\s*[:\-–—,]\s*(?:book|volume|vol\.?|part)\s+(\w+)\b`)
+	// "Dune 2" or "Mistborn #3", but not "Apollo 13" or "Windows 95": only a
+	// single digit counts as a position unless marked with "#"
+	numberedTitlePattern = regexp.MustCompile(`^(.+?)\s+(?:#(\d{1,2})|([1-9]))$`)
+	// "Calculus, Edition 2" numbers an edition, not a series entry
+	editionNamePattern = regexp.MustCompile(`(?i)\b(?:edition|ed\.)$`)
+
+	// Edition series statements: "Stormlight Archive ; 1", "Wheel of Time, bk. 4", "Discworld (3)"
+	editionSeriesPattern = regexp.MustCompile(`(?i)^(.+?)\s*(?:;|--|,|#|\()\s*(?:(?:bk|book|vol|volume|no|v)\.?\s*)?#?(\w+)\)?\.?\s*$`)
+)
+
+var ordinalWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+	"i": 1, "ii": 2, "iii": 3, "iv": 4, "v": 5, "vi": 6, "vii": 7, "viii": 8, "ix": 9, "x": 10,
+}
+
+// detectSeries guesses from a title whether a work belongs to a series,
+// returning the normalized series name and the work's position in it. The
+// position is 0 when the title names a series but not a position, and the
+// series name is empty when the title does not look like a series entry.
+func detectSeries(title string) (series string, position int) {
+	info := titleSeries(title)
+	return normalizeSeries(info.Name), info.Position
+}
+
+// titleSeries is detectSeries keeping the series name as written in the title.
+func titleSeries(title string) seriesInfo {
+	title = strings.TrimSpace(title)
+	if m := parenSeriesPattern.FindStringSubmatch(title); m != nil {
+		return seriesInfo{strings.TrimSpace(m[2]), parsePosition(m[3])}
+	}
+	if m := ofSeriesPattern.FindStringSubmatch(title); m != nil {
+		return seriesInfo{strings.TrimSpace(m[2]), parsePosition(m[1])}
+	}
+	if m := suffixSeriesPattern.FindStringSubmatch(title); m != nil {
+		return seriesInfo{strings.TrimSpace(m[1]), parsePosition(m[2])}
+	}
+	if m := numberedTitlePattern.FindStringSubmatch(title); m != nil && !editionNamePattern.MatchString(m[1]) {
+		return seriesInfo{strings.TrimSpace(m[1]), parsePosition(m[2] + m[3])}
+	}
+	return seriesInfo{}
+}
+
+// parseEditionSeries parses an edition's series statement. Statements with a
+// position are preferred, since many editions only name the series.
+func parseEditionSeries(statements []string) seriesInfo {
+	var named seriesInfo
+	for _, statement := range statements {
+		statement = strings.TrimSpace(statement)
+		if m := editionSeriesPattern.FindStringSubmatch(statement); m != nil {
+			if position := parsePosition(m[2]); position > 0 {
+				return seriesInfo{strings.TrimSpace(m[1]), position}
+			}
+		}
+		if named.Name == "" && statement != "" {
+			named.Name = strings.TrimRight(statement, " .;,")
+		}
+	}
+	return named
+}
+
+// workSeries returns the series a work belongs to, from its title when that
+// names the series and position, and from Open Library's edition data
+// otherwise. Lookup failures are logged and treated as no series data.
+func workSeries(ctx context.Context, work models.SubjectWork) seriesInfo {
+	fromTitle := titleSeries(work.Title)
+	if fromTitle.Name != "" && fromTitle.Position > 0 {
+		return fromTitle
+	}
+	// Only Open Library lists editions, so other providers' works are known
+	// by their titles alone
+	if providers.IsGoogleKey(work.Key) {
+		return fromTitle
+	}
+
+	editions, err := getWorkEditions(ctx, work.Key)
+	if err != nil {
+		log.Printf("Error fetching series of work '%s': %v", work.Key, err)
+		return fromTitle
+	}
+	var statements []string
+	for _, edition := range editions {
+		statements = append(statements, edition.Series...)
+	}
+	fromEditions := parseEditionSeries(statements)
+	if fromEditions.Name == "" {
+		return fromTitle
+	}
+	return fromEditions
+}
+
+// groupSeries reorders books so that books from the same series are adjacent,
+// in series order, at the place of the series' first book. Other books keep
+// their order.
+func groupSeries(books []models.Work) []models.Work {
+	first := make(map[string]int)
+	rank := make([]int, len(books))
+	for i, book := range books {
+		rank[i] = i
+		if book.Series == "" {
+			continue
+		}
+		series := normalizeSeries(book.Series)
+		if j, ok := first[series]; ok {
+			rank[i] = j
+		} else {
+			first[series] = i
+		}
+	}
+
+	grouped := make([]int, len(books))
+	for i := range grouped {
+		grouped[i] = i
+	}
+	sort.SliceStable(grouped, func(a, b int) bool {
+		i, j := grouped[a], grouped[b]
+		if rank[i] != rank[j] {
+			return rank[i] < rank[j]
+		}
+		return books[i].SeriesPosition < books[j].SeriesPosition
+	})
+
+	result := make([]models.Work, len(books))
+	for i, j := range grouped {
+		result[i] = books[j]
+	}
+	return result
+}
+
+func normalizeSeries(series string) string {
+	series = strings.ToLower(strings.TrimSpace(series))
+	return strings.TrimPrefix(series, "the ")
+}
+
+func parsePosition(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return ordinalWords[strings.ToLower(s)]
+}
+
+// seriesStart finds the first book of the series a work belongs to, searching
+// the series name among the works of the work's first author. ok is false
+// when the first book is not found.
+func seriesStart(ctx context.Context, work models.SubjectWork, series seriesInfo) (first models.SubjectWork, ok bool) {
+	var author string
+	if len(work.Authors) > 0 {
+		author = work.Authors[0]
+	}
+	name := normalizeSeries(series.Name)
+	key := strings.ToLower(author) + "|" + name
+	if first, ok := seriesStartCache.Get(key); ok {
+		budget.CacheHit(ctx)
+		return first, first.Key != ""
+	}
+
+	candidates, err := OpenLibrary.SearchWorks(ctx, series.Name, author, seriesSearchLimit)
+	if err != nil {
+		log.Printf("Error searching for the first book of series '%s': %v", series.Name, err)
+		return models.SubjectWork{}, false
+	}
+	for _, candidate := range candidates {
+		if info := workSeries(ctx, candidate); info.Position == 1 && normalizeSeries(info.Name) == name {
+			first = candidate
+			break
+		}
+	}
+	seriesStartCache.Set(key, first)
+	return first, first.Key != ""
+}
@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestTitleSeries(t *testing.T) {
+	tests := []struct {
+		title string
+		want  seriesInfo
+	}{
+		{"The Way of Kings (The Stormlight Archive, #1)", seriesInfo{"The Stormlight Archive", 1}},
+		{"Book Two of the Wheel of Time", seriesInfo{"Wheel of Time", 2}},
+		{"Dune - Part Two", seriesInfo{"Dune", 2}},
+		{"Dune 2", seriesInfo{"Dune", 2}},
+		{"Mistborn #3", seriesInfo{"Mistborn", 3}},
+		{"Discworld #12", seriesInfo{"Discworld", 12}},
+		// Years, edition numbers, and numbers that are part of the title
+		{"1984", seriesInfo{}},
+		{"Nineteen Eighty-Four 1984", seriesInfo{}},
+		{"Apollo 13", seriesInfo{}},
+		{"Catch 22", seriesInfo{}},
+		{"Calculus 2nd Edition", seriesInfo{}},
+		{"Calculus Edition 2", seriesInfo{}},
+		{"Organic Chemistry, 3rd ed. 3", seriesInfo{}},
+	}
+	for _, tt := range tests {
+		if got := titleSeries(tt.title); got != tt.want {
+			t.Errorf("titleSeries(%q) = %+v, want %+v", tt.title, got, tt.want)
+		}
+	}
+}
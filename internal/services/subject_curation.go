@@ -0,0 +1,205 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"be-takehome-2024/internal/config"
+	"be-takehome-2024/internal/models"
+)
+
+// defaultSubjectAliases maps subject strings to the equivalent subject they
+// are counted as, so users whose authors are tagged inconsistently still
+// share subjects. The local embedder expands the words of subjects by them
+// too. Subjects are lowercase, and targets are Open Library subject names,
+// as books are fetched by them.
+var defaultSubjectAliases = map[string]string{
+	"ya":                            "young adult",
+	"young adult fiction":           "young adult",
+	"sff":                           "speculative fiction",
+	"sf":                            "science fiction",
+	"sci-fi":                        "science fiction",
+	"sci fi":                        "science fiction",
+	"scifi":                         "science fiction",
+	"science-fiction":               "science fiction",
+	"fiction, science fiction":      "science fiction",
+	"fantasy fiction":               "fantasy",
+	"fiction, fantasy":              "fantasy",
+	"mystery and detective stories": "detective and mystery stories",
+	"horror fiction":                "horror",
+	"horror tales":                  "horror",
+	"romance fiction":               "romance",
+	"love stories":                  "romance",
+	"children's fiction":            "juvenile fiction",
+	"non-fiction":                   "nonfiction",
+	"nonfic":                        "nonfiction",
+	"lit":                           "literature",
+	"bio":                           "biography",
+	"romcom":                        "romantic comedy",
+	"rom com":                       "romantic comedy",
+	"lgbt":                          "lgbtq",
+	"wwi":                           "world war, 1914-1918",
+	"ww1":                           "world war, 1914-1918",
+	"wwii":                          "world war, 1939-1945",
+	"ww2":                           "world war, 1939-1945",
+}
+
+// defaultStopSubjects are subjects too generic or noisy to match users on,
+// mostly Open Library's lending and accessibility tags.
+var defaultStopSubjects = []string{
+	"accessible book",
+	"protected daisy",
+	"in library",
+	"lending library",
+	"overdrive",
+	"large type books",
+	"open library staff picks",
+	"internet archive wishlist",
+}
+
+// SubjectRules are curated subject rules kept outside the configuration, as
+// managed through the admin API. They apply over the built-in rules and the
+// configured aliases; a false Stop or Block entry, or an empty alias, cancels
+// a built-in one. Subjects are lowercase.
+type SubjectRules struct {
+	Stop    map[string]bool
+	Aliases map[string]string
+	Block   map[string]bool
+}
+
+// subjectCuration is the curation in effect, built from the built-in rules,
+// the configured aliases, and the curated rules.
+type subjectCuration struct {
+	aliases map[string]string
+	stop    map[string]bool
+	block   map[string]bool
+}
+
+var (
+	curation atomic.Pointer[subjectCuration]
+
+	curatedMu    sync.Mutex
+	curatedRules SubjectRules
+)
+
+func init() {
+	applySubjectCuration(config.Get())
+	config.OnReload(applySubjectCuration)
+}
+
+// SetSubjectRules replaces the curated subject rules, taking effect at once
+// for subjects counted from then on.
+func SetSubjectRules(rules SubjectRules) {
+	curatedMu.Lock()
+	curatedRules = rules
+	curatedMu.Unlock()
+	applySubjectCuration(config.Get())
+}
+
+// applySubjectCuration rebuilds the curation in effect.
+func applySubjectCuration(cfg *config.Config) {
+	curatedMu.Lock()
+	defer curatedMu.Unlock()
+
+	c := &subjectCuration{
+		aliases: make(map[string]string, len(defaultSubjectAliases)),
+		stop:    make(map[string]bool, len(defaultStopSubjects)),
+		block:   make(map[string]bool),
+	}
+	for alias, subject := range defaultSubjectAliases {
+		c.aliases[alias] = subject
+	}
+	for _, aliases := range []map[string]string{cfg.SubjectAliases, curatedRules.Aliases} {
+		for alias, subject := range aliases {
+			alias, subject = strings.ToLower(alias), strings.ToLower(subject)
+			if subject == "" {
+				delete(c.aliases, alias)
+			} else {
+				c.aliases[alias] = subject
+			}
+		}
+	}
+	for _, subject := range defaultStopSubjects {
+		c.stop[subject] = true
+	}
+	applySubjectSet(c.stop, curatedRules.Stop)
+	applySubjectSet(c.block, curatedRules.Block)
+	curation.Store(c)
+}
+
+// applySubjectSet adds the subjects curated true to set, and removes those
+// curated false.
+func applySubjectSet(set, curated map[string]bool) {
+	for subject, on := range curated {
+		if on {
+			set[subject] = true
+		} else {
+			delete(set, subject)
+		}
+	}
+}
+
+// SubjectCuration returns the subject rules in effect, built-in ones included.
+func SubjectCuration() (stop []string, aliases map[string]string, block []string) {
+	c := curation.Load()
+	aliases = make(map[string]string, len(c.aliases))
+	for alias, subject := range c.aliases {
+		aliases[alias] = subject
+	}
+	return sortedKeys(c.stop), aliases, sortedKeys(c.block)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// canonicalSubject returns the subject a lowercase subject is an alias of,
+// or the subject itself.
+func canonicalSubject(subject string) string {
+	if canonical, ok := subjectAlias(subject); ok {
+		return canonical
+	}
+	return subject
+}
+
+// subjectAlias returns the subject a lowercase subject is an alias of under
+// the curation in effect, if any.
+func subjectAlias(subject string) (string, bool) {
+	canonical, ok := curation.Load().aliases[subject]
+	return canonical, ok
+}
+
+// countedSubject returns the normalized subject a work's subject counts
+// towards in profiles, or "" when it is stop-listed or blocklisted.
+func countedSubject(subject string) string {
+	lower := strings.ToLower(strings.TrimSpace(subject))
+	normalized := canonicalSubject(lower)
+	c := curation.Load()
+	if c.stop[lower] || c.stop[normalized] || c.block[lower] || c.block[normalized] {
+		return ""
+	}
+	return normalized
+}
+
+// blockedWork reports whether a work carries a blocklisted subject, so it is
+// never recommended.
+func blockedWork(work models.SubjectWork) bool {
+	c := curation.Load()
+	if len(c.block) == 0 {
+		return false
+	}
+	for _, subject := range work.Subjects {
+		lower := strings.ToLower(strings.TrimSpace(subject))
+		if c.block[lower] || c.block[canonicalSubject(lower)] {
+			return true
+		}
+	}
+	return false
+}
@@ -2,155 +2,387 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"strings"
+	"sort"
 	"sync"
 
+	"be-takehome-2024/internal/budget"
+	"be-takehome-2024/internal/httpclient"
 	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
 )
 
 // SubjectAuthorResult holds both aggregate subject counts and per-author subjects.
 type SubjectAuthorResult struct {
 	Aggregate  map[string]int      // Aggregate subject counts across all authors
+	WorkShare  map[string]float64  // Per subject, the sum over authors of the share of their works carrying it
+	RankWeight map[string]float64  // Per subject, the sum over authors of their rank weight
+	WorkCount  map[string]int      // Per subject, the number of the authors' works carrying it
 	PerAuthor  map[string][]string // Subjects per individual author
 	ProcessedW map[string]struct{} // Set of processed work IDs
+	Authors    int                 // Number of authors whose works were counted
 }
 
 // GetSubjectAuthorCounts retrieves subjects per author and counts how many authors have written in each subject concurrently.
-// It ensures that each work is processed only once using work IDs.
+// It ensures that each work is processed only once using work IDs. Authors are
+// given in order of preference, for the rank-weighted profile.
 func GetSubjectAuthorCounts(ctx context.Context, authors []models.Author) (SubjectAuthorResult, error) {
 	subjectAuthorCount := make(map[string]int)
+	subjectWorkShare := make(map[string]float64)
+	subjectRankWeight := make(map[string]float64)
+	subjectWorkCount := make(map[string]int)
 	perAuthorSubjects := make(map[string][]string)
 	processedWorks := make(map[string]struct{}) // To track processed work IDs
 
+	// Each author's subjects, counting the works carrying each, and number of
+	// works, by rank; combined in rank order once all are fetched, so the
+	// weights do not depend on which fetch finished first
+	authorSubjects := make([]map[string]int, len(authors))
+	authorWorks := make([]int, len(authors))
+
 	var (
 		wg          sync.WaitGroup
-		mu          sync.Mutex
 		concurrency = 20 // Limit the number of concurrent goroutines
 		sem         = make(chan struct{}, concurrency)
 	)
 
-	// Channel to collect errors from goroutines
-	errCh := make(chan error, len(authors))
+	// Collect a failure per author
+	errs := &MultiError{}
 
-	for _, author := range authors {
+	for rank, author := range authors {
+		// Acquire a semaphore slot, starting no more fetches once the caller gives up
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return SubjectAuthorResult{}, ctx.Err()
+		}
 		wg.Add(1)
-		sem <- struct{}{} // Acquire a semaphore slot
 
 		// Capture the current author to avoid closure issues
 		author := author
 
-		go func(author models.Author) {
+		go func(rank int, author models.Author) {
 			defer wg.Done()
 			defer func() { <-sem }() // Release the semaphore slot
 
 			// Fetch works for the author with context
-			worksURL := fmt.Sprintf("https://openlibrary.org/authors/%s/works.json?limit=100", author.Key)
-
-			// Create HTTP request with context
-			req, err := http.NewRequestWithContext(ctx, "GET", worksURL, nil)
-			if err != nil {
-				log.Printf("Error creating request for author '%s': %v", author.Name, err)
-				errCh <- fmt.Errorf("Author '%s': %v", author.Name, err)
+			works, err := GetAuthorWorks(ctx, author)
+			if errors.Is(err, httpclient.ErrNotFound) {
+				// The author's record is gone, so they add no subjects
+				log.Printf("No works found for author '%s': %v", redact.Name(author.Name), err)
 				return
 			}
-
-			// Perform the HTTP request
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				log.Printf("Error fetching works for author '%s': %v", author.Name, err)
-				errCh <- fmt.Errorf("Author '%s': %v", author.Name, err)
+			if budget.CutShort(ctx, err) {
+				// Out of time; count the subjects of the authors fetched so far
+				log.Printf("Out of time fetching works for author '%s': %v", redact.Name(author.Name), err)
 				return
 			}
-			defer resp.Body.Close()
-
-			// Read the response body
-			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
-				log.Printf("Error reading works response for author '%s': %v", author.Name, err)
-				errCh <- fmt.Errorf("Author '%s': %v", author.Name, err)
-				return
-			}
-
-			// Parse the JSON response
-			var worksResult struct {
-				Entries []struct {
-					Title    string   `json:"title"`
-					Subjects []string `json:"subjects"`
-					Key      string   `json:"key"` // Work ID
-				} `json:"entries"`
-			}
-			if err := json.Unmarshal(body, &worksResult); err != nil {
-				log.Printf("Error parsing works JSON for author '%s': %v", author.Name, err)
-				errCh <- fmt.Errorf("Author '%s': %v", author.Name, err)
+				log.Printf("Error fetching works for author '%s': %v", redact.Name(author.Name), err)
+				errs.Add(&AuthorError{Author: author.Name, Err: err})
 				return
 			}
 
-			// Collect unique subjects for the author, ensuring unique works
-			subjectsSet := make(map[string]struct{})
-			for i, work := range worksResult.Entries {
+			// Collect unique subjects for the author, counting the works carrying each
+			subjectWorks := make(map[string]int)
+			for i, work := range works {
 				// Log the author's name and the work number
-				log.Printf("Author: %s, Work %d: %s, Subject: %s", author.Name, i+1, work.Title, work.Subjects)
+				log.Printf("Author: %s, Work %d: %s, Subject: %s", redact.Name(author.Name), i+1, work.Title, work.Subjects)
 
+				seen := make(map[string]bool)
 				for _, subject := range work.Subjects {
-					normalizedSubject := strings.ToLower(strings.TrimSpace(subject))
-					subjectsSet[normalizedSubject] = struct{}{}
+					normalizedSubject := countedSubject(subject)
+					if normalizedSubject != "" && !seen[normalizedSubject] {
+						seen[normalizedSubject] = true
+						subjectWorks[normalizedSubject]++
+					}
 				}
 			}
 
-			// Safely update the aggregate and per-author subject counts
-			mu.Lock()
-			for subject := range subjectsSet {
-				subjectAuthorCount[subject]++
-				perAuthorSubjects[author.Name] = append(perAuthorSubjects[author.Name], subject)
-			}
-			mu.Unlock()
-		}(author)
+			authorSubjects[rank], authorWorks[rank] = subjectWorks, len(works)
+		}(rank, author)
 	}
 
 	// Wait for all goroutines to finish
 	wg.Wait()
-	close(errCh)
 
 	// Check for errors
-	if len(errCh) > 0 {
-		errMessages := []string{}
-		for err := range errCh {
-			errMessages = append(errMessages, err.Error())
+	if err := errs.ErrorOrNil(); err != nil {
+		return SubjectAuthorResult{}, err
+	}
+
+	// Update the aggregate and per-author subject counts, in a fixed order
+	counted := 0
+	for rank, author := range authors {
+		if authorWorks[rank] > 0 {
+			counted++
+		}
+		subjects := make([]string, 0, len(authorSubjects[rank]))
+		for subject := range authorSubjects[rank] {
+			subjects = append(subjects, subject)
+		}
+		sort.Strings(subjects)
+		for _, subject := range subjects {
+			subjectAuthorCount[subject]++
+			subjectWorkShare[subject] += float64(authorSubjects[rank][subject]) / float64(authorWorks[rank])
+			subjectRankWeight[subject] += RankWeight(rank)
+			subjectWorkCount[subject] += authorSubjects[rank][subject]
+			perAuthorSubjects[author.Name] = append(perAuthorSubjects[author.Name], subject)
 		}
-		return SubjectAuthorResult{}, fmt.Errorf(strings.Join(errMessages, "; "))
 	}
 
 	return SubjectAuthorResult{
 		Aggregate:  subjectAuthorCount,
+		WorkShare:  subjectWorkShare,
+		RankWeight: subjectRankWeight,
+		WorkCount:  subjectWorkCount,
 		PerAuthor:  perAuthorSubjects,
 		ProcessedW: processedWorks,
+		Authors:    counted,
 	}, nil
 }
 
-func FindMostCommonSubject(user1Subjects, user2Subjects map[string]int) (string, error) {
-    var (
-        mostCommonSubject string
-        highestCount      int
-    )
-
-    for subject, count1 := range user1Subjects {
-        if count2, exists := user2Subjects[subject]; exists {
-            totalCount := count1 + count2
-            if totalCount > highestCount {
-                highestCount = totalCount
-                mostCommonSubject = subject
-            }
-        }
-    }
-
-    if mostCommonSubject == "" {
-        return "", fmt.Errorf("No common subjects found between the users")
-    }
-
-    return mostCommonSubject, nil
+// Weighting selects which subject profile drives subject selection.
+type Weighting string
+
+const (
+	// WeightingAuthors counts each author that has written in a subject once.
+	WeightingAuthors Weighting = "authors"
+	// WeightingWorkShare weights each author by the share of their works in the subject.
+	WeightingWorkShare Weighting = "work_share"
+	// WeightingRank weights each author by their rank among the user's
+	// favorites, so the first counts twice as much as the fifth.
+	WeightingRank Weighting = "rank"
+)
+
+// RankWeight is the weight of a favorite author at a zero-based rank: 1 for
+// the first, falling to 1/2 for the fifth.
+func RankWeight(rank int) float64 {
+	return 1 / (1 + 0.25*float64(rank))
+}
+
+// ParseWeighting validates a weighting name, defaulting to WeightingAuthors when empty.
+func ParseWeighting(name string) (Weighting, error) {
+	switch weighting := Weighting(name); weighting {
+	case "":
+		return WeightingAuthors, nil
+	case WeightingAuthors, WeightingWorkShare, WeightingRank:
+		return weighting, nil
+	default:
+		return "", fmt.Errorf("unknown weighting '%s'", name)
+	}
+}
+
+// Profile returns the subject weights for the given weighting.
+func (r SubjectAuthorResult) Profile(weighting Weighting) models.SubjectProfile {
+	switch weighting {
+	case WeightingWorkShare:
+		return r.WorkShare
+	case WeightingRank:
+		return r.RankWeight
+	}
+	return AuthorCountProfile(r.Aggregate)
+}
+
+// AuthorCountProfile converts subject author counts into subject weights.
+func AuthorCountProfile(counts map[string]int) models.SubjectProfile {
+	profile := make(models.SubjectProfile, len(counts))
+	for subject, count := range counts {
+		profile[subject] = float64(count)
+	}
+	return profile
+}
+
+// Scoring combines the two users' weights for a subject into one score.
+type Scoring string
+
+const (
+	// ScoringSum adds the counts, so one user's strong interest can outweigh a shared one.
+	ScoringSum Scoring = "sum"
+	// ScoringMin scores by the smaller count, only rewarding interest both users share.
+	ScoringMin Scoring = "min"
+	// ScoringHarmonic takes the harmonic mean, favoring balanced counts while still rewarding volume.
+	ScoringHarmonic Scoring = "harmonic"
+)
+
+// ParseScoring validates a scoring method name, defaulting to ScoringSum when empty.
+func ParseScoring(name string) (Scoring, error) {
+	switch scoring := Scoring(name); scoring {
+	case "":
+		return ScoringSum, nil
+	case ScoringSum, ScoringMin, ScoringHarmonic:
+		return scoring, nil
+	default:
+		return "", fmt.Errorf("unknown scoring method '%s'", name)
+	}
+}
+
+// Score returns the combined score for a subject with the given per-user counts.
+func (s Scoring) Score(count1, count2 float64) float64 {
+	switch s {
+	case ScoringMin:
+		return min(count1, count2)
+	case ScoringHarmonic:
+		if count1+count2 == 0 {
+			return 0
+		}
+		return 2 * count1 * count2 / (count1 + count2)
+	default:
+		return count1 + count2
+	}
+}
+
+// ScoreAll combines any number of users' weights for a subject into one
+// score, as Score does for two. A zero weight makes ScoringMin and
+// ScoringHarmonic score zero.
+func (s Scoring) ScoreAll(weights ...float64) float64 {
+	var score float64
+	switch s {
+	case ScoringMin:
+		for i, weight := range weights {
+			if i == 0 || weight < score {
+				score = weight
+			}
+		}
+	case ScoringHarmonic:
+		var inverse float64
+		for _, weight := range weights {
+			if weight == 0 {
+				return 0
+			}
+			inverse += 1 / weight
+		}
+		if inverse > 0 {
+			score = float64(len(weights)) / inverse
+		}
+	default:
+		for _, weight := range weights {
+			score += weight
+		}
+	}
+	return score
+}
+
+// FindMostCommonSubject returns the common subject with the highest score.
+// Equal scores are broken by the subject's total work count, how many of both
+// users' authors' works carry it, then alphabetically, so the same profiles
+// always give the same subject.
+func FindMostCommonSubject(user1Subjects, user2Subjects, workCounts models.SubjectProfile, scoring Scoring) (string, error) {
+	var (
+		mostCommonSubject string
+		highestScore      float64
+		highestWorks      float64
+	)
+
+	for subject, count1 := range user1Subjects {
+		if count2, exists := user2Subjects[subject]; exists {
+			score := scoring.Score(count1, count2)
+			works := workCounts[subject]
+			if score > highestScore || (score == highestScore && (works > highestWorks ||
+				(works == highestWorks && subject < mostCommonSubject))) {
+				highestScore = score
+				highestWorks = works
+				mostCommonSubject = subject
+			}
+		}
+	}
+
+	if mostCommonSubject == "" {
+		return "", fmt.Errorf("No common subjects found between the users")
+	}
+
+	return mostCommonSubject, nil
+}
+
+// scoredSubject is a candidate subject with the secondary signal that breaks
+// ties between equal scores.
+type scoredSubject struct {
+	models.Subject
+	total float64
+}
+
+// rankedSubjects returns up to k of the subjects in ranked order.
+func rankedSubjects(ranked []scoredSubject, k int) []models.Subject {
+	if len(ranked) > k {
+		ranked = ranked[:k]
+	}
+	subjects := make([]models.Subject, len(ranked))
+	for i, subject := range ranked {
+		subjects[i] = subject.Subject
+	}
+	return subjects
+}
+
+// FindTopCommonSubjects returns up to k subjects common to both users, highest
+// score first, ties broken as FindMostCommonSubject breaks them.
+func FindTopCommonSubjects(user1Subjects, user2Subjects, workCounts models.SubjectProfile, k int, scoring Scoring) ([]models.Subject, error) {
+	var common []scoredSubject
+	for subject, count1 := range user1Subjects {
+		if count2, exists := user2Subjects[subject]; exists {
+			common = append(common, scoredSubject{Subject: models.Subject{Key: subject, Score: scoring.Score(count1, count2)}, total: workCounts[subject]})
+		}
+	}
+
+	if len(common) == 0 {
+		return nil, fmt.Errorf("No common subjects found between the users")
+	}
+
+	sort.Slice(common, func(i, j int) bool {
+		if common[i].Score != common[j].Score {
+			return common[i].Score > common[j].Score
+		}
+		if common[i].total != common[j].total {
+			return common[i].total > common[j].total
+		}
+		return common[i].Key < common[j].Key
+	})
+	return rankedSubjects(common, k), nil
+}
+
+// FindTopGroupSubjects returns up to k subjects shared by at least two of a
+// group's members. Subjects more of the group shares come first; among
+// those, the highest score across every member's weight, zero for members
+// without the subject.
+func FindTopGroupSubjects(profiles []models.SubjectProfile, k int, scoring Scoring) ([]models.Subject, error) {
+	members := make(map[string]int)
+	for _, profile := range profiles {
+		for subject := range profile {
+			members[subject]++
+		}
+	}
+
+	var shared []scoredSubject
+	weights := make([]float64, len(profiles))
+	for subject, count := range members {
+		if count < 2 {
+			continue
+		}
+		var total float64
+		for i, profile := range profiles {
+			weights[i] = profile[subject]
+			total += weights[i]
+		}
+		shared = append(shared, scoredSubject{Subject: models.Subject{Key: subject, Score: scoring.ScoreAll(weights...), Members: count}, total: total})
+	}
+
+	if len(shared) == 0 {
+		return nil, fmt.Errorf("No subjects are shared by any two members of the group")
+	}
+
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].Members != shared[j].Members {
+			return shared[i].Members > shared[j].Members
+		}
+		if shared[i].Score != shared[j].Score {
+			return shared[i].Score > shared[j].Score
+		}
+		if shared[i].total != shared[j].total {
+			return shared[i].total > shared[j].total
+		}
+		return shared[i].Key < shared[j].Key
+	})
+	return rankedSubjects(shared, k), nil
 }
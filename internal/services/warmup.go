@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"be-takehome-2024/internal/models"
+	"be-takehome-2024/internal/redact"
+)
+
+// ready reports whether the service has finished starting up.
+var ready atomic.Bool
+
+// Ready reports whether startup, including any warm-up, has finished.
+func Ready() bool {
+	return ready.Load()
+}
+
+// MarkReady flags the service as ready to take traffic.
+func MarkReady() {
+	ready.Store(true)
+}
+
+// WarmUp resolves the keys of the given authors ahead of the first request,
+// issuing at most ratePerSecond searches per second so startup does not
+// trip upstream rate limits. Failures are logged and skipped. It returns the
+// authors that were found, keyed by the searched name.
+func WarmUp(ctx context.Context, authors []string, ratePerSecond float64) map[string]models.Author {
+	start := time.Now()
+	log.Printf("Warming up %d favorite authors", len(authors))
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / ratePerSecond))
+	defer ticker.Stop()
+
+	resolved := make(map[string]models.Author)
+	for i, name := range authors {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				log.Printf("Warm-up cancelled after %d of %d authors: %v", i, len(authors), ctx.Err())
+				return resolved
+			}
+		}
+
+		author, found, err := resolveAuthor(ctx, name)
+		if err != nil {
+			log.Printf("Warm-up: error resolving author '%s': %v", redact.Name(name), err)
+		} else if found {
+			resolved[name] = author
+		}
+	}
+	log.Printf("Warm-up resolved %d of %d authors in %v", len(resolved), len(authors), time.Since(start))
+	return resolved
+}
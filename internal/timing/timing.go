@@ -0,0 +1,81 @@
+// Package timing records how long the stages of a request take. The timings
+// travel in the request context, so stages running in other goroutines or
+// packages can be recorded without threading a recorder through every call.
+package timing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timings holds the stage timings of one request. A nil *Timings records
+// nothing, so callers need not check for one.
+type Timings struct {
+	mu     sync.Mutex
+	stages map[string]span
+}
+
+// span covers every run of a stage, from the first start to the last end, so
+// a stage run concurrently for several users reports its wall-clock time.
+type span struct {
+	start, end time.Time
+}
+
+// New returns empty timings.
+func New() *Timings {
+	return &Timings{stages: make(map[string]span)}
+}
+
+type contextKey struct{}
+
+// WithTimings returns a context recording stage timings in t.
+func WithTimings(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the timings of a context, or nil if it has none.
+func FromContext(ctx context.Context) *Timings {
+	t, _ := ctx.Value(contextKey{}).(*Timings)
+	return t
+}
+
+// Start begins a run of a stage in the context's timings, returning the
+// function that ends it.
+//
+//	defer timing.Start(ctx, "book_fetch")()
+func Start(ctx context.Context, stage string) func() {
+	t := FromContext(ctx)
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.record(stage, start, time.Now()) }
+}
+
+func (t *Timings) record(stage string, start, end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stages[stage]
+	if !ok || start.Before(s.start) {
+		s.start = start
+	}
+	if end.After(s.end) {
+		s.end = end
+	}
+	t.stages[stage] = s
+}
+
+// Milliseconds returns each recorded stage's duration in milliseconds.
+func (t *Timings) Milliseconds() map[string]float64 {
+	ms := make(map[string]float64)
+	if t == nil {
+		return ms
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for stage, s := range t.stages {
+		ms[stage] = float64(s.end.Sub(s.start).Microseconds()) / 1000
+	}
+	return ms
+}
@@ -0,0 +1,200 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"be-takehome-2024/internal/i18n"
+)
+
+// FieldError describes why one field of a request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+
+	format string // Untranslated message format
+	args   []interface{}
+}
+
+// Errors is every field error found in a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fmt.Sprintf("'%s' %s", fieldErr.Field, fieldErr.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Localize returns the errors with their messages translated into lang.
+func (e Errors) Localize(lang string) Errors {
+	localized := make(Errors, len(e))
+	for i, fieldErr := range e {
+		fieldErr.Message = i18n.T(lang, fieldErr.format, fieldErr.args...)
+		localized[i] = fieldErr
+	}
+	return localized
+}
+
+// Validator collects field errors while a request is parsed, so the client
+// learns about every invalid field at once. Parsing methods return the
+// field's default when it is missing or invalid.
+type Validator struct {
+	errs Errors
+}
+
+// New returns an empty Validator.
+func New() *Validator {
+	return &Validator{}
+}
+
+// Err returns the collected errors, or nil if the request is valid.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Add records an error for a field.
+func (v *Validator) Add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{
+		Field:   field,
+		Message: i18n.T(i18n.DefaultLanguage, format, args...),
+		format:  format,
+		args:    args,
+	})
+}
+
+// Check records an error for a field unless ok holds.
+func (v *Validator) Check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.Add(field, format, args...)
+	}
+}
+
+// Required records an error if a string field is blank.
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// RequiredInt parses a required integer query parameter within [min, max].
+// Pass math.MaxInt as max for no upper bound.
+func (v *Validator) RequiredInt(query url.Values, field string, min, max int) int {
+	if query.Get(field) == "" {
+		v.Add(field, "is required")
+		return 0
+	}
+	return v.Int(query, field, 0, min, max)
+}
+
+// Int parses an optional integer query parameter within [min, max].
+func (v *Validator) Int(query url.Values, field string, fallback, min, max int) int {
+	raw := query.Get(field)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min || n > max {
+		addRangeError(v, field, min, max)
+		return fallback
+	}
+	return n
+}
+
+// Float parses an optional number query parameter within [min, max].
+func (v *Validator) Float(query url.Values, field string, fallback, min, max float64) float64 {
+	raw := query.Get(field)
+	if raw == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < min || f > max {
+		v.Add(field, "must be a number between %v and %v", min, max)
+		return fallback
+	}
+	return f
+}
+
+// Bool parses an optional boolean query parameter.
+func (v *Validator) Bool(query url.Values, field string, fallback bool) bool {
+	raw := query.Get(field)
+	if raw == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		v.Add(field, "must be true or false")
+		return fallback
+	}
+	return b
+}
+
+// Enum parses an optional query parameter restricted to the allowed values.
+func (v *Validator) Enum(query url.Values, field, fallback string, allowed ...string) string {
+	raw := query.Get(field)
+	if raw == "" {
+		return fallback
+	}
+	for _, value := range allowed {
+		if raw == value {
+			return raw
+		}
+	}
+	v.Add(field, "must be one of: %s", strings.Join(allowed, ", "))
+	return fallback
+}
+
+// EnumList parses an optional comma-separated query parameter whose items are
+// restricted to the allowed values. Duplicate items are dropped.
+func (v *Validator) EnumList(query url.Values, field string, allowed ...string) []string {
+	raw := query.Get(field)
+	if raw == "" {
+		return nil
+	}
+	var values []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if !slices.Contains(allowed, item) {
+			v.Add(field, "must be one of: %s", strings.Join(allowed, ", "))
+			return nil
+		}
+		if !seen[item] {
+			seen[item] = true
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// Time parses an optional RFC 3339 timestamp query parameter.
+func (v *Validator) Time(query url.Values, field string) time.Time {
+	raw := query.Get(field)
+	if raw == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		v.Add(field, "must be an RFC 3339 timestamp")
+		return time.Time{}
+	}
+	return t
+}
+
+func addRangeError(v *Validator, field string, min, max int) {
+	switch {
+	case max == math.MaxInt && min == 0:
+		v.Add(field, "must be a non-negative integer")
+	case max == math.MaxInt:
+		v.Add(field, "must be an integer of at least %d", min)
+	default:
+		v.Add(field, "must be an integer between %d and %d", min, max)
+	}
+}
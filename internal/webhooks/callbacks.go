@@ -0,0 +1,88 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"be-takehome-2024/internal/config"
+)
+
+// CheckCallbackURL returns an error unless rawURL is fit for the server to
+// POST to on a client's behalf: an absolute http or https URL whose host is
+// on the configured allowlist or, without one, resolves only to public
+// addresses, so clients can't aim deliveries at the server's own network.
+// Hosts the allowlist names are trusted wherever they resolve to.
+func CheckCallbackURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("not an absolute http or https URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	if allowed := config.Get().CallbackAllowedHosts; len(allowed) > 0 {
+		for _, pattern := range allowed {
+			pattern = strings.ToLower(pattern)
+			if host == pattern || (strings.HasPrefix(pattern, ".") && strings.HasSuffix(host, pattern)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host %s is not allowed", host)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("host %s does not resolve", host)
+	}
+	for _, ip := range ips {
+		if !publicIP(ip.IP) {
+			return fmt.Errorf("host %s resolves to a non-public address", host)
+		}
+	}
+	return nil
+}
+
+// publicIP reports whether ip is routable on the public internet.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// deliveryClient posts deliveries. The address is checked as it is dialed,
+// so a host that starts resolving to a private address after its URL was
+// checked is still refused, and redirects, which could lead anywhere, are
+// not followed.
+var deliveryClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   dialPublic,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// dialPublic refuses connections to non-public addresses, unless a host
+// allowlist is configured, which CheckCallbackURL holds URLs to instead.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	if len(config.Get().CallbackAllowedHosts) > 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"be-takehome-2024/internal/database"
+	"be-takehome-2024/internal/queue"
+)
+
+// EventRecommendationsUpdated is sent when the background refresher computes
+// recommendations for a pair that differ from the ones stored before.
+const EventRecommendationsUpdated = "recommendations.updated"
+
+// EventRecommendationsScheduled is sent to a subscription's URL with the
+// recommendations computed for it on its schedule.
+const EventRecommendationsScheduled = "recommendations.scheduled"
+
+// SignatureHeader carries the hex HMAC-SHA256 of the timestamp, a ".", and
+// the request body, keyed with the webhook's secret and prefixed with
+// "sha256=". Receivers should reject requests whose timestamp is more than a
+// few minutes old, so a captured request cannot be replayed.
+const SignatureHeader = "X-Webhook-Signature"
+
+// TimestampHeader carries when the request was sent, in Unix seconds.
+const TimestampHeader = "X-Webhook-Timestamp"
+
+// TaskDelivery is the queue task kind delivering an event to one destination.
+const TaskDelivery = "webhook.delivery"
+
+func init() {
+	queue.Handle(TaskDelivery, queue.Options{
+		// A delivery is tried four times before it is dead-lettered, waiting
+		// 2s before the first retry and twice as long before each retry after
+		MaxAttempts: 4,
+		Backoff:     2 * time.Second,
+		Timeout:     10 * time.Second,
+	}, runDelivery)
+}
+
+// Event is the JSON body POSTed to webhooks.
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	User1ID int    `json:"user1_id,omitempty"`
+	User2ID int    `json:"user2_id,omitempty"`
+	GroupID int    `json:"group_id,omitempty"`
+	// SubscriptionID is set on events delivered to a subscription.
+	SubscriptionID int         `json:"subscription_id,omitempty"`
+	Data           interface{} `json:"data"`
+	OccurredAt     time.Time   `json:"occurred_at"`
+}
+
+// NewSecret returns a random signing secret for a new webhook.
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for body sent with the timestamp
+// header value.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish sends a pair event to every webhook subscribed to the pair.
+// Deliveries are queued, each retried with backoff on failure.
+func Publish(db *sql.DB, eventType string, user1ID, user2ID int, data interface{}) {
+	hooks, err := database.GetPairWebhooks(db, user1ID, user2ID)
+	if err != nil {
+		log.Printf("Error loading webhooks for pair %d/%d: %v", user1ID, user2ID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := encode(Event{Type: eventType, User1ID: user1ID, User2ID: user2ID, Data: data})
+	if err != nil {
+		log.Printf("Error encoding webhook event: %v", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		dest := delivery{fmt.Sprintf("webhook %d", hook.ID), hook.URL, hook.Secret, eventType, body}
+		if err := enqueue(dest); err != nil {
+			log.Printf("Error queueing delivery to %s: %v", dest.Name, err)
+		}
+	}
+}
+
+// Deliver posts an event to a single URL, signed with secret, once, leaving
+// retries to the caller. The event's ID and time are filled in; name
+// identifies the destination in logs.
+func Deliver(ctx context.Context, name, url, secret string, event Event) error {
+	body, err := encode(event)
+	if err != nil {
+		return err
+	}
+	if err := post(ctx, delivery{name, url, secret, event.Type, body}); err != nil {
+		return fmt.Errorf("delivery to %s failed: %v", name, err)
+	}
+	log.Printf("Delivered %s to %s", event.Type, name)
+	return nil
+}
+
+// encode gives the event a fresh ID and the current time and encodes it.
+func encode(event Event) ([]byte, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("error generating event ID: %v", err)
+	}
+	event.ID = id
+	event.OccurredAt = time.Now().UTC()
+	return json.Marshal(event)
+}
+
+// delivery is an event on its way to a destination, the payload of a
+// delivery task.
+type delivery struct {
+	// Name identifies the destination in logs.
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret"`
+	EventType string `json:"event_type"`
+	Body      []byte `json:"body"`
+}
+
+func enqueue(d delivery) error {
+	_, err := queue.Enqueue(context.Background(), TaskDelivery, 0, d)
+	return err
+}
+
+// runDelivery makes one attempt at a delivery task.
+func runDelivery(ctx context.Context, task queue.Task) (interface{}, error) {
+	var d delivery
+	if err := json.Unmarshal(task.Payload, &d); err != nil {
+		return nil, queue.Permanent(fmt.Errorf("error decoding delivery: %v", err))
+	}
+	if err := post(ctx, d); err != nil {
+		return nil, fmt.Errorf("delivery to %s failed: %v", d.Name, err)
+	}
+	log.Printf("Delivered %s to %s", d.EventType, d.Name)
+	return nil, nil
+}
+
+func post(ctx context.Context, d delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	// Each attempt is signed afresh, so a retry is not taken for a replay
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(d.Secret, timestamp, d.Body))
+
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}